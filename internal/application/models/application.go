@@ -1,11 +1,24 @@
 package models
 
+import (
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+)
+
 type Application struct {
-	Id             string   `db:"id" json:"id"`
-	Name           string   `db:"name" json:"name"`
-	OrganizationId string   `db:"organization_id" json:"organization_id"`
-	ClientId       string   `db:"client_id" json:"client_id,omitempty"`
-	ClientSecret   string   `db:"client_secret" json:"client_secret,omitempty"`
-	RedirectUris   []string `db:"redirect_uris" json:"redirect_uris,omitempty"`
-	GrantTypes     []string `json:"grant_types,omitempty"`
+	Id                     string   `db:"id" json:"id"`
+	Name                   string   `db:"name" json:"name"`
+	OrganizationId         string   `db:"organization_id" json:"organization_id"`
+	ClientId               string   `db:"client_id" json:"client_id,omitempty"`
+	ClientSecret           string   `db:"client_secret" json:"client_secret,omitempty"`
+	RedirectUris           []string `db:"redirect_uris" json:"redirect_uris,omitempty"`
+	GrantTypes             []string `json:"grant_types,omitempty"`
+	ResponseMode           string   `db:"response_mode" json:"response_mode,omitempty"`
+	PostLogoutRedirectUris []string `db:"post_logout_redirect_uris" json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutUri   string   `db:"backchannel_logout_uri" json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutUri  string   `db:"frontchannel_logout_uri" json:"frontchannel_logout_uri,omitempty"`
+	// AuthenticationSequence is the login of the application, the default sequence when empty.
+	AuthenticationSequence authn_models.AuthenticationSequence `db:"authentication_sequence" json:"authentication_sequence,omitempty"`
+	// RequireConsent asks users to approve the scopes the application requests before they are
+	// first granted. It is left unchanged by an update when nil.
+	RequireConsent *bool `db:"require_consent" json:"require_consent,omitempty"`
 }
@@ -2,6 +2,7 @@ package application
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -9,17 +10,20 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/shashimalcse/tiny-is/internal/application/models"
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
 )
 
 type ApplicationRepository interface {
 	GetApplications(ctx context.Context, orgId string) ([]models.Application, error)
 	GetApplicationByID(ctx context.Context, id, orgId string) (models.Application, error)
+	GetApplicationByClientId(ctx context.Context, clientId, orgId string) (models.Application, error)
 	CreateApplication(ctx context.Context, application models.Application) error
 	UpdateApplication(ctx context.Context, id string, updateApplication models.Application) error
 	DeleteApplication(ctx context.Context, id, orgId string) error
 	ValidateClientId(ctx context.Context, clientId, orgId string) (bool, error)
 	ValidateClientSecret(ctx context.Context, clientId, clientSecret, orgId string) (bool, error)
 	ValidateRedirectUri(ctx context.Context, clientId, redirectUri, orgId string) (bool, error)
+	ValidatePostLogoutRedirectUri(ctx context.Context, clientId, postLogoutRedirectUri, orgId string) (bool, error)
 }
 
 type applicationRepository struct {
@@ -55,6 +59,55 @@ func (r *applicationRepository) GetApplicationByID(ctx context.Context, id, orgI
 	return application, nil
 }
 
+func (r *applicationRepository) GetApplicationByClientId(ctx context.Context, clientId, orgId string) (models.Application, error) {
+	var row struct {
+		Id              string                              `db:"id"`
+		Name            string                              `db:"name"`
+		OrganizationId  string                              `db:"organization_id"`
+		ClientId        string                              `db:"client_id"`
+		RedirectUris    sql.NullString                      `db:"redirect_uris"`
+		ResponseMode    sql.NullString                      `db:"response_mode"`
+		PostLogoutUris  sql.NullString                      `db:"post_logout_redirect_uris"`
+		BackchannelUri  sql.NullString                      `db:"backchannel_logout_uri"`
+		FrontchannelUri sql.NullString                      `db:"frontchannel_logout_uri"`
+		Sequence        authn_models.AuthenticationSequence `db:"authentication_sequence"`
+		RequireConsent  bool                                `db:"require_consent"`
+	}
+	err := r.db.GetContext(ctx, &row, "SELECT id, name, organization_id, client_id, redirect_uris, response_mode, post_logout_redirect_uris, backchannel_logout_uri, frontchannel_logout_uri, authentication_sequence, require_consent FROM application WHERE client_id=$1 AND organization_id=$2", clientId, orgId)
+	if err != nil {
+		return models.Application{}, err
+	}
+	application := models.Application{
+		Id:                     row.Id,
+		Name:                   row.Name,
+		OrganizationId:         row.OrganizationId,
+		ClientId:               row.ClientId,
+		ResponseMode:           row.ResponseMode.String,
+		BackchannelLogoutUri:   row.BackchannelUri.String,
+		FrontchannelLogoutUri:  row.FrontchannelUri.String,
+		AuthenticationSequence: row.Sequence,
+		RequireConsent:         &row.RequireConsent,
+	}
+	if row.RedirectUris.Valid && row.RedirectUris.String != "" {
+		err = json.Unmarshal([]byte(row.RedirectUris.String), &application.RedirectUris)
+		if err != nil {
+			return models.Application{}, err
+		}
+	}
+	if row.PostLogoutUris.Valid && row.PostLogoutUris.String != "" {
+		err = json.Unmarshal([]byte(row.PostLogoutUris.String), &application.PostLogoutRedirectUris)
+		if err != nil {
+			return models.Application{}, err
+		}
+	}
+	grantTypes, err := r.GetApplicationGrant(ctx, application.Id)
+	if err != nil {
+		return models.Application{}, err
+	}
+	application.GrantTypes = grantTypes
+	return application, nil
+}
+
 func (r *applicationRepository) GetApplicationGrant(ctx context.Context, applicationID string) ([]string, error) {
 	var grantTypes []string
 	query := `
@@ -75,13 +128,23 @@ func (r *applicationRepository) CreateApplication(ctx context.Context, applicati
 	if err != nil {
 		return err
 	}
-	_, err = r.db.NamedExec("INSERT INTO application (id, name, organization_id, client_id, client_secret, redirect_uris) VALUES (:id, :name, :organization_id, :client_id, :client_secret, :redirect_uris)", map[string]interface{}{
-		"id":              application.Id,
-		"name":            application.Name,
-		"organization_id": application.OrganizationId,
-		"client_id":       application.ClientId,
-		"client_secret":   application.ClientSecret,
-		"redirect_uris":   string(redirectURIsJSON),
+	postLogoutRedirectURIsJSON, err := json.Marshal(application.PostLogoutRedirectUris)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.NamedExec("INSERT INTO application (id, name, organization_id, client_id, client_secret, redirect_uris, response_mode, post_logout_redirect_uris, backchannel_logout_uri, frontchannel_logout_uri, authentication_sequence, require_consent) VALUES (:id, :name, :organization_id, :client_id, :client_secret, :redirect_uris, :response_mode, :post_logout_redirect_uris, :backchannel_logout_uri, :frontchannel_logout_uri, :authentication_sequence, :require_consent)", map[string]interface{}{
+		"id":                        application.Id,
+		"name":                      application.Name,
+		"organization_id":           application.OrganizationId,
+		"client_id":                 application.ClientId,
+		"client_secret":             application.ClientSecret,
+		"redirect_uris":             string(redirectURIsJSON),
+		"response_mode":             application.ResponseMode,
+		"post_logout_redirect_uris": string(postLogoutRedirectURIsJSON),
+		"backchannel_logout_uri":    application.BackchannelLogoutUri,
+		"frontchannel_logout_uri":   application.FrontchannelLogoutUri,
+		"authentication_sequence":   application.AuthenticationSequence,
+		"require_consent":           application.RequireConsent != nil && *application.RequireConsent,
 	})
 	if err != nil {
 		return err
@@ -127,6 +190,46 @@ func (r *applicationRepository) UpdateApplication(ctx context.Context, id string
 		updateValues = append(updateValues, pq.Array(updateApplication.RedirectUris))
 		paramCount++
 	}
+
+	if updateApplication.PostLogoutRedirectUris != nil {
+		postLogoutRedirectURIsJSON, err := json.Marshal(updateApplication.PostLogoutRedirectUris)
+		if err != nil {
+			return err
+		}
+		updateFields = append(updateFields, fmt.Sprintf("post_logout_redirect_uris = $%d", paramCount))
+		updateValues = append(updateValues, string(postLogoutRedirectURIsJSON))
+		paramCount++
+	}
+
+	if updateApplication.BackchannelLogoutUri != "" {
+		updateFields = append(updateFields, fmt.Sprintf("backchannel_logout_uri = $%d", paramCount))
+		updateValues = append(updateValues, updateApplication.BackchannelLogoutUri)
+		paramCount++
+	}
+
+	if updateApplication.FrontchannelLogoutUri != "" {
+		updateFields = append(updateFields, fmt.Sprintf("frontchannel_logout_uri = $%d", paramCount))
+		updateValues = append(updateValues, updateApplication.FrontchannelLogoutUri)
+		paramCount++
+	}
+
+	if updateApplication.AuthenticationSequence != nil {
+		updateFields = append(updateFields, fmt.Sprintf("authentication_sequence = $%d", paramCount))
+		updateValues = append(updateValues, updateApplication.AuthenticationSequence)
+		paramCount++
+	}
+
+	if updateApplication.ResponseMode != "" {
+		updateFields = append(updateFields, fmt.Sprintf("response_mode = $%d", paramCount))
+		updateValues = append(updateValues, updateApplication.ResponseMode)
+		paramCount++
+	}
+
+	if updateApplication.RequireConsent != nil {
+		updateFields = append(updateFields, fmt.Sprintf("require_consent = $%d", paramCount))
+		updateValues = append(updateValues, *updateApplication.RequireConsent)
+		paramCount++
+	}
 	if len(updateFields) > 0 {
 		updateQuery += strings.Join(updateFields, ", ") + fmt.Sprintf(" WHERE id = $%d", paramCount)
 		updateValues = append(updateValues, id)
@@ -187,6 +290,20 @@ func (r *applicationRepository) ValidateRedirectUri(ctx context.Context, clientI
 	return count > 0, nil
 }
 
+func (r *applicationRepository) ValidatePostLogoutRedirectUri(ctx context.Context, clientId, postLogoutRedirectUri, orgId string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM application WHERE client_id = ? AND organization_id = ? AND json_array_length(json_extract(post_logout_redirect_uris, '$')) > 0 
+        AND ? IN (SELECT value FROM json_each(post_logout_redirect_uris))
+    `
+	err := r.db.GetContext(ctx, &count, query, clientId, orgId, postLogoutRedirectUri)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 func (r *applicationRepository) getGrantIdsByNames(grantTypeNames []string) ([]string, error) {
 	query := "SELECT id FROM grant_type WHERE name IN (?)"
 	var grantTypeIDs []string
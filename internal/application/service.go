@@ -13,12 +13,14 @@ import (
 type ApplicationService interface {
 	GetApplications(ctx context.Context, orgId string) ([]models.Application, error)
 	GetApplicationByID(ctx context.Context, id, orgId string) (models.Application, error)
+	GetApplicationByClientId(ctx context.Context, clientId, orgId string) (models.Application, error)
 	CreateApplication(ctx context.Context, application models.Application) error
 	UpdateApplication(ctx context.Context, id, orgId string, application models.Application) error
 	DeleteApplication(ctx context.Context, id, orgId string) error
 	ValidateClientId(ctx context.Context, clientId, orgId string) (bool, error)
 	ValidateClientSecret(ctx context.Context, clientId, clientSecret, orgId string) (bool, error)
 	ValidateRedirectUri(ctx context.Context, clientId, redirectUri, orgId string) (bool, error)
+	ValidatePostLogoutRedirectUri(ctx context.Context, clientId, postLogoutRedirectUri, orgId string) (bool, error)
 }
 
 type applicationService struct {
@@ -41,6 +43,10 @@ func (s *applicationService) GetApplicationByID(ctx context.Context, id, orgId s
 	return s.repo.GetApplicationByID(ctx, id, orgId)
 }
 
+func (s *applicationService) GetApplicationByClientId(ctx context.Context, clientId, orgId string) (models.Application, error) {
+	return s.repo.GetApplicationByClientId(ctx, clientId, orgId)
+}
+
 func (s *applicationService) CreateApplication(ctx context.Context, application models.Application) error {
 	appId := uuid.New().String()
 	clientId, err := GenerateClientId()
@@ -85,6 +91,10 @@ func (s *applicationService) ValidateRedirectUri(ctx context.Context, clientId,
 	return s.repo.ValidateRedirectUri(ctx, clientId, redirectUri, orgId)
 }
 
+func (s *applicationService) ValidatePostLogoutRedirectUri(ctx context.Context, clientId, postLogoutRedirectUri, orgId string) (bool, error) {
+	return s.repo.ValidatePostLogoutRedirectUri(ctx, clientId, postLogoutRedirectUri, orgId)
+}
+
 func GenerateClientId() (string, error) {
 	bytes := make([]byte, 10)
 	_, err := rand.Read(bytes)
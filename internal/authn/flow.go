@@ -0,0 +1,426 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/authn/screens"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+var (
+	ErrAuthenticatorNotOffered = errors.New("the authenticator is not offered at this step of the login")
+	ErrUserMismatch            = errors.New("the authenticated user is not the user of the login")
+	ErrNoAuthenticator         = errors.New("none of the authenticators of the login step are set up for the user")
+	// ErrStepUpNotPossible is returned when a risky login needs a second factor the user doesn't have.
+	ErrStepUpNotPossible = errors.New("the login needs a second factor the user has not set up")
+)
+
+// secondFactorStep follows the authentication sequence when the login still needs a second factor.
+var secondFactorStep = models.AuthenticationStep{
+	Authenticators: []string{models.AuthenticatorTOTP, models.AuthenticatorPasskey, models.AuthenticatorSMS},
+}
+
+// LoginFlow is what an authenticator knows about the login it is offered in.
+type LoginFlow struct {
+	SessionDataKey   string
+	OrganizationName string
+	LoginHint        string
+	// User is the user an earlier step identified, empty at the first step.
+	User models.AuthenticatedUser
+}
+
+// Authenticator completes a step of the login through its own form and endpoint.
+type Authenticator interface {
+	Name() string
+	AuthMethods() []string
+	// IsAvailable reports whether the user has the authenticator set up. It is not asked when the
+	// user is unknown, so the login doesn't reveal which usernames exist.
+	IsAvailable(ctx context.Context, user models.AuthenticatedUser) (bool, error)
+	Form(ctx context.Context, flow LoginFlow) templ.Component
+}
+
+func newAuthenticators(userService user.UserService, mfaService mfa.MFAService, webAuthnService webauthn.WebAuthnService) map[string]Authenticator {
+	authenticators := map[string]Authenticator{}
+	for _, authenticator := range []Authenticator{
+		identifierAuthenticator{},
+		passwordAuthenticator{},
+		passkeyAuthenticator{webAuthnService: webAuthnService},
+		emailAuthenticator{userService: userService},
+		totpAuthenticator{mfaService: mfaService},
+		smsAuthenticator{userService: userService},
+	} {
+		authenticators[authenticator.Name()] = authenticator
+	}
+	return authenticators
+}
+
+type identifierAuthenticator struct{}
+
+func (identifierAuthenticator) Name() string { return models.AuthenticatorIdentifier }
+
+func (identifierAuthenticator) AuthMethods() []string { return nil }
+
+func (identifierAuthenticator) IsAvailable(ctx context.Context, user models.AuthenticatedUser) (bool, error) {
+	return true, nil
+}
+
+func (identifierAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	return screens.IdentifierForm(flow.SessionDataKey, flow.OrganizationName, flow.LoginHint)
+}
+
+type passwordAuthenticator struct{}
+
+func (passwordAuthenticator) Name() string { return models.AuthenticatorPassword }
+
+func (passwordAuthenticator) AuthMethods() []string { return []string{models.AuthMethodPassword} }
+
+func (passwordAuthenticator) IsAvailable(ctx context.Context, user models.AuthenticatedUser) (bool, error) {
+	return true, nil
+}
+
+func (passwordAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	return screens.PasswordForm(flow.SessionDataKey, flow.OrganizationName, flow.User.Username, flow.LoginHint)
+}
+
+type passkeyAuthenticator struct {
+	webAuthnService webauthn.WebAuthnService
+}
+
+func (passkeyAuthenticator) Name() string { return models.AuthenticatorPasskey }
+
+// AuthMethods of a passkey include mfa, as the authenticator verified the user on its own.
+func (passkeyAuthenticator) AuthMethods() []string {
+	return []string{models.AuthMethodHardwareKey, models.AuthMethodMFA}
+}
+
+func (a passkeyAuthenticator) IsAvailable(ctx context.Context, user models.AuthenticatedUser) (bool, error) {
+	return a.webAuthnService.HasCredentials(ctx, user.Id, user.OrganizationId)
+}
+
+func (passkeyAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	label := "Sign in with a passkey"
+	if flow.User.Id != "" {
+		label = "Use a passkey"
+	}
+	return screens.PasskeyForm(flow.SessionDataKey, flow.OrganizationName, label)
+}
+
+type emailAuthenticator struct {
+	userService user.UserService
+}
+
+func (emailAuthenticator) Name() string { return models.AuthenticatorEmail }
+
+func (emailAuthenticator) AuthMethods() []string { return []string{models.AuthMethodOTP} }
+
+func (a emailAuthenticator) IsAvailable(ctx context.Context, authenticatedUser models.AuthenticatedUser) (bool, error) {
+	user, err := a.userService.GetUserByID(ctx, authenticatedUser.Id, authenticatedUser.OrganizationId)
+	if err != nil {
+		return false, err
+	}
+	return user.Email != "" && user.EmailVerified, nil
+}
+
+func (emailAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	return screens.EmailLoginButton(flow.SessionDataKey, flow.OrganizationName)
+}
+
+type totpAuthenticator struct {
+	mfaService mfa.MFAService
+}
+
+func (totpAuthenticator) Name() string { return models.AuthenticatorTOTP }
+
+func (totpAuthenticator) AuthMethods() []string { return []string{models.AuthMethodOTP} }
+
+func (a totpAuthenticator) IsAvailable(ctx context.Context, user models.AuthenticatedUser) (bool, error) {
+	status, err := a.mfaService.GetTOTPStatus(ctx, user.Id, user.OrganizationId)
+	if err != nil {
+		return false, err
+	}
+	return status.Enrolled, nil
+}
+
+func (totpAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	return screens.TOTPForm(flow.SessionDataKey, flow.OrganizationName)
+}
+
+type smsAuthenticator struct {
+	userService user.UserService
+}
+
+func (smsAuthenticator) Name() string { return models.AuthenticatorSMS }
+
+func (smsAuthenticator) AuthMethods() []string { return []string{models.AuthMethodSMS} }
+
+func (a smsAuthenticator) IsAvailable(ctx context.Context, authenticatedUser models.AuthenticatedUser) (bool, error) {
+	user, err := a.userService.GetUserByID(ctx, authenticatedUser.Id, authenticatedUser.OrganizationId)
+	if err != nil {
+		return false, err
+	}
+	return user.PhoneNumberVerified, nil
+}
+
+func (smsAuthenticator) Form(ctx context.Context, flow LoginFlow) templ.Component {
+	return screens.SMSLoginForm(flow.SessionDataKey, flow.OrganizationName)
+}
+
+func (s *authnService) getAuthenticationSequence(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (models.AuthenticationSequence, error) {
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	app, err := s.applicationService.GetApplicationByClientId(ctx, authorizeRequest.ClientId, authorizeRequest.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	if len(app.AuthenticationSequence) == 0 {
+		return models.DefaultAuthenticationSequence, nil
+	}
+	return app.AuthenticationSequence, nil
+}
+
+// getLoginStep returns the step the login is at, the second factor step past the end of the sequence.
+func (s *authnService) getLoginStep(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (models.AuthenticationStep, error) {
+	sequence, err := s.getAuthenticationSequence(ctx, oauth2AuthorizeContext)
+	if err != nil {
+		return models.AuthenticationStep{}, err
+	}
+	if oauth2AuthorizeContext.LoginComplete {
+		// only the password change is left
+		return models.AuthenticationStep{}, nil
+	}
+	if oauth2AuthorizeContext.LoginStep < len(sequence) {
+		return sequence[oauth2AuthorizeContext.LoginStep], nil
+	}
+	return secondFactorStep, nil
+}
+
+func (s *authnService) getAvailableAuthenticators(ctx context.Context, step models.AuthenticationStep, user models.AuthenticatedUser) ([]Authenticator, error) {
+	var available []Authenticator
+	for _, name := range step.Authenticators {
+		authenticator, found := s.authenticators[name]
+		if !found {
+			continue
+		}
+		if user.Id != "" {
+			ok, err := authenticator.IsAvailable(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		available = append(available, authenticator)
+	}
+	return available, nil
+}
+
+func (s *authnService) IsAuthenticatorOffered(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string) (bool, error) {
+	step, err := s.getLoginStep(ctx, oauth2AuthorizeContext)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(step.Authenticators, authenticator), nil
+}
+
+// GetLoginStepForm returns the forms of the authenticators the user can complete the current step
+// with. A required step the user has nothing set up for offers TOTP enrollment, see canEnrollTOTP.
+func (s *authnService) GetLoginStepForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) (templ.Component, error) {
+	step, err := s.getLoginStep(ctx, oauth2AuthorizeContext)
+	if err != nil {
+		return nil, err
+	}
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	available, err := s.getAvailableAuthenticators(ctx, step, oauth2AuthorizeContext.PendingUser)
+	if err != nil {
+		return nil, err
+	}
+	if len(available) == 0 {
+		if oauth2AuthorizeContext.RiskStepUp {
+			return nil, ErrStepUpNotPossible
+		}
+		if !slices.Contains(step.Authenticators, models.AuthenticatorTOTP) || !canEnrollTOTP(oauth2AuthorizeContext) {
+			return nil, ErrNoAuthenticator
+		}
+		enrollment, found, err := s.GetPendingTOTPEnrollment(ctx, oauth2AuthorizeContext)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			enrollment, err = s.StartTOTPEnrollment(ctx, oauth2AuthorizeContext)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s.GetTOTPEnrollForm(ctx, sessionDataKey, authorizeRequest.OrganizationName, enrollment, errorMessage), nil
+	}
+	flow := LoginFlow{
+		SessionDataKey:   sessionDataKey,
+		OrganizationName: authorizeRequest.OrganizationName,
+		LoginHint:        authorizeRequest.LoginHint,
+		User:             oauth2AuthorizeContext.PendingUser,
+	}
+	var forms []templ.Component
+	for _, authenticator := range available {
+		forms = append(forms, authenticator.Form(ctx, flow))
+	}
+	var signUpLink templ.Component
+	if oauth2AuthorizeContext.LoginStep == 0 {
+		registrationPolicy, err := s.userService.GetRegistrationPolicy(ctx, authorizeRequest.OrganizationId)
+		if err != nil {
+			return nil, err
+		}
+		if registrationPolicy.Enabled {
+			signUpLink = screens.SignUpLink(sessionDataKey, authorizeRequest.OrganizationName)
+		}
+	}
+	return screens.LoginStep(forms, signUpLink, errorMessage), nil
+}
+
+// hasFirstFactor reports whether the user authenticated, the identifier step adds no auth methods.
+func hasFirstFactor(oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) bool {
+	return oauth2AuthorizeContext.PendingUser.Id != "" && len(oauth2AuthorizeContext.PendingAuthMethods) > 0
+}
+
+// canEnrollTOTP reports whether the login can be completed by enrolling a TOTP authenticator. A
+// risky login can't, as whoever holds the first factor would enroll their own authenticator.
+func canEnrollTOTP(oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) bool {
+	return hasFirstFactor(oauth2AuthorizeContext) && !oauth2AuthorizeContext.RiskStepUp
+}
+
+// CompleteLoginStep moves the login past the current step and reports whether it is done. A user
+// whose account is locked gets a user.LockoutError.
+func (s *authnService) CompleteLoginStep(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticatorName string, authenticatedUser models.AuthenticatedUser) (oauth2_models.OAuth2AuthorizeContext, bool, error) {
+	offered, err := s.IsAuthenticatorOffered(ctx, oauth2AuthorizeContext, authenticatorName)
+	if err != nil {
+		return oauth2AuthorizeContext, false, err
+	}
+	authenticator, found := s.authenticators[authenticatorName]
+	if !offered || !found {
+		return oauth2AuthorizeContext, false, ErrAuthenticatorNotOffered
+	}
+	pendingUser := oauth2AuthorizeContext.PendingUser
+	if (pendingUser.Id != "" && authenticatedUser.Id != pendingUser.Id) || (pendingUser.Id == "" && pendingUser.Username != "" && authenticatedUser.Username != pendingUser.Username) {
+		return oauth2AuthorizeContext, false, ErrUserMismatch
+	}
+	if err := s.checkLockout(ctx, authenticatedUser); err != nil {
+		return oauth2AuthorizeContext, false, err
+	}
+	oauth2AuthorizeContext.PendingUser = authenticatedUser
+	for _, authMethod := range authenticator.AuthMethods() {
+		if !slices.Contains(oauth2AuthorizeContext.PendingAuthMethods, authMethod) {
+			oauth2AuthorizeContext.PendingAuthMethods = append(oauth2AuthorizeContext.PendingAuthMethods, authMethod)
+		}
+	}
+	if authenticatorName != models.AuthenticatorIdentifier {
+		oauth2AuthorizeContext.LoginAuthenticators = append(oauth2AuthorizeContext.LoginAuthenticators, authenticatorName)
+	}
+	if len(oauth2AuthorizeContext.LoginAuthenticators) > 1 && !slices.Contains(oauth2AuthorizeContext.PendingAuthMethods, models.AuthMethodMFA) {
+		oauth2AuthorizeContext.PendingAuthMethods = append(oauth2AuthorizeContext.PendingAuthMethods, models.AuthMethodMFA)
+	}
+	if authenticatorName == models.AuthenticatorTOTP || authenticatorName == models.AuthenticatorSMS || authenticatorName == models.AuthenticatorPasskey {
+		if err := s.mfaService.ResetFailedAttempts(ctx, authenticatedUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId); err != nil {
+			return oauth2AuthorizeContext, false, err
+		}
+	}
+	done, err := s.nextLoginStep(ctx, &oauth2AuthorizeContext)
+	if err != nil {
+		return oauth2AuthorizeContext, false, err
+	}
+	if err := s.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return oauth2AuthorizeContext, false, err
+	}
+	return oauth2AuthorizeContext, done, nil
+}
+
+func (s *authnService) checkLockout(ctx context.Context, authenticatedUser models.AuthenticatedUser) error {
+	if authenticatedUser.Id == "" {
+		return nil
+	}
+	lockedUser, err := s.userService.GetUserByID(ctx, authenticatedUser.Id, authenticatedUser.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if locked, until := user.IsLocked(lockedUser.Lockout, time.Now()); locked {
+		return &user.LockoutError{Err: user.ErrAccountLocked, RetryAfter: until}
+	}
+	return nil
+}
+
+func (s *authnService) nextLoginStep(ctx context.Context, oauth2AuthorizeContext *oauth2_models.OAuth2AuthorizeContext) (bool, error) {
+	sequence, err := s.getAuthenticationSequence(ctx, *oauth2AuthorizeContext)
+	if err != nil {
+		return false, err
+	}
+	if oauth2AuthorizeContext.LoginStep >= len(sequence) {
+		// the second factor step was completed
+		return true, nil
+	}
+	user := oauth2AuthorizeContext.PendingUser
+	multiFactor := slices.Contains(oauth2AuthorizeContext.PendingAuthMethods, models.AuthMethodMFA)
+	for oauth2AuthorizeContext.LoginStep++; oauth2AuthorizeContext.LoginStep < len(sequence); oauth2AuthorizeContext.LoginStep++ {
+		step := sequence[oauth2AuthorizeContext.LoginStep]
+		if !step.Optional {
+			return false, nil
+		}
+		if multiFactor {
+			continue
+		}
+		available, err := s.getAvailableAuthenticators(ctx, step, user)
+		if err != nil {
+			return false, err
+		}
+		if len(available) > 0 {
+			return false, nil
+		}
+	}
+	if multiFactor {
+		return true, nil
+	}
+	if oauth2AuthorizeContext.RiskStepUp {
+		return false, nil
+	}
+	requirement, err := s.getMFARequirement(ctx, user.Id, user.OrganizationId, oauth2AuthorizeContext.OAuth2AuthorizeRequest.ClientId)
+	if err != nil {
+		return false, err
+	}
+	return requirement == mfa.RequirementNone, nil
+}
+
+// IdentifyUser returns the user with the username. An unknown username is returned without an id,
+// so the login continues as usual and fails at the next step.
+func (s *authnService) IdentifyUser(ctx context.Context, username, orgId string) (models.AuthenticatedUser, error) {
+	user, err := s.userService.GetUserByUsername(ctx, username, orgId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AuthenticatedUser{Username: username, OrganizationId: orgId}, nil
+	}
+	if err != nil {
+		return models.AuthenticatedUser{}, err
+	}
+	return models.AuthenticatedUser{
+		Id:             user.Id,
+		Username:       user.Username,
+		Email:          user.Email,
+		OrganizationId: user.OrganizationId,
+	}, nil
+}
+
+// ResetLogin starts the login over from the first step.
+func (s *authnService) ResetLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	oauth2AuthorizeContext.PendingUser = models.AuthenticatedUser{}
+	oauth2AuthorizeContext.PendingAuthMethods = nil
+	oauth2AuthorizeContext.LoginStep = 0
+	oauth2AuthorizeContext.LoginAuthenticators = nil
+	oauth2AuthorizeContext.RiskStepUp = false
+	oauth2AuthorizeContext.PasswordChangeUser = models.AuthenticatedUser{}
+	oauth2AuthorizeContext.PasswordChangeReason = ""
+	return s.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext)
+}
@@ -0,0 +1,235 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/application"
+	application_models "github.com/shashimalcse/tiny-is/internal/application/models"
+	"github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	user_models "github.com/shashimalcse/tiny-is/internal/user/models"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+type testApplicationService struct {
+	application.ApplicationService
+	sequence models.AuthenticationSequence
+}
+
+func (s testApplicationService) GetApplicationByClientId(ctx context.Context, clientId, orgId string) (application_models.Application, error) {
+	return application_models.Application{ClientId: clientId, AuthenticationSequence: s.sequence}, nil
+}
+
+// testMFAService is a user without a TOTP authenticator.
+type testMFAService struct {
+	mfa.MFAService
+	enrollments int
+}
+
+func (s *testMFAService) GetRequirement(ctx context.Context, userId, orgId, clientId string) (mfa.Requirement, error) {
+	return mfa.RequirementNone, nil
+}
+
+func (s *testMFAService) GetTOTPStatus(ctx context.Context, userId, orgId string) (mfa.TOTPStatus, error) {
+	return mfa.TOTPStatus{}, nil
+}
+
+func (s *testMFAService) GetPendingTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (mfa.TOTPEnrollment, bool, error) {
+	return mfa.TOTPEnrollment{}, false, nil
+}
+
+func (s *testMFAService) StartTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (mfa.TOTPEnrollment, error) {
+	s.enrollments++
+	return mfa.TOTPEnrollment{Secret: "test-secret"}, nil
+}
+
+func (s *testMFAService) ConfirmTOTPEnrollment(ctx context.Context, userId, orgId, code string) ([]string, error) {
+	return []string{"test-recovery-code"}, nil
+}
+
+func (s *testMFAService) ResetFailedAttempts(ctx context.Context, userId, orgId string) error {
+	return nil
+}
+
+type testUserService struct {
+	user.UserService
+	email   string
+	lockout user_models.Lockout
+}
+
+func (s testUserService) GetUserByID(ctx context.Context, id, orgId string) (user_models.User, error) {
+	return user_models.User{Id: id, OrganizationId: orgId, Email: s.email, Lockout: s.lockout}, nil
+}
+
+type testWebAuthnService struct {
+	webauthn.WebAuthnService
+}
+
+func (testWebAuthnService) HasCredentials(ctx context.Context, userId, orgId string) (bool, error) {
+	return false, nil
+}
+
+func newTestFlowService(sequence models.AuthenticationSequence) (*authnService, *testMFAService) {
+	cfg := &config.Config{}
+	mfaService := &testMFAService{}
+	webAuthnService := testWebAuthnService{}
+	userService := testUserService{}
+	return &authnService{
+		cfg:                   cfg,
+		authorizeContextStore: store.NewInMemoryAuthorizeContextStore(),
+		mfaService:            mfaService,
+		webAuthnService:       webAuthnService,
+		userService:           userService,
+		applicationService:    testApplicationService{sequence: sequence},
+		authenticators:        newAuthenticators(userService, mfaService, webAuthnService),
+	}, mfaService
+}
+
+var testPendingUser = models.AuthenticatedUser{Id: "test-user-id", Username: "alice", OrganizationId: "test-organization-id"}
+
+func newTestLogin() oauth2_models.OAuth2AuthorizeContext {
+	return oauth2_models.OAuth2AuthorizeContext{
+		OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{ClientId: "test-client-id", OrganizationId: "test-organization-id", OrganizationName: "test"},
+	}
+}
+
+func TestTOTPEnrollmentNeedsFirstFactor(t *testing.T) {
+	ctx := context.Background()
+	// stored before sequences with a second factor right after the identifier were rejected
+	s, mfaService := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorIdentifier}},
+		{Authenticators: []string{models.AuthenticatorTOTP}},
+	})
+	login, done, err := s.CompleteLoginStep(ctx, "test-session-data-key", newTestLogin(), models.AuthenticatorIdentifier, testPendingUser)
+	if err != nil || done {
+		t.Fatalf("Expected the login to continue after the identifier, got %v %v", done, err)
+	}
+	if _, err := s.GetLoginStepForm(ctx, "test-session-data-key", login, ""); !errors.Is(err, ErrNoAuthenticator) {
+		t.Errorf("Expected no way to complete the step, got %v", err)
+	}
+	if _, err := s.StartTOTPEnrollment(ctx, login); !errors.Is(err, ErrNoAuthenticator) {
+		t.Errorf("Expected the enrollment to be refused, got %v", err)
+	}
+	if _, err := s.ConfirmTOTPEnrollment(ctx, login, "123456"); !errors.Is(err, ErrNoAuthenticator) {
+		t.Errorf("Expected the enrollment to be refused, got %v", err)
+	}
+	if mfaService.enrollments != 0 {
+		t.Errorf("Expected no enrollment to be started, got %d", mfaService.enrollments)
+	}
+}
+
+func TestTOTPEnrollmentAfterPassword(t *testing.T) {
+	ctx := context.Background()
+	s, mfaService := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorIdentifier}},
+		{Authenticators: []string{models.AuthenticatorPassword}},
+		{Authenticators: []string{models.AuthenticatorTOTP}},
+	})
+	login, _, err := s.CompleteLoginStep(ctx, "test-session-data-key", newTestLogin(), models.AuthenticatorIdentifier, testPendingUser)
+	if err != nil {
+		t.Fatalf("Failed to complete the identifier step: %v", err)
+	}
+	login, done, err := s.CompleteLoginStep(ctx, "test-session-data-key", login, models.AuthenticatorPassword, testPendingUser)
+	if err != nil || done {
+		t.Fatalf("Expected the login to continue after the password, got %v %v", done, err)
+	}
+	if _, err := s.GetLoginStepForm(ctx, "test-session-data-key", login, ""); err != nil {
+		t.Fatalf("Expected the enrollment form, got %v", err)
+	}
+	if mfaService.enrollments != 1 {
+		t.Errorf("Expected an enrollment to be started, got %d", mfaService.enrollments)
+	}
+	if _, err := s.ConfirmTOTPEnrollment(ctx, login, "123456"); err != nil {
+		t.Fatalf("Failed to confirm the enrollment: %v", err)
+	}
+	login, done, err = s.CompleteLoginStep(ctx, "test-session-data-key", login, models.AuthenticatorTOTP, testPendingUser)
+	if err != nil || !done {
+		t.Fatalf("Expected the login to be done, got %v %v", done, err)
+	}
+	if got := login.PendingAuthMethods; len(got) != 3 || got[2] != models.AuthMethodMFA {
+		t.Errorf("Expected pwd, otp and mfa, got %v", got)
+	}
+}
+
+func TestOptionalSecondFactorIsSkipped(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorPassword}},
+		{Authenticators: []string{models.AuthenticatorTOTP}, Optional: true},
+	})
+	if _, done, err := s.CompleteLoginStep(ctx, "test-session-data-key", newTestLogin(), models.AuthenticatorPassword, testPendingUser); err != nil || !done {
+		t.Errorf("Expected the login to be done without a TOTP authenticator, got %v %v", done, err)
+	}
+	if _, _, err := s.CompleteLoginStep(ctx, "test-session-data-key", newTestLogin(), models.AuthenticatorTOTP, testPendingUser); !errors.Is(err, ErrAuthenticatorNotOffered) {
+		t.Errorf("Expected the TOTP authenticator not to be offered at the first step, got %v", err)
+	}
+}
+
+func TestRiskStepUpWithoutSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	s, mfaService := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorPassword}},
+	})
+	login := newTestLogin()
+	login.RiskStepUp = true
+	login, done, err := s.CompleteLoginStep(ctx, "test-session-data-key", login, models.AuthenticatorPassword, testPendingUser)
+	if err != nil || done {
+		t.Fatalf("Expected the risky login to need a second factor, got %v %v", done, err)
+	}
+	if _, err := s.GetLoginStepForm(ctx, "test-session-data-key", login, ""); !errors.Is(err, ErrStepUpNotPossible) {
+		t.Errorf("Expected the step up to be impossible, got %v", err)
+	}
+	if _, err := s.ConfirmTOTPEnrollment(ctx, login, "123456"); !errors.Is(err, ErrNoAuthenticator) {
+		t.Errorf("Expected the enrollment to be refused, got %v", err)
+	}
+	if mfaService.enrollments != 0 {
+		t.Errorf("Expected no enrollment to be started, got %d", mfaService.enrollments)
+	}
+}
+
+func TestLockedUserCantCompleteAStep(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorIdentifier}},
+		{Authenticators: []string{models.AuthenticatorEmail}},
+	})
+	s.userService = testUserService{lockout: user_models.Lockout{Locked: true}}
+	var lockoutErr *user.LockoutError
+	if _, _, err := s.CompleteLoginStep(ctx, "test-session-data-key", newTestLogin(), models.AuthenticatorIdentifier, testPendingUser); !errors.As(err, &lockoutErr) {
+		t.Errorf("Expected a locked account not to be identified, got %v", err)
+	}
+	login := newTestLogin()
+	login.LoginStep = 1
+	login.PendingUser = testPendingUser
+	if _, _, err := s.CompleteLoginStep(ctx, "test-session-data-key", login, models.AuthenticatorEmail, testPendingUser); !errors.Is(err, user.ErrAccountLocked) {
+		t.Errorf("Expected a locked account not to sign in with an email code, got %v", err)
+	}
+}
+
+func TestCompleteLoginOnlyOffersPasswordChange(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFlowService(models.AuthenticationSequence{
+		{Authenticators: []string{models.AuthenticatorEmail}},
+	})
+	login := newTestLogin()
+	login.LoginStep = 1
+	login.PendingUser = testPendingUser
+	login.LoginComplete = true
+	if _, _, err := s.CompleteLoginStep(ctx, "test-session-data-key", login, models.AuthenticatorTOTP, testPendingUser); !errors.Is(err, ErrAuthenticatorNotOffered) {
+		t.Errorf("Expected no step to be offered before the password is changed, got %v", err)
+	}
+}
+
+func TestEmailLoginNeedsVerifiedEmail(t *testing.T) {
+	authenticator := emailAuthenticator{userService: testUserService{email: "alice@example.com"}}
+	if available, err := authenticator.IsAvailable(context.Background(), testPendingUser); err != nil || available {
+		t.Errorf("Expected an unverified email address not to sign in, got %v %v", available, err)
+	}
+}
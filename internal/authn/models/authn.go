@@ -1,5 +1,30 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// amr values of RFC 8176
+const (
+	AuthMethodPassword = "pwd"
+	// AuthMethodOTP covers TOTP and recovery codes, and codes or links sent by email.
+	AuthMethodOTP         = "otp"
+	AuthMethodSMS         = "sms"
+	AuthMethodHardwareKey = "hwk"
+	// AuthMethodMFA is added when the user authenticated with more than one factor.
+	AuthMethodMFA = "mfa"
+)
+
+// ways to sign in with email
+const (
+	EmailLoginCode = "code"
+	EmailLoginLink = "link"
+)
+
 type AuthenticatedUser struct {
 	Id             string `json:"id"`
 	Username       string `json:"username"`
@@ -11,3 +36,102 @@ type AuthenticateResult struct {
 	Authenticated     bool
 	AuthenticatedUser AuthenticatedUser
 }
+
+// authenticators of the login steps
+const (
+	// AuthenticatorIdentifier asks for the username without authenticating the user.
+	AuthenticatorIdentifier = "identifier"
+	AuthenticatorPassword   = "password"
+	AuthenticatorPasskey    = "passkey"
+	AuthenticatorEmail      = "email"
+	AuthenticatorTOTP       = "totp"
+	AuthenticatorSMS        = "sms"
+)
+
+// second factors, only offered to a user who already authenticated
+var userBoundAuthenticators = []string{AuthenticatorTOTP, AuthenticatorSMS}
+
+var authenticators = []string{AuthenticatorIdentifier, AuthenticatorPassword, AuthenticatorPasskey, AuthenticatorEmail, AuthenticatorTOTP, AuthenticatorSMS}
+
+// AuthenticationStep is a step of the login, completed with any one of its authenticators.
+type AuthenticationStep struct {
+	Authenticators []string `json:"authenticators"`
+	// Optional steps are skipped when the user has none of the authenticators set up, or already
+	// authenticated with more than one factor.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// AuthenticationSequence is the login of an application, one step after the other.
+type AuthenticationSequence []AuthenticationStep
+
+// DefaultAuthenticationSequence is used by applications without a sequence of their own.
+var DefaultAuthenticationSequence = AuthenticationSequence{
+	{Authenticators: []string{AuthenticatorPassword, AuthenticatorPasskey, AuthenticatorEmail}},
+}
+
+func (sequence AuthenticationSequence) Validate() error {
+	if len(sequence) == 0 {
+		return errors.New("authentication sequence has no steps")
+	}
+	authenticates := false
+	for i, step := range sequence {
+		if len(step.Authenticators) == 0 {
+			return fmt.Errorf("step %d has no authenticators", i+1)
+		}
+		for j, authenticator := range step.Authenticators {
+			if !slices.Contains(authenticators, authenticator) {
+				return fmt.Errorf("unknown authenticator: %s", authenticator)
+			}
+			if slices.Contains(step.Authenticators[:j], authenticator) {
+				return fmt.Errorf("step %d has %s more than once", i+1, authenticator)
+			}
+			if authenticator == AuthenticatorIdentifier && (i > 0 || len(step.Authenticators) > 1) {
+				return errors.New("identifier can only be the first step, on its own")
+			}
+			if !authenticates && slices.Contains(userBoundAuthenticators, authenticator) {
+				return fmt.Errorf("%s has to come after a required step that authenticates the user", authenticator)
+			}
+		}
+		if i == 0 && step.Optional {
+			return errors.New("the first step can't be optional")
+		}
+		if !step.Optional && step.Authenticators[0] != AuthenticatorIdentifier {
+			authenticates = true
+		}
+	}
+	if !authenticates {
+		return errors.New("authentication sequence has no required step that authenticates the user")
+	}
+	return nil
+}
+
+func (sequence *AuthenticationSequence) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*sequence = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported authentication sequence type: %T", value)
+	}
+	if len(data) == 0 {
+		*sequence = nil
+		return nil
+	}
+	return json.Unmarshal(data, sequence)
+}
+
+func (sequence AuthenticationSequence) Value() (driver.Value, error) {
+	if len(sequence) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(sequence)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticationSequenceValidate(t *testing.T) {
+	valid := []AuthenticationSequence{
+		DefaultAuthenticationSequence,
+		{
+			{Authenticators: []string{AuthenticatorIdentifier}},
+			{Authenticators: []string{AuthenticatorPassword, AuthenticatorPasskey}},
+			{Authenticators: []string{AuthenticatorTOTP, AuthenticatorSMS}, Optional: true},
+		},
+	}
+	for _, sequence := range valid {
+		if err := sequence.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", sequence, err)
+		}
+	}
+	invalid := map[string]AuthenticationSequence{
+		"empty":                   {},
+		"empty step":              {{}},
+		"unknown authenticator":   {{Authenticators: []string{"fingerprint"}}},
+		"repeated authenticator":  {{Authenticators: []string{AuthenticatorPassword, AuthenticatorPassword}}},
+		"identifier only":         {{Authenticators: []string{AuthenticatorIdentifier}}},
+		"identifier with another": {{Authenticators: []string{AuthenticatorIdentifier, AuthenticatorPassword}}},
+		"identifier later":        {{Authenticators: []string{AuthenticatorPassword}}, {Authenticators: []string{AuthenticatorIdentifier}}},
+		"totp first":              {{Authenticators: []string{AuthenticatorTOTP}}},
+		"totp after identifier": {
+			{Authenticators: []string{AuthenticatorIdentifier}},
+			{Authenticators: []string{AuthenticatorTOTP}},
+		},
+		"sms with the first factor": {
+			{Authenticators: []string{AuthenticatorIdentifier}},
+			{Authenticators: []string{AuthenticatorPassword, AuthenticatorSMS}},
+		},
+		"totp after an optional step": {
+			{Authenticators: []string{AuthenticatorIdentifier}},
+			{Authenticators: []string{AuthenticatorPassword}, Optional: true},
+			{Authenticators: []string{AuthenticatorTOTP}},
+		},
+		"optional first": {{Authenticators: []string{AuthenticatorPassword}, Optional: true}},
+		"nothing required": {
+			{Authenticators: []string{AuthenticatorIdentifier}},
+			{Authenticators: []string{AuthenticatorPassword}, Optional: true},
+		},
+	}
+	for name, sequence := range invalid {
+		if err := sequence.Validate(); err == nil {
+			t.Errorf("Expected %s sequence to be invalid", name)
+		}
+	}
+}
+
+func TestAuthenticationSequenceScan(t *testing.T) {
+	sequence := AuthenticationSequence{
+		{Authenticators: []string{AuthenticatorPassword}},
+		{Authenticators: []string{AuthenticatorTOTP}, Optional: true},
+	}
+	value, err := sequence.Value()
+	if err != nil {
+		t.Fatalf("Failed to encode sequence: %v", err)
+	}
+	var scanned AuthenticationSequence
+	if err := scanned.Scan(value); err != nil {
+		t.Fatalf("Failed to scan sequence: %v", err)
+	}
+	if !reflect.DeepEqual(scanned, sequence) {
+		t.Errorf("Expected %+v, got %+v", sequence, scanned)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("Expected a NULL sequence to be empty, got %+v %v", scanned, err)
+	}
+}
@@ -2,51 +2,128 @@ package authn
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/a-h/templ"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shashimalcse/tiny-is/internal/application"
 	"github.com/shashimalcse/tiny-is/internal/authn/models"
 	"github.com/shashimalcse/tiny-is/internal/authn/screens"
 	"github.com/shashimalcse/tiny-is/internal/cache"
 	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	"github.com/shashimalcse/tiny-is/internal/notification"
 	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/otp"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
 	"github.com/shashimalcse/tiny-is/internal/session"
 	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
 )
 
+var ErrUnsupportedEmailLogin = errors.New("unsupported email login method")
+
 type AuthnService interface {
-	GetLoginPage(ctx context.Context, sessionDataKey, organizationName string) templ.Component
-	AuthenticateUser(ctx context.Context, username, password, orgId string) (models.AuthenticateResult, error)
-	GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx context.Context, sessionDataKey string) (oauth2_models.OAuth2AuthorizeContext, error)
-	AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext oauth2_models.OAuth2AuthorizeContext)
-	CreateSession(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, sessionDuration time.Duration) string
-	GetSession(ctx context.Context, sessionID string) (session.SessionInfo, bool)
+	GetLoginStepForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) (templ.Component, error)
+	IsAuthenticatorOffered(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string) (bool, error)
+	CompleteLoginStep(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string, authenticatedUser models.AuthenticatedUser) (oauth2_models.OAuth2AuthorizeContext, bool, error)
+	ResetLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error
+	IdentifyUser(ctx context.Context, username, orgId string) (models.AuthenticatedUser, error)
+	AuthenticateUser(ctx context.Context, username, password, orgId, ipAddress string) (models.AuthenticateResult, error)
+	// GetPasswordStatus returns why the user should change their password, empty when they can keep it.
+	GetPasswordStatus(ctx context.Context, authenticatedUser models.AuthenticatedUser, password string) (string, error)
+	IsPasswordExpired(ctx context.Context, authenticatedUser models.AuthenticatedUser) (bool, error)
+	ChangeExpiredPassword(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, password string) error
+	GetPasswordChangeForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) templ.Component
+	GetOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string) (oauth2_models.OAuth2AuthorizeContext, error)
+	AddOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext oauth2_models.OAuth2AuthorizeContext) error
+	CreateSession(ctx context.Context, currentSessionID string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authMethods []string, device session.Device) (oauth2_models.OAuth2AuthorizeContext, error)
+	ResumeSession(ctx context.Context, sessionID string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (oauth2_models.OAuth2AuthorizeContext, bool, error)
+	GetSession(ctx context.Context, sessionID string) (session.SessionInfo, bool, error)
+	ValidateLogoutRequest(ctx context.Context, logoutRequest server_models.LogoutRequest) (server_models.LogoutRequest, error)
+	Logout(ctx context.Context, sessionID string) error
+	GetLogoutConfirmPage(ctx context.Context, logoutRequest server_models.LogoutRequest) templ.Component
+	GetLoggedOutPage(ctx context.Context) templ.Component
+	GetFrontchannelLogoutUris(ctx context.Context, sessionInfo session.SessionInfo) []string
+	GetFrontchannelLogoutPage(ctx context.Context, frontchannelLogoutUris []string, redirectURL string) templ.Component
+	VerifyTOTP(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) (bool, error)
+	// CheckMFAAttempts returns mfa.ErrTooManyAttempts while the pending user is locked out.
+	CheckMFAAttempts(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error
+	FailMFAAttempt(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error
+	StartTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (mfa.TOTPEnrollment, error)
+	GetPendingTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (mfa.TOTPEnrollment, bool, error)
+	ConfirmTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) ([]string, error)
+	SendSMSCode(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error
+	VerifySMSCode(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) error
+	GetSMSCodeForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) (templ.Component, error)
+	GetTOTPEnrollForm(ctx context.Context, sessionDataKey, organizationName string, enrollment mfa.TOTPEnrollment, errorMessage string) templ.Component
+	GetRecoveryCodes(ctx context.Context, sessionDataKey, organizationName string, codes []string) templ.Component
+	BeginPasskeyLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (webauthn.RequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, response webauthn.AssertionResponse) (models.AuthenticatedUser, error)
+	GetPasskeysPage(ctx context.Context, sessionInfo session.SessionInfo, organizationName, csrfToken string) (templ.Component, error)
+	GetPasskeysSignInRequiredPage(ctx context.Context, organizationName string) templ.Component
+	BeginPasskeyRegistration(ctx context.Context, sessionInfo session.SessionInfo) (webauthn.CreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, sessionInfo session.SessionInfo, organizationName, name string, response webauthn.RegistrationResponse) (templ.Component, error)
+	DeletePasskey(ctx context.Context, sessionInfo session.SessionInfo, credentialId string) error
+	SendEmailLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, email, method string) error
+	VerifyEmailCode(ctx context.Context, sessionDataKey, code string) (models.AuthenticatedUser, error)
+	VerifyMagicLink(ctx context.Context, token string) (string, models.AuthenticatedUser, error)
+	GetEmailLoginForm(ctx context.Context, sessionDataKey, organizationName, email, errorMessage string) templ.Component
+	GetEmailCodeForm(ctx context.Context, sessionDataKey, organizationName, email, errorMessage string) templ.Component
+	GetMagicLinkSessionDataKey(ctx context.Context, token string) (string, error)
+	GetMagicLinkSent(ctx context.Context, email string) templ.Component
+	GetMagicLinkOtherBrowser(ctx context.Context) templ.Component
+	GetMagicLinkConfirmPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component
+	GetLoginStepPage(ctx context.Context, step templ.Component, csrfToken string) templ.Component
+	GetLoginError(ctx context.Context, message string) templ.Component
 }
 
 type authnService struct {
-	cfg          *config.Config
-	cacheService cache.CacheService
-	SessionStore session.SessionStore
-	userService  user.UserService
+	cfg                   *config.Config
+	cacheService          cache.CacheService
+	authorizeContextStore store.AuthorizeContextStore
+	SessionStore          session.SessionStore
+	sessionService        session.SessionService
+	mfaService            mfa.MFAService
+	webAuthnService       webauthn.WebAuthnService
+	otpService            otp.OTPService
+	userService           user.UserService
+	applicationService    application.ApplicationService
+	tokenService          token.TokenService
+	authenticators        map[string]Authenticator
 }
 
-func NewAuthnService(cfg *config.Config, cacheService cache.CacheService, sessionStore session.SessionStore, userService user.UserService) AuthnService {
+func NewAuthnService(cfg *config.Config, cacheService cache.CacheService, authorizeContextStore store.AuthorizeContextStore, sessionStore session.SessionStore, sessionService session.SessionService, mfaService mfa.MFAService, webAuthnService webauthn.WebAuthnService, otpService otp.OTPService, userService user.UserService, applicationService application.ApplicationService, tokenService token.TokenService) AuthnService {
 	service := &authnService{
-		cfg:          cfg,
-		cacheService: cacheService,
-		SessionStore: sessionStore,
-		userService:  userService,
+		cfg:                   cfg,
+		cacheService:          cacheService,
+		authorizeContextStore: authorizeContextStore,
+		SessionStore:          sessionStore,
+		sessionService:        sessionService,
+		mfaService:            mfaService,
+		webAuthnService:       webAuthnService,
+		otpService:            otpService,
+		userService:           userService,
+		applicationService:    applicationService,
+		tokenService:          tokenService,
+		authenticators:        newAuthenticators(userService, mfaService, webAuthnService),
 	}
 	return service
 }
 
-func (s *authnService) GetLoginPage(ctx context.Context, sessionDataKey, organizationName string) templ.Component {
-	return screens.LoginPage(sessionDataKey, organizationName)
-}
-
-func (s *authnService) AuthenticateUser(ctx context.Context, username, password, orgId string) (models.AuthenticateResult, error) {
-	authenticated, err := s.userService.AuthenticateUser(ctx, username, password, orgId)
+func (s *authnService) AuthenticateUser(ctx context.Context, username, password, orgId, ipAddress string) (models.AuthenticateResult, error) {
+	authenticated, err := s.userService.AuthenticateUser(ctx, username, password, orgId, ipAddress)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AuthenticateResult{}, nil
+	}
 	if err != nil {
 		return models.AuthenticateResult{}, err
 	}
@@ -63,23 +140,514 @@ func (s *authnService) AuthenticateUser(ctx context.Context, username, password,
 	return models.AuthenticateResult{Authenticated: authenticated, AuthenticatedUser: authenticatedUser}, nil
 }
 
-func (s *authnService) GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx context.Context, sessionDataKey string) (oauth2_models.OAuth2AuthorizeContext, error) {
-	oauth2AuthorizeContext, found := s.cacheService.GetOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey)
+func (s *authnService) GetPasswordStatus(ctx context.Context, authenticatedUser models.AuthenticatedUser, password string) (string, error) {
+	return s.userService.GetPasswordStatus(ctx, authenticatedUser.Id, authenticatedUser.OrganizationId, password)
+}
+
+func (s *authnService) IsPasswordExpired(ctx context.Context, authenticatedUser models.AuthenticatedUser) (bool, error) {
+	return s.userService.IsPasswordExpired(ctx, authenticatedUser.Id, authenticatedUser.OrganizationId)
+}
+
+func (s *authnService) ChangeExpiredPassword(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, password string) error {
+	changeUser := oauth2AuthorizeContext.PasswordChangeUser
+	return s.userService.SetPassword(ctx, changeUser.Id, changeUser.OrganizationId, password, false)
+}
+
+func (s *authnService) GetPasswordChangeForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) templ.Component {
+	notice := "Your password has expired. Choose a new password to continue."
+	switch oauth2AuthorizeContext.PasswordChangeReason {
+	case user.PasswordBreached:
+		notice = "Your password has appeared in a data breach. Choose a new password to continue."
+	case user.PasswordBreachedWarning:
+		notice = "Your password has appeared in a data breach. We recommend choosing a new password."
+	}
+	optional := oauth2AuthorizeContext.PasswordChangeReason == user.PasswordBreachedWarning
+	return screens.PasswordChangeForm(sessionDataKey, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName, notice, optional, errorMessage)
+}
+
+func (s *authnService) GetOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string) (oauth2_models.OAuth2AuthorizeContext, error) {
+	oauth2AuthorizeContext, found := s.authorizeContextStore.GetBySessionDataKey(sessionDataKey)
 	if !found {
 		return oauth2_models.OAuth2AuthorizeContext{}, errors.New("invalid session_data_key")
 	}
 	return oauth2AuthorizeContext, nil
 }
 
-func (s *authnService) AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext oauth2_models.OAuth2AuthorizeContext) {
-	s.cacheService.AddOAuth2AuthorizeContextToCacheBySessionDataKey(sessionDataKey, authroizeContext)
+func (s *authnService) AddOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	return s.authorizeContextStore.AddBySessionDataKey(sessionDataKey, authroizeContext, s.cfg.GetSessionDataKeyTTL())
 }
 
-func (s *authnService) CreateSession(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, sessionDuration time.Duration) string {
-	sessionID := s.SessionStore.CreateSession(oauth2AuthorizeContext.AuthenticatedUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId, oauth2AuthorizeContext.OAuth2AuthorizeRequest.ClientId, sessionDuration)
-	return sessionID
+// CreateSession starts or refreshes the SSO session of the user and joins the requesting client to it.
+func (s *authnService) CreateSession(ctx context.Context, currentSessionID string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authMethods []string, device session.Device) (oauth2_models.OAuth2AuthorizeContext, error) {
+	userId := oauth2AuthorizeContext.AuthenticatedUser.Id
+	orgId := oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId
+	sessionID := ""
+	if currentSessionID != "" {
+		sessionInfo, found, err := s.SessionStore.GetSession(currentSessionID)
+		if err != nil {
+			return oauth2AuthorizeContext, err
+		}
+		if found && sessionInfo.UserID == userId && sessionInfo.OrganizationId == orgId {
+			err := s.SessionStore.UpdateAuthentication(currentSessionID, authMethods)
+			if err == nil {
+				sessionID = currentSessionID
+			} else if !errors.Is(err, session.ErrSessionNotFound) {
+				return oauth2AuthorizeContext, err
+			}
+		}
+	}
+	if sessionID == "" {
+		issuer, err := tinyhttp.GetIssuer(ctx, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName)
+		if err != nil {
+			return oauth2AuthorizeContext, err
+		}
+		sessionID, err = s.sessionService.CreateSession(ctx, session.SessionInfo{
+			UserID:         userId,
+			OrganizationId: orgId,
+			Issuer:         issuer,
+			AuthMethods:    authMethods,
+			Device:         device,
+		})
+		if err != nil {
+			return oauth2AuthorizeContext, err
+		}
+	}
+	if err := s.SessionStore.AddClientToSession(sessionID, oauth2AuthorizeContext.OAuth2AuthorizeRequest.ClientId); err != nil {
+		return oauth2AuthorizeContext, err
+	}
+	sessionInfo, found, err := s.SessionStore.GetSession(sessionID)
+	if err != nil {
+		return oauth2AuthorizeContext, err
+	}
+	if !found {
+		return oauth2AuthorizeContext, session.ErrSessionNotFound
+	}
+	return withSession(oauth2AuthorizeContext, sessionInfo), nil
 }
 
-func (s *authnService) GetSession(ctx context.Context, sessionID string) (session.SessionInfo, bool) {
+// ResumeSession reuses the SSO session when it satisfies the prompt, max_age and id_token_hint.
+func (s *authnService) ResumeSession(ctx context.Context, sessionID string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (oauth2_models.OAuth2AuthorizeContext, bool, error) {
+	sessionInfo, found, err := s.SessionStore.GetSession(sessionID)
+	if err != nil || !found || !s.canReuseSession(ctx, oauth2AuthorizeContext, sessionInfo) {
+		return oauth2AuthorizeContext, false, err
+	}
+	authenticatedUser, err := s.getAuthenticatedUser(ctx, sessionInfo.UserID, sessionInfo.OrganizationId)
+	if err != nil {
+		return oauth2AuthorizeContext, false, err
+	}
+	if err := s.SessionStore.AddClientToSession(sessionID, oauth2AuthorizeContext.OAuth2AuthorizeRequest.ClientId); err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return oauth2AuthorizeContext, false, nil
+		}
+		return oauth2AuthorizeContext, false, err
+	}
+	oauth2AuthorizeContext.AuthenticatedUser = authenticatedUser
+	return withSession(oauth2AuthorizeContext, sessionInfo), true, nil
+}
+
+func withSession(oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, sessionInfo session.SessionInfo) oauth2_models.OAuth2AuthorizeContext {
+	oauth2AuthorizeContext.SessionId = sessionInfo.SessionId
+	oauth2AuthorizeContext.AuthTime = sessionInfo.AuthTime
+	oauth2AuthorizeContext.AuthMethods = sessionInfo.AuthMethods
+	return oauth2AuthorizeContext
+}
+
+func (s *authnService) GetSession(ctx context.Context, sessionID string) (session.SessionInfo, bool, error) {
 	return s.SessionStore.GetSession(sessionID)
 }
+
+func (s *authnService) canReuseSession(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, sessionInfo session.SessionInfo) bool {
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	if sessionInfo.OrganizationId != authorizeRequest.OrganizationId || authorizeRequest.HasPrompt(oauth2_models.PromptLogin) {
+		return false
+	}
+	if maxAge, ok := authorizeRequest.GetMaxAge(); ok && time.Since(sessionInfo.AuthTime) > maxAge {
+		return false
+	}
+	if authorizeRequest.IdTokenHint != "" {
+		claims, err := s.parseIdTokenHint(ctx, authorizeRequest.IdTokenHint, authorizeRequest.OrganizationId, authorizeRequest.OrganizationName)
+		if err != nil {
+			return false
+		}
+		if sub, _ := claims["sub"].(string); sub != sessionInfo.UserID {
+			return false
+		}
+	}
+	// a session that only passed the first factor can't be used where a second factor is needed
+	if !slices.Contains(sessionInfo.AuthMethods, models.AuthMethodMFA) {
+		requirement, err := s.getMFARequirement(ctx, sessionInfo.UserID, sessionInfo.OrganizationId, authorizeRequest.ClientId)
+		if err != nil || requirement != mfa.RequirementNone {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *authnService) parseIdTokenHint(ctx context.Context, idTokenHint, orgId, orgName string) (jwt.MapClaims, error) {
+	issuer, err := tinyhttp.GetIssuer(ctx, orgName)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.tokenService.ParseIdTokenHint(ctx, idTokenHint, issuer)
+	if err != nil {
+		return nil, err
+	}
+	audience, _ := claims.GetAudience()
+	validClientId, err := s.applicationService.ValidateClientId(ctx, audience[0], orgId)
+	if err != nil {
+		return nil, err
+	}
+	if !validClientId {
+		return nil, errors.New("id_token_hint was issued to another organization")
+	}
+	return claims, nil
+}
+
+func (s *authnService) getAuthenticatedUser(ctx context.Context, userId, orgId string) (models.AuthenticatedUser, error) {
+	user, err := s.userService.GetUserByID(ctx, userId, orgId)
+	if err != nil {
+		return models.AuthenticatedUser{}, err
+	}
+	return models.AuthenticatedUser{
+		Id:             user.Id,
+		Username:       user.Username,
+		Email:          user.Email,
+		OrganizationId: user.OrganizationId,
+	}, nil
+}
+
+func (s *authnService) ValidateLogoutRequest(ctx context.Context, logoutRequest server_models.LogoutRequest) (server_models.LogoutRequest, error) {
+	if logoutRequest.IdTokenHint != "" {
+		claims, err := s.parseIdTokenHint(ctx, logoutRequest.IdTokenHint, logoutRequest.OrganizationId, logoutRequest.OrganizationName)
+		if err != nil {
+			return server_models.LogoutRequest{}, err
+		}
+		audience, _ := claims.GetAudience()
+		clientId := audience[0]
+		if logoutRequest.ClientId != "" && clientId != "" && logoutRequest.ClientId != clientId {
+			return server_models.LogoutRequest{}, errors.New("client_id does not match the id_token_hint")
+		}
+		if logoutRequest.ClientId == "" {
+			logoutRequest.ClientId = clientId
+		}
+		logoutRequest.Subject, _ = claims["sub"].(string)
+	}
+	if logoutRequest.PostLogoutRedirectUri != "" {
+		if logoutRequest.ClientId == "" {
+			return server_models.LogoutRequest{}, errors.New("client_id or id_token_hint is required with post_logout_redirect_uri")
+		}
+		validPostLogoutRedirectUri, err := s.applicationService.ValidatePostLogoutRedirectUri(ctx, logoutRequest.ClientId, logoutRequest.PostLogoutRedirectUri, logoutRequest.OrganizationId)
+		if err != nil {
+			return server_models.LogoutRequest{}, err
+		}
+		if !validPostLogoutRedirectUri {
+			return server_models.LogoutRequest{}, errors.New("invalid post_logout_redirect_uri")
+		}
+	}
+	return logoutRequest, nil
+}
+
+func (s *authnService) Logout(ctx context.Context, sessionID string) error {
+	return s.SessionStore.DeleteSession(sessionID)
+}
+
+func (s *authnService) GetLogoutConfirmPage(ctx context.Context, logoutRequest server_models.LogoutRequest) templ.Component {
+	return screens.LogoutConfirmPage(logoutRequest.OrganizationName, logoutRequest.IdTokenHint, logoutRequest.ClientId, logoutRequest.PostLogoutRedirectUri, logoutRequest.State)
+}
+
+func (s *authnService) GetLoggedOutPage(ctx context.Context) templ.Component {
+	return screens.LoggedOutPage()
+}
+
+func (s *authnService) GetFrontchannelLogoutUris(ctx context.Context, sessionInfo session.SessionInfo) []string {
+	var frontchannelLogoutUris []string
+	for _, clientId := range sessionInfo.ClientIDs {
+		app, err := s.applicationService.GetApplicationByClientId(ctx, clientId, sessionInfo.OrganizationId)
+		if err != nil || app.FrontchannelLogoutUri == "" {
+			continue
+		}
+		u, err := url.Parse(app.FrontchannelLogoutUri)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		query.Set("iss", sessionInfo.Issuer)
+		query.Set("sid", sessionInfo.SessionId)
+		u.RawQuery = query.Encode()
+		frontchannelLogoutUris = append(frontchannelLogoutUris, u.String())
+	}
+	return frontchannelLogoutUris
+}
+
+// getMFARequirement counts a passkey as an enrolled second factor. A verified phone number is only
+// used when the policy requires a second factor.
+func (s *authnService) getMFARequirement(ctx context.Context, userId, orgId, clientId string) (mfa.Requirement, error) {
+	requirement, err := s.mfaService.GetRequirement(ctx, userId, orgId, clientId)
+	if err != nil || requirement == mfa.RequirementVerify {
+		return requirement, err
+	}
+	hasPasskeys, err := s.webAuthnService.HasCredentials(ctx, userId, orgId)
+	if err != nil {
+		return mfa.RequirementNone, err
+	}
+	if hasPasskeys {
+		return mfa.RequirementVerify, nil
+	}
+	if requirement == mfa.RequirementEnroll {
+		user, err := s.userService.GetUserByID(ctx, userId, orgId)
+		if err != nil {
+			return mfa.RequirementNone, err
+		}
+		if user.PhoneNumberVerified {
+			return mfa.RequirementVerify, nil
+		}
+	}
+	return requirement, nil
+}
+
+func (s *authnService) VerifyTOTP(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) (bool, error) {
+	if oauth2AuthorizeContext.PendingUser.Id == "" {
+		return false, nil
+	}
+	return s.mfaService.VerifyTOTP(ctx, oauth2AuthorizeContext.PendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId, code)
+}
+
+func (s *authnService) CheckMFAAttempts(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	if oauth2AuthorizeContext.PendingUser.Id == "" {
+		return nil
+	}
+	return s.mfaService.CheckFailedAttempts(ctx, oauth2AuthorizeContext.PendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId)
+}
+
+func (s *authnService) FailMFAAttempt(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	if oauth2AuthorizeContext.PendingUser.Id == "" {
+		return nil
+	}
+	return s.mfaService.RecordFailedAttempt(ctx, oauth2AuthorizeContext.PendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId)
+}
+
+func (s *authnService) StartTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (mfa.TOTPEnrollment, error) {
+	if !canEnrollTOTP(oauth2AuthorizeContext) {
+		return mfa.TOTPEnrollment{}, ErrNoAuthenticator
+	}
+	pendingUser := oauth2AuthorizeContext.PendingUser
+	return s.mfaService.StartTOTPEnrollment(ctx, pendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName, pendingUser.Username)
+}
+
+func (s *authnService) GetPendingTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (mfa.TOTPEnrollment, bool, error) {
+	pendingUser := oauth2AuthorizeContext.PendingUser
+	return s.mfaService.GetPendingTOTPEnrollment(ctx, pendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName, pendingUser.Username)
+}
+
+// ConfirmTOTPEnrollment completes the login step with the new authenticator, so it is only allowed
+// after the user authenticated with another factor, in a login that was not risky.
+func (s *authnService) ConfirmTOTPEnrollment(ctx context.Context, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) ([]string, error) {
+	if !canEnrollTOTP(oauth2AuthorizeContext) {
+		return nil, ErrNoAuthenticator
+	}
+	return s.mfaService.ConfirmTOTPEnrollment(ctx, oauth2AuthorizeContext.PendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId, code)
+}
+
+// SendSMSCode texts a code to the verified phone number of the pending user. Nothing is sent when the
+// identifier step did not find the user, the code is then never accepted.
+func (s *authnService) SendSMSCode(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	if oauth2AuthorizeContext.PendingUser.Id == "" {
+		return nil
+	}
+	user, err := s.userService.GetUserByID(ctx, oauth2AuthorizeContext.PendingUser.Id, authorizeRequest.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if !user.PhoneNumberVerified {
+		return otp.ErrNoPhoneNumber
+	}
+	recipient := otp.Recipient{
+		UserId:         user.Id,
+		OrganizationId: user.OrganizationId,
+		PhoneNumber:    user.PhoneNumber,
+	}
+	return s.otpService.SendCode(ctx, otp.ChannelSMS, sessionDataKey, recipient, authorizeRequest.OrganizationName)
+}
+
+func (s *authnService) VerifySMSCode(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, code string) error {
+	recipient, err := s.otpService.VerifyCode(ctx, otp.ChannelSMS, sessionDataKey, code)
+	if err != nil {
+		return err
+	}
+	if recipient.UserId != oauth2AuthorizeContext.PendingUser.Id {
+		return otp.ErrCodeExpired
+	}
+	return nil
+}
+
+func (s *authnService) GetSMSCodeForm(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) (templ.Component, error) {
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	if oauth2AuthorizeContext.PendingUser.Id == "" {
+		return screens.SMSCodeForm(sessionDataKey, authorizeRequest.OrganizationName, "your phone", errorMessage), nil
+	}
+	user, err := s.userService.GetUserByID(ctx, oauth2AuthorizeContext.PendingUser.Id, authorizeRequest.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	return screens.SMSCodeForm(sessionDataKey, authorizeRequest.OrganizationName, maskPhoneNumber(user.PhoneNumber), errorMessage), nil
+}
+
+func maskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 4 {
+		return phoneNumber
+	}
+	return strings.Repeat("•", len(phoneNumber)-4) + phoneNumber[len(phoneNumber)-4:]
+}
+
+func (s *authnService) GetTOTPEnrollForm(ctx context.Context, sessionDataKey, organizationName string, enrollment mfa.TOTPEnrollment, errorMessage string) templ.Component {
+	return screens.TOTPEnrollForm(sessionDataKey, organizationName, enrollment.Secret, enrollment.ProvisioningURI, errorMessage)
+}
+
+func (s *authnService) GetRecoveryCodes(ctx context.Context, sessionDataKey, organizationName string, codes []string) templ.Component {
+	return screens.RecoveryCodes(sessionDataKey, organizationName, codes)
+}
+
+// BeginPasskeyLogin starts a sign in with a passkey. After the password it must be a passkey of the
+// pending user, otherwise any passkey of the organization signs its user in.
+func (s *authnService) BeginPasskeyLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) (webauthn.RequestOptions, error) {
+	return s.webAuthnService.BeginLogin(ctx, passkeyLoginCeremonyKey(sessionDataKey), oauth2AuthorizeContext.PendingUser.Id, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId)
+}
+
+func (s *authnService) FinishPasskeyLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, response webauthn.AssertionResponse) (models.AuthenticatedUser, error) {
+	credential, err := s.webAuthnService.FinishLogin(ctx, passkeyLoginCeremonyKey(sessionDataKey), response)
+	if err != nil {
+		return models.AuthenticatedUser{}, err
+	}
+	return s.getAuthenticatedUser(ctx, credential.UserId, credential.OrganizationId)
+}
+
+func (s *authnService) GetPasskeysPage(ctx context.Context, sessionInfo session.SessionInfo, organizationName, csrfToken string) (templ.Component, error) {
+	user, err := s.userService.GetUserByID(ctx, sessionInfo.UserID, sessionInfo.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.webAuthnService.GetCredentials(ctx, sessionInfo.UserID, sessionInfo.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	return screens.PasskeysPage(organizationName, user.Username, credentials, csrfToken), nil
+}
+
+func (s *authnService) GetPasskeysSignInRequiredPage(ctx context.Context, organizationName string) templ.Component {
+	return screens.PasskeysSignInRequiredPage(organizationName)
+}
+
+func (s *authnService) BeginPasskeyRegistration(ctx context.Context, sessionInfo session.SessionInfo) (webauthn.CreationOptions, error) {
+	user, err := s.userService.GetUserByID(ctx, sessionInfo.UserID, sessionInfo.OrganizationId)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+	return s.webAuthnService.BeginRegistration(ctx, passkeyRegistrationCeremonyKey(sessionInfo.SessionId), user.Id, user.OrganizationId, user.Username)
+}
+
+func (s *authnService) FinishPasskeyRegistration(ctx context.Context, sessionInfo session.SessionInfo, organizationName, name string, response webauthn.RegistrationResponse) (templ.Component, error) {
+	credential, err := s.webAuthnService.FinishRegistration(ctx, passkeyRegistrationCeremonyKey(sessionInfo.SessionId), name, response)
+	if err != nil {
+		return nil, err
+	}
+	return screens.PasskeyRow(organizationName, credential), nil
+}
+
+func (s *authnService) DeletePasskey(ctx context.Context, sessionInfo session.SessionInfo, credentialId string) error {
+	return s.webAuthnService.DeleteCredential(ctx, credentialId, sessionInfo.UserID, sessionInfo.OrganizationId)
+}
+
+// SendEmailLogin emails a one-time code or a sign in link to the user with the verified email
+// address. Nothing is sent when there is none, but the login continues the same way.
+func (s *authnService) SendEmailLogin(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, email, method string) error {
+	if method != models.EmailLoginCode && method != models.EmailLoginLink {
+		return ErrUnsupportedEmailLogin
+	}
+	authorizeRequest := oauth2AuthorizeContext.OAuth2AuthorizeRequest
+	user, err := s.userService.GetUserByEmail(ctx, email, authorizeRequest.OrganizationId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !user.EmailVerified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	recipient := otp.Recipient{
+		UserId:         user.Id,
+		OrganizationId: user.OrganizationId,
+		Email:          user.Email,
+	}
+	if method == models.EmailLoginCode {
+		return s.otpService.SendCode(ctx, otp.ChannelEmail, sessionDataKey, recipient, authorizeRequest.OrganizationName)
+	}
+	link := func(token string) string {
+		return notification.GetLink(s.cfg, authorizeRequest.OrganizationName, "/login/email/link", token)
+	}
+	return s.otpService.SendMagicLink(ctx, sessionDataKey, recipient, authorizeRequest.OrganizationName, link)
+}
+
+func (s *authnService) VerifyEmailCode(ctx context.Context, sessionDataKey, code string) (models.AuthenticatedUser, error) {
+	recipient, err := s.otpService.VerifyCode(ctx, otp.ChannelEmail, sessionDataKey, code)
+	if err != nil {
+		return models.AuthenticatedUser{}, err
+	}
+	return s.getAuthenticatedUser(ctx, recipient.UserId, recipient.OrganizationId)
+}
+
+// VerifyMagicLink uses up the link and returns its login and user.
+func (s *authnService) VerifyMagicLink(ctx context.Context, token string) (string, models.AuthenticatedUser, error) {
+	sessionDataKey, recipient, err := s.otpService.VerifyMagicLink(ctx, token)
+	if err != nil {
+		return "", models.AuthenticatedUser{}, err
+	}
+	authenticatedUser, err := s.getAuthenticatedUser(ctx, recipient.UserId, recipient.OrganizationId)
+	if err != nil {
+		return "", models.AuthenticatedUser{}, err
+	}
+	return sessionDataKey, authenticatedUser, nil
+}
+
+func (s *authnService) GetEmailLoginForm(ctx context.Context, sessionDataKey, organizationName, email, errorMessage string) templ.Component {
+	return screens.EmailLoginForm(sessionDataKey, organizationName, email, errorMessage)
+}
+
+func (s *authnService) GetEmailCodeForm(ctx context.Context, sessionDataKey, organizationName, email, errorMessage string) templ.Component {
+	return screens.EmailCodeForm(sessionDataKey, organizationName, email, errorMessage)
+}
+
+// GetMagicLinkSessionDataKey returns the login the link was sent for without using it up.
+func (s *authnService) GetMagicLinkSessionDataKey(ctx context.Context, token string) (string, error) {
+	return s.otpService.GetMagicLinkKey(ctx, token)
+}
+
+func (s *authnService) GetMagicLinkSent(ctx context.Context, email string) templ.Component {
+	return screens.MagicLinkSent(email)
+}
+
+func (s *authnService) GetMagicLinkOtherBrowser(ctx context.Context) templ.Component {
+	return screens.MagicLinkOtherBrowser()
+}
+
+func (s *authnService) GetMagicLinkConfirmPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component {
+	return screens.MagicLinkConfirmPage(organizationName, token, csrfToken)
+}
+
+func (s *authnService) GetLoginStepPage(ctx context.Context, step templ.Component, csrfToken string) templ.Component {
+	return screens.LoginStepPage(step, csrfToken)
+}
+
+func (s *authnService) GetLoginError(ctx context.Context, message string) templ.Component {
+	return screens.LoginError(message)
+}
+
+func passkeyLoginCeremonyKey(sessionDataKey string) string {
+	return "login_" + sessionDataKey
+}
+
+func passkeyRegistrationCeremonyKey(sessionId string) string {
+	return "registration_" + sessionId
+}
+
+func (s *authnService) GetFrontchannelLogoutPage(ctx context.Context, frontchannelLogoutUris []string, redirectURL string) templ.Component {
+	return screens.FrontchannelLogoutPage(frontchannelLogoutUris, redirectURL)
+}
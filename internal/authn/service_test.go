@@ -0,0 +1,31 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+type failingSessionStore struct {
+	session.SessionStore
+}
+
+func (failingSessionStore) AddClientToSession(sessionID, clientID string) error {
+	return errors.New("database is unavailable")
+}
+
+func TestCreateSessionFailsWhenClientIsNotRecorded(t *testing.T) {
+	s, _ := newTestFlowService(models.AuthenticationSequence{})
+	sessionStore := session.NewInMemorySessionStore()
+	s.SessionStore = failingSessionStore{sessionStore}
+	sessionID, _ := sessionStore.CreateSession(session.SessionInfo{UserID: testPendingUser.Id, OrganizationId: testPendingUser.OrganizationId}, time.Minute)
+	login := newTestLogin()
+	login.AuthenticatedUser = testPendingUser
+	if _, err := s.CreateSession(context.Background(), sessionID, login, []string{"pwd"}, session.Device{}); err == nil {
+		t.Error("Expected the login to fail when the client can't join the session")
+	}
+}
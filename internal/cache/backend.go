@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Backend stores encoded cache entries. Implementations may be local to the instance or shared
+// between instances.
+type Backend interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	// SetNX sets the key only when it is not set yet and reports whether it did.
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr atomically increments the counter at the key and returns its new value. A new counter
+	// expires ttl after its first increment.
+	Incr(key string, ttl time.Duration) (int64, error)
+	Delete(keys ...string) error
+	Close() error
+}
+
+// Invalidator is implemented by backends shared between instances, so an instance can tell the
+// others to drop their local copies of a key.
+type Invalidator interface {
+	PublishInvalidation(key string) error
+	// SubscribeInvalidations calls onInvalidate with every key another instance invalidated, and
+	// onReset when invalidations may have been missed, such as after a reconnect.
+	SubscribeInvalidations(onInvalidate func(key string), onReset func())
+}
+
+type memoryBackend struct {
+	c  *cache.Cache
+	mu sync.Mutex
+}
+
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		c: cache.New(cache.NoExpiration, 10*time.Minute),
+	}
+}
+
+func (b *memoryBackend) Get(key string) ([]byte, bool, error) {
+	value, found := b.c.Get(key)
+	if !found {
+		return nil, false, nil
+	}
+	return value.([]byte), true, nil
+}
+
+func (b *memoryBackend) Set(key string, value []byte, ttl time.Duration) error {
+	b.c.Set(key, value, ttl)
+	return nil
+}
+
+func (b *memoryBackend) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return b.c.Add(key, value, ttl) == nil, nil
+}
+
+func (b *memoryBackend) Incr(key string, ttl time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := int64(1)
+	expiresAt := time.Now().Add(ttl)
+	if value, expiration, found := b.c.GetWithExpiration(key); found {
+		current, err := strconv.ParseInt(string(value.([]byte)), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		count = current + 1
+		expiresAt = expiration
+	}
+	b.c.Set(key, []byte(strconv.FormatInt(count, 10)), time.Until(expiresAt))
+	return count, nil
+}
+
+func (b *memoryBackend) Delete(keys ...string) error {
+	for _, key := range keys {
+		b.c.Delete(key)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
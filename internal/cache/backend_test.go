@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func testIncr(t *testing.T, backend Backend) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := backend.Incr("test-counter", time.Minute); err != nil {
+				t.Errorf("failed to increment: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count, err := backend.Incr("test-counter", time.Minute); err != nil || count != 11 {
+		t.Errorf("Expected every increment to count, got %d %v", count, err)
+	}
+	if _, err := backend.Incr("test-expiring-counter", 50*time.Millisecond); err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if count, err := backend.Incr("test-expiring-counter", time.Minute); err != nil || count != 1 {
+		t.Errorf("Expected the counter to start over once expired, got %d %v", count, err)
+	}
+}
+
+func TestMemoryBackendIncr(t *testing.T) {
+	testIncr(t, NewMemoryBackend())
+}
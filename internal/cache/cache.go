@@ -1,10 +1,10 @@
 package cache
 
 import (
+	"log"
 	"time"
 
 	"github.com/patrickmn/go-cache"
-	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
 	org_models "github.com/shashimalcse/tiny-is/internal/organization/models"
 )
 
@@ -13,13 +13,9 @@ var (
 	organization_id_cache_prefix   = "organization_id_"
 )
 
+const organizationTTL = 5 * time.Minute
+
 type CacheService interface {
-	AddOAuth2AuthorizeContextToCacheBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext)
-	GetOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool)
-	DeleteOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey string)
-	AddOAuth2AuthorizeContextToCacheByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext)
-	GetOAuth2AuthorizeContextFromCacheByAuthCode(code string) (models.OAuth2AuthorizeContext, bool)
-	DeleteOAuth2AuthorizeContextFromCacheByAuthCode(code string)
 	GetOrganizationByName(name string) (org_models.Organization, bool)
 	GetOrganizationById(id string) (org_models.Organization, bool)
 	SetOrganization(organization org_models.Organization)
@@ -28,73 +24,108 @@ type CacheService interface {
 }
 
 type cacheService struct {
-	c *cache.Cache
+	backend Backend
+	// local keeps short lived decoded copies of the entries of a shared backend. Other instances
+	// invalidate them through the backend.
+	local *cache.Cache
 }
 
 func NewCacheService() CacheService {
-	c := cache.New(5*time.Minute, 10*time.Minute)
-	return &cacheService{
-		c: c,
-	}
-}
-
-func (s *cacheService) AddOAuth2AuthorizeContextToCacheBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext) {
-	s.c.Set(sessionDataKey, authorizeContext, cache.NoExpiration)
+	return NewCacheServiceWithBackend(NewMemoryBackend(), 0)
 }
 
-func (s *cacheService) GetOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool) {
-	authorizeContext, found := s.c.Get(sessionDataKey)
-	if !found {
-		return models.OAuth2AuthorizeContext{}, false
+// NewCacheServiceWithBackend returns a cache service that keeps its entries in the backend. When the
+// backend is shared between instances, each instance also keeps local copies for localTTL.
+func NewCacheServiceWithBackend(backend Backend, localTTL time.Duration) CacheService {
+	s := &cacheService{
+		backend: backend,
+	}
+	if invalidator, ok := backend.(Invalidator); ok && localTTL > 0 {
+		s.local = cache.New(localTTL, 2*localTTL)
+		invalidator.SubscribeInvalidations(s.local.Delete, s.local.Flush)
 	}
-	return authorizeContext.(models.OAuth2AuthorizeContext), true
+	return s
 }
 
-func (s *cacheService) DeleteOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey string) {
-	s.c.Delete(sessionDataKey)
+func (s *cacheService) GetOrganizationByName(name string) (org_models.Organization, bool) {
+	return get[org_models.Organization](s, organization_name_cache_prefix+name)
 }
 
-func (s *cacheService) AddOAuth2AuthorizeContextToCacheByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext) {
-	s.c.Set(code, authorizeContext, cache.DefaultExpiration)
+func (s *cacheService) GetOrganizationById(id string) (org_models.Organization, bool) {
+	return get[org_models.Organization](s, organization_id_cache_prefix+id)
 }
 
-func (s *cacheService) GetOAuth2AuthorizeContextFromCacheByAuthCode(code string) (models.OAuth2AuthorizeContext, bool) {
-	authorizeContext, found := s.c.Get(code)
-	if !found || authorizeContext == nil {
-		return models.OAuth2AuthorizeContext{}, false
-	}
-	return authorizeContext.(models.OAuth2AuthorizeContext), true
+func (s *cacheService) SetOrganization(organization org_models.Organization) {
+	set(s, organization_name_cache_prefix+organization.Name, organization, organizationTTL)
+	set(s, organization_id_cache_prefix+organization.Id, organization, organizationTTL)
 }
 
-func (s *cacheService) DeleteOAuth2AuthorizeContextFromCacheByAuthCode(code string) {
-	s.c.Delete(code)
+func (s *cacheService) DeleteOrganizationByName(name string) {
+	s.delete(organization_name_cache_prefix + name)
 }
 
-func (s *cacheService) GetOrganizationByName(name string) (org_models.Organization, bool) {
-	authorizeContext, found := s.c.Get(organization_name_cache_prefix + name)
-	if !found {
-		return org_models.Organization{}, false
-	}
-	return authorizeContext.(org_models.Organization), true
+func (s *cacheService) DeleteOrganizationById(id string) {
+	s.delete(organization_id_cache_prefix + id)
 }
 
-func (s *cacheService) GetOrganizationById(id string) (org_models.Organization, bool) {
-	authorizeContext, found := s.c.Get(organization_id_cache_prefix + id)
+// get reads an entry, treating backend failures as misses so the caller falls back to the source.
+func get[T any](s *cacheService, key string) (T, bool) {
+	var zero T
+	if s.local != nil {
+		if value, found := s.local.Get(key); found {
+			return value.(T), true
+		}
+	}
+	data, found, err := s.backend.Get(key)
+	if err != nil {
+		log.Printf("failed to read cache entry %s: %v", key, err)
+		return zero, false
+	}
 	if !found {
-		return org_models.Organization{}, false
+		return zero, false
+	}
+	value, err := Decode[T](data)
+	if err != nil {
+		log.Printf("failed to decode cache entry %s: %v", key, err)
+		return zero, false
 	}
-	return authorizeContext.(org_models.Organization), true
+	if s.local != nil {
+		s.local.SetDefault(key, value)
+	}
+	return value, true
 }
 
-func (s *cacheService) SetOrganization(organization org_models.Organization) {
-	s.c.Set(organization_name_cache_prefix+organization.Name, organization, cache.DefaultExpiration)
-	s.c.Set(organization_id_cache_prefix+organization.Id, organization, cache.DefaultExpiration)
+func set[T any](s *cacheService, key string, value T, ttl time.Duration) {
+	data, err := Encode(value)
+	if err != nil {
+		log.Printf("failed to encode cache entry %s: %v", key, err)
+		return
+	}
+	if err := s.backend.Set(key, data, ttl); err != nil {
+		log.Printf("failed to write cache entry %s: %v", key, err)
+		return
+	}
+	if s.local != nil {
+		s.local.SetDefault(key, value)
+	}
+	// the other instances may still hold a local copy of the previous value
+	s.publishInvalidation(key)
 }
 
-func (s *cacheService) DeleteOrganizationByName(name string) {
-	s.c.Delete(organization_name_cache_prefix + name)
+func (s *cacheService) delete(key string) {
+	if s.local != nil {
+		s.local.Delete(key)
+	}
+	if err := s.backend.Delete(key); err != nil {
+		log.Printf("failed to delete cache entry %s: %v", key, err)
+	}
+	s.publishInvalidation(key)
 }
 
-func (s *cacheService) DeleteOrganizationById(id string) {
-	s.c.Delete(organization_id_cache_prefix + id)
+func (s *cacheService) publishInvalidation(key string) {
+	if invalidator, ok := s.backend.(Invalidator); ok {
+		if err := invalidator.PublishInvalidation(key); err != nil {
+			log.Printf("failed to publish cache invalidation %s: %v", key, err)
+		}
+	}
 }
@@ -0,0 +1,15 @@
+package cache
+
+import "encoding/json"
+
+// Encode serializes a value for a backend. Entries are decoded back into their concrete type with
+// Decode, so shared backends never hand out untyped values.
+func Encode(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func Decode[T any](data []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const invalidationChannel = "tiny-is:cache:invalidate"
+
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+type redisBackend struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+	mu       sync.Mutex
+	conn     *redisConn
+	closed   chan struct{}
+	subConn  *redisConn
+	subMu    sync.Mutex
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisBackend returns a backend that talks to a Redis compatible server over RESP. Entries are
+// shared by all instances using the same server, which also carries cache invalidations.
+func NewRedisBackend(address, password string, db int, timeout time.Duration) Backend {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &redisBackend{
+		address:  address,
+		password: password,
+		db:       db,
+		timeout:  timeout,
+		closed:   make(chan struct{}),
+	}
+}
+
+func (b *redisBackend) Get(key string) ([]byte, bool, error) {
+	reply, err := b.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+func (b *redisBackend) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := b.do(setArgs(key, value, ttl)...)
+	return err
+}
+
+func (b *redisBackend) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := b.do(append(setArgs(key, value, ttl), "NX")...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (b *redisBackend) Incr(key string, ttl time.Duration) (int64, error) {
+	// the counter is created with its expiry, as INCR keeps the expiry of an existing key
+	if _, err := b.do(append(setArgs(key, []byte("0"), ttl), "NX")...); err != nil {
+		return 0, err
+	}
+	reply, err := b.do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to INCR: %v", reply)
+	}
+	// the key may have expired between the two commands
+	if count == 1 && ttl > 0 {
+		if _, err := b.do("PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (b *redisBackend) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := b.do(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+func (b *redisBackend) PublishInvalidation(key string) error {
+	_, err := b.do("PUBLISH", invalidationChannel, key)
+	return err
+}
+
+func (b *redisBackend) SubscribeInvalidations(onInvalidate func(key string), onReset func()) {
+	go func() {
+		for {
+			err := b.subscribe(onInvalidate)
+			select {
+			case <-b.closed:
+				return
+			default:
+			}
+			log.Printf("cache invalidation subscription lost: %v", err)
+			onReset()
+			select {
+			case <-b.closed:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+}
+
+func (b *redisBackend) subscribe(onInvalidate func(key string)) error {
+	conn, err := b.dial()
+	if err != nil {
+		return err
+	}
+	b.subMu.Lock()
+	select {
+	case <-b.closed:
+		b.subMu.Unlock()
+		conn.conn.Close()
+		return errors.New("redis backend is closed")
+	default:
+	}
+	b.subConn = conn
+	b.subMu.Unlock()
+	defer conn.conn.Close()
+	if err := conn.write([]string{"SUBSCRIBE", invalidationChannel}); err != nil {
+		return err
+	}
+	for {
+		// subscribed connections only receive pushes, so they are read without a deadline
+		conn.conn.SetReadDeadline(time.Time{})
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		message, ok := reply.([]any)
+		if !ok || len(message) != 3 {
+			continue
+		}
+		if kind, _ := message[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		if key, ok := message[2].([]byte); ok {
+			onInvalidate(string(key))
+		}
+	}
+}
+
+func (b *redisBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.closed:
+		return nil
+	default:
+	}
+	close(b.closed)
+	b.subMu.Lock()
+	if b.subConn != nil {
+		b.subConn.conn.Close()
+	}
+	b.subMu.Unlock()
+	if b.conn != nil {
+		err := b.conn.conn.Close()
+		b.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (b *redisBackend) do(args ...string) (any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.closed:
+		return nil, errors.New("redis backend is closed")
+	default:
+	}
+	if b.conn == nil {
+		conn, err := b.dial()
+		if err != nil {
+			return nil, err
+		}
+		b.conn = conn
+	}
+	reply, err := b.conn.do(b.timeout, args)
+	if err != nil {
+		if _, ok := err.(RedisError); !ok {
+			// the connection is in an unknown state, dial again on the next command
+			b.conn.conn.Close()
+			b.conn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (b *redisBackend) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", b.address, b.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if b.password != "" {
+		if _, err := c.do(b.timeout, []string{"AUTH", b.password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if b.db != 0 {
+		if _, err := c.do(b.timeout, []string{"SELECT", strconv.Itoa(b.db)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func setArgs(key string, value []byte, ttl time.Duration) []string {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	return args
+}
+
+func (c *redisConn) do(timeout time.Duration, args []string) (any, error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.write(args); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) write(args []string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.conn, sb.String())
+	return err
+}
+
+// read parses one RESP reply. Bulk strings are returned as []byte, nil replies as nil and server
+// errors as RedisError.
+func (c *redisConn) read() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:length], nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		elements := make([]any, length)
+		for i := range elements {
+			if elements[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	}
+	return nil, fmt.Errorf("unexpected redis reply: %q", line)
+}
@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	org_models "github.com/shashimalcse/tiny-is/internal/organization/models"
+)
+
+// fakeRedisServer is an in-process stand-in that speaks enough RESP for the redis backend.
+type fakeRedisServer struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	values      map[string]fakeRedisValue
+	subscribers map[string][]net.Conn
+}
+
+type fakeRedisValue struct {
+	data      string
+	expiresAt time.Time
+}
+
+func newFakeRedisServer(t *testing.T) *fakeRedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeRedisServer{
+		listener:    listener,
+		values:      make(map[string]fakeRedisValue),
+		subscribers: make(map[string][]net.Conn),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedisServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readFakeRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.handle(conn, args)
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedisServer) handle(conn net.Conn, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, found := s.values[args[1]]
+		if !found || (!value.expiresAt.IsZero() && time.Now().After(value.expiresAt)) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value.data), value.data)
+	case "SET":
+		value := fakeRedisValue{data: args[2]}
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				value.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				i++
+			case "NX":
+				nx = true
+			}
+		}
+		if existing, found := s.values[args[1]]; nx && found && (existing.expiresAt.IsZero() || time.Now().Before(existing.expiresAt)) {
+			return "$-1\r\n"
+		}
+		s.values[args[1]] = value
+		return "+OK\r\n"
+	case "INCR":
+		value, found := s.values[args[1]]
+		if !found || (!value.expiresAt.IsZero() && time.Now().After(value.expiresAt)) {
+			value = fakeRedisValue{data: "0"}
+		}
+		count, err := strconv.Atoi(value.data)
+		if err != nil {
+			return "-ERR value is not an integer\r\n"
+		}
+		value.data = strconv.Itoa(count + 1)
+		s.values[args[1]] = value
+		return fmt.Sprintf(":%d\r\n", count+1)
+	case "PEXPIRE":
+		value, found := s.values[args[1]]
+		if !found {
+			return ":0\r\n"
+		}
+		ms, _ := strconv.Atoi(args[2])
+		value.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		s.values[args[1]] = value
+		return ":1\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, found := s.values[key]; found {
+				delete(s.values, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "PUBLISH":
+		message := fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+		for _, subscriber := range s.subscribers[args[1]] {
+			io.WriteString(subscriber, message)
+		}
+		return fmt.Sprintf(":%d\r\n", len(s.subscribers[args[1]]))
+	case "SUBSCRIBE":
+		s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+		return fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readFakeRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func (s *fakeRedisServer) subscriberCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers[invalidationChannel])
+}
+
+func newTestRedisBackend(t *testing.T, server *fakeRedisServer) Backend {
+	backend := NewRedisBackend(server.address(), "", 0, time.Second)
+	t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+func TestRedisBackend(t *testing.T) {
+	backend := newTestRedisBackend(t, newFakeRedisServer(t))
+	if err := backend.Set("test-key", []byte("test-value"), time.Minute); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	value, found, err := backend.Get("test-key")
+	if err != nil || !found || string(value) != "test-value" {
+		t.Errorf("Expected to get the value, got %q %v %v", value, found, err)
+	}
+	if set, err := backend.SetNX("test-key", []byte("other-value"), time.Minute); err != nil || set {
+		t.Errorf("Expected SetNX not to overwrite the value, got %v %v", set, err)
+	}
+	if err := backend.Delete("test-key"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, found, _ := backend.Get("test-key"); found {
+		t.Error("Expected not to find the deleted value")
+	}
+	if set, err := backend.SetNX("test-key", []byte("other-value"), time.Minute); err != nil || !set {
+		t.Errorf("Expected SetNX to set the value, got %v %v", set, err)
+	}
+}
+
+func TestRedisBackendReconnects(t *testing.T) {
+	server := newFakeRedisServer(t)
+	backend := NewRedisBackend(server.address(), "", 0, time.Second).(*redisBackend)
+	t.Cleanup(func() { backend.Close() })
+	if err := backend.Set("test-key", []byte("test-value"), time.Minute); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	backend.conn.conn.Close()
+	// the first command fails on the broken connection, the next one dials again
+	backend.Get("test-key")
+	if _, found, err := backend.Get("test-key"); err != nil || !found {
+		t.Errorf("Expected to get the value after reconnecting, got %v %v", found, err)
+	}
+}
+
+func TestCacheServiceCrossInstanceInvalidation(t *testing.T) {
+	server := newFakeRedisServer(t)
+	instance1 := NewCacheServiceWithBackend(newTestRedisBackend(t, server), time.Minute)
+	instance2 := NewCacheServiceWithBackend(newTestRedisBackend(t, server), time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for server.subscriberCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	testOrganization := org_models.Organization{
+		Id:   "test-id",
+		Name: "test-name",
+	}
+	instance1.SetOrganization(testOrganization)
+	organization, found := instance2.GetOrganizationByName(testOrganization.Name)
+	if !found || organization != testOrganization {
+		t.Fatalf("Expected the other instance to find the organization, got %v %v", organization, found)
+	}
+	updatedOrganization := testOrganization
+	updatedOrganization.Id = "updated-test-id"
+	instance1.SetOrganization(updatedOrganization)
+	deadline = time.Now().Add(time.Second)
+	for {
+		if organization, _ := instance2.GetOrganizationByName(testOrganization.Name); organization == updatedOrganization {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the updated organization on the other instance")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	instance1.DeleteOrganizationByName(testOrganization.Name)
+	deadline = time.Now().Add(time.Second)
+	for {
+		if _, found := instance2.GetOrganizationByName(testOrganization.Name); !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the organization to be invalidated on the other instance")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisBackendIncr(t *testing.T) {
+	testIncr(t, newTestRedisBackend(t, newFakeRedisServer(t)))
+}
@@ -3,12 +3,20 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
+	Server struct {
+		Host struct {
+			Name string `yaml:"name"`
+			Port int    `yaml:"port"`
+		} `yaml:"host"`
+	} `yaml:"server"`
 	Database struct {
 		Path string `yaml:"path"`
 	} `yaml:"database"`
@@ -27,10 +35,310 @@ type Config struct {
 			Key  string `yaml:"key"`
 			Cert string `yaml:"cert"`
 		}
+		Cookie struct {
+			Key string `yaml:"key"`
+		} `yaml:"cookie"`
 	} `yaml:"crypto"`
 	Transport struct {
 		Https bool `yaml:"https"`
 	} `yaml:"transport"`
+	Cache struct {
+		Backend  string `yaml:"backend"`
+		LocalTTL int    `yaml:"local_ttl"`
+		Redis    struct {
+			Address  string `yaml:"address"`
+			Password string `yaml:"password"`
+			DB       int    `yaml:"db"`
+			Timeout  int    `yaml:"timeout"`
+		} `yaml:"redis"`
+	} `yaml:"cache"`
+	Session struct {
+		Store           string `yaml:"store"`
+		IdleTimeout     int    `yaml:"idle_timeout"`
+		AbsoluteTimeout int    `yaml:"absolute_timeout"`
+		MaxSessions     int    `yaml:"max_sessions"`
+		LimitAction     string `yaml:"session_limit_action"`
+		SweepInterval   int    `yaml:"sweep_interval"`
+	} `yaml:"session"`
+	MFA struct {
+		Mode string `yaml:"mode"`
+	} `yaml:"mfa"`
+	PasswordPolicy struct {
+		MinLength           int      `yaml:"min_length"`
+		RequireUppercase    bool     `yaml:"require_uppercase"`
+		RequireLowercase    bool     `yaml:"require_lowercase"`
+		RequireDigit        bool     `yaml:"require_digit"`
+		RequireSymbol       bool     `yaml:"require_symbol"`
+		BannedWords         []string `yaml:"banned_words"`
+		HistoryCount        int      `yaml:"history_count"`
+		MaxAge              int      `yaml:"max_age"`
+		RejectBreached      bool     `yaml:"reject_breached"`
+		BreachedLoginAction string   `yaml:"breached_login_action"`
+	} `yaml:"password_policy"`
+	PasswordHashing struct {
+		Algorithm string `yaml:"algorithm"`
+		Bcrypt    struct {
+			Cost int `yaml:"cost"`
+		} `yaml:"bcrypt"`
+		Argon2id struct {
+			Memory      int `yaml:"memory"`
+			Iterations  int `yaml:"iterations"`
+			Parallelism int `yaml:"parallelism"`
+		} `yaml:"argon2id"`
+		Scrypt struct {
+			N int `yaml:"n"`
+			R int `yaml:"r"`
+			P int `yaml:"p"`
+		} `yaml:"scrypt"`
+	} `yaml:"password_hashing"`
+	BreachedPasswords struct {
+		File     string `yaml:"file"`
+		MinCount int    `yaml:"min_count"`
+	} `yaml:"breached_passwords"`
+	Lockout struct {
+		MaxFailedAttempts      int `yaml:"max_failed_attempts"`
+		LockoutDuration        int `yaml:"lockout_duration"`
+		MaxLockouts            int `yaml:"max_lockouts"`
+		ProgressiveDelay       int `yaml:"progressive_delay"`
+		MaxDelay               int `yaml:"max_delay"`
+		MaxFailedAttemptsPerIP int `yaml:"max_failed_attempts_per_ip"`
+		IPWindow               int `yaml:"ip_window"`
+	} `yaml:"lockout"`
+	Risk struct {
+		Mode                    string  `yaml:"mode"`
+		GeoIPFile               string  `yaml:"geoip_file"`
+		IPReputationFile        string  `yaml:"ip_reputation_file"`
+		MaxTravelSpeed          float64 `yaml:"max_travel_speed"`
+		FailedAttemptsWindow    int     `yaml:"failed_attempts_window"`
+		FailedAttemptsThreshold int     `yaml:"failed_attempts_threshold"`
+		DeviceCookieMaxAge      int     `yaml:"device_cookie_max_age"`
+		LoginEventRetention     int     `yaml:"login_event_retention"`
+		SweepInterval           int     `yaml:"sweep_interval"`
+	} `yaml:"risk"`
+	WebAuthn struct {
+		RPID    string   `yaml:"rp_id"`
+		RPName  string   `yaml:"rp_name"`
+		Origins []string `yaml:"origins"`
+		Timeout int      `yaml:"timeout"`
+	} `yaml:"webauthn"`
+	OTP struct {
+		Timeout        int `yaml:"timeout"`
+		LinkTimeout    int `yaml:"link_timeout"`
+		ResendInterval int `yaml:"resend_interval"`
+	} `yaml:"otp"`
+	PasswordReset struct {
+		LinkTimeout int `yaml:"link_timeout"`
+	} `yaml:"password_reset"`
+	Registration struct {
+		Enabled               bool     `yaml:"enabled"`
+		RequiredAttributes    []string `yaml:"required_attributes"`
+		RequireChallenge      bool     `yaml:"require_challenge"`
+		LinkTimeout           int      `yaml:"link_timeout"`
+		ProofOfWorkDifficulty int      `yaml:"proof_of_work_difficulty"`
+	} `yaml:"registration"`
+	Notification struct {
+		Email struct {
+			Sender string `yaml:"sender"`
+			From   string `yaml:"from"`
+			File   string `yaml:"file"`
+			SMTP   struct {
+				Host     string `yaml:"host"`
+				Port     int    `yaml:"port"`
+				Username string `yaml:"username"`
+				Password string `yaml:"password"`
+			} `yaml:"smtp"`
+		} `yaml:"email"`
+		SMS struct {
+			Provider string `yaml:"provider"`
+			Webhook  struct {
+				URL     string `yaml:"url"`
+				Token   string `yaml:"token"`
+				Timeout int    `yaml:"timeout"`
+			} `yaml:"webhook"`
+		} `yaml:"sms"`
+	} `yaml:"notification"`
+	OAuth2 struct {
+		Store                string `yaml:"store"`
+		AuthorizationCodeTTL int    `yaml:"authorization_code_ttl"`
+		SessionDataKeyTTL    int    `yaml:"session_data_key_ttl"`
+		SweepInterval        int    `yaml:"sweep_interval"`
+	} `yaml:"oauth2"`
+	Logout struct {
+		Backchannel struct {
+			MaxAttempts   int `yaml:"max_attempts"`
+			RetryInterval int `yaml:"retry_interval"`
+			Timeout       int `yaml:"timeout"`
+		} `yaml:"backchannel"`
+	} `yaml:"logout"`
+}
+
+// GetServerURL returns the public base url of the server, used when there is no request to derive it from.
+func (c *Config) GetServerURL() string {
+	scheme := "http"
+	if c.Transport.Https {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.Server.Host.Name, c.Server.Host.Port)
+}
+
+// GetAuthorizationCodeTTL returns how long an authorization code can be redeemed.
+func (c *Config) GetAuthorizationCodeTTL() time.Duration {
+	if c.OAuth2.AuthorizationCodeTTL <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.OAuth2.AuthorizationCodeTTL) * time.Second
+}
+
+// GetSessionDataKeyTTL returns how long the user has to finish an authorization request.
+func (c *Config) GetSessionDataKeyTTL() time.Duration {
+	if c.OAuth2.SessionDataKeyTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.OAuth2.SessionDataKeyTTL) * time.Second
+}
+
+// GetSessionIdleTimeout returns how long an SSO session can go unused, zero keeps it alive until it
+// expires.
+func (c *Config) GetSessionIdleTimeout() time.Duration {
+	if c.Session.IdleTimeout <= 0 {
+		return 0
+	}
+	return time.Duration(c.Session.IdleTimeout) * time.Second
+}
+
+// GetSessionAbsoluteTimeout returns how long an SSO session lasts after the user signed in.
+func (c *Config) GetSessionAbsoluteTimeout() time.Duration {
+	if c.Session.AbsoluteTimeout <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.Session.AbsoluteTimeout) * time.Second
+}
+
+// GetWebAuthnRPID returns the relying party id passkeys are bound to, the host name of the server
+// unless configured.
+func (c *Config) GetWebAuthnRPID() string {
+	if c.WebAuthn.RPID == "" {
+		return c.Server.Host.Name
+	}
+	return c.WebAuthn.RPID
+}
+
+// GetWebAuthnOrigins returns the origins the browser may run passkey ceremonies on.
+func (c *Config) GetWebAuthnOrigins() []string {
+	if len(c.WebAuthn.Origins) == 0 {
+		return []string{c.GetServerURL()}
+	}
+	return c.WebAuthn.Origins
+}
+
+// GetWebAuthnTimeout returns how long the user has to complete a passkey ceremony.
+func (c *Config) GetWebAuthnTimeout() time.Duration {
+	if c.WebAuthn.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.WebAuthn.Timeout) * time.Second
+}
+
+// GetOTPTimeout returns how long a one-time code sent to the user can be used.
+func (c *Config) GetOTPTimeout() time.Duration {
+	if c.OTP.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.OTP.Timeout) * time.Second
+}
+
+// GetMagicLinkTimeout returns how long a sign in link sent to the user can be used.
+func (c *Config) GetMagicLinkTimeout() time.Duration {
+	if c.OTP.LinkTimeout <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.OTP.LinkTimeout) * time.Second
+}
+
+// GetPasswordResetLinkTimeout returns how long a password reset link sent to the user can be used.
+func (c *Config) GetPasswordResetLinkTimeout() time.Duration {
+	if c.PasswordReset.LinkTimeout <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.PasswordReset.LinkTimeout) * time.Second
+}
+
+// GetRegistrationLinkTimeout returns how long the link that verifies the email address of someone
+// who signed up can be used.
+func (c *Config) GetRegistrationLinkTimeout() time.Duration {
+	if c.Registration.LinkTimeout <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.Registration.LinkTimeout) * time.Second
+}
+
+// GetProofOfWorkDifficulty returns how many leading zero bits the hash of a solved proof of work
+// challenge has.
+func (c *Config) GetProofOfWorkDifficulty() int {
+	if c.Registration.ProofOfWorkDifficulty <= 0 {
+		return 16
+	}
+	return c.Registration.ProofOfWorkDifficulty
+}
+
+// GetOTPResendInterval returns how long the user has to wait before another code or link is sent.
+func (c *Config) GetOTPResendInterval() time.Duration {
+	if c.OTP.ResendInterval < 0 {
+		return 0
+	}
+	if c.OTP.ResendInterval == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.OTP.ResendInterval) * time.Second
+}
+
+// GetRiskMaxTravelSpeed returns the speed, in kilometres per hour, above which travelling between
+// the locations of two logins is scored as impossible.
+func (c *Config) GetRiskMaxTravelSpeed() float64 {
+	if c.Risk.MaxTravelSpeed <= 0 {
+		return 1000
+	}
+	return c.Risk.MaxTravelSpeed
+}
+
+// GetRiskFailedAttemptsWindow returns how far back failed attempts count towards the risk of a login.
+func (c *Config) GetRiskFailedAttemptsWindow() time.Duration {
+	if c.Risk.FailedAttemptsWindow <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Risk.FailedAttemptsWindow) * time.Second
+}
+
+// GetRiskFailedAttemptsThreshold returns how many recent failed attempts make a login risky.
+func (c *Config) GetRiskFailedAttemptsThreshold() int {
+	if c.Risk.FailedAttemptsThreshold <= 0 {
+		return 3
+	}
+	return c.Risk.FailedAttemptsThreshold
+}
+
+// GetRiskDeviceCookieMaxAge returns how long a browser is remembered as a known device.
+func (c *Config) GetRiskDeviceCookieMaxAge() time.Duration {
+	if c.Risk.DeviceCookieMaxAge <= 0 {
+		return 365 * 24 * time.Hour
+	}
+	return time.Duration(c.Risk.DeviceCookieMaxAge) * time.Second
+}
+
+// GetRiskLoginEventRetention returns how long login events are kept.
+func (c *Config) GetRiskLoginEventRetention() time.Duration {
+	if c.Risk.LoginEventRetention <= 0 {
+		return 90 * 24 * time.Hour
+	}
+	return time.Duration(c.Risk.LoginEventRetention) * time.Second
+}
+
+// GetEmailFrom returns the sender address of the emails the server sends.
+func (c *Config) GetEmailFrom() string {
+	if c.Notification.Email.From == "" {
+		return "tiny-is <no-reply@" + c.Server.Host.Name + ">"
+	}
+	return c.Notification.Email.From
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -46,3 +354,12 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 	return config, nil
 }
+
+// GetBreachedPasswordsMinCount returns how many times a password has to have been seen in breaches
+// to count as breached.
+func (c *Config) GetBreachedPasswordsMinCount() int {
+	if c.BreachedPasswords.MinCount <= 0 {
+		return 1
+	}
+	return c.BreachedPasswords.MinCount
+}
@@ -0,0 +1,62 @@
+package logout
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/shashimalcse/tiny-is/internal/application"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+type BackchannelLogoutService interface {
+	NotifySessionEnded(sessionInfo session.SessionInfo)
+}
+
+type backchannelLogoutService struct {
+	applicationService application.ApplicationService
+	tokenService       token.TokenService
+	worker             *DeliveryWorker
+}
+
+func NewBackchannelLogoutService(applicationService application.ApplicationService, tokenService token.TokenService, worker *DeliveryWorker) BackchannelLogoutService {
+	return &backchannelLogoutService{
+		applicationService: applicationService,
+		tokenService:       tokenService,
+		worker:             worker,
+	}
+}
+
+// NotifySessionEnded sends a logout token to every client of the session that registered a
+// back-channel logout uri. It is safe to use as a session.SessionEndListener.
+func (s *backchannelLogoutService) NotifySessionEnded(sessionInfo session.SessionInfo) {
+	go func() {
+		err := s.notify(context.Background(), sessionInfo)
+		if err != nil {
+			log.Printf("Failed to send back-channel logout for session %s: %v", sessionInfo.SessionId, err)
+		}
+	}()
+}
+
+func (s *backchannelLogoutService) notify(ctx context.Context, sessionInfo session.SessionInfo) error {
+	if sessionInfo.Issuer == "" {
+		return errors.New("the session has no issuer")
+	}
+	for _, clientId := range sessionInfo.ClientIDs {
+		application, err := s.applicationService.GetApplicationByClientId(ctx, clientId, sessionInfo.OrganizationId)
+		if err != nil {
+			log.Printf("Failed to get application %s for back-channel logout: %v", clientId, err)
+			continue
+		}
+		if application.BackchannelLogoutUri == "" {
+			continue
+		}
+		logoutToken, err := s.tokenService.GenerateLogoutToken(ctx, sessionInfo.Issuer, clientId, sessionInfo.UserID, sessionInfo.SessionId)
+		if err != nil {
+			return err
+		}
+		s.worker.Enqueue(application.BackchannelLogoutUri, logoutToken)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package logout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/application"
+	"github.com/shashimalcse/tiny-is/internal/application/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+type testApplicationService struct {
+	application.ApplicationService
+	backchannelLogoutUri string
+}
+
+func (s testApplicationService) GetApplicationByClientId(ctx context.Context, clientId, orgId string) (models.Application, error) {
+	return models.Application{ClientId: clientId, BackchannelLogoutUri: s.backchannelLogoutUri}, nil
+}
+
+type testTokenService struct {
+	token.TokenService
+}
+
+func (testTokenService) GenerateLogoutToken(ctx context.Context, issuer, clientId, sub, sid string) (string, error) {
+	return issuer + " " + clientId + " " + sid, nil
+}
+
+func TestBackchannelLogoutUsesIssuerOfSession(t *testing.T) {
+	var received atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.FormValue("logout_token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	worker, results := newTestDeliveryWorker(1)
+	defer worker.Stop()
+	s := NewBackchannelLogoutService(testApplicationService{backchannelLogoutUri: server.URL}, testTokenService{}, worker).(*backchannelLogoutService)
+
+	sessionInfo := session.SessionInfo{
+		SessionId:      "test-session-id",
+		UserID:         "test-user-id",
+		OrganizationId: "test-organization-id",
+		Issuer:         "https://login.example.com/o/test",
+		ClientIDs:      []string{"test-client-id"},
+	}
+	if err := s.notify(context.Background(), sessionInfo); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if !waitForDelivery(t, results) {
+		t.Fatal("Expected the logout token to be delivered")
+	}
+	if logoutToken := received.Load(); logoutToken != "https://login.example.com/o/test test-client-id test-session-id" {
+		t.Errorf("Expected the logout token of the session issuer, got %v", logoutToken)
+	}
+}
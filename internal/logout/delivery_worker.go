@@ -0,0 +1,115 @@
+package logout
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type deliveryJob struct {
+	uri         string
+	logoutToken string
+	attempt     int
+}
+
+// DeliveryWorker posts logout tokens to back-channel logout uris, retrying failed deliveries
+// with an exponential backoff until maxAttempts is reached.
+type DeliveryWorker struct {
+	client        *http.Client
+	maxAttempts   int
+	retryInterval time.Duration
+	jobs          chan deliveryJob
+	quit          chan struct{}
+	wg            sync.WaitGroup
+	// OnDelivered is called after a delivery succeeded or was given up, mainly for tests.
+	OnDelivered func(uri string, delivered bool)
+}
+
+func NewDeliveryWorker(client *http.Client, maxAttempts int, retryInterval time.Duration) *DeliveryWorker {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &DeliveryWorker{
+		client:        client,
+		maxAttempts:   maxAttempts,
+		retryInterval: retryInterval,
+		jobs:          make(chan deliveryJob, 100),
+		quit:          make(chan struct{}),
+	}
+}
+
+func (w *DeliveryWorker) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case job := <-w.jobs:
+				w.deliver(job)
+			case <-w.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (w *DeliveryWorker) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+func (w *DeliveryWorker) Enqueue(uri, logoutToken string) {
+	w.schedule(deliveryJob{uri: uri, logoutToken: logoutToken})
+}
+
+func (w *DeliveryWorker) schedule(job deliveryJob) {
+	select {
+	case w.jobs <- job:
+	case <-w.quit:
+	}
+}
+
+func (w *DeliveryWorker) deliver(job deliveryJob) {
+	job.attempt++
+	err := w.post(job)
+	if err == nil {
+		w.delivered(job.uri, true)
+		return
+	}
+	if job.attempt >= w.maxAttempts {
+		log.Printf("Giving up back-channel logout delivery to %s after %d attempts: %v", job.uri, job.attempt, err)
+		w.delivered(job.uri, false)
+		return
+	}
+	backoff := w.retryInterval * time.Duration(1<<(job.attempt-1))
+	time.AfterFunc(backoff, func() { w.schedule(job) })
+}
+
+func (w *DeliveryWorker) post(job deliveryJob) error {
+	form := url.Values{}
+	form.Set("logout_token", job.logoutToken)
+	req, err := http.NewRequest(http.MethodPost, job.uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *DeliveryWorker) delivered(uri string, delivered bool) {
+	if w.OnDelivered != nil {
+		w.OnDelivered(uri, delivered)
+	}
+}
@@ -0,0 +1,89 @@
+package logout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestDeliveryWorker(maxAttempts int) (*DeliveryWorker, chan bool) {
+	worker := NewDeliveryWorker(&http.Client{Timeout: time.Second}, maxAttempts, 10*time.Millisecond)
+	results := make(chan bool, 1)
+	worker.OnDelivered = func(uri string, delivered bool) {
+		results <- delivered
+	}
+	worker.Start()
+	return worker, results
+}
+
+func waitForDelivery(t *testing.T, results chan bool) bool {
+	select {
+	case delivered := <-results:
+		return delivered
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the delivery")
+	}
+	return false
+}
+
+func TestDeliveryWorkerPostsLogoutToken(t *testing.T) {
+	var received atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.FormValue("logout_token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	worker, results := newTestDeliveryWorker(3)
+	defer worker.Stop()
+
+	worker.Enqueue(server.URL, "test-logout-token")
+	if !waitForDelivery(t, results) {
+		t.Fatal("Expected the logout token to be delivered")
+	}
+	if received.Load() != "test-logout-token" {
+		t.Errorf("Expected the logout token to be posted, got %v", received.Load())
+	}
+}
+
+func TestDeliveryWorkerRetriesFailedDelivery(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	worker, results := newTestDeliveryWorker(5)
+	defer worker.Stop()
+
+	worker.Enqueue(server.URL, "test-logout-token")
+	if !waitForDelivery(t, results) {
+		t.Fatal("Expected the logout token to be delivered")
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestDeliveryWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	worker, results := newTestDeliveryWorker(2)
+	defer worker.Stop()
+
+	worker.Enqueue(server.URL, "test-logout-token")
+	if waitForDelivery(t, results) {
+		t.Fatal("Expected the delivery to be given up")
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts.Load())
+	}
+}
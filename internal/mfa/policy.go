@@ -0,0 +1,98 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// MFAModeOptional asks for a second factor only from users who enrolled one.
+	MFAModeOptional = "optional"
+	// MFAModeRequired asks every user for a second factor.
+	MFAModeRequired = "required"
+	// MFAModePerApplication asks every user for a second factor when they sign in to one of the
+	// applications of the policy, and behaves like MFAModeOptional for the others.
+	MFAModePerApplication = "per_application"
+)
+
+// MFAPolicy controls when the users of an organization must use a second factor.
+type MFAPolicy struct {
+	OrganizationId string
+	Mode           string
+	// ClientIds are the applications that require a second factor in MFAModePerApplication.
+	ClientIds []string
+}
+
+func (p MFAPolicy) Validate() error {
+	if p.Mode != MFAModeOptional && p.Mode != MFAModeRequired && p.Mode != MFAModePerApplication {
+		return errors.New("mode must be optional, required or per_application")
+	}
+	return nil
+}
+
+// IsRequired reports whether signing in to the client needs a second factor even from users who
+// have not enrolled one.
+func (p MFAPolicy) IsRequired(clientId string) bool {
+	switch p.Mode {
+	case MFAModeRequired:
+		return true
+	case MFAModePerApplication:
+		return slices.Contains(p.ClientIds, clientId)
+	}
+	return false
+}
+
+type MFAPolicyRepository interface {
+	GetMFAPolicy(ctx context.Context, orgId string) (MFAPolicy, bool, error)
+	SaveMFAPolicy(ctx context.Context, policy MFAPolicy) error
+}
+
+type mfaPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewMFAPolicyRepository(db *sqlx.DB) MFAPolicyRepository {
+	return &mfaPolicyRepository{
+		db: db,
+	}
+}
+
+func (r *mfaPolicyRepository) GetMFAPolicy(ctx context.Context, orgId string) (MFAPolicy, bool, error) {
+	var row struct {
+		OrganizationId string         `db:"organization_id"`
+		Mode           string         `db:"mode"`
+		ClientIds      sql.NullString `db:"client_ids"`
+	}
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, mode, client_ids FROM mfa_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return MFAPolicy{}, false, nil
+		}
+		return MFAPolicy{}, false, err
+	}
+	policy := MFAPolicy{
+		OrganizationId: row.OrganizationId,
+		Mode:           row.Mode,
+	}
+	if row.ClientIds.Valid && row.ClientIds.String != "" {
+		if err := json.Unmarshal([]byte(row.ClientIds.String), &policy.ClientIds); err != nil {
+			return MFAPolicy{}, false, err
+		}
+	}
+	return policy, true, nil
+}
+
+func (r *mfaPolicyRepository) SaveMFAPolicy(ctx context.Context, policy MFAPolicy) error {
+	clientIdsJSON, err := json.Marshal(policy.ClientIds)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO mfa_policy (organization_id, mode, client_ids) VALUES (?, ?, ?) ON CONFLICT (organization_id) DO UPDATE SET mode = excluded.mode, client_ids = excluded.client_ids",
+		policy.OrganizationId, policy.Mode, string(clientIdsJSON))
+	return err
+}
@@ -0,0 +1,129 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TOTPCredential is the TOTP authenticator of a user. It is only used for sign in once the user
+// proved they set it up by entering a code.
+type TOTPCredential struct {
+	UserId         string `db:"user_id"`
+	OrganizationId string `db:"organization_id"`
+	Secret         string `db:"secret"`
+	Confirmed      bool   `db:"confirmed"`
+	// LastUsedStep is the time step of the last accepted code, a code can't be used twice.
+	LastUsedStep int64 `db:"last_used_step"`
+}
+
+type MFARepository interface {
+	GetTOTPCredential(ctx context.Context, userId, orgId string) (TOTPCredential, bool, error)
+	SaveTOTPCredential(ctx context.Context, credential TOTPCredential) error
+	ConfirmTOTPCredential(ctx context.Context, userId, orgId string) error
+	// UseTOTPStep records the step of an accepted code. It returns false when the same or a later
+	// step was already used.
+	UseTOTPStep(ctx context.Context, userId, orgId string, step int64) (bool, error)
+	DeleteTOTPCredential(ctx context.Context, userId, orgId string) error
+	ReplaceRecoveryCodes(ctx context.Context, userId, orgId string, codeHashes []string) error
+	// UseRecoveryCode marks an unused recovery code as used and reports whether there was one.
+	UseRecoveryCode(ctx context.Context, userId, orgId, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userId, orgId string) (int, error)
+}
+
+type mfaRepository struct {
+	db *sqlx.DB
+}
+
+func NewMFARepository(db *sqlx.DB) MFARepository {
+	return &mfaRepository{
+		db: db,
+	}
+}
+
+func (r *mfaRepository) GetTOTPCredential(ctx context.Context, userId, orgId string) (TOTPCredential, bool, error) {
+	var credential TOTPCredential
+	err := r.db.GetContext(ctx, &credential, "SELECT user_id, organization_id, secret, confirmed, last_used_step FROM user_totp WHERE user_id = ? AND organization_id = ?", userId, orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TOTPCredential{}, false, nil
+		}
+		return TOTPCredential{}, false, err
+	}
+	return credential, true, nil
+}
+
+func (r *mfaRepository) SaveTOTPCredential(ctx context.Context, credential TOTPCredential) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO user_totp (user_id, organization_id, secret, confirmed, last_used_step, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, confirmed = excluded.confirmed, last_used_step = excluded.last_used_step, created_at = excluded.created_at",
+		credential.UserId, credential.OrganizationId, credential.Secret, credential.Confirmed, credential.LastUsedStep, time.Now().Unix())
+	return err
+}
+
+func (r *mfaRepository) ConfirmTOTPCredential(ctx context.Context, userId, orgId string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE user_totp SET confirmed = 1 WHERE user_id = ? AND organization_id = ?", userId, orgId)
+	return err
+}
+
+func (r *mfaRepository) UseTOTPStep(ctx context.Context, userId, orgId string, step int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND organization_id = ? AND last_used_step < ?", step, userId, orgId, step)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+func (r *mfaRepository) DeleteTOTPCredential(ctx context.Context, userId, orgId string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ? AND organization_id = ?", userId, orgId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_code WHERE user_id = ? AND organization_id = ?", userId, orgId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userId, orgId string, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_code WHERE user_id = ? AND organization_id = ?", userId, orgId); err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_code (user_id, organization_id, code_hash) VALUES (?, ?, ?)", userId, orgId, codeHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userId, orgId, codeHash string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE user_recovery_code SET used_at = ? WHERE user_id = ? AND organization_id = ? AND code_hash = ? AND used_at IS NULL", time.Now().Unix(), userId, orgId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+func (r *mfaRepository) CountRecoveryCodes(ctx context.Context, userId, orgId string) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM user_recovery_code WHERE user_id = ? AND organization_id = ? AND used_at IS NULL", userId, orgId)
+	return count, err
+}
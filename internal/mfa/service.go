@@ -0,0 +1,321 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+var (
+	ErrTOTPAlreadyEnrolled = errors.New("TOTP is already enrolled")
+	ErrTOTPNotEnrolled     = errors.New("TOTP is not enrolled")
+	ErrInvalidCode         = errors.New("invalid code")
+	ErrTooManyAttempts     = errors.New("too many invalid codes, try again later")
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	maxFailedAttempts         = 5
+	failedAttemptsWindow      = 15 * time.Minute
+	failedAttemptsCachePrefix = "mfa_failed_attempts_"
+)
+
+// Requirement is the second factor step a user has to complete after the first factor.
+type Requirement int
+
+const (
+	RequirementNone Requirement = iota
+	// RequirementVerify asks the user for a code from their enrolled authenticator.
+	RequirementVerify
+	// RequirementEnroll asks the user to set up an authenticator before they can continue.
+	RequirementEnroll
+)
+
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+type TOTPStatus struct {
+	Enrolled               bool
+	RecoveryCodesRemaining int
+}
+
+type MFAService interface {
+	GetRequirement(ctx context.Context, userId, orgId, clientId string) (Requirement, error)
+	GetTOTPStatus(ctx context.Context, userId, orgId string) (TOTPStatus, error)
+	StartTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (TOTPEnrollment, error)
+	GetPendingTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (TOTPEnrollment, bool, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userId, orgId, code string) ([]string, error)
+	VerifyTOTP(ctx context.Context, userId, orgId, code string) (bool, error)
+	RegenerateRecoveryCodes(ctx context.Context, userId, orgId string) ([]string, error)
+	DeleteTOTP(ctx context.Context, userId, orgId string) error
+	// CheckFailedAttempts returns ErrTooManyAttempts while the second factors of the user are
+	// locked after too many invalid codes.
+	CheckFailedAttempts(ctx context.Context, userId, orgId string) error
+	// RecordFailedAttempt counts an invalid code of the user and returns ErrTooManyAttempts when it
+	// locks their second factors. The count is kept per user, so starting the login over doesn't
+	// reset it.
+	RecordFailedAttempt(ctx context.Context, userId, orgId string) error
+	ResetFailedAttempts(ctx context.Context, userId, orgId string) error
+	GetMFAPolicy(ctx context.Context, orgId string) (MFAPolicy, error)
+	UpdateMFAPolicy(ctx context.Context, policy MFAPolicy) error
+}
+
+type mfaService struct {
+	cfg              *config.Config
+	backend          cache.Backend
+	repository       MFARepository
+	policyRepository MFAPolicyRepository
+}
+
+func NewMFAService(cfg *config.Config, backend cache.Backend, repository MFARepository, policyRepository MFAPolicyRepository) MFAService {
+	return &mfaService{
+		cfg:              cfg,
+		backend:          backend,
+		repository:       repository,
+		policyRepository: policyRepository,
+	}
+}
+
+func (s *mfaService) GetRequirement(ctx context.Context, userId, orgId, clientId string) (Requirement, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return RequirementNone, err
+	}
+	if found && credential.Confirmed {
+		return RequirementVerify, nil
+	}
+	policy, err := s.GetMFAPolicy(ctx, orgId)
+	if err != nil {
+		return RequirementNone, err
+	}
+	if policy.IsRequired(clientId) {
+		return RequirementEnroll, nil
+	}
+	return RequirementNone, nil
+}
+
+func (s *mfaService) GetTOTPStatus(ctx context.Context, userId, orgId string) (TOTPStatus, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return TOTPStatus{}, err
+	}
+	if !found || !credential.Confirmed {
+		return TOTPStatus{}, nil
+	}
+	remaining, err := s.repository.CountRecoveryCodes(ctx, userId, orgId)
+	if err != nil {
+		return TOTPStatus{}, err
+	}
+	return TOTPStatus{Enrolled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// StartTOTPEnrollment creates a new secret for the user. The secret replaces any enrollment the
+// user did not finish, and is only used for sign in once ConfirmTOTPEnrollment accepts a code.
+func (s *mfaService) StartTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (TOTPEnrollment, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if found && credential.Confirmed {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnrolled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	err = s.repository.SaveTOTPCredential(ctx, TOTPCredential{
+		UserId:         userId,
+		OrganizationId: orgId,
+		Secret:         secret,
+	})
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: GetTOTPProvisioningURI(issuer, accountName, secret),
+	}, nil
+}
+
+// GetPendingTOTPEnrollment returns the enrollment the user started but has not confirmed yet.
+func (s *mfaService) GetPendingTOTPEnrollment(ctx context.Context, userId, orgId, issuer, accountName string) (TOTPEnrollment, bool, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil || !found || credential.Confirmed {
+		return TOTPEnrollment{}, false, err
+	}
+	return TOTPEnrollment{
+		Secret:          credential.Secret,
+		ProvisioningURI: GetTOTPProvisioningURI(issuer, accountName, credential.Secret),
+	}, true, nil
+}
+
+// ConfirmTOTPEnrollment activates the pending secret of the user when the code matches it, and
+// returns a fresh set of recovery codes.
+func (s *mfaService) ConfirmTOTPEnrollment(ctx context.Context, userId, orgId, code string) ([]string, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if credential.Confirmed {
+		return nil, ErrTOTPAlreadyEnrolled
+	}
+	if ok, err := s.useTOTPCode(ctx, credential, code); err != nil || !ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCode
+	}
+	if err := s.repository.ConfirmTOTPCredential(ctx, userId, orgId); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userId, orgId)
+}
+
+// VerifyTOTP checks a code from the user's authenticator, or one of their recovery codes.
+func (s *mfaService) VerifyTOTP(ctx context.Context, userId, orgId, code string) (bool, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return false, err
+	}
+	if !found || !credential.Confirmed {
+		return false, ErrTOTPNotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.useTOTPCode(ctx, credential, code)
+	}
+	return s.repository.UseRecoveryCode(ctx, userId, orgId, hashRecoveryCode(code))
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userId, orgId string) ([]string, error) {
+	credential, found, err := s.repository.GetTOTPCredential(ctx, userId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if !found || !credential.Confirmed {
+		return nil, ErrTOTPNotEnrolled
+	}
+	return s.replaceRecoveryCodes(ctx, userId, orgId)
+}
+
+func (s *mfaService) DeleteTOTP(ctx context.Context, userId, orgId string) error {
+	return s.repository.DeleteTOTPCredential(ctx, userId, orgId)
+}
+
+func (s *mfaService) CheckFailedAttempts(ctx context.Context, userId, orgId string) error {
+	data, found, err := s.backend.Get(failedAttemptsCachePrefix + orgId + "_" + userId)
+	if err != nil || !found {
+		return err
+	}
+	count, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return err
+	}
+	if count >= maxFailedAttempts {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (s *mfaService) RecordFailedAttempt(ctx context.Context, userId, orgId string) error {
+	count, err := s.backend.Incr(failedAttemptsCachePrefix+orgId+"_"+userId, failedAttemptsWindow)
+	if err != nil {
+		return err
+	}
+	if count >= maxFailedAttempts {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (s *mfaService) ResetFailedAttempts(ctx context.Context, userId, orgId string) error {
+	return s.backend.Delete(failedAttemptsCachePrefix + orgId + "_" + userId)
+}
+
+func (s *mfaService) GetMFAPolicy(ctx context.Context, orgId string) (MFAPolicy, error) {
+	policy, found, err := s.policyRepository.GetMFAPolicy(ctx, orgId)
+	if err != nil {
+		return MFAPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	mode := s.cfg.MFA.Mode
+	if mode == "" {
+		mode = MFAModeOptional
+	}
+	return MFAPolicy{OrganizationId: orgId, Mode: mode}, nil
+}
+
+func (s *mfaService) UpdateMFAPolicy(ctx context.Context, policy MFAPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	return s.policyRepository.SaveMFAPolicy(ctx, policy)
+}
+
+func (s *mfaService) useTOTPCode(ctx context.Context, credential TOTPCredential, code string) (bool, error) {
+	step, ok := ValidateTOTP(credential.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.repository.UseTOTPStep(ctx, credential.UserId, credential.OrganizationId, step)
+}
+
+func (s *mfaService) replaceRecoveryCodes(ctx context.Context, userId, orgId string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		codeHashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.repository.ReplaceRecoveryCodes(ctx, userId, orgId, codeHashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeLength; i++ {
+		if i == recoveryCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// hashRecoveryCode hashes a recovery code the way the user may type it, ignoring case, spaces and
+// the separator.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package mfa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+func newTestMFAService(t *testing.T) MFAService {
+	db := testutil.NewDB(t, "mfa.sql")
+	return NewMFAService(&config.Config{}, cache.NewMemoryBackend(), NewMFARepository(db), NewMFAPolicyRepository(db))
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMFAService(t)
+	enrollment, err := s.StartTOTPEnrollment(ctx, "test-user-id", "test-organization-id", "tiny-is", "alice")
+	if err != nil {
+		t.Fatalf("Failed to start enrollment: %v", err)
+	}
+	if requirement, _ := s.GetRequirement(ctx, "test-user-id", "test-organization-id", "test-client-id"); requirement != RequirementNone {
+		t.Errorf("Expected an unconfirmed enrollment not to be required, got %v", requirement)
+	}
+	if _, err := s.ConfirmTOTPEnrollment(ctx, "test-user-id", "test-organization-id", "000000"); err != ErrInvalidCode {
+		t.Errorf("Expected an invalid code error, got %v", err)
+	}
+	code, _ := GenerateTOTP(enrollment.Secret, TOTPStep(time.Now()))
+	recoveryCodes, err := s.ConfirmTOTPEnrollment(ctx, "test-user-id", "test-organization-id", code)
+	if err != nil {
+		t.Fatalf("Failed to confirm enrollment: %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %v", recoveryCodeCount, recoveryCodes)
+	}
+	if requirement, _ := s.GetRequirement(ctx, "test-user-id", "test-organization-id", "test-client-id"); requirement != RequirementVerify {
+		t.Errorf("Expected an enrolled user to verify, got %v", requirement)
+	}
+	// the code that confirmed the enrollment can't be used again
+	if verified, _ := s.VerifyTOTP(ctx, "test-user-id", "test-organization-id", code); verified {
+		t.Error("Expected a replayed code to be rejected")
+	}
+	if _, err := s.StartTOTPEnrollment(ctx, "test-user-id", "test-organization-id", "tiny-is", "alice"); err != ErrTOTPAlreadyEnrolled {
+		t.Errorf("Expected an already enrolled error, got %v", err)
+	}
+}
+
+func TestVerifyRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMFAService(t)
+	enrollment, _ := s.StartTOTPEnrollment(ctx, "test-user-id", "test-organization-id", "tiny-is", "alice")
+	code, _ := GenerateTOTP(enrollment.Secret, TOTPStep(time.Now()))
+	recoveryCodes, err := s.ConfirmTOTPEnrollment(ctx, "test-user-id", "test-organization-id", code)
+	if err != nil {
+		t.Fatalf("Failed to confirm enrollment: %v", err)
+	}
+	if verified, _ := s.VerifyTOTP(ctx, "test-user-id", "test-organization-id", " "+recoveryCodes[0]+" "); !verified {
+		t.Error("Expected the recovery code to be accepted")
+	}
+	if verified, _ := s.VerifyTOTP(ctx, "test-user-id", "test-organization-id", recoveryCodes[0]); verified {
+		t.Error("Expected a used recovery code to be rejected")
+	}
+	if status, _ := s.GetTOTPStatus(ctx, "test-user-id", "test-organization-id"); status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("Expected %d recovery codes to remain, got %d", recoveryCodeCount-1, status.RecoveryCodesRemaining)
+	}
+	if err := s.DeleteTOTP(ctx, "test-user-id", "test-organization-id"); err != nil {
+		t.Fatalf("Failed to delete TOTP: %v", err)
+	}
+	if status, _ := s.GetTOTPStatus(ctx, "test-user-id", "test-organization-id"); status.Enrolled {
+		t.Error("Expected TOTP not to be enrolled after deleting it")
+	}
+}
+
+func TestMFAPolicyRequirement(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMFAService(t)
+	err := s.UpdateMFAPolicy(ctx, MFAPolicy{OrganizationId: "test-organization-id", Mode: MFAModePerApplication, ClientIds: []string{"test-client-id"}})
+	if err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+	if requirement, _ := s.GetRequirement(ctx, "test-user-id", "test-organization-id", "test-client-id"); requirement != RequirementEnroll {
+		t.Errorf("Expected the application to require enrollment, got %v", requirement)
+	}
+	if requirement, _ := s.GetRequirement(ctx, "test-user-id", "test-organization-id", "other-client-id"); requirement != RequirementNone {
+		t.Errorf("Expected other applications not to require MFA, got %v", requirement)
+	}
+	if err := s.UpdateMFAPolicy(ctx, MFAPolicy{OrganizationId: "test-organization-id", Mode: "always"}); err == nil {
+		t.Error("Expected an invalid mode to be rejected")
+	}
+}
+
+func TestFailedAttempts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestMFAService(t)
+	for i := 1; i < maxFailedAttempts; i++ {
+		if err := s.RecordFailedAttempt(ctx, "test-user-id", "test-organization-id"); err != nil {
+			t.Fatalf("Expected attempt %d not to lock the user, got %v", i, err)
+		}
+	}
+	if err := s.CheckFailedAttempts(ctx, "test-user-id", "test-organization-id"); err != nil {
+		t.Fatalf("Expected the user not to be locked yet, got %v", err)
+	}
+	if err := s.RecordFailedAttempt(ctx, "test-user-id", "test-organization-id"); err != ErrTooManyAttempts {
+		t.Fatalf("Expected the last attempt to lock the user, got %v", err)
+	}
+	if err := s.CheckFailedAttempts(ctx, "test-user-id", "test-organization-id"); err != ErrTooManyAttempts {
+		t.Errorf("Expected the user to stay locked, got %v", err)
+	}
+	if err := s.CheckFailedAttempts(ctx, "test-user-id-2", "test-organization-id"); err != nil {
+		t.Errorf("Expected another user not to be locked, got %v", err)
+	}
+	s.ResetFailedAttempts(ctx, "test-user-id", "test-organization-id")
+	if err := s.CheckFailedAttempts(ctx, "test-user-id", "test-organization-id"); err != nil {
+		t.Errorf("Expected the reset to unlock the user, got %v", err)
+	}
+}
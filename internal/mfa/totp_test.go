@@ -0,0 +1,46 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// secret of the RFC 6238 test vectors, "12345678901234567890" base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTP(t *testing.T) {
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		code, err := GenerateTOTP(rfc6238Secret, TOTPStep(time.Unix(test.time, 0)))
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		if code != test.code {
+			t.Errorf("Expected code %s at %d, got %s", test.code, test.time, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := TOTPStep(now)
+	previous, _ := GenerateTOTP(rfc6238Secret, step-1)
+	if matched, ok := ValidateTOTP(rfc6238Secret, previous, now); !ok || matched != step-1 {
+		t.Errorf("Expected the code of the previous period to be accepted, got %d %v", matched, ok)
+	}
+	stale, _ := GenerateTOTP(rfc6238Secret, step-2)
+	if _, ok := ValidateTOTP(rfc6238Secret, stale, now); ok {
+		t.Error("Expected a code two periods old to be rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "08180", now); ok {
+		t.Error("Expected a short code to be rejected")
+	}
+}
@@ -0,0 +1,191 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+var ErrInvalidRecipient = errors.New("invalid email recipient")
+
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender delivers emails to users, such as one-time codes and sign in links.
+type EmailSender interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+// NewEmailSender returns the email sender selected in the config. The file and log senders don't
+// deliver anything, they are meant for local development and tests.
+func NewEmailSender(cfg *config.Config) (EmailSender, error) {
+	emailCfg := cfg.Notification.Email
+	switch emailCfg.Sender {
+	case "smtp":
+		if emailCfg.SMTP.Host == "" {
+			return nil, errors.New("notification.email.smtp.host is required")
+		}
+		return NewSMTPEmailSender(emailCfg.SMTP.Host, emailCfg.SMTP.Port, emailCfg.SMTP.Username, emailCfg.SMTP.Password, cfg.GetEmailFrom()), nil
+	case "file":
+		if emailCfg.File == "" {
+			return nil, errors.New("notification.email.file is required")
+		}
+		return NewFileEmailSender(emailCfg.File, cfg.GetEmailFrom()), nil
+	case "", "log":
+		return NewLogEmailSender(cfg.GetEmailFrom()), nil
+	}
+	return nil, fmt.Errorf("unsupported email sender: %s", emailCfg.Sender)
+}
+
+type queuedEmailSender struct {
+	sender EmailSender
+	queue  chan Email
+}
+
+// NewQueuedEmailSender returns a sender that hands the emails to sender in the background, so the
+// request that sends one answers as fast as the one that doesn't. Failed deliveries are logged,
+// and emails are dropped while size emails are already waiting.
+func NewQueuedEmailSender(sender EmailSender, size int) EmailSender {
+	s := &queuedEmailSender{sender: sender, queue: make(chan Email, size)}
+	go func() {
+		for email := range s.queue {
+			if err := s.sender.SendEmail(context.Background(), email); err != nil {
+				log.Printf("Failed to send email: %v", err)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *queuedEmailSender) SendEmail(ctx context.Context, email Email) error {
+	select {
+	case s.queue <- email:
+	default:
+		log.Printf("Dropped email, the queue is full")
+	}
+	return nil
+}
+
+type smtpEmailSender struct {
+	address string
+	host    string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPEmailSender returns a sender that delivers through an SMTP server. The connection is
+// upgraded with STARTTLS when the server offers it, and the credentials are only sent over TLS or
+// to localhost.
+func NewSMTPEmailSender(host string, port int, username, password, from string) EmailSender {
+	if port == 0 {
+		port = 587
+	}
+	sender := &smtpEmailSender{
+		address: net.JoinHostPort(host, strconv.Itoa(port)),
+		host:    host,
+		from:    from,
+	}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+func (s *smtpEmailSender) SendEmail(ctx context.Context, email Email) error {
+	message, err := formatEmail(s.from, email)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid email sender address: %w", err)
+	}
+	return smtp.SendMail(s.address, s.auth, from.Address, []string{email.To}, message)
+}
+
+type fileEmailSender struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+// NewFileEmailSender returns a sender that appends every email to a file.
+func NewFileEmailSender(path, from string) EmailSender {
+	return &fileEmailSender{
+		path: path,
+		from: from,
+	}
+}
+
+func (s *fileEmailSender) SendEmail(ctx context.Context, email Email) error {
+	message, err := formatEmail(s.from, email)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(message, "\r\n"...))
+	return err
+}
+
+type logEmailSender struct {
+	from string
+}
+
+// NewLogEmailSender returns a sender that writes every email to the server log.
+func NewLogEmailSender(from string) EmailSender {
+	return &logEmailSender{
+		from: from,
+	}
+}
+
+func (s *logEmailSender) SendEmail(ctx context.Context, email Email) error {
+	if _, err := formatEmail(s.from, email); err != nil {
+		return err
+	}
+	log.Printf("Email to: %s, Subject: %s\n%s", email.To, email.Subject, email.Body)
+	return nil
+}
+
+// formatEmail returns the email as a plain text RFC 5322 message.
+func formatEmail(from string, email Email) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil || to.Address != email.To {
+		return nil, ErrInvalidRecipient
+	}
+	if strings.ContainsAny(email.Subject, "\r\n") {
+		return nil, errors.New("invalid email subject")
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", email.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(email.Body, "\r\n", "\n"), "\n", "\r\n"))
+	message.WriteString("\r\n")
+	return message.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileEmailSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emails.log")
+	sender := NewFileEmailSender(path, "tiny-is <no-reply@example.com>")
+	err := sender.SendEmail(context.Background(), Email{To: "alice@example.com", Subject: "Your code", Body: "Your code is 123456."})
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read emails: %v", err)
+	}
+	for _, expected := range []string{"From: tiny-is <no-reply@example.com>\r\n", "To: alice@example.com\r\n", "Subject: Your code\r\n", "\r\n\r\nYour code is 123456.\r\n"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in %q", expected, data)
+		}
+	}
+}
+
+func TestEmailSenderRejectsHeaderInjection(t *testing.T) {
+	sender := NewLogEmailSender("tiny-is <no-reply@example.com>")
+	ctx := context.Background()
+	if err := sender.SendEmail(ctx, Email{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Your code"}); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("Expected the recipient to be rejected, got %v", err)
+	}
+	if err := sender.SendEmail(ctx, Email{To: "Alice <alice@example.com>", Subject: "Your code"}); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("Expected only a plain address to be accepted, got %v", err)
+	}
+	if err := sender.SendEmail(ctx, Email{To: "alice@example.com", Subject: "Your code\r\nBcc: eve@example.com"}); err == nil {
+		t.Errorf("Expected the subject to be rejected")
+	}
+}
+
+type blockingEmailSender struct {
+	release chan struct{}
+	sent    chan Email
+}
+
+func (s blockingEmailSender) SendEmail(ctx context.Context, email Email) error {
+	<-s.release
+	s.sent <- email
+	return nil
+}
+
+func TestQueuedEmailSender(t *testing.T) {
+	blocking := blockingEmailSender{release: make(chan struct{}), sent: make(chan Email, 1)}
+	sender := NewQueuedEmailSender(blocking, 1)
+	if err := sender.SendEmail(context.Background(), Email{To: "alice@example.com", Subject: "Your code"}); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	close(blocking.release)
+	select {
+	case email := <-blocking.sent:
+		if email.To != "alice@example.com" {
+			t.Errorf("Expected the email to alice@example.com, got %s", email.To)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the email to be delivered")
+	}
+}
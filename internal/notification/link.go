@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+// Emailed links carry a token that signs in, verifies or resets something for whoever holds it.
+// Opening a link only shows a form, the token is used up when the form is submitted, as mail
+// scanners open links to check them.
+
+const linkTokenLength = 32
+
+// NewLinkToken returns a random token to send in a link.
+func NewLinkToken() (string, error) {
+	token := make([]byte, linkTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashLinkToken returns what is kept of a token, so the cache does not hold usable links.
+func HashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetLink returns the link to the path of the organization with the token. It is built from the
+// configured server url, not from the request, so a forged Host header can't send the token
+// elsewhere.
+func GetLink(cfg *config.Config, organizationName, path, token string) string {
+	return cfg.GetServerURL() + "/o/" + url.PathEscape(organizationName) + path + "?token=" + url.QueryEscape(token)
+}
+
+// UseLink marks the link with the key as used until the ttl passes, and reports whether it was
+// not used before, so two requests racing with the same link can't both use it.
+func UseLink(backend cache.Backend, key string, ttl time.Duration) (bool, error) {
+	return backend.SetNX(key, []byte("1"), ttl)
+}
@@ -0,0 +1,18 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+func TestGetLink(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Host.Name = "id.example.com"
+	cfg.Server.Host.Port = 443
+	cfg.Transport.Https = true
+	link := GetLink(cfg, "acme corp", "/password/reset", "a+b/c")
+	if expected := "https://id.example.com:443/o/acme%20corp/password/reset?token=a%2Bb%2Fc"; link != expected {
+		t.Errorf("Expected %s, got %s", expected, link)
+	}
+}
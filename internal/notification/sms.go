@@ -0,0 +1,110 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+type SMS struct {
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+// SMSSender delivers text messages to users' phone numbers.
+type SMSSender interface {
+	SendSMS(ctx context.Context, sms SMS) error
+}
+
+// NewSMSSender returns the SMS provider selected in the config. The fake provider doesn't deliver
+// anything, it is meant for local development and tests.
+func NewSMSSender(cfg *config.Config) (SMSSender, error) {
+	smsCfg := cfg.Notification.SMS
+	switch smsCfg.Provider {
+	case "webhook":
+		if smsCfg.Webhook.URL == "" {
+			return nil, errors.New("notification.sms.webhook.url is required")
+		}
+		timeout := time.Duration(smsCfg.Webhook.Timeout) * time.Second
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		return NewWebhookSMSSender(&http.Client{Timeout: timeout}, smsCfg.Webhook.URL, smsCfg.Webhook.Token), nil
+	case "", "fake":
+		return NewFakeSMSSender(), nil
+	}
+	return nil, fmt.Errorf("unsupported sms provider: %s", smsCfg.Provider)
+}
+
+type webhookSMSSender struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+// NewWebhookSMSSender returns a sender that posts every message as JSON to a URL, to be delivered
+// by a gateway of the operator's SMS provider.
+func NewWebhookSMSSender(client *http.Client, url, token string) SMSSender {
+	return &webhookSMSSender{
+		client: client,
+		url:    url,
+		token:  token,
+	}
+}
+
+func (s *webhookSMSSender) SendSMS(ctx context.Context, sms SMS) error {
+	body, err := json.Marshal(sms)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms provider responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FakeSMSSender records the messages instead of sending them, and writes them to the server log.
+type FakeSMSSender struct {
+	mu       sync.Mutex
+	messages []SMS
+}
+
+func NewFakeSMSSender() *FakeSMSSender {
+	return &FakeSMSSender{}
+}
+
+func (s *FakeSMSSender) SendSMS(ctx context.Context, sms SMS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, sms)
+	log.Printf("SMS to: %s\n%s", sms.To, sms.Body)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (s *FakeSMSSender) Messages() []SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMS(nil), s.messages...)
+}
@@ -0,0 +1,36 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSMSSender(t *testing.T) {
+	var received SMS
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sms := SMS{To: "+94771234567", Body: "123456 is your code."}
+	if err := NewWebhookSMSSender(server.Client(), server.URL, "test-token").SendSMS(context.Background(), sms); err != nil {
+		t.Fatalf("Failed to send SMS: %v", err)
+	}
+	if received != sms {
+		t.Errorf("Expected %+v, got %+v", sms, received)
+	}
+	if err := NewWebhookSMSSender(server.Client(), server.URL, "wrong-token").SendSMS(context.Background(), sms); err == nil {
+		t.Errorf("Expected an error when the provider rejects the message")
+	}
+}
@@ -0,0 +1,46 @@
+package oauth2
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConsentRepository keeps the scopes users granted to the applications that require consent.
+type ConsentRepository interface {
+	GetConsentedScopes(ctx context.Context, userId, orgId, clientId string) ([]string, error)
+	AddConsent(ctx context.Context, userId, orgId, clientId string, scopes []string) error
+}
+
+type consentRepository struct {
+	db *sqlx.DB
+}
+
+func NewConsentRepository(db *sqlx.DB) ConsentRepository {
+	return &consentRepository{
+		db: db,
+	}
+}
+
+func (r *consentRepository) GetConsentedScopes(ctx context.Context, userId, orgId, clientId string) ([]string, error) {
+	var scopes []string
+	err := r.db.SelectContext(ctx, &scopes, "SELECT scope FROM user_consent WHERE user_id = ? AND organization_id = ? AND client_id = ?", userId, orgId, clientId)
+	return scopes, err
+}
+
+func (r *consentRepository) AddConsent(ctx context.Context, userId, orgId, clientId string, scopes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	for _, scope := range scopes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_consent (user_id, organization_id, client_id, scope, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING", userId, orgId, clientId, scope, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -5,46 +5,47 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"slices"
+	"strings"
 
-	"github.com/shashimalcse/tiny-is/internal/cache"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
 	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
 )
 
 type AuthorizationCodeGrantHandler struct {
-	cacheService cache.CacheService
-	tokenService token.TokenService
+	authorizeContextStore store.AuthorizeContextStore
+	tokenService          token.TokenService
 }
 
-func NewAuthorizationCodeGrantHandler(cacheService cache.CacheService, tokenService token.TokenService) *AuthorizationCodeGrantHandler {
+func NewAuthorizationCodeGrantHandler(authorizeContextStore store.AuthorizeContextStore, tokenService token.TokenService) *AuthorizationCodeGrantHandler {
 	return &AuthorizationCodeGrantHandler{
-		cacheService: cacheService,
-		tokenService: tokenService,
+		authorizeContextStore: authorizeContextStore,
+		tokenService:          tokenService,
 	}
 }
 
 func (gh *AuthorizationCodeGrantHandler) HandleGrant(ctx context.Context, oauth2TokenContext models.OAuth2TokenContext) (server_models.TokenResponse, error) {
-	authorizeContext, found := gh.cacheService.GetOAuth2AuthorizeContextFromCacheByAuthCode(oauth2TokenContext.OAuth2TokenRequest.Code)
-	if !found {
-		return server_models.TokenResponse{}, errors.New("invalid_code")
+	authorizeContext, err := gh.authorizeContextStore.GetByAuthCode(oauth2TokenContext.OAuth2TokenRequest.Code)
+	if err == nil {
+		// the code is only used once the client has proven the code verifier, so a wrong one can't
+		// burn the code of the legitimate client
+		if err := verifyCodeVerifier(authorizeContext, oauth2TokenContext.OAuth2TokenRequest.CodeVerifier); err != nil {
+			return server_models.TokenResponse{}, err
+		}
+		authorizeContext, err = gh.authorizeContextStore.ConsumeAuthCode(oauth2TokenContext.OAuth2TokenRequest.Code)
 	}
-	// handle pkce
-	if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge != "" {
-		if authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "" || authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "plain" {
-			if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge != oauth2TokenContext.OAuth2TokenRequest.CodeVerifier {
-				return server_models.TokenResponse{}, errors.New("invalid_code_verifier")
-			}
-		} else if authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "S256" {
-			h := sha256.New()
-			h.Write([]byte(oauth2TokenContext.OAuth2TokenRequest.CodeVerifier))
-			codeChallenge := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-			if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge != codeChallenge {
-				return server_models.TokenResponse{}, errors.New("invalid_code_verifier")
-			}
-		} else {
-			return server_models.TokenResponse{}, errors.New("invalid_code_challenge_method")
+	if err == store.ErrAuthorizationCodeReused {
+		// a replayed code may have been stolen, so the tokens issued from it can't be trusted either
+		if err := gh.tokenService.RevokeTokensByAuthorizationCode(ctx, authorizeContext.CodeId); err != nil {
+			return server_models.TokenResponse{}, err
 		}
+		return server_models.TokenResponse{}, errors.New("invalid_code")
+	}
+	if err != nil {
+		return server_models.TokenResponse{}, errors.New("invalid_code")
 	}
 	tokenString, err := gh.tokenService.GenerateAccessToken(ctx, authorizeContext, map[string]string{})
 	if err != nil {
@@ -54,12 +55,44 @@ func (gh *AuthorizationCodeGrantHandler) HandleGrant(ctx context.Context, oauth2
 	if err != nil {
 		return server_models.TokenResponse{}, err
 	}
-	gh.cacheService.DeleteOAuth2AuthorizeContextFromCacheByAuthCode(oauth2TokenContext.OAuth2TokenRequest.Code)
 	tokenResponse := server_models.TokenResponse{
 		AccessToken:  tokenString,
 		RefreshToken: refreshTokenString,
 		TokenType:    "Bearer",
 		ExpiresIn:    3600,
 	}
+	if slices.Contains(strings.Fields(authorizeContext.OAuth2AuthorizeRequest.Scope), "openid") {
+		issuer, err := tinyhttp.GetIssuer(ctx, oauth2TokenContext.OAuth2TokenRequest.OrganizationName)
+		if err != nil {
+			return server_models.TokenResponse{}, err
+		}
+		idToken, err := gh.tokenService.GenerateIdToken(ctx, issuer, authorizeContext)
+		if err != nil {
+			return server_models.TokenResponse{}, err
+		}
+		tokenResponse.IdToken = idToken
+	}
 	return tokenResponse, nil
 }
+
+// verifyCodeVerifier checks the code verifier against the PKCE challenge of the authorization request.
+func verifyCodeVerifier(authorizeContext models.OAuth2AuthorizeContext, codeVerifier string) error {
+	if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge == "" {
+		return nil
+	}
+	if authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "" || authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "plain" {
+		if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge != codeVerifier {
+			return errors.New("invalid_code_verifier")
+		}
+	} else if authorizeContext.OAuth2AuthorizeRequest.CodeChallengeMethod == "S256" {
+		h := sha256.New()
+		h.Write([]byte(codeVerifier))
+		codeChallenge := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+		if authorizeContext.OAuth2AuthorizeRequest.CodeChallenge != codeChallenge {
+			return errors.New("invalid_code_verifier")
+		}
+	} else {
+		return errors.New("invalid_code_challenge_method")
+	}
+	return nil
+}
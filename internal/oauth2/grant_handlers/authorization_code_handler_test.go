@@ -0,0 +1,55 @@
+package grant_handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	ctx := context.Background()
+	authorizeContextStore := store.NewInMemoryAuthorizeContextStore()
+	tokenService := token.NewTokenService(nil, token.NewTokenRepository(testutil.NewDB(t, "token.sql")), testutil.NewKeyManager(t))
+	gh := NewAuthorizationCodeGrantHandler(authorizeContextStore, tokenService)
+	authorizeContext := models.OAuth2AuthorizeContext{
+		OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{ClientId: "test-client-id", CodeChallenge: "test-code-verifier", CodeChallengeMethod: "plain"},
+		CodeId:                 "test-code-id",
+	}
+	authorizeContext.AuthenticatedUser.Id = "test-user-id"
+	if err := authorizeContextStore.AddByAuthCode("test-code", authorizeContext, time.Minute); err != nil {
+		t.Fatalf("Failed to add the code: %v", err)
+	}
+	tokenContext := func(codeVerifier string) models.OAuth2TokenContext {
+		return models.OAuth2TokenContext{OAuth2TokenRequest: server_models.OAuth2TokenRequest{Code: "test-code", CodeVerifier: codeVerifier}}
+	}
+
+	if _, err := gh.HandleGrant(ctx, tokenContext("wrong-code-verifier")); err == nil || err.Error() != "invalid_code_verifier" {
+		t.Fatalf("Expected invalid_code_verifier, got %v", err)
+	}
+	tokenResponse, err := gh.HandleGrant(ctx, tokenContext("test-code-verifier"))
+	if err != nil {
+		t.Fatalf("Expected the code to survive a wrong code verifier, got %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenResponse.AccessToken, claims); err != nil {
+		t.Fatalf("Failed to parse the access token: %v", err)
+	}
+	jti, _ := claims["jti"].(string)
+	if active, _ := tokenService.IsTokenActive(ctx, jti); !active {
+		t.Fatal("Expected the access token to be active")
+	}
+	if _, err := gh.HandleGrant(ctx, tokenContext("test-code-verifier")); err == nil || err.Error() != "invalid_code" {
+		t.Fatalf("Expected a replayed code to be rejected, got %v", err)
+	}
+	if active, _ := tokenService.IsTokenActive(ctx, jti); active {
+		t.Error("Expected the access token issued from the replayed code to be revoked")
+	}
+}
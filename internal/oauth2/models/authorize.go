@@ -1,21 +1,124 @@
 package models
 
 import (
+	"net/url"
+	"time"
+
 	"github.com/shashimalcse/tiny-is/internal/authn/models"
 	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
 )
 
+const (
+	ResponseModeQuery       = "query"
+	ResponseModeFragment    = "fragment"
+	ResponseModeFormPost    = "form_post"
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFragmentJWT = "fragment.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+var SupportedResponseModes = []string{
+	ResponseModeQuery,
+	ResponseModeFragment,
+	ResponseModeFormPost,
+	ResponseModeJWT,
+	ResponseModeQueryJWT,
+	ResponseModeFragmentJWT,
+	ResponseModeFormPostJWT,
+}
+
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+)
+
+var SupportedPrompts = []string{
+	PromptNone,
+	PromptLogin,
+	PromptConsent,
+	PromptSelectAccount,
+}
+
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorAccessDenied            = "access_denied"
+	ErrorServerError             = "server_error"
+	ErrorLoginRequired           = "login_required"
+	ErrorConsentRequired         = "consent_required"
+)
+
+// AuthorizeError is an authorization error that is returned to the client's redirect uri
+// instead of being shown to the user.
+type AuthorizeError struct {
+	ErrorCode   string
+	Description string
+}
+
+func (e AuthorizeError) Error() string {
+	return e.Description
+}
+
+func NewAuthorizeError(errorCode, description string) AuthorizeError {
+	return AuthorizeError{ErrorCode: errorCode, Description: description}
+}
+
 type OAuth2AuthorizeContext struct {
 	OAuth2AuthorizeRequest server_models.OAuth2AuthorizeRequest `json:"oauth2_authorize_request"`
 	AuthenticatedUser      models.AuthenticatedUser             `json:"authenticated_user"`
+	SessionId              string                               `json:"session_id"`
+	AuthTime               time.Time                            `json:"auth_time"`
+	AuthMethods            []string                             `json:"amr"`
+	ConsentGranted         bool                                 `json:"consent_granted"`
+	// PendingUser is the user a step of the login identified or authenticated, before the login
+	// is complete. The request is not authenticated until the user moves to AuthenticatedUser.
+	PendingUser        models.AuthenticatedUser `json:"pending_user"`
+	PendingAuthMethods []string                 `json:"pending_amr"`
+	// LoginStep is the step of the authentication sequence the login is at, and LoginAuthenticators
+	// the authenticators that completed the steps before it.
+	LoginStep           int      `json:"login_step"`
+	LoginAuthenticators []string `json:"login_authenticators"`
+	// RiskStepUp asks the login for a second factor, because the first one was risky.
+	RiskStepUp bool `json:"risk_step_up"`
+	// PasswordChangeUser is the user who passed the password step with an expired or breached
+	// password, and is asked to choose a new one for the reason before the step is complete.
+	PasswordChangeUser   models.AuthenticatedUser `json:"password_change_user"`
+	PasswordChangeReason string                   `json:"password_change_reason"`
+	// LoginComplete is set when the user passed every step of the login without the password step,
+	// but their password expired. The login completes once they chose a new one.
+	LoginComplete bool `json:"login_complete"`
+	// BrowserToken is the login CSRF token of the browser that started the request.
+	BrowserToken string `json:"browser_token"`
+	// CodeId identifies the authorization code the tokens are issued from, so they can be revoked
+	// when the code is replayed.
+	CodeId string `json:"code_id"`
 }
 
 type OAuth2TokenContext struct {
 	OAuth2TokenRequest server_models.OAuth2TokenRequest `json:"oauth2_token_request"`
 }
 
+// AuthorizeResponse carries the parameters sent back to the client from /authorize
+// and how they should be delivered to the redirect uri.
+type AuthorizeResponse struct {
+	RedirectUri  string
+	ResponseMode string
+	Parameters   url.Values
+}
+
 type Metadata struct {
-	Issuer                string `json:"issuer"`
-	AuthorizationEndpoint string `json:"authorization_endpoint"`
-	TokenEndpoint         string `json:"token_endpoint"`
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	AuthorizationSigningAlgValuesSupported     []string `json:"authorization_signing_alg_values_supported"`
+	AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	BackchannelLogoutSupported                 bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported          bool     `json:"backchannel_logout_session_supported"`
+	FrontchannelLogoutSupported                bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported         bool     `json:"frontchannel_logout_session_supported"`
 }
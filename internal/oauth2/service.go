@@ -3,48 +3,67 @@ package oauth2
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/a-h/templ"
 
 	"github.com/shashimalcse/tiny-is/internal/application"
 	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/grant_handlers"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/screens"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
 	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
 )
 
 type OAuth2Service interface {
 	ValidateAuthroizeRequest(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) error
-	AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext models.OAuth2AuthorizeContext)
-	GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx context.Context, sessionDataKey string) (models.OAuth2AuthorizeContext, error)
-	AddOAuth2AuthorizeContextToCacheByAuthCode(ctx context.Context, code string, authroizeContext models.OAuth2AuthorizeContext)
-	GetOAuth2AuthorizeContextFromCacheByAuthCode(ctx context.Context, code string) (models.OAuth2AuthorizeContext, error)
+	AddOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext models.OAuth2AuthorizeContext) error
+	GetOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string) (models.OAuth2AuthorizeContext, error)
+	DeleteOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string)
+	AddOAuth2AuthorizeContextByAuthCode(ctx context.Context, code string, authroizeContext models.OAuth2AuthorizeContext) error
 	ValidateTokenRequest(ctx context.Context, tokenContext models.OAuth2TokenContext) error
 	GetGrantHandler(grantType string) (grant_handlers.GrantHandler, error)
 	RevokeToken(ctx context.Context, tokenString string)
-	GetMetadata(ctx context.Context) (models.Metadata, error)
+	GetMetadata(ctx context.Context, organizationName string) (models.Metadata, error)
+	GetAuthorizeResponse(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, parameters url.Values) (models.AuthorizeResponse, error)
+	GetAuthorizeErrorResponse(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, authorizeError models.AuthorizeError) (models.AuthorizeResponse, error)
+	GetConsentPage(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, csrfToken string) (templ.Component, error)
+	IsConsentRequired(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) (bool, error)
+	GrantConsent(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) error
 }
 
 type oauth2Service struct {
-	cacheService       cache.CacheService
-	tokenService       token.TokenService
-	applicationService application.ApplicationService
-	grantHandlers      map[string]grant_handlers.GrantHandler
+	cfg                   *config.Config
+	cacheService          cache.CacheService
+	authorizeContextStore store.AuthorizeContextStore
+	tokenService          token.TokenService
+	applicationService    application.ApplicationService
+	consentRepository     ConsentRepository
+	grantHandlers         map[string]grant_handlers.GrantHandler
 }
 
-func NewOAuth2Service(cacheService cache.CacheService, tokenService token.TokenService, applicationService application.ApplicationService) OAuth2Service {
+func NewOAuth2Service(cfg *config.Config, cacheService cache.CacheService, authorizeContextStore store.AuthorizeContextStore, tokenService token.TokenService, applicationService application.ApplicationService, consentRepository ConsentRepository) OAuth2Service {
 	service := &oauth2Service{
-		cacheService:       cacheService,
-		applicationService: applicationService,
-		grantHandlers:      make(map[string]grant_handlers.GrantHandler),
-		tokenService:       tokenService,
+		cfg:                   cfg,
+		cacheService:          cacheService,
+		authorizeContextStore: authorizeContextStore,
+		applicationService:    applicationService,
+		consentRepository:     consentRepository,
+		grantHandlers:         make(map[string]grant_handlers.GrantHandler),
+		tokenService:          tokenService,
 	}
 	service.registerGrantHandlers()
 	return service
 }
 
 func (s *oauth2Service) registerGrantHandlers() {
-	s.grantHandlers["authorization_code"] = grant_handlers.NewAuthorizationCodeGrantHandler(s.cacheService, s.tokenService)
+	s.grantHandlers["authorization_code"] = grant_handlers.NewAuthorizationCodeGrantHandler(s.authorizeContextStore, s.tokenService)
 	s.grantHandlers["refresh_token"] = grant_handlers.NewRefreshTokenGrantHandler(s.cacheService, s.tokenService)
 	s.grantHandlers["client_credentials"] = grant_handlers.NewClientCredetialGrantHandler(s.cacheService, s.tokenService)
 }
@@ -57,6 +76,8 @@ func (s *oauth2Service) GetGrantHandler(grantType string) (grant_handlers.GrantH
 	return grantHandler, nil
 }
 
+// ValidateAuthroizeRequest validates the client and redirect uri first. Once they are trusted,
+// any other problem is returned as a models.AuthorizeError so it can be sent back to the client.
 func (s *oauth2Service) ValidateAuthroizeRequest(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) error {
 	validClientId, err := s.applicationService.ValidateClientId(ctx, authroizeContext.OAuth2AuthorizeRequest.ClientId, authroizeContext.OAuth2AuthorizeRequest.OrganizationId)
 	if err != nil {
@@ -72,9 +93,149 @@ func (s *oauth2Service) ValidateAuthroizeRequest(ctx context.Context, authroizeC
 	if !validRedirectUri {
 		return errors.New("invalid redirect uri")
 	}
+	if authroizeContext.OAuth2AuthorizeRequest.ResponseType != "code" {
+		return models.NewAuthorizeError(models.ErrorUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !authroizeContext.OAuth2AuthorizeRequest.IsValidRequest() {
+		return models.NewAuthorizeError(models.ErrorInvalidRequest, "invalid request")
+	}
+	_, err = s.getResponseMode(ctx, authroizeContext.OAuth2AuthorizeRequest)
+	if err != nil {
+		return err
+	}
+	return s.validateOIDCParameters(ctx, authroizeContext.OAuth2AuthorizeRequest)
+}
+
+func (s *oauth2Service) validateOIDCParameters(ctx context.Context, authorizeRequest server_models.OAuth2AuthorizeRequest) error {
+	prompts := strings.Fields(authorizeRequest.Prompt)
+	for _, prompt := range prompts {
+		if !slices.Contains(models.SupportedPrompts, prompt) {
+			return models.NewAuthorizeError(models.ErrorInvalidRequest, "unsupported prompt")
+		}
+	}
+	if slices.Contains(prompts, models.PromptNone) && len(prompts) > 1 {
+		return models.NewAuthorizeError(models.ErrorInvalidRequest, "prompt none must not be combined with other values")
+	}
+	if _, ok := authorizeRequest.GetMaxAge(); authorizeRequest.MaxAge != "" && !ok {
+		return models.NewAuthorizeError(models.ErrorInvalidRequest, "invalid max_age")
+	}
+	if authorizeRequest.IdTokenHint != "" {
+		if err := s.validateIdTokenHint(ctx, authorizeRequest); err != nil {
+			return models.NewAuthorizeError(models.ErrorInvalidRequest, "invalid id_token_hint")
+		}
+	}
 	return nil
 }
 
+// validateIdTokenHint checks that the hint is an ID token the organization issued to one of its
+// clients.
+func (s *oauth2Service) validateIdTokenHint(ctx context.Context, authorizeRequest server_models.OAuth2AuthorizeRequest) error {
+	issuer, err := s.getIssuer(ctx, authorizeRequest.OrganizationName)
+	if err != nil {
+		return err
+	}
+	claims, err := s.tokenService.ParseIdTokenHint(ctx, authorizeRequest.IdTokenHint, issuer)
+	if err != nil {
+		return err
+	}
+	audience, _ := claims.GetAudience()
+	validClientId, err := s.applicationService.ValidateClientId(ctx, audience[0], authorizeRequest.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if !validClientId {
+		return errors.New("id_token_hint was issued to another organization")
+	}
+	return nil
+}
+
+// getResponseMode resolves the response mode for the request, falling back to the
+// mode required by the application and finally to the default query mode.
+func (s *oauth2Service) getResponseMode(ctx context.Context, authorizeRequest server_models.OAuth2AuthorizeRequest) (string, error) {
+	if authorizeRequest.ResponseMode != "" && !slices.Contains(models.SupportedResponseModes, authorizeRequest.ResponseMode) {
+		return "", models.NewAuthorizeError(models.ErrorInvalidRequest, "unsupported response mode")
+	}
+	application, err := s.applicationService.GetApplicationByClientId(ctx, authorizeRequest.ClientId, authorizeRequest.OrganizationId)
+	if err != nil {
+		return "", err
+	}
+	if application.ResponseMode != "" {
+		// applications saved before their response mode was validated
+		if !slices.Contains(models.SupportedResponseModes, application.ResponseMode) {
+			return "", models.NewAuthorizeError(models.ErrorInvalidRequest, "unsupported response mode")
+		}
+		if authorizeRequest.ResponseMode != "" && authorizeRequest.ResponseMode != application.ResponseMode {
+			return "", models.NewAuthorizeError(models.ErrorInvalidRequest, "response mode not allowed for the client")
+		}
+		return application.ResponseMode, nil
+	}
+	if authorizeRequest.ResponseMode != "" {
+		return authorizeRequest.ResponseMode, nil
+	}
+	return models.ResponseModeQuery, nil
+}
+
+func (s *oauth2Service) GetAuthorizeResponse(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, parameters url.Values) (models.AuthorizeResponse, error) {
+	responseMode, err := s.getResponseMode(ctx, authroizeContext.OAuth2AuthorizeRequest)
+	if err != nil {
+		return models.AuthorizeResponse{}, err
+	}
+	return s.buildAuthorizeResponse(ctx, authroizeContext, responseMode, parameters)
+}
+
+func (s *oauth2Service) GetAuthorizeErrorResponse(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, authorizeError models.AuthorizeError) (models.AuthorizeResponse, error) {
+	parameters := url.Values{}
+	parameters.Set("error", authorizeError.ErrorCode)
+	if authorizeError.Description != "" {
+		parameters.Set("error_description", authorizeError.Description)
+	}
+	responseMode, err := s.getResponseMode(ctx, authroizeContext.OAuth2AuthorizeRequest)
+	if err != nil {
+		// the requested response mode is the problem, so fall back to the default
+		responseMode = models.ResponseModeQuery
+	}
+	return s.buildAuthorizeResponse(ctx, authroizeContext, responseMode, parameters)
+}
+
+func (s *oauth2Service) buildAuthorizeResponse(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, responseMode string, parameters url.Values) (models.AuthorizeResponse, error) {
+	issuer, err := s.getIssuer(ctx, authroizeContext.OAuth2AuthorizeRequest.OrganizationName)
+	if err != nil {
+		return models.AuthorizeResponse{}, err
+	}
+	if state := authroizeContext.OAuth2AuthorizeRequest.State; state != "" {
+		parameters.Set("state", state)
+	}
+	authorizeResponse := models.AuthorizeResponse{
+		RedirectUri:  authroizeContext.OAuth2AuthorizeRequest.RedirectUri,
+		ResponseMode: responseMode,
+		Parameters:   parameters,
+	}
+	switch responseMode {
+	case models.ResponseModeJWT, models.ResponseModeQueryJWT, models.ResponseModeFragmentJWT, models.ResponseModeFormPostJWT:
+		// the iss claim of the response token identifies the issuer (RFC 9207 section 2.4)
+		claims := make(map[string]string)
+		for name := range parameters {
+			claims[name] = parameters.Get(name)
+		}
+		responseToken, err := s.tokenService.GenerateAuthorizationResponseToken(ctx, issuer, authroizeContext.OAuth2AuthorizeRequest.ClientId, claims)
+		if err != nil {
+			return models.AuthorizeResponse{}, err
+		}
+		authorizeResponse.Parameters = url.Values{"response": {responseToken}}
+		switch responseMode {
+		case models.ResponseModeFragmentJWT:
+			authorizeResponse.ResponseMode = models.ResponseModeFragment
+		case models.ResponseModeFormPostJWT:
+			authorizeResponse.ResponseMode = models.ResponseModeFormPost
+		default:
+			authorizeResponse.ResponseMode = models.ResponseModeQuery
+		}
+	default:
+		parameters.Set("iss", issuer)
+	}
+	return authorizeResponse, nil
+}
+
 func (s *oauth2Service) ValidateTokenRequest(ctx context.Context, tokenContext models.OAuth2TokenContext) error {
 	validClientId, err := s.applicationService.ValidateClientId(ctx, tokenContext.OAuth2TokenRequest.ClientId, tokenContext.OAuth2TokenRequest.OrganizationId)
 	if err != nil {
@@ -97,44 +258,91 @@ func (s *oauth2Service) RevokeToken(ctx context.Context, tokenString string) {
 	s.tokenService.RevokeToken(ctx, tokenString)
 }
 
-func (s *oauth2Service) GetMetadata(ctx context.Context) (models.Metadata, error) {
+// getIssuer returns the issuer identifier of an organization. Each organization is its own
+// issuer so clients talking to several organizations can tell their responses apart.
+func (s *oauth2Service) getIssuer(ctx context.Context, organizationName string) (string, error) {
+	return tinyhttp.GetIssuer(ctx, organizationName)
+}
+
+func (s *oauth2Service) GetConsentPage(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext, csrfToken string) (templ.Component, error) {
+	authorizeRequest := authroizeContext.OAuth2AuthorizeRequest
+	application, err := s.applicationService.GetApplicationByClientId(ctx, authorizeRequest.ClientId, authorizeRequest.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	return screens.ConsentPage(authorizeRequest.OrganizationName, authorizeRequest.SessionDataKey, csrfToken, application.Name, strings.Fields(authorizeRequest.Scope)), nil
+}
 
-	server_url, ok := ctx.Value(tinyhttp.SERVER_URL).(string)
-	if !ok {
-		return models.Metadata{}, errors.New("server url not found in context")
+// IsConsentRequired reports whether the user has to approve the request, because the client asks
+// for it with prompt=consent, or the application requires consent to scopes the user has not
+// granted yet.
+func (s *oauth2Service) IsConsentRequired(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) (bool, error) {
+	authorizeRequest := authroizeContext.OAuth2AuthorizeRequest
+	if authorizeRequest.HasPrompt(models.PromptConsent) {
+		return true, nil
 	}
-	server_scheme, ok := ctx.Value(tinyhttp.SERVER_SCHEME).(string)
-	if !ok {
-		return models.Metadata{}, errors.New("server scheme not found in context")
+	application, err := s.applicationService.GetApplicationByClientId(ctx, authorizeRequest.ClientId, authorizeRequest.OrganizationId)
+	if err != nil {
+		return false, err
+	}
+	if application.RequireConsent == nil || !*application.RequireConsent {
+		return false, nil
+	}
+	consentedScopes, err := s.consentRepository.GetConsentedScopes(ctx, authroizeContext.AuthenticatedUser.Id, authorizeRequest.OrganizationId, authorizeRequest.ClientId)
+	if err != nil {
+		return false, err
+	}
+	for _, scope := range strings.Fields(authorizeRequest.Scope) {
+		if !slices.Contains(consentedScopes, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GrantConsent remembers the scopes the user approved, so they are not asked again.
+func (s *oauth2Service) GrantConsent(ctx context.Context, authroizeContext models.OAuth2AuthorizeContext) error {
+	authorizeRequest := authroizeContext.OAuth2AuthorizeRequest
+	return s.consentRepository.AddConsent(ctx, authroizeContext.AuthenticatedUser.Id, authorizeRequest.OrganizationId, authorizeRequest.ClientId, strings.Fields(authorizeRequest.Scope))
+}
+
+func (s *oauth2Service) GetMetadata(ctx context.Context, organizationName string) (models.Metadata, error) {
+
+	issuer, err := s.getIssuer(ctx, organizationName)
+	if err != nil {
+		return models.Metadata{}, err
 	}
-	fullURL := fmt.Sprintf("%s://%s", server_scheme, server_url)
 	matadata := models.Metadata{
-		Issuer:                fullURL + "/token",
-		AuthorizationEndpoint: fullURL + "/authorize",
-		TokenEndpoint:         fullURL + "/token",
+		Issuer:                                 issuer,
+		AuthorizationEndpoint:                  issuer + "/authorize",
+		TokenEndpoint:                          issuer + "/token",
+		ResponseModesSupported:                 models.SupportedResponseModes,
+		AuthorizationSigningAlgValuesSupported: []string{"EdDSA"},
+		AuthorizationResponseIssParameterSupported: true,
+		EndSessionEndpoint:                         issuer + "/logout",
+		BackchannelLogoutSupported:                 true,
+		BackchannelLogoutSessionSupported:          true,
+		FrontchannelLogoutSupported:                true,
+		FrontchannelLogoutSessionSupported:         true,
 	}
 	return matadata, nil
 }
-func (s *oauth2Service) AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext models.OAuth2AuthorizeContext) {
-	s.cacheService.AddOAuth2AuthorizeContextToCacheBySessionDataKey(sessionDataKey, authroizeContext)
+func (s *oauth2Service) AddOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string, authroizeContext models.OAuth2AuthorizeContext) error {
+	return s.authorizeContextStore.AddBySessionDataKey(sessionDataKey, authroizeContext, s.cfg.GetSessionDataKeyTTL())
 }
 
-func (s *oauth2Service) GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx context.Context, sessionDataKey string) (models.OAuth2AuthorizeContext, error) {
-	oauth2AuthorizeContext, found := s.cacheService.GetOAuth2AuthorizeContextFromCacheBySessionDataKey(sessionDataKey)
+func (s *oauth2Service) GetOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string) (models.OAuth2AuthorizeContext, error) {
+	oauth2AuthorizeContext, found := s.authorizeContextStore.GetBySessionDataKey(sessionDataKey)
 	if !found {
 		return models.OAuth2AuthorizeContext{}, errors.New("invalid session_data_key")
 	}
 	return oauth2AuthorizeContext, nil
 }
 
-func (s *oauth2Service) AddOAuth2AuthorizeContextToCacheByAuthCode(ctx context.Context, code string, authroizeContext models.OAuth2AuthorizeContext) {
-	s.cacheService.AddOAuth2AuthorizeContextToCacheByAuthCode(code, authroizeContext)
+func (s *oauth2Service) DeleteOAuth2AuthorizeContextBySessionDataKey(ctx context.Context, sessionDataKey string) {
+	s.authorizeContextStore.DeleteBySessionDataKey(sessionDataKey)
 }
 
-func (s *oauth2Service) GetOAuth2AuthorizeContextFromCacheByAuthCode(ctx context.Context, code string) (models.OAuth2AuthorizeContext, error) {
-	oauth2AuthorizeContext, found := s.cacheService.GetOAuth2AuthorizeContextFromCacheByAuthCode(code)
-	if !found {
-		return models.OAuth2AuthorizeContext{}, errors.New("invalid code")
-	}
-	return oauth2AuthorizeContext, nil
+func (s *oauth2Service) AddOAuth2AuthorizeContextByAuthCode(ctx context.Context, code string, authroizeContext models.OAuth2AuthorizeContext) error {
+	return s.authorizeContextStore.AddByAuthCode(code, authroizeContext, s.cfg.GetAuthorizationCodeTTL())
 }
@@ -0,0 +1,65 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/application"
+	app_models "github.com/shashimalcse/tiny-is/internal/application/models"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+// testApplicationService returns one application, the methods the oauth2 service does not use
+// in the tests are not implemented.
+type testApplicationService struct {
+	application.ApplicationService
+	application app_models.Application
+}
+
+func (s *testApplicationService) GetApplicationByClientId(ctx context.Context, clientId, orgId string) (app_models.Application, error) {
+	return s.application, nil
+}
+
+func newTestAuthorizeContext(scope, prompt string) models.OAuth2AuthorizeContext {
+	authorizeContext := models.OAuth2AuthorizeContext{
+		OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{
+			ClientId:       "test-client-id",
+			OrganizationId: "test-organization-id",
+			Scope:          scope,
+			Prompt:         prompt,
+		},
+	}
+	authorizeContext.AuthenticatedUser.Id = "test-user-id"
+	return authorizeContext
+}
+
+func TestConsent(t *testing.T) {
+	ctx := context.Background()
+	requireConsent := true
+	applicationService := &testApplicationService{application: app_models.Application{ClientId: "test-client-id", RequireConsent: &requireConsent}}
+	s := NewOAuth2Service(&config.Config{}, nil, nil, nil, applicationService, NewConsentRepository(testutil.NewDB(t, "consent.sql")))
+
+	if required, err := s.IsConsentRequired(ctx, newTestAuthorizeContext("openid profile", "")); !required || err != nil {
+		t.Fatalf("Expected consent to be required before it was granted, got %v", err)
+	}
+	if err := s.GrantConsent(ctx, newTestAuthorizeContext("openid profile", "")); err != nil {
+		t.Fatalf("Failed to grant consent: %v", err)
+	}
+	if required, _ := s.IsConsentRequired(ctx, newTestAuthorizeContext("openid", "none")); required {
+		t.Errorf("Expected granted scopes not to need consent again")
+	}
+	if required, _ := s.IsConsentRequired(ctx, newTestAuthorizeContext("openid email", "none")); !required {
+		t.Errorf("Expected a new scope to need consent")
+	}
+	if required, _ := s.IsConsentRequired(ctx, newTestAuthorizeContext("openid", "consent")); !required {
+		t.Errorf("Expected prompt=consent to ask again")
+	}
+
+	requireConsent = false
+	if required, _ := s.IsConsentRequired(ctx, newTestAuthorizeContext("openid email", "")); required {
+		t.Errorf("Expected an application without required consent not to ask")
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+)
+
+var (
+	ErrAuthorizationCodeNotFound = errors.New("invalid authorization code")
+	ErrAuthorizationCodeReused   = errors.New("authorization code has already been used")
+)
+
+// AuthorizeContextStore keeps the authorize context of in-flight authorization requests, by
+// session_data_key while the user authenticates and by authorization code until it is redeemed.
+type AuthorizeContextStore interface {
+	AddBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error
+	GetBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool)
+	DeleteBySessionDataKey(sessionDataKey string)
+	AddByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error
+	// GetByAuthCode returns the authorize context of the code without using the code, with the
+	// errors of ConsumeAuthCode.
+	GetByAuthCode(code string) (models.OAuth2AuthorizeContext, error)
+	// ConsumeAuthCode returns the authorize context of the code and marks the code as used, so
+	// only one of concurrent callers gets it. A code that was already used returns its authorize
+	// context with ErrAuthorizationCodeReused, until the code expires.
+	ConsumeAuthCode(code string) (models.OAuth2AuthorizeContext, error)
+}
+
+type authCodeEntry struct {
+	authorizeContext models.OAuth2AuthorizeContext
+	expiresAt        time.Time
+	consumed         bool
+}
+
+type inMemoryAuthorizeContextStore struct {
+	sessionDataKeys *cache.Cache
+	codes           *cache.Cache
+	mu              sync.Mutex
+}
+
+func NewInMemoryAuthorizeContextStore() AuthorizeContextStore {
+	return &inMemoryAuthorizeContextStore{
+		sessionDataKeys: cache.New(cache.NoExpiration, time.Minute),
+		codes:           cache.New(cache.NoExpiration, time.Minute),
+	}
+}
+
+func (s *inMemoryAuthorizeContextStore) AddBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	// go-cache keeps items without a positive ttl forever
+	if ttl <= 0 {
+		s.sessionDataKeys.Delete(sessionDataKey)
+		return nil
+	}
+	s.sessionDataKeys.Set(sessionDataKey, authorizeContext, ttl)
+	return nil
+}
+
+func (s *inMemoryAuthorizeContextStore) GetBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool) {
+	authorizeContext, found := s.sessionDataKeys.Get(sessionDataKey)
+	if !found {
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	return authorizeContext.(models.OAuth2AuthorizeContext), true
+}
+
+func (s *inMemoryAuthorizeContextStore) DeleteBySessionDataKey(sessionDataKey string) {
+	s.sessionDataKeys.Delete(sessionDataKey)
+}
+
+func (s *inMemoryAuthorizeContextStore) AddByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	if ttl <= 0 {
+		s.codes.Delete(code)
+		return nil
+	}
+	s.codes.Set(code, authCodeEntry{authorizeContext: authorizeContext, expiresAt: time.Now().Add(ttl)}, ttl)
+	return nil
+}
+
+func (s *inMemoryAuthorizeContextStore) GetByAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, err := s.getAuthCode(code)
+	return entry.authorizeContext, err
+}
+
+func (s *inMemoryAuthorizeContextStore) ConsumeAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, err := s.getAuthCode(code)
+	if err != nil {
+		return entry.authorizeContext, err
+	}
+	entry.consumed = true
+	s.codes.Set(code, entry, time.Until(entry.expiresAt))
+	return entry.authorizeContext, nil
+}
+
+func (s *inMemoryAuthorizeContextStore) getAuthCode(code string) (authCodeEntry, error) {
+	data, found := s.codes.Get(code)
+	if !found {
+		return authCodeEntry{}, ErrAuthorizationCodeNotFound
+	}
+	entry := data.(authCodeEntry)
+	if time.Until(entry.expiresAt) <= 0 {
+		return authCodeEntry{}, ErrAuthorizationCodeNotFound
+	}
+	if entry.consumed {
+		return entry, ErrAuthorizationCodeReused
+	}
+	return entry, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
+)
+
+var testAuthorizeContext = models.OAuth2AuthorizeContext{
+	OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{
+		ClientId:       "test-client-id",
+		OrganizationId: "test-organization-id",
+	},
+	CodeId: "test-code-id",
+}
+
+func testAuthorizeContextBySessionDataKey(t *testing.T, s AuthorizeContextStore) {
+	testSessionDataKey := "test-session-data-key"
+	if err := s.AddBySessionDataKey(testSessionDataKey, testAuthorizeContext, time.Minute); err != nil {
+		t.Fatalf("failed to add authorize context: %v", err)
+	}
+	authorizeContext, found := s.GetBySessionDataKey(testSessionDataKey)
+	if !found {
+		t.Fatal("Expected to find the authorize context")
+	}
+	if authorizeContext.OAuth2AuthorizeRequest.ClientId != "test-client-id" {
+		t.Errorf("Unexpected authorize context %+v", authorizeContext)
+	}
+	s.DeleteBySessionDataKey(testSessionDataKey)
+	if _, found := s.GetBySessionDataKey(testSessionDataKey); found {
+		t.Error("Expected not to find the authorize context")
+	}
+	if err := s.AddBySessionDataKey(testSessionDataKey, testAuthorizeContext, -time.Second); err != nil {
+		t.Fatalf("failed to add authorize context: %v", err)
+	}
+	if _, found := s.GetBySessionDataKey(testSessionDataKey); found {
+		t.Error("Expected not to find the expired authorize context")
+	}
+}
+
+func testConsumeAuthCode(t *testing.T, s AuthorizeContextStore) {
+	testCode := "test-code"
+	if err := s.AddByAuthCode(testCode, testAuthorizeContext, time.Minute); err != nil {
+		t.Fatalf("failed to add authorize context: %v", err)
+	}
+	if authorizeContext, err := s.GetByAuthCode(testCode); err != nil || authorizeContext.CodeId != "test-code-id" {
+		t.Fatalf("Expected to get the authorize context of the code, got %+v, %v", authorizeContext, err)
+	}
+	authorizeContext, err := s.ConsumeAuthCode(testCode)
+	if err != nil {
+		t.Fatalf("failed to consume code: %v", err)
+	}
+	if authorizeContext.CodeId != "test-code-id" {
+		t.Errorf("Unexpected authorize context %+v", authorizeContext)
+	}
+	authorizeContext, err = s.ConsumeAuthCode(testCode)
+	if err != ErrAuthorizationCodeReused {
+		t.Errorf("Expected ErrAuthorizationCodeReused, got %v", err)
+	}
+	if authorizeContext.CodeId != "test-code-id" {
+		t.Errorf("Expected the authorize context of the reused code, got %+v", authorizeContext)
+	}
+	if _, err := s.GetByAuthCode(testCode); err != ErrAuthorizationCodeReused {
+		t.Errorf("Expected ErrAuthorizationCodeReused, got %v", err)
+	}
+	if _, err := s.ConsumeAuthCode("unknown-code"); err != ErrAuthorizationCodeNotFound {
+		t.Errorf("Expected ErrAuthorizationCodeNotFound, got %v", err)
+	}
+	if err := s.AddByAuthCode("expired-code", testAuthorizeContext, -time.Second); err != nil {
+		t.Fatalf("failed to add authorize context: %v", err)
+	}
+	if _, err := s.GetByAuthCode("expired-code"); err != ErrAuthorizationCodeNotFound {
+		t.Errorf("Expected ErrAuthorizationCodeNotFound for an expired code, got %v", err)
+	}
+	if _, err := s.ConsumeAuthCode("expired-code"); err != ErrAuthorizationCodeNotFound {
+		t.Errorf("Expected ErrAuthorizationCodeNotFound for an expired code, got %v", err)
+	}
+}
+
+func TestInMemoryAuthorizeContextStoreBySessionDataKey(t *testing.T) {
+	testAuthorizeContextBySessionDataKey(t, NewInMemoryAuthorizeContextStore())
+}
+
+func TestInMemoryAuthorizeContextStoreConsumeAuthCode(t *testing.T) {
+	testConsumeAuthCode(t, NewInMemoryAuthorizeContextStore())
+}
+
+func TestCacheAuthorizeContextStoreBySessionDataKey(t *testing.T) {
+	testAuthorizeContextBySessionDataKey(t, NewCacheAuthorizeContextStore(cache.NewMemoryBackend()))
+}
+
+func TestCacheAuthorizeContextStoreConsumeAuthCode(t *testing.T) {
+	testConsumeAuthCode(t, NewCacheAuthorizeContextStore(cache.NewMemoryBackend()))
+}
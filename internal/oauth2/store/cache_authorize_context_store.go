@@ -0,0 +1,127 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+)
+
+const (
+	sessionDataKeyCachePrefix = "authorize_context_session_data_key_"
+	authCodeCachePrefix       = "authorize_context_code_"
+	usedAuthCodeCachePrefix   = "authorize_context_used_code_"
+)
+
+type cacheAuthorizeContextStore struct {
+	backend cache.Backend
+}
+
+type authCodeCacheEntry struct {
+	AuthorizeContext models.OAuth2AuthorizeContext `json:"authorize_context"`
+	ExpiresAt        time.Time                     `json:"expires_at"`
+}
+
+// NewCacheAuthorizeContextStore returns an authorize context store that keeps the contexts in a
+// cache backend, such as Redis shared by all instances.
+func NewCacheAuthorizeContextStore(backend cache.Backend) AuthorizeContextStore {
+	return &cacheAuthorizeContextStore{
+		backend: backend,
+	}
+}
+
+func (s *cacheAuthorizeContextStore) AddBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.backend.Delete(sessionDataKeyCachePrefix + sessionDataKey)
+	}
+	data, err := cache.Encode(authorizeContext)
+	if err != nil {
+		return err
+	}
+	return s.backend.Set(sessionDataKeyCachePrefix+sessionDataKey, data, ttl)
+}
+
+func (s *cacheAuthorizeContextStore) GetBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool) {
+	data, found, err := s.backend.Get(sessionDataKeyCachePrefix + sessionDataKey)
+	if err != nil {
+		log.Printf("failed to get authorize context: %v", err)
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	if !found {
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	authorizeContext, err := cache.Decode[models.OAuth2AuthorizeContext](data)
+	if err != nil {
+		log.Printf("failed to read authorize context: %v", err)
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	return authorizeContext, true
+}
+
+func (s *cacheAuthorizeContextStore) DeleteBySessionDataKey(sessionDataKey string) {
+	if err := s.backend.Delete(sessionDataKeyCachePrefix + sessionDataKey); err != nil {
+		log.Printf("failed to delete authorize context: %v", err)
+	}
+}
+
+func (s *cacheAuthorizeContextStore) AddByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.backend.Delete(authCodeCachePrefix + code)
+	}
+	data, err := cache.Encode(authCodeCacheEntry{AuthorizeContext: authorizeContext, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	return s.backend.Set(authCodeCachePrefix+code, data, ttl)
+}
+
+func (s *cacheAuthorizeContextStore) GetByAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	entry, err := s.getAuthCode(code)
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	_, used, err := s.backend.Get(usedAuthCodeCachePrefix + code)
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	if used {
+		return entry.AuthorizeContext, ErrAuthorizationCodeReused
+	}
+	return entry.AuthorizeContext, nil
+}
+
+func (s *cacheAuthorizeContextStore) ConsumeAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	entry, err := s.getAuthCode(code)
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	remaining := time.Until(entry.ExpiresAt)
+	// the marker is set at most once, so only one instance redeems the code
+	claimed, err := s.backend.SetNX(usedAuthCodeCachePrefix+code, []byte("1"), remaining)
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	if !claimed {
+		return entry.AuthorizeContext, ErrAuthorizationCodeReused
+	}
+	return entry.AuthorizeContext, nil
+}
+
+func (s *cacheAuthorizeContextStore) getAuthCode(code string) (authCodeCacheEntry, error) {
+	data, found, err := s.backend.Get(authCodeCachePrefix + code)
+	if err != nil {
+		return authCodeCacheEntry{}, err
+	}
+	if !found {
+		return authCodeCacheEntry{}, ErrAuthorizationCodeNotFound
+	}
+	entry, err := cache.Decode[authCodeCacheEntry](data)
+	if err != nil {
+		return authCodeCacheEntry{}, err
+	}
+	if time.Until(entry.ExpiresAt) <= 0 {
+		return authCodeCacheEntry{}, ErrAuthorizationCodeNotFound
+	}
+	return entry, nil
+}
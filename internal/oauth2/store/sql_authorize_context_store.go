@@ -0,0 +1,151 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+)
+
+const (
+	authorizeContextTypeSessionDataKey = "session_data_key"
+	authorizeContextTypeAuthCode       = "code"
+)
+
+type sqlAuthorizeContextStore struct {
+	db *sqlx.DB
+}
+
+type authorizeContextRow struct {
+	Context    string        `db:"context"`
+	ExpiresAt  int64         `db:"expires_at"`
+	ConsumedAt sql.NullInt64 `db:"consumed_at"`
+}
+
+// NewSQLAuthorizeContextStore returns an authorize context store that keeps the contexts in the
+// database so any instance can continue an authorization request. Expired contexts are swept every
+// sweepInterval.
+func NewSQLAuthorizeContextStore(db *sqlx.DB, sweepInterval time.Duration) AuthorizeContextStore {
+	s := &sqlAuthorizeContextStore{
+		db: db,
+	}
+	if sweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(sweepInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.sweep()
+			}
+		}()
+	}
+	return s
+}
+
+func (s *sqlAuthorizeContextStore) AddBySessionDataKey(sessionDataKey string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	return s.add(authorizeContextTypeSessionDataKey, sessionDataKey, authorizeContext, ttl)
+}
+
+func (s *sqlAuthorizeContextStore) GetBySessionDataKey(sessionDataKey string) (models.OAuth2AuthorizeContext, bool) {
+	row, found := s.get(authorizeContextTypeSessionDataKey, sessionDataKey)
+	if !found || row.ExpiresAt <= time.Now().Unix() {
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	authorizeContext, err := row.toAuthorizeContext()
+	if err != nil {
+		log.Printf("failed to read authorize context: %v", err)
+		return models.OAuth2AuthorizeContext{}, false
+	}
+	return authorizeContext, true
+}
+
+func (s *sqlAuthorizeContextStore) DeleteBySessionDataKey(sessionDataKey string) {
+	_, err := s.db.Exec("DELETE FROM authorize_context WHERE type = ? AND id = ?", authorizeContextTypeSessionDataKey, sessionDataKey)
+	if err != nil {
+		log.Printf("failed to delete authorize context: %v", err)
+	}
+}
+
+func (s *sqlAuthorizeContextStore) AddByAuthCode(code string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	return s.add(authorizeContextTypeAuthCode, code, authorizeContext, ttl)
+}
+
+func (s *sqlAuthorizeContextStore) GetByAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	row, found := s.get(authorizeContextTypeAuthCode, code)
+	if !found || row.ExpiresAt <= time.Now().Unix() {
+		return models.OAuth2AuthorizeContext{}, ErrAuthorizationCodeNotFound
+	}
+	authorizeContext, err := row.toAuthorizeContext()
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	if row.ConsumedAt.Valid {
+		return authorizeContext, ErrAuthorizationCodeReused
+	}
+	return authorizeContext, nil
+}
+
+func (s *sqlAuthorizeContextStore) ConsumeAuthCode(code string) (models.OAuth2AuthorizeContext, error) {
+	now := time.Now().Unix()
+	// the conditional update lets exactly one instance claim the code
+	result, err := s.db.Exec("UPDATE authorize_context SET consumed_at = ? WHERE type = ? AND id = ? AND consumed_at IS NULL AND expires_at > ?", now, authorizeContextTypeAuthCode, code, now)
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	row, found := s.get(authorizeContextTypeAuthCode, code)
+	if !found {
+		return models.OAuth2AuthorizeContext{}, ErrAuthorizationCodeNotFound
+	}
+	authorizeContext, err := row.toAuthorizeContext()
+	if err != nil {
+		return models.OAuth2AuthorizeContext{}, err
+	}
+	if claimed == 1 {
+		return authorizeContext, nil
+	}
+	if row.ConsumedAt.Valid && row.ExpiresAt > now {
+		return authorizeContext, ErrAuthorizationCodeReused
+	}
+	return models.OAuth2AuthorizeContext{}, ErrAuthorizationCodeNotFound
+}
+
+func (s *sqlAuthorizeContextStore) add(contextType, id string, authorizeContext models.OAuth2AuthorizeContext, ttl time.Duration) error {
+	contextJSON, err := json.Marshal(authorizeContext)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO authorize_context (type, id, context, expires_at) VALUES (?, ?, ?, ?) ON CONFLICT (type, id) DO UPDATE SET context = excluded.context, expires_at = excluded.expires_at",
+		contextType, id, string(contextJSON), time.Now().Add(ttl).Unix())
+	return err
+}
+
+func (s *sqlAuthorizeContextStore) get(contextType, id string) (authorizeContextRow, bool) {
+	var row authorizeContextRow
+	err := s.db.Get(&row, "SELECT context, expires_at, consumed_at FROM authorize_context WHERE type = ? AND id = ?", contextType, id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("failed to get authorize context: %v", err)
+		}
+		return authorizeContextRow{}, false
+	}
+	return row, true
+}
+
+func (s *sqlAuthorizeContextStore) sweep() {
+	_, err := s.db.Exec("DELETE FROM authorize_context WHERE expires_at <= ?", time.Now().Unix())
+	if err != nil {
+		log.Printf("failed to sweep authorize contexts: %v", err)
+	}
+}
+
+func (row authorizeContextRow) toAuthorizeContext() (models.OAuth2AuthorizeContext, error) {
+	var authorizeContext models.OAuth2AuthorizeContext
+	err := json.Unmarshal([]byte(row.Context), &authorizeContext)
+	return authorizeContext, err
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+func newTestSQLAuthorizeContextStore(t *testing.T) *sqlAuthorizeContextStore {
+	db := testutil.NewDB(t, "authorize_context.sql")
+	return NewSQLAuthorizeContextStore(db, 0).(*sqlAuthorizeContextStore)
+}
+
+func TestSQLAuthorizeContextStoreBySessionDataKey(t *testing.T) {
+	testAuthorizeContextBySessionDataKey(t, newTestSQLAuthorizeContextStore(t))
+}
+
+func TestSQLAuthorizeContextStoreConsumeAuthCode(t *testing.T) {
+	testConsumeAuthCode(t, newTestSQLAuthorizeContextStore(t))
+}
+
+func TestSQLAuthorizeContextStoreConsumeAuthCodeOnce(t *testing.T) {
+	s := newTestSQLAuthorizeContextStore(t)
+	if err := s.AddByAuthCode("test-code", testAuthorizeContext, time.Minute); err != nil {
+		t.Fatalf("failed to add authorize context: %v", err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ConsumeAuthCode("test-code"); err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Errorf("Expected the code to be consumed once, got %d", consumed)
+	}
+}
+
+func TestSQLAuthorizeContextStoreSweep(t *testing.T) {
+	s := newTestSQLAuthorizeContextStore(t)
+	s.AddByAuthCode("expired-code", testAuthorizeContext, -time.Second)
+	s.AddByAuthCode("test-code", testAuthorizeContext, time.Minute)
+	s.sweep()
+	var count int
+	if err := s.db.Get(&count, "SELECT COUNT(*) FROM authorize_context"); err != nil {
+		t.Fatalf("failed to count authorize contexts: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected only the active code to remain, got %d", count)
+	}
+}
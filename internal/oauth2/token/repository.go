@@ -2,14 +2,29 @@ package token
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// Token is the stored record of an issued access or refresh token.
+type Token struct {
+	Id             string         `db:"id"`
+	EntryId        string         `db:"entry_id"`
+	ClientId       string         `db:"client_id"`
+	OrganizationId sql.NullString `db:"organization_id"`
+	SessionId      sql.NullString `db:"session_id"`
+	CodeId         sql.NullString `db:"code_id"`
+}
+
 type TokenRepository interface {
-	PersistToken(ctx context.Context, jti, entryId, clientId, organizationId string, createdAt, expiresAt int64) error
+	PersistToken(ctx context.Context, jti, entryId, clientId, organizationId, sessionId, codeId string, createdAt, expiresAt int64) error
 	DeleteToken(ctx context.Context, jti string) error
+	DeleteTokensBySession(ctx context.Context, sessionId string) error
+	DeleteTokensByCode(ctx context.Context, codeId string) error
+	DeleteTokensByUser(ctx context.Context, userId, organizationId string) error
 	IsTokenExists(ctx context.Context, jti string) (bool, error)
+	GetToken(ctx context.Context, jti string) (Token, bool, error)
 }
 
 type tokenRepository struct {
@@ -22,8 +37,9 @@ func NewTokenRepository(db *sqlx.DB) TokenRepository {
 	}
 }
 
-func (r *tokenRepository) PersistToken(ctx context.Context, jti, entryId, clientId, organizationId string, createdAt, expiresAt int64) error {
-	_, err := r.db.Exec("INSERT INTO token (id, entry_id, client_id, organization_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6)", jti, entryId, clientId, organizationId, createdAt, expiresAt)
+func (r *tokenRepository) PersistToken(ctx context.Context, jti, entryId, clientId, organizationId, sessionId, codeId string, createdAt, expiresAt int64) error {
+	_, err := r.db.Exec("INSERT INTO token (id, entry_id, client_id, organization_id, session_id, code_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)", jti, entryId, clientId,
+		sql.NullString{String: organizationId, Valid: organizationId != ""}, sql.NullString{String: sessionId, Valid: sessionId != ""}, sql.NullString{String: codeId, Valid: codeId != ""}, createdAt, expiresAt)
 	if err != nil {
 		return err
 	}
@@ -38,6 +54,30 @@ func (r *tokenRepository) DeleteToken(ctx context.Context, jti string) error {
 	return nil
 }
 
+func (r *tokenRepository) DeleteTokensBySession(ctx context.Context, sessionId string) error {
+	_, err := r.db.Exec("DELETE FROM token WHERE session_id=$1", sessionId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) DeleteTokensByUser(ctx context.Context, userId, organizationId string) error {
+	_, err := r.db.Exec("DELETE FROM token WHERE entry_id=$1 AND organization_id=$2", userId, organizationId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) DeleteTokensByCode(ctx context.Context, codeId string) error {
+	_, err := r.db.Exec("DELETE FROM token WHERE code_id=$1", codeId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (r *tokenRepository) IsTokenExists(ctx context.Context, jti string) (bool, error) {
 	var count int
 	err := r.db.Get(&count, "SELECT COUNT(*) FROM token WHERE id=$1", jti)
@@ -46,3 +86,15 @@ func (r *tokenRepository) IsTokenExists(ctx context.Context, jti string) (bool,
 	}
 	return count > 0, nil
 }
+
+func (r *tokenRepository) GetToken(ctx context.Context, jti string) (Token, bool, error) {
+	var token Token
+	err := r.db.Get(&token, "SELECT id, entry_id, client_id, organization_id, session_id, code_id FROM token WHERE id=$1", jti)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Token{}, false, nil
+		}
+		return Token{}, false, err
+	}
+	return token, true, nil
+}
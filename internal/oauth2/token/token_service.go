@@ -19,6 +19,14 @@ type TokenService interface {
 	GenerateRefreshToken(ctx context.Context, oauth2AuthroizeContext models.OAuth2AuthorizeContext, UserData map[string]string) (string, error)
 	ValidateRefreshToken(ctx context.Context, tokenString string) (models.OAuth2AuthorizeContext, error)
 	RevokeToken(ctx context.Context, tokenString string)
+	IsTokenActive(ctx context.Context, jti string) (bool, error)
+	GenerateAuthorizationResponseToken(ctx context.Context, issuer, clientId string, parameters map[string]string) (string, error)
+	ParseIdTokenHint(ctx context.Context, tokenString, issuer string) (jwt.MapClaims, error)
+	GenerateLogoutToken(ctx context.Context, issuer, clientId, sub, sid string) (string, error)
+	GenerateIdToken(ctx context.Context, issuer string, oauth2AuthroizeContext models.OAuth2AuthorizeContext) (string, error)
+	RevokeTokensBySession(ctx context.Context, sessionId string) error
+	RevokeTokensByAuthorizationCode(ctx context.Context, codeId string) error
+	RevokeTokensByUser(ctx context.Context, userId, orgId string) error
 }
 
 type tokenService struct {
@@ -40,7 +48,14 @@ func (s *tokenService) GenerateAccessToken(ctx context.Context, oauth2AuthroizeC
 	if err != nil {
 		return "", err
 	}
-	// s.tokenRepository.PersistToken(ctx, claims["jti"].(string), claims["sub"].(string), oauth2AuthroizeContext.OAuth2AuthorizeRequest.ClientId, oauth2AuthroizeContext.OAuth2AuthorizeRequest.OrganizationId, claims["iat"].(int64), claims["exp"].(int64))
+	if !oauth2AuthroizeContext.AuthTime.IsZero() {
+		claims["auth_time"] = oauth2AuthroizeContext.AuthTime.Unix()
+	}
+	// access tokens are stored like refresh tokens, so they can be revoked before they expire
+	err = s.tokenRepository.PersistToken(ctx, claims["jti"].(string), claims["sub"].(string), oauth2AuthroizeContext.OAuth2AuthorizeRequest.ClientId, oauth2AuthroizeContext.OAuth2AuthorizeRequest.OrganizationId, oauth2AuthroizeContext.SessionId, oauth2AuthroizeContext.CodeId, claims["iat"].(int64), claims["exp"].(int64))
+	if err != nil {
+		return "", err
+	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
 	keyPair, err := s.keyManager.GetKeyPair("eddsa")
 	if err != nil {
@@ -58,7 +73,7 @@ func (s *tokenService) GenerateRefreshToken(ctx context.Context, oauth2Authroize
 	if err != nil {
 		return "", err
 	}
-	err = s.tokenRepository.PersistToken(ctx, claims["jti"].(string), claims["sub"].(string), oauth2AuthroizeContext.OAuth2AuthorizeRequest.ClientId, oauth2AuthroizeContext.OAuth2AuthorizeRequest.OrganizationId, claims["iat"].(int64), claims["exp"].(int64))
+	err = s.tokenRepository.PersistToken(ctx, claims["jti"].(string), claims["sub"].(string), oauth2AuthroizeContext.OAuth2AuthorizeRequest.ClientId, oauth2AuthroizeContext.OAuth2AuthorizeRequest.OrganizationId, oauth2AuthroizeContext.SessionId, oauth2AuthroizeContext.CodeId, claims["iat"].(int64), claims["exp"].(int64))
 	if err != nil {
 		return "", err
 	}
@@ -101,7 +116,7 @@ func (s *tokenService) ValidateRefreshToken(ctx context.Context, tokenString str
 		if !ok {
 			return models.OAuth2AuthorizeContext{}, errors.New("jti not found in refresh token")
 		}
-		isRefreshTokenExists, err := s.tokenRepository.IsTokenExists(ctx, jti)
+		refreshToken, isRefreshTokenExists, err := s.tokenRepository.GetToken(ctx, jti)
 		if err != nil {
 			return models.OAuth2AuthorizeContext{}, err
 		}
@@ -116,13 +131,17 @@ func (s *tokenService) ValidateRefreshToken(ctx context.Context, tokenString str
 		if !ok {
 			return models.OAuth2AuthorizeContext{}, errors.New("sub not found in refresh token")
 		}
+		// the access tokens issued from the refresh token are revoked with it, by session or by code
 		authroizeContext := models.OAuth2AuthorizeContext{
 			OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{
-				ClientId: clientID,
+				ClientId:       clientID,
+				OrganizationId: refreshToken.OrganizationId.String,
 			},
 			AuthenticatedUser: authn_models.AuthenticatedUser{
 				Id: sub,
 			},
+			SessionId: refreshToken.SessionId.String,
+			CodeId:    refreshToken.CodeId.String,
 		}
 		return authroizeContext, nil
 	}
@@ -150,6 +169,143 @@ func (s *tokenService) RevokeToken(ctx context.Context, tokenString string) {
 	}
 }
 
+// IsTokenActive reports whether the token with the jti was issued and has not been revoked.
+func (s *tokenService) IsTokenActive(ctx context.Context, jti string) (bool, error) {
+	return s.tokenRepository.IsTokenExists(ctx, jti)
+}
+
+// RevokeTokensBySession revokes the access and refresh tokens issued under a session.
+func (s *tokenService) RevokeTokensBySession(ctx context.Context, sessionId string) error {
+	return s.tokenRepository.DeleteTokensBySession(ctx, sessionId)
+}
+
+// RevokeTokensByAuthorizationCode revokes the access and refresh tokens issued from an
+// authorization code.
+func (s *tokenService) RevokeTokensByAuthorizationCode(ctx context.Context, codeId string) error {
+	return s.tokenRepository.DeleteTokensByCode(ctx, codeId)
+}
+
+// RevokeTokensByUser revokes the access and refresh tokens issued to a user, under any session.
+func (s *tokenService) RevokeTokensByUser(ctx context.Context, userId, orgId string) error {
+	return s.tokenRepository.DeleteTokensByUser(ctx, userId, orgId)
+}
+
+// GenerateAuthorizationResponseToken wraps authorization response parameters in a signed JWT (JARM).
+func (s *tokenService) GenerateAuthorizationResponseToken(ctx context.Context, issuer, clientId string, parameters map[string]string) (string, error) {
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": clientId,
+		"exp": time.Now().Add(time.Minute * 10).Unix(),
+	}
+	for name, value := range parameters {
+		claims[name] = value
+	}
+	responseToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	keyPair, err := s.keyManager.GetKeyPair("eddsa")
+	if err != nil {
+		return "", err
+	}
+	tokenString, err := responseToken.SignedString(keyPair.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// ParseIdTokenHint verifies that the token is an ID token previously issued by the issuer. Expired
+// tokens are accepted since a hint is usually presented after the token has expired. The caller
+// checks that the audience is a client of the organization.
+func (s *tokenService) ParseIdTokenHint(ctx context.Context, tokenString, issuer string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		keyPair, err := s.keyManager.GetKeyPair("eddsa")
+		if err != nil {
+			return "", err
+		}
+		return keyPair.PublicKey, nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil || !token.Valid {
+		return jwt.MapClaims{}, errors.New("invalid id_token_hint")
+	}
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return jwt.MapClaims{}, errors.New("id_token_hint was issued by another issuer")
+	}
+	// access, refresh and logout tokens carry a jti, and authorization response tokens have no subject
+	sub, _ := claims.GetSubject()
+	audience, _ := claims.GetAudience()
+	_, hasJti := claims["jti"]
+	if sub == "" || len(audience) != 1 || audience[0] == "" || hasJti {
+		return jwt.MapClaims{}, errors.New("id_token_hint is not an id token")
+	}
+	return claims, nil
+}
+
+func (s *tokenService) GenerateIdToken(ctx context.Context, issuer string, oauth2AuthroizeContext models.OAuth2AuthorizeContext) (string, error) {
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": oauth2AuthroizeContext.AuthenticatedUser.Id,
+		"aud": oauth2AuthroizeContext.OAuth2AuthorizeRequest.ClientId,
+		"exp": time.Now().Add(time.Minute * 60).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	if nonce := oauth2AuthroizeContext.OAuth2AuthorizeRequest.Nonce; nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if oauth2AuthroizeContext.SessionId != "" {
+		claims["sid"] = oauth2AuthroizeContext.SessionId
+	}
+	if !oauth2AuthroizeContext.AuthTime.IsZero() {
+		claims["auth_time"] = oauth2AuthroizeContext.AuthTime.Unix()
+	}
+	if len(oauth2AuthroizeContext.AuthMethods) > 0 {
+		claims["amr"] = oauth2AuthroizeContext.AuthMethods
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	keyPair, err := s.keyManager.GetKeyPair("eddsa")
+	if err != nil {
+		return "", err
+	}
+	tokenString, err := idToken.SignedString(keyPair.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// GenerateLogoutToken creates the logout token sent to clients in OIDC back-channel logout.
+func (s *tokenService) GenerateLogoutToken(ctx context.Context, issuer, clientId, sub, sid string) (string, error) {
+	jti, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": clientId,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute * 2).Unix(),
+		"jti": jti.String(),
+		"sub": sub,
+		"sid": sid,
+		"events": map[string]interface{}{
+			"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{},
+		},
+	}
+	logoutToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	logoutToken.Header["typ"] = "logout+jwt"
+	keyPair, err := s.keyManager.GetKeyPair("eddsa")
+	if err != nil {
+		return "", err
+	}
+	tokenString, err := logoutToken.SignedString(keyPair.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
 func GetClaimsForAccessToken(sub, issuer string) (jwt.MapClaims, error) {
 	expiresAt := time.Now().Add(time.Minute * 60).Unix()
 	iat := time.Now().Unix()
@@ -0,0 +1,45 @@
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	server_models "github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+func TestParseIdTokenHint(t *testing.T) {
+	ctx := context.Background()
+	s := NewTokenService(nil, NewTokenRepository(testutil.NewDB(t, "token.sql")), testutil.NewKeyManager(t))
+	issuer := "https://localhost:9444/o/test"
+	authorizeContext := models.OAuth2AuthorizeContext{OAuth2AuthorizeRequest: server_models.OAuth2AuthorizeRequest{ClientId: "test-client-id"}}
+	authorizeContext.AuthenticatedUser.Id = "test-user-id"
+
+	idToken, err := s.GenerateIdToken(ctx, issuer, authorizeContext)
+	if err != nil {
+		t.Fatalf("Failed to generate an ID token: %v", err)
+	}
+	claims, err := s.ParseIdTokenHint(ctx, idToken, issuer)
+	if err != nil {
+		t.Fatalf("Expected the ID token to be a valid hint, got %v", err)
+	}
+	if sub, _ := claims.GetSubject(); sub != "test-user-id" {
+		t.Errorf("Expected the subject of the ID token, got %q", sub)
+	}
+	if _, err := s.ParseIdTokenHint(ctx, idToken, "https://localhost:9444/o/other"); err == nil {
+		t.Errorf("Expected an ID token of another organization to be rejected")
+	}
+
+	accessToken, _ := s.GenerateAccessToken(ctx, authorizeContext, nil)
+	logoutToken, _ := s.GenerateLogoutToken(ctx, issuer, "test-client-id", "test-user-id", "test-session-id")
+	responseToken, _ := s.GenerateAuthorizationResponseToken(ctx, issuer, "test-client-id", map[string]string{"code": "test-code"})
+	for _, tokenString := range []string{accessToken, logoutToken, responseToken} {
+		if _, err := s.ParseIdTokenHint(ctx, tokenString, issuer); err == nil {
+			t.Errorf("Expected a token that is not an ID token to be rejected: %s", tokenString)
+		}
+	}
+	if _, err := s.ParseIdTokenHint(ctx, accessToken, "tiny-is"); err == nil {
+		t.Errorf("Expected an access token to be rejected")
+	}
+}
@@ -0,0 +1,315 @@
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/notification"
+)
+
+var (
+	ErrInvalidCode   = errors.New("invalid code")
+	ErrCodeExpired   = errors.New("the code expired, request a new one")
+	ErrInvalidLink   = errors.New("the sign in link is invalid or expired")
+	ErrResendTooSoon = errors.New("wait a moment before requesting another code")
+	ErrNoEmail       = errors.New("the user has no email address")
+	ErrNoPhoneNumber = errors.New("the user has no phone number")
+)
+
+// Channel is how a code is delivered. Codes of different channels are kept apart, so a code sent
+// by email can't be used where an SMS code is expected.
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+)
+
+const (
+	codeCachePrefix   = "otp_code_"
+	linkCachePrefix   = "otp_link_"
+	resendCachePrefix = "otp_resend_"
+	codeDigits        = 6
+	maxCodeAttempts   = 5
+)
+
+// Recipient is the user a code or link is sent to.
+type Recipient struct {
+	UserId         string `json:"user_id"`
+	OrganizationId string `json:"organization_id"`
+	Email          string `json:"email,omitempty"`
+	PhoneNumber    string `json:"phone_number,omitempty"`
+}
+
+// challenge is a code or link that was sent, kept until it is used or expires.
+type challenge struct {
+	Key       string    `json:"key"`
+	Recipient Recipient `json:"recipient"`
+	CodeHash  string    `json:"code_hash,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type OTPService interface {
+	// SendCode sends a one-time code to the recipient through the channel. The key ties the code
+	// to what it was requested for, such as a login, and a new code replaces the previous one.
+	SendCode(ctx context.Context, channel Channel, key string, recipient Recipient, organizationName string) error
+	// VerifyCode returns the recipient of the code sent for the key. A code can be used once, and
+	// is dropped after too many wrong guesses.
+	VerifyCode(ctx context.Context, channel Channel, key, code string) (Recipient, error)
+	// SendMagicLink emails a sign in link to the recipient, made from a one-time token by link.
+	SendMagicLink(ctx context.Context, key string, recipient Recipient, organizationName string, link func(token string) string) error
+	// VerifyMagicLink returns the key the link was sent for and its recipient, once.
+	VerifyMagicLink(ctx context.Context, token string) (string, Recipient, error)
+	// GetMagicLinkKey returns the key the link was sent for without using up the link.
+	GetMagicLinkKey(ctx context.Context, token string) (string, error)
+}
+
+type otpService struct {
+	cfg         *config.Config
+	backend     cache.Backend
+	emailSender notification.EmailSender
+	smsSender   notification.SMSSender
+}
+
+// NewOTPService returns a service that keeps the codes and links in the cache backend.
+func NewOTPService(cfg *config.Config, backend cache.Backend, emailSender notification.EmailSender, smsSender notification.SMSSender) OTPService {
+	return &otpService{
+		cfg:         cfg,
+		backend:     backend,
+		emailSender: emailSender,
+		smsSender:   smsSender,
+	}
+}
+
+func (s *otpService) SendCode(ctx context.Context, channel Channel, key string, recipient Recipient, organizationName string) error {
+	switch channel {
+	case ChannelEmail:
+		if recipient.Email == "" {
+			return ErrNoEmail
+		}
+	case ChannelSMS:
+		if recipient.PhoneNumber == "" {
+			return ErrNoPhoneNumber
+		}
+	default:
+		return fmt.Errorf("unsupported channel: %s", channel)
+	}
+	if err := s.throttle(channel, recipient); err != nil {
+		return err
+	}
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	timeout := s.cfg.GetOTPTimeout()
+	if err := s.save(codeCacheKey(channel, key), challenge{
+		Key:       key,
+		Recipient: recipient,
+		CodeHash:  hashSecret(code),
+		ExpiresAt: time.Now().Add(timeout),
+	}); err != nil {
+		return err
+	}
+	minutes := int(timeout.Minutes())
+	if channel == ChannelSMS {
+		return s.smsSender.SendSMS(ctx, notification.SMS{
+			To:   recipient.PhoneNumber,
+			Body: fmt.Sprintf("%s is your %s code. It expires in %d minutes. Don't share it with anyone.", code, organizationName, minutes),
+		})
+	}
+	return s.emailSender.SendEmail(ctx, notification.Email{
+		To:      recipient.Email,
+		Subject: fmt.Sprintf("Your %s sign in code", organizationName),
+		Body:    fmt.Sprintf("Your sign in code is %s. It expires in %d minutes.\n\nIf you did not try to sign in, you can ignore this email.", code, minutes),
+	})
+}
+
+func (s *otpService) VerifyCode(ctx context.Context, channel Channel, key, code string) (Recipient, error) {
+	cacheKey := codeCacheKey(channel, key)
+	state, found, err := s.load(cacheKey)
+	if err != nil {
+		return Recipient{}, err
+	}
+	if !found {
+		return Recipient{}, ErrCodeExpired
+	}
+	// every guess is counted before it is checked, so parallel guesses can't get past the limit
+	attempts, err := s.backend.Incr(challengeKey(cacheKey, state)+"_attempts", time.Until(state.ExpiresAt))
+	if err != nil {
+		return Recipient{}, err
+	}
+	if attempts > maxCodeAttempts {
+		return Recipient{}, ErrCodeExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(state.CodeHash), []byte(hashSecret(code))) != 1 {
+		if attempts == maxCodeAttempts {
+			if err := s.backend.Delete(cacheKey); err != nil {
+				return Recipient{}, err
+			}
+			return Recipient{}, ErrCodeExpired
+		}
+		return Recipient{}, ErrInvalidCode
+	}
+	if err := s.consume(cacheKey, state); err != nil {
+		return Recipient{}, err
+	}
+	return state.Recipient, nil
+}
+
+func (s *otpService) SendMagicLink(ctx context.Context, key string, recipient Recipient, organizationName string, link func(token string) string) error {
+	if recipient.Email == "" {
+		return ErrNoEmail
+	}
+	if err := s.throttle(ChannelEmail, recipient); err != nil {
+		return err
+	}
+	token, err := notification.NewLinkToken()
+	if err != nil {
+		return err
+	}
+	timeout := s.cfg.GetMagicLinkTimeout()
+	if err := s.save(linkCachePrefix+notification.HashLinkToken(token), challenge{
+		Key:       key,
+		Recipient: recipient,
+		ExpiresAt: time.Now().Add(timeout),
+	}); err != nil {
+		return err
+	}
+	return s.emailSender.SendEmail(ctx, notification.Email{
+		To:      recipient.Email,
+		Subject: fmt.Sprintf("Sign in to %s", organizationName),
+		Body:    fmt.Sprintf("Open this link to sign in:\n\n%s\n\nThe link expires in %d minutes and can be used once. If you did not try to sign in, you can ignore this email.", link(token), int(timeout.Minutes())),
+	})
+}
+
+func (s *otpService) VerifyMagicLink(ctx context.Context, token string) (string, Recipient, error) {
+	if token == "" {
+		return "", Recipient{}, ErrInvalidLink
+	}
+	cacheKey := linkCachePrefix + notification.HashLinkToken(token)
+	state, found, err := s.load(cacheKey)
+	if err != nil {
+		return "", Recipient{}, err
+	}
+	if !found {
+		return "", Recipient{}, ErrInvalidLink
+	}
+	if err := s.consume(cacheKey, state); err != nil {
+		if errors.Is(err, ErrCodeExpired) {
+			return "", Recipient{}, ErrInvalidLink
+		}
+		return "", Recipient{}, err
+	}
+	return state.Key, state.Recipient, nil
+}
+
+func (s *otpService) GetMagicLinkKey(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidLink
+	}
+	state, found, err := s.load(linkCachePrefix + notification.HashLinkToken(token))
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrInvalidLink
+	}
+	return state.Key, nil
+}
+
+// throttle limits how often codes and links are sent to a user through a channel, whichever login
+// they are requested from.
+func (s *otpService) throttle(channel Channel, recipient Recipient) error {
+	interval := s.cfg.GetOTPResendInterval()
+	if interval == 0 {
+		return nil
+	}
+	allowed, err := s.backend.SetNX(resendCachePrefix+string(channel)+"_"+recipient.OrganizationId+"_"+recipient.UserId, []byte("1"), interval)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrResendTooSoon
+	}
+	return nil
+}
+
+func (s *otpService) save(cacheKey string, state challenge) error {
+	ttl := time.Until(state.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := cache.Encode(state)
+	if err != nil {
+		return err
+	}
+	return s.backend.Set(cacheKey, data, ttl)
+}
+
+func (s *otpService) load(cacheKey string) (challenge, bool, error) {
+	data, found, err := s.backend.Get(cacheKey)
+	if err != nil || !found {
+		return challenge{}, false, err
+	}
+	state, err := cache.Decode[challenge](data)
+	if err != nil {
+		return challenge{}, false, err
+	}
+	if time.Now().After(state.ExpiresAt) {
+		return challenge{}, false, nil
+	}
+	return state, true, nil
+}
+
+// consume marks the challenge as used, failing when it already was.
+func (s *otpService) consume(cacheKey string, state challenge) error {
+	ttl := time.Until(state.ExpiresAt)
+	if ttl <= 0 {
+		return ErrCodeExpired
+	}
+	used, err := notification.UseLink(s.backend, challengeKey(cacheKey, state)+"_used", ttl)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrCodeExpired
+	}
+	return s.backend.Delete(cacheKey)
+}
+
+// challengeKey identifies one challenge stored under the cache key, as a new code replaces the
+// previous one under the same key.
+func challengeKey(cacheKey string, state challenge) string {
+	return cacheKey + "_" + strconv.FormatInt(state.ExpiresAt.UnixNano(), 10)
+}
+
+func codeCacheKey(channel Channel, key string) string {
+	return codeCachePrefix + string(channel) + "_" + key
+}
+
+func generateCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/notification"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+var testRecipient = Recipient{UserId: "test-user-id", OrganizationId: "test-organization-id", Email: "alice@example.com", PhoneNumber: "+94771234567"}
+
+func newTestOTPService(resendInterval int) (OTPService, *testutil.EmailSender, *notification.FakeSMSSender) {
+	cfg := &config.Config{}
+	cfg.OTP.ResendInterval = resendInterval
+	emailSender := &testutil.EmailSender{}
+	smsSender := notification.NewFakeSMSSender()
+	return NewOTPService(cfg, cache.NewMemoryBackend(), emailSender, smsSender), emailSender, smsSender
+}
+
+func TestEmailCode(t *testing.T) {
+	ctx := context.Background()
+	s, sender, _ := newTestOTPService(-1)
+	if err := s.SendCode(ctx, ChannelEmail, "test-session-data-key", testRecipient, "test-organization"); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	code := sender.Last(t, `code is (\d{6})\.`)
+	if sender.Emails()[0].To != testRecipient.Email {
+		t.Errorf("Expected the code to be sent to %s, got %s", testRecipient.Email, sender.Emails()[0].To)
+	}
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "other-session-data-key", code); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Expected the code to be tied to its login, got %v", err)
+	}
+	recipient, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", code)
+	if err != nil {
+		t.Fatalf("Failed to verify code: %v", err)
+	}
+	if recipient != testRecipient {
+		t.Errorf("Expected %+v, got %+v", testRecipient, recipient)
+	}
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", code); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Expected a used code to be rejected, got %v", err)
+	}
+}
+
+func TestEmailCodeIsDroppedAfterTooManyAttempts(t *testing.T) {
+	ctx := context.Background()
+	s, sender, _ := newTestOTPService(-1)
+	s.SendCode(ctx, ChannelEmail, "test-session-data-key", testRecipient, "test-organization")
+	code := sender.Last(t, `code is (\d{6})\.`)
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	for i := 1; i < maxCodeAttempts; i++ {
+		if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", wrongCode); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("Expected an invalid code, got %v", err)
+		}
+	}
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", wrongCode); !errors.Is(err, ErrCodeExpired) {
+		t.Fatalf("Expected the code to be dropped, got %v", err)
+	}
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", code); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Expected the dropped code to be rejected, got %v", err)
+	}
+}
+
+func TestConcurrentWrongCodes(t *testing.T) {
+	ctx := context.Background()
+	s, sender, _ := newTestOTPService(-1)
+	s.SendCode(ctx, ChannelEmail, "test-session-data-key", testRecipient, "test-organization")
+	code := sender.Last(t, `code is (\d{6})\.`)
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	var invalid atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4*maxCodeAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", wrongCode); errors.Is(err, ErrInvalidCode) {
+				invalid.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := invalid.Load(); n != maxCodeAttempts-1 {
+		t.Errorf("Expected %d guesses to be checked, got %d", maxCodeAttempts-1, n)
+	}
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", code); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Expected the code to be dropped, got %v", err)
+	}
+}
+
+func TestMagicLink(t *testing.T) {
+	ctx := context.Background()
+	s, sender, _ := newTestOTPService(-1)
+	link := func(token string) string { return "https://login.example.com/link?token=" + token }
+	if err := s.SendMagicLink(ctx, "test-session-data-key", testRecipient, "test-organization", link); err != nil {
+		t.Fatalf("Failed to send link: %v", err)
+	}
+	token := sender.Last(t, `token=([A-Za-z0-9_-]+)`)
+	if key, err := s.GetMagicLinkKey(ctx, token); err != nil || key != "test-session-data-key" {
+		t.Fatalf("Expected the key of the link, got %q %v", key, err)
+	}
+	key, recipient, err := s.VerifyMagicLink(ctx, token)
+	if err != nil {
+		t.Fatalf("Failed to verify link: %v", err)
+	}
+	if key != "test-session-data-key" || recipient != testRecipient {
+		t.Errorf("Unexpected link %s %+v", key, recipient)
+	}
+	if _, _, err := s.VerifyMagicLink(ctx, token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Expected a used link to be rejected, got %v", err)
+	}
+	if _, _, err := s.VerifyMagicLink(ctx, "invalid"); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Expected an unknown link to be rejected, got %v", err)
+	}
+	if _, err := s.GetMagicLinkKey(ctx, "invalid"); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Expected an unknown link to be rejected, got %v", err)
+	}
+}
+
+func TestResendInterval(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestOTPService(0)
+	if err := s.SendCode(ctx, ChannelEmail, "test-session-data-key", testRecipient, "test-organization"); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	// a new login does not reset the interval
+	if err := s.SendCode(ctx, ChannelEmail, "other-session-data-key", testRecipient, "test-organization"); !errors.Is(err, ErrResendTooSoon) {
+		t.Errorf("Expected the second email to be throttled, got %v", err)
+	}
+}
+
+func TestSMSCode(t *testing.T) {
+	ctx := context.Background()
+	s, _, smsSender := newTestOTPService(-1)
+	if err := s.SendCode(ctx, ChannelSMS, "test-session-data-key", testRecipient, "test-organization"); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	messages := smsSender.Messages()
+	if len(messages) != 1 || messages[0].To != testRecipient.PhoneNumber {
+		t.Fatalf("Expected a message to %s, got %+v", testRecipient.PhoneNumber, messages)
+	}
+	code := regexp.MustCompile(`^(\d{6}) `).FindStringSubmatch(messages[0].Body)[1]
+	if _, err := s.VerifyCode(ctx, ChannelEmail, "test-session-data-key", code); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Expected an SMS code to be rejected as an email code, got %v", err)
+	}
+	if _, err := s.VerifyCode(ctx, ChannelSMS, "test-session-data-key", code); err != nil {
+		t.Errorf("Failed to verify code: %v", err)
+	}
+	if err := s.SendCode(ctx, ChannelSMS, "test-session-data-key", Recipient{UserId: "test-user-id"}, "test-organization"); !errors.Is(err, ErrNoPhoneNumber) {
+		t.Errorf("Expected a recipient without a phone number to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package recovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/shashimalcse/tiny-is/internal/authn/screens"
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/notification"
+	"github.com/shashimalcse/tiny-is/internal/security"
+	"github.com/shashimalcse/tiny-is/internal/session"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+var ErrInvalidResetLink = errors.New("the password reset link is invalid, expired or was already used")
+
+const (
+	resetResendCachePrefix = "password_reset_resend_"
+	resetUsedCachePrefix   = "password_reset_used_"
+	resetNonceLength       = 16
+)
+
+// TokenRevoker revokes the refresh tokens issued to a user.
+type TokenRevoker interface {
+	RevokeTokensByUser(ctx context.Context, userId, orgId string) error
+}
+
+// resetClaims is what a password reset link proves. The link stops working once the password
+// changes, so it can be used once.
+type resetClaims struct {
+	UserId            string `json:"sub"`
+	OrganizationId    string `json:"org"`
+	PasswordChangedAt int64  `json:"pwd"`
+	Nonce             string `json:"nonce"`
+	ExpiresAt         int64  `json:"exp"`
+}
+
+type RecoveryService interface {
+	// SendPasswordReset emails a password reset link to the verified email address of the user with
+	// the username or email address. Nothing is sent when there is no such user, or a link was sent to them a moment ago, but no
+	// error is returned either, so the form can't be used to find out which accounts exist.
+	SendPasswordReset(ctx context.Context, orgId, organizationName, identifier string) error
+	// VerifyPasswordReset returns the user the reset link was sent to, without using it up.
+	VerifyPasswordReset(ctx context.Context, orgId, token string) (models.User, error)
+	// ResetPassword sets a password that meets the password policy with the reset link, then ends
+	// the sessions of the user and revokes their refresh tokens.
+	ResetPassword(ctx context.Context, orgId, token, password string) error
+	GetForgotPasswordForm(ctx context.Context, sessionDataKey, organizationName, identifier, errorMessage string) templ.Component
+	GetPasswordResetSent(ctx context.Context, identifier string) templ.Component
+	GetPasswordResetPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component
+	GetPasswordResetForm(ctx context.Context, organizationName, token, errorMessage string) templ.Component
+	GetPasswordResetDone(ctx context.Context) templ.Component
+}
+
+type recoveryService struct {
+	cfg            *config.Config
+	backend        cache.Backend
+	keyManager     *security.KeyManager
+	emailSender    notification.EmailSender
+	userService    user.UserService
+	sessionService session.SessionService
+	tokenRevoker   TokenRevoker
+}
+
+// NewRecoveryService returns a service that signs reset links with a key derived from the signing
+// key of the server, so the links can be checked on any instance.
+func NewRecoveryService(cfg *config.Config, backend cache.Backend, keyManager *security.KeyManager, emailSender notification.EmailSender, userService user.UserService, sessionService session.SessionService, tokenRevoker TokenRevoker) RecoveryService {
+	return &recoveryService{
+		cfg:            cfg,
+		backend:        backend,
+		keyManager:     keyManager,
+		emailSender:    emailSender,
+		userService:    userService,
+		sessionService: sessionService,
+		tokenRevoker:   tokenRevoker,
+	}
+}
+
+func (s *recoveryService) SendPasswordReset(ctx context.Context, orgId, organizationName, identifier string) error {
+	var resetUser models.User
+	var err error
+	if strings.Contains(identifier, "@") {
+		resetUser, err = s.userService.GetUserByEmail(ctx, identifier, orgId)
+	} else {
+		resetUser, err = s.userService.GetUserByUsername(ctx, identifier, orgId)
+	}
+	// a link sent to an address nobody proved they own would hand the account to its owner
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (resetUser.Email == "" || !resetUser.EmailVerified)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if interval := s.cfg.GetOTPResendInterval(); interval > 0 {
+		allowed, err := s.backend.SetNX(resetResendCachePrefix+orgId+"_"+resetUser.Id, []byte("1"), interval)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			// answered like an unknown account, which is never throttled
+			return nil
+		}
+	}
+	nonce := make([]byte, resetNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timeout := s.cfg.GetPasswordResetLinkTimeout()
+	token, err := s.sign(resetClaims{
+		UserId:            resetUser.Id,
+		OrganizationId:    orgId,
+		PasswordChangedAt: resetUser.PasswordChangedAt,
+		Nonce:             base64.RawURLEncoding.EncodeToString(nonce),
+		ExpiresAt:         time.Now().Add(timeout).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	link := notification.GetLink(s.cfg, organizationName, "/password/reset", token)
+	return s.emailSender.SendEmail(ctx, notification.Email{
+		To:      resetUser.Email,
+		Subject: fmt.Sprintf("Reset your %s password", organizationName),
+		Body:    fmt.Sprintf("Open this link to choose a new password:\n\n%s\n\nThe link expires in %d minutes and can be used once. If you did not ask to reset your password, you can ignore this email.", link, int(timeout.Minutes())),
+	})
+}
+
+func (s *recoveryService) VerifyPasswordReset(ctx context.Context, orgId, token string) (models.User, error) {
+	claims, err := s.verify(token)
+	if err != nil {
+		return models.User{}, err
+	}
+	if claims.OrganizationId != orgId || time.Now().Unix() > claims.ExpiresAt {
+		return models.User{}, ErrInvalidResetLink
+	}
+	resetUser, err := s.userService.GetUserByID(ctx, claims.UserId, orgId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrInvalidResetLink
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if resetUser.PasswordChangedAt != claims.PasswordChangedAt {
+		return models.User{}, ErrInvalidResetLink
+	}
+	return resetUser, nil
+}
+
+func (s *recoveryService) ResetPassword(ctx context.Context, orgId, token, password string) error {
+	resetUser, err := s.VerifyPasswordReset(ctx, orgId, token)
+	if err != nil {
+		return err
+	}
+	claims, err := s.verify(token)
+	if err != nil {
+		return err
+	}
+	used, err := notification.UseLink(s.backend, resetUsedCachePrefix+claims.Nonce, time.Until(time.Unix(claims.ExpiresAt, 0))+time.Minute)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetLink
+	}
+	if err := s.userService.SetPassword(ctx, resetUser.Id, orgId, password, false); err != nil {
+		// the link can be used again with a password that meets the policy
+		if deleteErr := s.backend.Delete(resetUsedCachePrefix + claims.Nonce); deleteErr != nil {
+			return deleteErr
+		}
+		return err
+	}
+	if err := s.sessionService.RevokeUserSessions(ctx, resetUser.Id, orgId, true); err != nil {
+		return err
+	}
+	return s.tokenRevoker.RevokeTokensByUser(ctx, resetUser.Id, orgId)
+}
+
+// sign encodes the claims and their HMAC, keyed for password resets only so the token can't be
+// passed off as any other token of the server.
+func (s *recoveryService) sign(claims resetClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	mac, err := s.mac(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac), nil
+}
+
+func (s *recoveryService) verify(token string) (resetClaims, error) {
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return resetClaims{}, ErrInvalidResetLink
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return resetClaims{}, ErrInvalidResetLink
+	}
+	tokenMAC, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return resetClaims{}, ErrInvalidResetLink
+	}
+	mac, err := s.mac(payload)
+	if err != nil {
+		return resetClaims{}, err
+	}
+	if !hmac.Equal(mac, tokenMAC) {
+		return resetClaims{}, ErrInvalidResetLink
+	}
+	var claims resetClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return resetClaims{}, ErrInvalidResetLink
+	}
+	return claims, nil
+}
+
+func (s *recoveryService) mac(payload []byte) ([]byte, error) {
+	key, err := s.keyManager.DeriveKey("password_reset")
+	if err != nil {
+		return nil, err
+	}
+	payloadMAC := hmac.New(sha256.New, key)
+	payloadMAC.Write(payload)
+	return payloadMAC.Sum(nil), nil
+}
+
+func (s *recoveryService) GetForgotPasswordForm(ctx context.Context, sessionDataKey, organizationName, identifier, errorMessage string) templ.Component {
+	return screens.ForgotPasswordForm(sessionDataKey, organizationName, identifier, errorMessage)
+}
+
+func (s *recoveryService) GetPasswordResetSent(ctx context.Context, identifier string) templ.Component {
+	return screens.PasswordResetSent(identifier)
+}
+
+func (s *recoveryService) GetPasswordResetPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component {
+	return screens.PasswordResetPage(screens.PasswordResetForm(organizationName, token, ""), csrfToken)
+}
+
+func (s *recoveryService) GetPasswordResetForm(ctx context.Context, organizationName, token, errorMessage string) templ.Component {
+	return screens.PasswordResetForm(organizationName, token, errorMessage)
+}
+
+func (s *recoveryService) GetPasswordResetDone(ctx context.Context) templ.Component {
+	return screens.PasswordResetDone()
+}
@@ -0,0 +1,130 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/session"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+	"github.com/shashimalcse/tiny-is/internal/user/usertest"
+)
+
+type testSessionService struct {
+	session.SessionService
+	revoked []string
+}
+
+func (s *testSessionService) RevokeUserSessions(ctx context.Context, userId, orgId string, revokeTokens bool) error {
+	s.revoked = append(s.revoked, userId)
+	return nil
+}
+
+type testTokenRevoker struct {
+	revoked []string
+}
+
+func (r *testTokenRevoker) RevokeTokensByUser(ctx context.Context, userId, orgId string) error {
+	r.revoked = append(r.revoked, userId)
+	return nil
+}
+
+var testUser = models.User{Id: "test-user-id", OrganizationId: "test-organization-id", Username: "alice", Email: "alice@example.com", EmailVerified: true}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.OTP.ResendInterval = -1
+	emailSender := &testutil.EmailSender{}
+	userService := &usertest.UserService{Users: []models.User{testUser}}
+	sessionService := &testSessionService{}
+	tokenRevoker := &testTokenRevoker{}
+	s := NewRecoveryService(cfg, cache.NewMemoryBackend(), testutil.NewKeyManager(t), emailSender, userService, sessionService, tokenRevoker)
+
+	if err := s.SendPasswordReset(ctx, "test-organization-id", "test", "bob"); err != nil || len(emailSender.Emails()) != 0 {
+		t.Fatalf("Expected nothing to be sent for an unknown user, got %v", err)
+	}
+	if err := s.SendPasswordReset(ctx, "test-organization-id", "test", "Alice@Example.com"); err != nil {
+		t.Fatalf("Failed to send password reset: %v", err)
+	}
+	token, _ := url.QueryUnescape(emailSender.Last(t, `token=(\S+)`))
+
+	if _, err := s.VerifyPasswordReset(ctx, "other-organization-id", token); !errors.Is(err, ErrInvalidResetLink) {
+		t.Errorf("Expected the link not to work in another organization, got %v", err)
+	}
+	tampered := []byte(token)
+	tampered[len(tampered)/4] ^= 1
+	if _, err := s.VerifyPasswordReset(ctx, "test-organization-id", string(tampered)); !errors.Is(err, ErrInvalidResetLink) {
+		t.Errorf("Expected a tampered link to be rejected, got %v", err)
+	}
+	resetUser, err := s.VerifyPasswordReset(ctx, "test-organization-id", token)
+	if err != nil || resetUser.Id != "test-user-id" {
+		t.Fatalf("Expected the link to verify, got %v", err)
+	}
+
+	var policyErr *user.PasswordPolicyError
+	if err := s.ResetPassword(ctx, "test-organization-id", token, "short"); !errors.As(err, &policyErr) {
+		t.Fatalf("Expected the password policy to be enforced, got %v", err)
+	}
+	if err := s.ResetPassword(ctx, "test-organization-id", token, "correct horse"); err != nil {
+		t.Fatalf("Expected the link to work after a rejected password, got %v", err)
+	}
+	if userService.Users[0].PasswordHash != "hashed-correct horse" || len(sessionService.revoked) != 1 || len(tokenRevoker.revoked) != 1 {
+		t.Errorf("Expected the password to change and the sessions and tokens to be revoked")
+	}
+	if err := s.ResetPassword(ctx, "test-organization-id", token, "battery staple"); !errors.Is(err, ErrInvalidResetLink) {
+		t.Errorf("Expected the link to be used up, got %v", err)
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.PasswordReset.LinkTimeout = 60
+	s := NewRecoveryService(cfg, cache.NewMemoryBackend(), testutil.NewKeyManager(t), &testutil.EmailSender{}, &usertest.UserService{}, nil, nil).(*recoveryService)
+	token, err := s.sign(resetClaims{UserId: "test-user-id", OrganizationId: "test-organization-id", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if _, err := s.VerifyPasswordReset(context.Background(), "test-organization-id", token); !errors.Is(err, ErrInvalidResetLink) {
+		t.Errorf("Expected an expired link to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordResetResend(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.OTP.ResendInterval = 60
+	emailSender := &testutil.EmailSender{}
+	userService := &usertest.UserService{Users: []models.User{testUser}}
+	s := NewRecoveryService(cfg, cache.NewMemoryBackend(), testutil.NewKeyManager(t), emailSender, userService, nil, nil)
+	for range 2 {
+		if err := s.SendPasswordReset(ctx, "test-organization-id", "test", "alice"); err != nil {
+			t.Fatalf("Expected a resend to be answered like a send, got %v", err)
+		}
+	}
+	if n := len(emailSender.Emails()); n != 1 {
+		t.Errorf("Expected one email, got %d", n)
+	}
+}
+
+func TestPasswordResetNeedsVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.OTP.ResendInterval = -1
+	emailSender := &testutil.EmailSender{}
+	unverified := testUser
+	unverified.EmailVerified = false
+	s := NewRecoveryService(cfg, cache.NewMemoryBackend(), testutil.NewKeyManager(t), emailSender, &usertest.UserService{Users: []models.User{unverified}}, nil, nil)
+	if err := s.SendPasswordReset(ctx, "test-organization-id", "test", "alice"); err != nil {
+		t.Fatalf("Expected an unverified address to be answered like an unknown one, got %v", err)
+	}
+	if n := len(emailSender.Emails()); n != 0 {
+		t.Errorf("Expected no email to an unverified address, got %d", n)
+	}
+}
@@ -0,0 +1,154 @@
+package registration
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/shashimalcse/tiny-is/internal/authn/screens"
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/security"
+)
+
+var ErrChallengeFailed = errors.New("the challenge was not passed")
+
+const (
+	powUsedCachePrefix = "pow_used_"
+	powChallengeLength = 16
+	powTimeout         = 10 * time.Minute
+	// nonces are decimal counters, a longer one was not found by counting
+	maxPowNonceLength = 20
+)
+
+// Challenge tells people from bots when they sign up. ProofOfWork is built in, a CAPTCHA can be
+// used instead by implementing Challenge with the widget and the verification API of its provider.
+type Challenge interface {
+	// Form returns the part of the sign up form that poses a new challenge.
+	Form(ctx context.Context) (templ.Component, error)
+	// Verify checks the response to the challenge submitted with the sign up form from the address.
+	// It returns ErrChallengeFailed when the challenge was not passed.
+	Verify(ctx context.Context, form url.Values, ipAddress string) error
+}
+
+// ProofOfWork asks the browser to find a nonce whose SHA-256 hash with a random challenge starts
+// with a number of zero bits. It costs a person a moment, and a bot as much for every account it
+// creates. Challenges are signed instead of stored, so showing the form writes nothing to the
+// backend, and a solved challenge can be used once.
+type ProofOfWork struct {
+	backend    cache.Backend
+	keyManager *security.KeyManager
+	difficulty int
+}
+
+func NewProofOfWork(backend cache.Backend, keyManager *security.KeyManager, difficulty int) *ProofOfWork {
+	return &ProofOfWork{
+		backend:    backend,
+		keyManager: keyManager,
+		difficulty: difficulty,
+	}
+}
+
+func (p *ProofOfWork) Form(ctx context.Context) (templ.Component, error) {
+	challengeBytes := make([]byte, powChallengeLength)
+	if _, err := rand.Read(challengeBytes); err != nil {
+		return nil, err
+	}
+	// the difficulty is signed with the challenge, so changing it doesn't fail challenges being solved
+	payload := fmt.Sprintf("%s.%d.%d", base64.RawURLEncoding.EncodeToString(challengeBytes), time.Now().Add(powTimeout).Unix(), p.difficulty)
+	mac, err := p.mac(payload)
+	if err != nil {
+		return nil, err
+	}
+	return screens.ProofOfWorkChallenge(payload+"."+base64.RawURLEncoding.EncodeToString(mac), p.difficulty), nil
+}
+
+func (p *ProofOfWork) Verify(ctx context.Context, form url.Values, ipAddress string) error {
+	challenge := form.Get("pow_challenge")
+	nonce := form.Get("pow_nonce")
+	if challenge == "" || nonce == "" || len(nonce) > maxPowNonceLength {
+		return ErrChallengeFailed
+	}
+	expiresAt, difficulty, err := p.verify(challenge)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(expiresAt) {
+		return ErrChallengeFailed
+	}
+	hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeroBits(hash[:]) < difficulty {
+		return ErrChallengeFailed
+	}
+	unused, err := p.backend.SetNX(powUsedCachePrefix+challenge, []byte("1"), time.Until(expiresAt))
+	if err != nil {
+		return err
+	}
+	if !unused {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// verify returns when the challenge expires and its difficulty, when the server posed it.
+func (p *ProofOfWork) verify(challenge string) (time.Time, int, error) {
+	separator := strings.LastIndex(challenge, ".")
+	if separator < 0 {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	payload := challenge[:separator]
+	challengeMAC, err := base64.RawURLEncoding.DecodeString(challenge[separator+1:])
+	if err != nil {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	mac, err := p.mac(payload)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if !hmac.Equal(mac, challengeMAC) {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return time.Time{}, 0, ErrChallengeFailed
+	}
+	return time.Unix(expiresAt, 0), difficulty, nil
+}
+
+func (p *ProofOfWork) mac(payload string) ([]byte, error) {
+	key, err := p.keyManager.DeriveKey("proof_of_work")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil), nil
+}
+
+func leadingZeroBits(hash []byte) int {
+	zeroBits := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeroBits + bits.LeadingZeros8(b)
+		}
+		zeroBits += 8
+	}
+	return zeroBits
+}
@@ -0,0 +1,119 @@
+package registration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+// newChallenge poses a challenge and returns it with a nonce that solves it, and one that doesn't.
+func newChallenge(t *testing.T, proofOfWork *ProofOfWork) (string, string, string) {
+	component, err := proofOfWork.Form(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to pose a challenge: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := component.Render(context.Background(), &buf); err != nil {
+		t.Fatalf("Failed to render the challenge: %v", err)
+	}
+	match := regexp.MustCompile(`name="pow_challenge" value="([^"]+)"`).FindStringSubmatch(buf.String())
+	if match == nil {
+		t.Fatalf("Expected a challenge in the form, got %q", buf.String())
+	}
+	challenge := match[1]
+	solution, wrong := "", ""
+	for i := 0; solution == "" || wrong == ""; i++ {
+		nonce := strconv.Itoa(i)
+		hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+		solved := leadingZeroBits(hash[:]) >= proofOfWork.difficulty
+		if solved && solution == "" {
+			solution = nonce
+		} else if !solved && wrong == "" {
+			wrong = nonce
+		}
+	}
+	return challenge, solution, wrong
+}
+
+// testBackend counts the writes to the backend.
+type testBackend struct {
+	cache.Backend
+	writes int
+}
+
+func (b *testBackend) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	b.writes++
+	return b.Backend.SetNX(key, value, ttl)
+}
+
+func TestProofOfWork(t *testing.T) {
+	ctx := context.Background()
+	backend := &testBackend{Backend: cache.NewMemoryBackend()}
+	proofOfWork := NewProofOfWork(backend, testutil.NewKeyManager(t), 8)
+
+	challenge, solution, wrong := newChallenge(t, proofOfWork)
+	if backend.writes != 0 {
+		t.Errorf("Expected posing a challenge not to write to the backend, got %d writes", backend.writes)
+	}
+	if err := proofOfWork.Verify(ctx, url.Values{"pow_challenge": {challenge}, "pow_nonce": {wrong}}, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected a wrong nonce to fail, got %v", err)
+	}
+	form := url.Values{"pow_challenge": {challenge}, "pow_nonce": {solution}}
+	if err := proofOfWork.Verify(ctx, form, ""); err != nil {
+		t.Errorf("Expected the solved challenge to pass, got %v", err)
+	}
+	if err := proofOfWork.Verify(ctx, form, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected the challenge to be used once, got %v", err)
+	}
+	if err := proofOfWork.Verify(ctx, url.Values{"pow_challenge": {"unknown"}, "pow_nonce": {"0"}}, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected an unknown challenge to fail, got %v", err)
+	}
+	// a challenge can't be made easier
+	parts := strings.Split(challenge, ".")
+	parts[2] = "0"
+	if err := proofOfWork.Verify(ctx, url.Values{"pow_challenge": {strings.Join(parts, ".")}, "pow_nonce": {"0"}}, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected a changed difficulty to fail, got %v", err)
+	}
+}
+
+func TestProofOfWorkExpires(t *testing.T) {
+	proofOfWork := NewProofOfWork(cache.NewMemoryBackend(), testutil.NewKeyManager(t), 0)
+	payload := fmt.Sprintf("test-challenge.%d.0", time.Now().Add(-time.Second).Unix())
+	mac, err := proofOfWork.mac(payload)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	challenge := payload + "." + base64.RawURLEncoding.EncodeToString(mac)
+	if err := proofOfWork.Verify(context.Background(), url.Values{"pow_challenge": {challenge}, "pow_nonce": {"0"}}, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected an expired challenge to fail, got %v", err)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash []byte
+		bits int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, test := range tests {
+		if bits := leadingZeroBits(test.hash); bits != test.bits {
+			t.Errorf("Expected %x to have %d leading zero bits, got %d", test.hash, test.bits, bits)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package registration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/a-h/templ"
+	"github.com/shashimalcse/tiny-is/internal/authn/screens"
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/notification"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+var (
+	ErrRegistrationDisabled    = errors.New("sign up is not enabled for the organization")
+	ErrInvalidUsername         = errors.New("the username is invalid")
+	ErrInvalidEmail            = errors.New("the email address is invalid")
+	ErrMissingAttribute        = errors.New("a required attribute is missing")
+	ErrUnknownAttribute        = errors.New("a required attribute is not an attribute of the organization")
+	ErrUsernameTaken           = errors.New("the username is taken")
+	ErrEmailTaken              = errors.New("the email address belongs to an account")
+	ErrResendTooSoon           = errors.New("wait a moment before requesting another email")
+	ErrInvalidVerificationLink = errors.New("the verification link is invalid, expired or was already used")
+)
+
+const (
+	registrationCachePrefix       = "registration_"
+	registrationUsedCachePrefix   = "registration_used_"
+	registrationResendCachePrefix = "registration_resend_"
+	maxUsernameLength             = 64
+)
+
+// Registration is what someone filled in to sign up.
+type Registration struct {
+	Username string
+	Email    string
+	Password string
+	// Attributes are the values of the required attributes of the organization, by name.
+	Attributes map[string]string
+}
+
+// pendingRegistration is kept until the email address is verified, with the password hashed.
+type pendingRegistration struct {
+	OrganizationId string                 `json:"organization_id"`
+	Username       string                 `json:"username"`
+	Email          string                 `json:"email"`
+	PasswordHash   string                 `json:"password_hash"`
+	Attributes     []models.UserAttribute `json:"attributes"`
+}
+
+type RegistrationService interface {
+	// GetRegistrationForm returns the sign up form of the organization, with a new challenge when the
+	// registration policy requires one.
+	GetRegistrationForm(ctx context.Context, sessionDataKey, orgId, organizationName string, registration Registration, errorMessage string) (templ.Component, error)
+	// Register checks the sign up form and emails a link to verify the email address, the account is
+	// created when the link is used. When the email address already belongs to an account its owner
+	// is told instead, so the form can't be used to find out which addresses have accounts.
+	Register(ctx context.Context, orgId, organizationName string, registration Registration, challengeResponse url.Values, ipAddress string) error
+	// CheckVerificationLink reports whether the link can still verify an email address, without
+	// using it up.
+	CheckVerificationLink(ctx context.Context, orgId, token string) error
+	// VerifyEmail uses the link and creates the account with a verified email address.
+	VerifyEmail(ctx context.Context, orgId, token string) error
+	GetRegistrationSent(ctx context.Context, email string) templ.Component
+	GetRegistrationConfirmPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component
+	GetRegistrationDonePage(ctx context.Context, organizationName string) templ.Component
+}
+
+type registrationService struct {
+	cfg         *config.Config
+	backend     cache.Backend
+	emailSender notification.EmailSender
+	userService user.UserService
+	challenge   Challenge
+}
+
+// NewRegistrationService returns a service that keeps sign ups in the backend until the email
+// address is verified, and poses the challenge to people signing up when the policy requires it.
+func NewRegistrationService(cfg *config.Config, backend cache.Backend, emailSender notification.EmailSender, userService user.UserService, challenge Challenge) RegistrationService {
+	return &registrationService{
+		cfg:         cfg,
+		backend:     backend,
+		emailSender: emailSender,
+		userService: userService,
+		challenge:   challenge,
+	}
+}
+
+func (s *registrationService) GetRegistrationForm(ctx context.Context, sessionDataKey, orgId, organizationName string, registration Registration, errorMessage string) (templ.Component, error) {
+	policy, err := s.getRegistrationPolicy(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+	var challenge templ.Component
+	if policy.RequireChallenge {
+		challenge, err = s.challenge.Form(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return screens.RegistrationForm(sessionDataKey, organizationName, registration.Username, registration.Email, policy.RequiredAttributes, registration.Attributes, challenge, errorMessage), nil
+}
+
+func (s *registrationService) Register(ctx context.Context, orgId, organizationName string, registration Registration, challengeResponse url.Values, ipAddress string) error {
+	policy, err := s.getRegistrationPolicy(ctx, orgId)
+	if err != nil {
+		return err
+	}
+	// the challenge comes first, so the form can't be used to check usernames cheaply
+	if policy.RequireChallenge {
+		if err := s.challenge.Verify(ctx, challengeResponse, ipAddress); err != nil {
+			return err
+		}
+	}
+	if err := checkUsername(registration.Username); err != nil {
+		return err
+	}
+	address, err := mail.ParseAddress(registration.Email)
+	if err != nil || address.Address != registration.Email {
+		return ErrInvalidEmail
+	}
+	attributes, err := s.getAttributes(ctx, orgId, policy, registration)
+	if err != nil {
+		return err
+	}
+	_, err = s.userService.GetUserByUsername(ctx, registration.Username, orgId)
+	if err == nil {
+		return ErrUsernameTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	passwordHash, err := s.userService.HashNewPassword(ctx, models.User{
+		OrganizationId: orgId,
+		Username:       registration.Username,
+		Email:          registration.Email,
+		Password:       registration.Password,
+	})
+	if err != nil {
+		return err
+	}
+	if interval := s.cfg.GetOTPResendInterval(); interval > 0 {
+		allowed, err := s.backend.SetNX(registrationResendCachePrefix+orgId+"_"+strings.ToLower(registration.Email), []byte("1"), interval)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrResendTooSoon
+		}
+	}
+	_, err = s.userService.GetUserByEmail(ctx, registration.Email, orgId)
+	if err == nil {
+		return s.emailSender.SendEmail(ctx, notification.Email{
+			To:      registration.Email,
+			Subject: fmt.Sprintf("Your %s account", organizationName),
+			Body:    fmt.Sprintf("Someone tried to create a %s account with this email address, but it already has one. If it was you, sign in, or reset your password if you forgot it. Otherwise you can ignore this email.", organizationName),
+		})
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	token, err := notification.NewLinkToken()
+	if err != nil {
+		return err
+	}
+	data, err := cache.Encode(pendingRegistration{
+		OrganizationId: orgId,
+		Username:       registration.Username,
+		Email:          registration.Email,
+		PasswordHash:   passwordHash,
+		Attributes:     attributes,
+	})
+	if err != nil {
+		return err
+	}
+	timeout := s.cfg.GetRegistrationLinkTimeout()
+	if err := s.backend.Set(registrationCachePrefix+notification.HashLinkToken(token), data, timeout); err != nil {
+		return err
+	}
+	link := notification.GetLink(s.cfg, organizationName, "/register/verify", token)
+	return s.emailSender.SendEmail(ctx, notification.Email{
+		To:      registration.Email,
+		Subject: fmt.Sprintf("Verify your email address for %s", organizationName),
+		Body:    fmt.Sprintf("Open this link to verify your email address and finish creating your %s account:\n\n%s\n\nThe link expires in %d hours. If you did not sign up, you can ignore this email.", organizationName, link, int(timeout.Hours())),
+	})
+}
+
+func (s *registrationService) CheckVerificationLink(ctx context.Context, orgId, token string) error {
+	_, err := s.getPendingRegistration(orgId, token)
+	return err
+}
+
+func (s *registrationService) VerifyEmail(ctx context.Context, orgId, token string) error {
+	pending, err := s.getPendingRegistration(orgId, token)
+	if err != nil {
+		return err
+	}
+	// the username or the email address may have been taken while the link was waiting
+	if _, err := s.userService.GetUserByUsername(ctx, pending.Username, orgId); !errors.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return err
+		}
+		return ErrUsernameTaken
+	}
+	if _, err := s.userService.GetUserByEmail(ctx, pending.Email, orgId); !errors.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return err
+		}
+		return ErrEmailTaken
+	}
+	usedKey := registrationUsedCachePrefix + notification.HashLinkToken(token)
+	unused, err := notification.UseLink(s.backend, usedKey, s.cfg.GetRegistrationLinkTimeout())
+	if err != nil {
+		return err
+	}
+	if !unused {
+		return ErrInvalidVerificationLink
+	}
+	err = s.userService.RegisterUser(ctx, models.User{
+		OrganizationId: orgId,
+		Username:       pending.Username,
+		Email:          pending.Email,
+		PasswordHash:   pending.PasswordHash,
+		Attributes:     pending.Attributes,
+	})
+	if err != nil {
+		// the link can be used again when the account could not be created
+		if deleteErr := s.backend.Delete(usedKey); deleteErr != nil {
+			return deleteErr
+		}
+		return err
+	}
+	return s.backend.Delete(registrationCachePrefix + notification.HashLinkToken(token))
+}
+
+func (s *registrationService) getPendingRegistration(orgId, token string) (pendingRegistration, error) {
+	if token == "" {
+		return pendingRegistration{}, ErrInvalidVerificationLink
+	}
+	data, found, err := s.backend.Get(registrationCachePrefix + notification.HashLinkToken(token))
+	if err != nil {
+		return pendingRegistration{}, err
+	}
+	if !found {
+		return pendingRegistration{}, ErrInvalidVerificationLink
+	}
+	pending, err := cache.Decode[pendingRegistration](data)
+	if err != nil {
+		return pendingRegistration{}, err
+	}
+	if pending.OrganizationId != orgId {
+		return pendingRegistration{}, ErrInvalidVerificationLink
+	}
+	return pending, nil
+}
+
+func (s *registrationService) getRegistrationPolicy(ctx context.Context, orgId string) (user.RegistrationPolicy, error) {
+	policy, err := s.userService.GetRegistrationPolicy(ctx, orgId)
+	if err != nil {
+		return user.RegistrationPolicy{}, err
+	}
+	if !policy.Enabled {
+		return user.RegistrationPolicy{}, ErrRegistrationDisabled
+	}
+	return policy, nil
+}
+
+// getAttributes returns the required attributes of the organization with the values filled in.
+// Other attributes are not taken from the form.
+func (s *registrationService) getAttributes(ctx context.Context, orgId string, policy user.RegistrationPolicy, registration Registration) ([]models.UserAttribute, error) {
+	if len(policy.RequiredAttributes) == 0 {
+		return nil, nil
+	}
+	orgAttributes, err := s.userService.GetAttributes(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+	var attributes []models.UserAttribute
+	for _, name := range policy.RequiredAttributes {
+		value := strings.TrimSpace(registration.Attributes[name])
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s", ErrMissingAttribute, name)
+		}
+		index := slices.IndexFunc(orgAttributes, func(attribute models.Attribute) bool { return attribute.Name == name })
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownAttribute, name)
+		}
+		attributes = append(attributes, models.UserAttribute{ID: orgAttributes[index].ID, Name: name, Value: value})
+	}
+	return attributes, nil
+}
+
+func (s *registrationService) GetRegistrationSent(ctx context.Context, email string) templ.Component {
+	return screens.RegistrationSent(email)
+}
+
+func (s *registrationService) GetRegistrationConfirmPage(ctx context.Context, organizationName, token, csrfToken string) templ.Component {
+	return screens.RegistrationPage(screens.RegistrationConfirmForm(organizationName, token, csrfToken))
+}
+
+func (s *registrationService) GetRegistrationDonePage(ctx context.Context, organizationName string) templ.Component {
+	return screens.RegistrationPage(screens.RegistrationDone(organizationName))
+}
+
+// checkUsername accepts usernames without spaces or control characters. An @ is not allowed, so a
+// username is never mistaken for an email address.
+func checkUsername(username string) error {
+	if username == "" || len(username) > maxUsernameLength || strings.Contains(username, "@") {
+		return ErrInvalidUsername
+	}
+	for _, r := range username {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return ErrInvalidUsername
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package registration
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+	"github.com/shashimalcse/tiny-is/internal/user/usertest"
+)
+
+func newTestRegistrationService(t *testing.T, policy user.RegistrationPolicy) (RegistrationService, *usertest.UserService, *testutil.EmailSender) {
+	cfg := &config.Config{}
+	cfg.OTP.ResendInterval = -1
+	emailSender := &testutil.EmailSender{}
+	userService := &usertest.UserService{RegistrationPolicy: policy, Attributes: []models.Attribute{{ID: "test-attribute-id", Name: "country"}}}
+	s := NewRegistrationService(cfg, cache.NewMemoryBackend(), emailSender, userService, NewProofOfWork(cache.NewMemoryBackend(), testutil.NewKeyManager(t), 1))
+	return s, userService, emailSender
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	s, userService, emailSender := newTestRegistrationService(t, user.RegistrationPolicy{Enabled: true, RequiredAttributes: []string{"country"}})
+	alice := Registration{Username: "alice", Email: "alice@example.com", Password: "correct horse", Attributes: map[string]string{"country": "LK"}}
+
+	if err := s.Register(ctx, "test-organization-id", "test", Registration{Username: "alice", Email: "alice@example.com", Password: "correct horse"}, nil, ""); !errors.Is(err, ErrMissingAttribute) {
+		t.Errorf("Expected a missing attribute to be rejected, got %v", err)
+	}
+	if err := s.Register(ctx, "test-organization-id", "test", Registration{Username: "al ice", Email: "alice@example.com", Password: "correct horse"}, nil, ""); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("Expected an invalid username to be rejected, got %v", err)
+	}
+	if err := s.Register(ctx, "test-organization-id", "test", alice, nil, ""); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if len(userService.Users) != 0 {
+		t.Fatalf("Expected the account to wait for the email address to be verified")
+	}
+	token, _ := url.QueryUnescape(emailSender.Last(t, `token=(\S+)`))
+
+	if err := s.CheckVerificationLink(ctx, "other-organization-id", token); !errors.Is(err, ErrInvalidVerificationLink) {
+		t.Errorf("Expected the link to be rejected for another organization, got %v", err)
+	}
+	if err := s.CheckVerificationLink(ctx, "test-organization-id", token); err != nil {
+		t.Fatalf("Expected the link to be valid, got %v", err)
+	}
+	if err := s.VerifyEmail(ctx, "test-organization-id", token); err != nil {
+		t.Fatalf("Failed to verify the email address: %v", err)
+	}
+	if len(userService.Users) != 1 {
+		t.Fatalf("Expected the account to be created, got %d accounts", len(userService.Users))
+	}
+	created := userService.Users[0]
+	if created.PasswordHash != "hashed-correct horse" || !created.EmailVerified || len(created.Attributes) != 1 || created.Attributes[0].Value != "LK" {
+		t.Errorf("Expected the account to be created as signed up, got %+v", created)
+	}
+	if err := s.VerifyEmail(ctx, "test-organization-id", token); !errors.Is(err, ErrInvalidVerificationLink) {
+		t.Errorf("Expected the link to be used once, got %v", err)
+	}
+
+	// signing up again with the same email address tells the owner of the account instead
+	if err := s.Register(ctx, "test-organization-id", "test", Registration{Username: "alice2", Email: "alice@example.com", Password: "correct horse", Attributes: alice.Attributes}, nil, ""); err != nil {
+		t.Fatalf("Expected an existing email address not to be revealed, got %v", err)
+	}
+	if body := emailSender.Emails()[1].Body; strings.Contains(body, "token=") {
+		t.Errorf("Expected no verification link for an existing email address, got %q", body)
+	}
+	if err := s.Register(ctx, "test-organization-id", "test", alice, nil, ""); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("Expected a taken username to be rejected, got %v", err)
+	}
+}
+
+func TestRegisterPolicy(t *testing.T) {
+	ctx := context.Background()
+	alice := Registration{Username: "alice", Email: "alice@example.com", Password: "correct horse"}
+
+	s, _, _ := newTestRegistrationService(t, user.RegistrationPolicy{})
+	if err := s.Register(ctx, "test-organization-id", "test", alice, nil, ""); !errors.Is(err, ErrRegistrationDisabled) {
+		t.Errorf("Expected sign up to be disabled, got %v", err)
+	}
+
+	s, _, emailSender := newTestRegistrationService(t, user.RegistrationPolicy{Enabled: true, RequireChallenge: true})
+	if err := s.Register(ctx, "test-organization-id", "test", alice, url.Values{}, ""); !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Expected sign up without solving the challenge to fail, got %v", err)
+	}
+	if len(emailSender.Emails()) != 0 {
+		t.Errorf("Expected no email to be sent, got %d", len(emailSender.Emails()))
+	}
+}
+
+func TestRegisterUnknownAttribute(t *testing.T) {
+	s, _, _ := newTestRegistrationService(t, user.RegistrationPolicy{Enabled: true, RequiredAttributes: []string{"country", "city"}})
+	registration := Registration{Username: "alice", Email: "alice@example.com", Password: "correct horse", Attributes: map[string]string{"country": "LK", "city": "Colombo"}}
+	if err := s.Register(context.Background(), "test-organization-id", "test", registration, nil, ""); !errors.Is(err, ErrUnknownAttribute) {
+		t.Errorf("Expected a required attribute the organization doesn't have to fail, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package risk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// networkTable finds the most specific network an address belongs to.
+type networkTable[T any] struct {
+	networks map[int]map[netip.Prefix]T
+	// bits are the prefix lengths of the networks, longest first
+	bits []int
+}
+
+func newNetworkTable[T any]() *networkTable[T] {
+	return &networkTable[T]{networks: map[int]map[netip.Prefix]T{}}
+}
+
+func (t *networkTable[T]) add(prefix netip.Prefix, value T) {
+	prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+	networks, ok := t.networks[prefix.Bits()]
+	if !ok {
+		networks = map[netip.Prefix]T{}
+		t.networks[prefix.Bits()] = networks
+		t.bits = append(t.bits, prefix.Bits())
+		slices.SortFunc(t.bits, func(a, b int) int { return b - a })
+	}
+	networks[prefix] = value
+}
+
+func (t *networkTable[T]) lookup(addr netip.Addr) (T, bool) {
+	addr = addr.Unmap()
+	for _, bits := range t.bits {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if value, ok := t.networks[bits][prefix]; ok {
+			return value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// parseNetwork parses a network in CIDR notation, or a single address.
+func parseNetwork(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// IPList is a list of networks, such as the addresses of known proxies, botnets or abusive hosts.
+type IPList struct {
+	networks *networkTable[struct{}]
+}
+
+// LoadIPList reads a list with a network in CIDR notation, or a single address, per line. Text
+// after a # is a comment.
+func LoadIPList(path string) (*IPList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseIPList(file)
+}
+
+func ParseIPList(r io.Reader) (*IPList, error) {
+	list := &IPList{networks: newNetworkTable[struct{}]()}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		list.networks.add(prefix, struct{}{})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *IPList) Contains(addr netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	_, found := l.networks.lookup(addr)
+	return found
+}
+
+// Location is where an address is, as far as the GeoIP database knows.
+type Location struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoIPDatabase locates addresses from a local database, so no address leaves the server.
+type GeoIPDatabase struct {
+	locations *networkTable[Location]
+}
+
+// LoadGeoIPDatabase reads a CSV file with the columns network, country, latitude and longitude,
+// such as one exported from a GeoLite2 City database. A header row and rows without coordinates
+// are skipped.
+func LoadGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseGeoIPDatabase(file)
+}
+
+func ParseGeoIPDatabase(r io.Reader) (*GeoIPDatabase, error) {
+	database := &GeoIPDatabase{locations: newNetworkTable[Location]()}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("line %d: expected network, country, latitude and longitude", line)
+		}
+		prefix, err := parseNetwork(record[0])
+		if err != nil {
+			if line == 1 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if record[2] == "" || record[3] == "" {
+			continue
+		}
+		latitude, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude", line)
+		}
+		longitude, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude", line)
+		}
+		database.locations.add(prefix, Location{Country: record[1], Latitude: latitude, Longitude: longitude})
+	}
+	return database, nil
+}
+
+func (d *GeoIPDatabase) Lookup(addr netip.Addr) (Location, bool) {
+	if d == nil {
+		return Location{}, false
+	}
+	return d.locations.lookup(addr)
+}
+
+// distance returns the great circle distance between two locations in kilometres.
+func distance(a, b Location) float64 {
+	const earthRadius = 6371
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
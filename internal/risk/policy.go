@@ -0,0 +1,174 @@
+package risk
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	// the usual hours of a policy can be in any time zone, even where the system has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// RiskModeOff records logins in the audit trail without scoring them.
+	RiskModeOff = "off"
+	// RiskModeMonitor scores logins and records the decisions without acting on them, to tune a
+	// policy before enforcing it.
+	RiskModeMonitor = "monitor"
+	// RiskModeEnforce asks risky logins for a second factor and blocks the riskiest.
+	RiskModeEnforce = "enforce"
+)
+
+const (
+	SignalNewDevice        = "new_device"
+	SignalIPReputation     = "ip_reputation"
+	SignalImpossibleTravel = "impossible_travel"
+	SignalFailedAttempts   = "failed_attempts"
+	SignalUnusualTime      = "unusual_time"
+)
+
+// DefaultWeights are the scores the signals add when a policy doesn't weigh them.
+var DefaultWeights = map[string]int{
+	SignalNewDevice:        20,
+	SignalIPReputation:     50,
+	SignalImpossibleTravel: 60,
+	SignalFailedAttempts:   30,
+	SignalUnusualTime:      10,
+}
+
+const (
+	DefaultStepUpScore = 40
+	DefaultBlockScore  = 80
+)
+
+// RiskPolicy controls how the logins of an organization are scored and what happens to risky ones.
+type RiskPolicy struct {
+	OrganizationId string
+	Mode           string
+	// StepUpScore is the score from which a login needs a second factor, and BlockScore the score
+	// from which it is blocked. A zero score disables the action.
+	StepUpScore int
+	BlockScore  int
+	// Weights overrides the scores of the signals, a zero weight ignores the signal.
+	Weights map[string]int
+	// Logins outside of [UsualHoursStart, UsualHoursEnd) in the time zone are scored as unusual.
+	// The hours wrap around midnight when the start is after the end, equal hours disable the signal.
+	UsualHoursStart int
+	UsualHoursEnd   int
+	Timezone        string
+}
+
+func (p RiskPolicy) Validate() error {
+	if p.Mode != RiskModeOff && p.Mode != RiskModeMonitor && p.Mode != RiskModeEnforce {
+		return errors.New("mode must be off, monitor or enforce")
+	}
+	if p.StepUpScore < 0 || p.BlockScore < 0 {
+		return errors.New("scores can't be negative")
+	}
+	if p.StepUpScore > 0 && p.BlockScore > 0 && p.StepUpScore > p.BlockScore {
+		return errors.New("step_up_score can't be above block_score")
+	}
+	for signal, weight := range p.Weights {
+		if _, ok := DefaultWeights[signal]; !ok {
+			return fmt.Errorf("unknown signal %q", signal)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of %s can't be negative", signal)
+		}
+	}
+	if p.UsualHoursStart < 0 || p.UsualHoursStart > 23 || p.UsualHoursEnd < 0 || p.UsualHoursEnd > 23 {
+		return errors.New("usual hours must be between 0 and 23")
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	return nil
+}
+
+// Weight returns the score the signal adds to a login.
+func (p RiskPolicy) Weight(signal string) int {
+	if weight, ok := p.Weights[signal]; ok {
+		return weight
+	}
+	return DefaultWeights[signal]
+}
+
+// IsUsualTime reports whether the login time is within the usual hours of the policy.
+func (p RiskPolicy) IsUsualTime(t time.Time) bool {
+	if p.UsualHoursStart == p.UsualHoursEnd {
+		return true
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	hour := t.In(location).Hour()
+	if p.UsualHoursStart < p.UsualHoursEnd {
+		return hour >= p.UsualHoursStart && hour < p.UsualHoursEnd
+	}
+	return hour >= p.UsualHoursStart || hour < p.UsualHoursEnd
+}
+
+type RiskPolicyRepository interface {
+	GetRiskPolicy(ctx context.Context, orgId string) (RiskPolicy, bool, error)
+	SaveRiskPolicy(ctx context.Context, policy RiskPolicy) error
+}
+
+type riskPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewRiskPolicyRepository(db *sqlx.DB) RiskPolicyRepository {
+	return &riskPolicyRepository{
+		db: db,
+	}
+}
+
+func (r *riskPolicyRepository) GetRiskPolicy(ctx context.Context, orgId string) (RiskPolicy, bool, error) {
+	var row struct {
+		OrganizationId  string         `db:"organization_id"`
+		Mode            string         `db:"mode"`
+		StepUpScore     int            `db:"step_up_score"`
+		BlockScore      int            `db:"block_score"`
+		Weights         sql.NullString `db:"weights"`
+		UsualHoursStart int            `db:"usual_hours_start"`
+		UsualHoursEnd   int            `db:"usual_hours_end"`
+		Timezone        string         `db:"timezone"`
+	}
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, mode, step_up_score, block_score, weights, usual_hours_start, usual_hours_end, timezone FROM risk_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RiskPolicy{}, false, nil
+		}
+		return RiskPolicy{}, false, err
+	}
+	policy := RiskPolicy{
+		OrganizationId:  row.OrganizationId,
+		Mode:            row.Mode,
+		StepUpScore:     row.StepUpScore,
+		BlockScore:      row.BlockScore,
+		UsualHoursStart: row.UsualHoursStart,
+		UsualHoursEnd:   row.UsualHoursEnd,
+		Timezone:        row.Timezone,
+	}
+	if row.Weights.Valid && row.Weights.String != "" {
+		if err := json.Unmarshal([]byte(row.Weights.String), &policy.Weights); err != nil {
+			return RiskPolicy{}, false, err
+		}
+	}
+	return policy, true, nil
+}
+
+func (r *riskPolicyRepository) SaveRiskPolicy(ctx context.Context, policy RiskPolicy) error {
+	weightsJSON, err := json.Marshal(policy.Weights)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO risk_policy (organization_id, mode, step_up_score, block_score, weights, usual_hours_start, usual_hours_end, timezone) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (organization_id) DO UPDATE SET mode = excluded.mode, step_up_score = excluded.step_up_score, block_score = excluded.block_score, weights = excluded.weights, usual_hours_start = excluded.usual_hours_start, usual_hours_end = excluded.usual_hours_end, timezone = excluded.timezone",
+		policy.OrganizationId, policy.Mode, policy.StepUpScore, policy.BlockScore, string(weightsJSON), policy.UsualHoursStart, policy.UsualHoursEnd, policy.Timezone)
+	return err
+}
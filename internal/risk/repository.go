@@ -0,0 +1,191 @@
+package risk
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LoginEvent is an entry of the audit trail of logins, with the signals the login raised and what
+// was decided.
+type LoginEvent struct {
+	Id             string
+	OrganizationId string
+	UserId         string
+	Username       string
+	ClientId       string
+	IPAddress      string
+	UserAgent      string
+	// Location is set when the GeoIP database knows the address.
+	Location *Location
+	// Succeeded is false for a failed attempt at any step of the login.
+	Succeeded bool
+	Score     int
+	Signals   []string
+	Decision  string
+	// Enforced is false when the decision was only recorded, because the policy is in monitor mode.
+	Enforced  bool
+	CreatedAt time.Time
+}
+
+type loginEventRow struct {
+	Id             string          `db:"id"`
+	OrganizationId string          `db:"organization_id"`
+	UserId         string          `db:"user_id"`
+	Username       string          `db:"username"`
+	ClientId       string          `db:"client_id"`
+	IPAddress      string          `db:"ip_address"`
+	UserAgent      string          `db:"user_agent"`
+	Country        sql.NullString  `db:"country"`
+	Latitude       sql.NullFloat64 `db:"latitude"`
+	Longitude      sql.NullFloat64 `db:"longitude"`
+	Succeeded      bool            `db:"succeeded"`
+	Score          int             `db:"score"`
+	Signals        sql.NullString  `db:"signals"`
+	Decision       string          `db:"decision"`
+	Enforced       bool            `db:"enforced"`
+	CreatedAt      int64           `db:"created_at"`
+}
+
+const loginEventColumns = "id, organization_id, user_id, username, client_id, ip_address, user_agent, country, latitude, longitude, succeeded, score, signals, decision, enforced, created_at"
+
+type RiskRepository interface {
+	AddLoginEvent(ctx context.Context, event LoginEvent) error
+	// GetLoginEvents returns the latest events of the organization, of one user when userId is set.
+	GetLoginEvents(ctx context.Context, orgId, userId string, limit int) ([]LoginEvent, error)
+	CountFailedLogins(ctx context.Context, orgId, username string, since time.Time) (int, error)
+	// GetLastLocatedLogin returns the latest login of the user that was let in from a known location.
+	GetLastLocatedLogin(ctx context.Context, orgId, userId string) (LoginEvent, bool, error)
+	HasDevice(ctx context.Context, orgId, userId, deviceHash string) (bool, error)
+	SaveDevice(ctx context.Context, orgId, userId, deviceHash string, seenAt time.Time) error
+	// DeleteLoginEvents removes the events older than before.
+	DeleteLoginEvents(ctx context.Context, before time.Time) error
+	// DeleteDevices removes the devices last seen before seenBefore.
+	DeleteDevices(ctx context.Context, seenBefore time.Time) error
+}
+
+type riskRepository struct {
+	db *sqlx.DB
+}
+
+func NewRiskRepository(db *sqlx.DB) RiskRepository {
+	return &riskRepository{
+		db: db,
+	}
+}
+
+func (r *riskRepository) AddLoginEvent(ctx context.Context, event LoginEvent) error {
+	signalsJSON, err := json.Marshal(event.Signals)
+	if err != nil {
+		return err
+	}
+	var country sql.NullString
+	var latitude, longitude sql.NullFloat64
+	if event.Location != nil {
+		country = sql.NullString{String: event.Location.Country, Valid: true}
+		latitude = sql.NullFloat64{Float64: event.Location.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: event.Location.Longitude, Valid: true}
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO login_event ("+loginEventColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.Id, event.OrganizationId, event.UserId, event.Username, event.ClientId, event.IPAddress, event.UserAgent,
+		country, latitude, longitude, event.Succeeded, event.Score, string(signalsJSON), event.Decision, event.Enforced, event.CreatedAt.Unix())
+	return err
+}
+
+func (r *riskRepository) GetLoginEvents(ctx context.Context, orgId, userId string, limit int) ([]LoginEvent, error) {
+	query := "SELECT " + loginEventColumns + " FROM login_event WHERE organization_id = ?"
+	args := []interface{}{orgId}
+	if userId != "" {
+		query += " AND user_id = ?"
+		args = append(args, userId)
+	}
+	query += " ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+	var rows []loginEventRow
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	events := []LoginEvent{}
+	for _, row := range rows {
+		event, err := row.toLoginEvent()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (r *riskRepository) CountFailedLogins(ctx context.Context, orgId, username string, since time.Time) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM login_event WHERE organization_id = ? AND username = ? AND succeeded = 0 AND created_at >= ?", orgId, username, since.Unix())
+	return count, err
+}
+
+func (r *riskRepository) GetLastLocatedLogin(ctx context.Context, orgId, userId string) (LoginEvent, bool, error) {
+	var row loginEventRow
+	err := r.db.GetContext(ctx, &row, "SELECT "+loginEventColumns+" FROM login_event WHERE organization_id = ? AND user_id = ? AND succeeded = 1 AND NOT (decision = ? AND enforced = 1) AND latitude IS NOT NULL ORDER BY created_at DESC, rowid DESC LIMIT 1",
+		orgId, userId, DecisionBlock)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return LoginEvent{}, false, nil
+		}
+		return LoginEvent{}, false, err
+	}
+	event, err := row.toLoginEvent()
+	if err != nil {
+		return LoginEvent{}, false, err
+	}
+	return event, true, nil
+}
+
+func (r *riskRepository) HasDevice(ctx context.Context, orgId, userId, deviceHash string) (bool, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM user_device WHERE user_id = ? AND organization_id = ? AND device_hash = ?", userId, orgId, deviceHash)
+	return count > 0, err
+}
+
+func (r *riskRepository) SaveDevice(ctx context.Context, orgId, userId, deviceHash string, seenAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO user_device (user_id, organization_id, device_hash, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (user_id, device_hash) DO UPDATE SET last_seen_at = excluded.last_seen_at",
+		userId, orgId, deviceHash, seenAt.Unix(), seenAt.Unix())
+	return err
+}
+
+func (r *riskRepository) DeleteLoginEvents(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_event WHERE created_at < ?", before.Unix())
+	return err
+}
+
+func (r *riskRepository) DeleteDevices(ctx context.Context, seenBefore time.Time) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM user_device WHERE last_seen_at < ?", seenBefore.Unix())
+	return err
+}
+
+func (row loginEventRow) toLoginEvent() (LoginEvent, error) {
+	event := LoginEvent{
+		Id:             row.Id,
+		OrganizationId: row.OrganizationId,
+		UserId:         row.UserId,
+		Username:       row.Username,
+		ClientId:       row.ClientId,
+		IPAddress:      row.IPAddress,
+		UserAgent:      row.UserAgent,
+		Succeeded:      row.Succeeded,
+		Score:          row.Score,
+		Decision:       row.Decision,
+		Enforced:       row.Enforced,
+		CreatedAt:      time.Unix(row.CreatedAt, 0),
+	}
+	if row.Latitude.Valid && row.Longitude.Valid {
+		event.Location = &Location{Country: row.Country.String, Latitude: row.Latitude.Float64, Longitude: row.Longitude.Float64}
+	}
+	if row.Signals.Valid && row.Signals.String != "" {
+		if err := json.Unmarshal([]byte(row.Signals.String), &event.Signals); err != nil {
+			return LoginEvent{}, err
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,267 @@
+package risk
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+const (
+	DecisionAllow  = "allow"
+	DecisionStepUp = "step_up"
+	DecisionBlock  = "block"
+)
+
+// travel between locations closer than this is not scored, GeoIP databases are not more accurate
+const minTravelDistance = 100
+
+// LoginAttempt is a login to score, made from a browser.
+type LoginAttempt struct {
+	OrganizationId string
+	ClientId       string
+	// UserId is empty when the username is not known.
+	UserId    string
+	Username  string
+	IPAddress string
+	UserAgent string
+	// DeviceId is the device cookie of the browser, empty when it has none.
+	DeviceId string
+	Time     time.Time
+}
+
+// Assessment is the risk of a login and what the policy decided to do about it.
+type Assessment struct {
+	Score    int
+	Signals  []string
+	Decision string
+	// Enforced reports whether the decision has to be acted on.
+	Enforced bool
+}
+
+type RiskService interface {
+	// AssessLogin scores a login that passed its first authentication step and records the decision
+	// in the audit trail.
+	AssessLogin(ctx context.Context, attempt LoginAttempt) (Assessment, error)
+	// RecordFailedLogin records a failed attempt at any step of the login.
+	RecordFailedLogin(ctx context.Context, attempt LoginAttempt) error
+	// RememberDevice marks the device as known to the user, and returns the device id the browser
+	// keeps and until when. A new id is returned when the browser has none.
+	RememberDevice(ctx context.Context, orgId, userId, deviceId string) (string, time.Time, error)
+	GetLoginEvents(ctx context.Context, orgId, userId string, limit int) ([]LoginEvent, error)
+	GetRiskPolicy(ctx context.Context, orgId string) (RiskPolicy, error)
+	UpdateRiskPolicy(ctx context.Context, policy RiskPolicy) error
+}
+
+type riskService struct {
+	cfg              *config.Config
+	repository       RiskRepository
+	policyRepository RiskPolicyRepository
+	geoIP            *GeoIPDatabase
+	ipReputation     *IPList
+}
+
+// NewRiskService returns a risk service. The GeoIP database and the IP reputation list are
+// optional, the signals that need them are not raised without them. Login events past their
+// retention, and devices the browser no longer remembers, are swept every risk.sweep_interval.
+func NewRiskService(cfg *config.Config, repository RiskRepository, policyRepository RiskPolicyRepository, geoIP *GeoIPDatabase, ipReputation *IPList) RiskService {
+	s := &riskService{
+		cfg:              cfg,
+		repository:       repository,
+		policyRepository: policyRepository,
+		geoIP:            geoIP,
+		ipReputation:     ipReputation,
+	}
+	if cfg.Risk.SweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Risk.SweepInterval) * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.sweep(context.Background(), time.Now())
+			}
+		}()
+	}
+	return s
+}
+
+func (s *riskService) sweep(ctx context.Context, now time.Time) {
+	if err := s.repository.DeleteLoginEvents(ctx, now.Add(-s.cfg.GetRiskLoginEventRetention())); err != nil {
+		log.Printf("failed to sweep login events: %v", err)
+	}
+	if err := s.repository.DeleteDevices(ctx, now.Add(-s.cfg.GetRiskDeviceCookieMaxAge())); err != nil {
+		log.Printf("failed to sweep devices: %v", err)
+	}
+}
+
+func (s *riskService) AssessLogin(ctx context.Context, attempt LoginAttempt) (Assessment, error) {
+	policy, err := s.GetRiskPolicy(ctx, attempt.OrganizationId)
+	if err != nil {
+		return Assessment{}, err
+	}
+	event := s.newLoginEvent(attempt, true)
+	assessment := Assessment{Decision: DecisionAllow}
+	if policy.Mode != RiskModeOff {
+		signals, err := s.getSignals(ctx, policy, attempt, event.Location)
+		if err != nil {
+			return Assessment{}, err
+		}
+		for _, signal := range signals {
+			weight := policy.Weight(signal)
+			if weight == 0 {
+				continue
+			}
+			assessment.Signals = append(assessment.Signals, signal)
+			assessment.Score += weight
+		}
+		switch {
+		case policy.BlockScore > 0 && assessment.Score >= policy.BlockScore:
+			assessment.Decision = DecisionBlock
+		case policy.StepUpScore > 0 && assessment.Score >= policy.StepUpScore:
+			assessment.Decision = DecisionStepUp
+		}
+		assessment.Enforced = policy.Mode == RiskModeEnforce && assessment.Decision != DecisionAllow
+	}
+	event.Score = assessment.Score
+	event.Signals = assessment.Signals
+	event.Decision = assessment.Decision
+	event.Enforced = assessment.Enforced
+	if err := s.repository.AddLoginEvent(ctx, event); err != nil {
+		return Assessment{}, err
+	}
+	return assessment, nil
+}
+
+func (s *riskService) getSignals(ctx context.Context, policy RiskPolicy, attempt LoginAttempt, location *Location) ([]string, error) {
+	var signals []string
+	if attempt.UserId != "" {
+		known := false
+		if attempt.DeviceId != "" {
+			var err error
+			known, err = s.repository.HasDevice(ctx, attempt.OrganizationId, attempt.UserId, hashDeviceId(attempt.DeviceId))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !known {
+			signals = append(signals, SignalNewDevice)
+		}
+	}
+	if addr, err := netip.ParseAddr(attempt.IPAddress); err == nil && s.ipReputation.Contains(addr) {
+		signals = append(signals, SignalIPReputation)
+	}
+	if location != nil && attempt.UserId != "" {
+		last, found, err := s.repository.GetLastLocatedLogin(ctx, attempt.OrganizationId, attempt.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if found && isImpossibleTravel(*last.Location, *location, attempt.Time.Sub(last.CreatedAt), s.cfg.GetRiskMaxTravelSpeed()) {
+			signals = append(signals, SignalImpossibleTravel)
+		}
+	}
+	failedAttempts, err := s.repository.CountFailedLogins(ctx, attempt.OrganizationId, attempt.Username, attempt.Time.Add(-s.cfg.GetRiskFailedAttemptsWindow()))
+	if err != nil {
+		return nil, err
+	}
+	if failedAttempts >= s.cfg.GetRiskFailedAttemptsThreshold() {
+		signals = append(signals, SignalFailedAttempts)
+	}
+	if !policy.IsUsualTime(attempt.Time) {
+		signals = append(signals, SignalUnusualTime)
+	}
+	return signals, nil
+}
+
+// isImpossibleTravel reports whether the user would have had to travel faster than the speed, in
+// kilometres per hour, to sign in from both locations.
+func isImpossibleTravel(from, to Location, elapsed time.Duration, maxSpeed float64) bool {
+	km := distance(from, to)
+	if km < minTravelDistance {
+		return false
+	}
+	hours := max(elapsed.Hours(), time.Minute.Hours())
+	return km/hours > maxSpeed
+}
+
+func (s *riskService) RecordFailedLogin(ctx context.Context, attempt LoginAttempt) error {
+	return s.repository.AddLoginEvent(ctx, s.newLoginEvent(attempt, false))
+}
+
+func (s *riskService) newLoginEvent(attempt LoginAttempt, succeeded bool) LoginEvent {
+	event := LoginEvent{
+		Id:             uuid.New().String(),
+		OrganizationId: attempt.OrganizationId,
+		UserId:         attempt.UserId,
+		Username:       attempt.Username,
+		ClientId:       attempt.ClientId,
+		IPAddress:      attempt.IPAddress,
+		UserAgent:      attempt.UserAgent,
+		Succeeded:      succeeded,
+		Decision:       DecisionAllow,
+		CreatedAt:      attempt.Time,
+	}
+	if addr, err := netip.ParseAddr(attempt.IPAddress); err == nil {
+		if location, found := s.geoIP.Lookup(addr); found {
+			event.Location = &location
+		}
+	}
+	return event
+}
+
+func (s *riskService) RememberDevice(ctx context.Context, orgId, userId, deviceId string) (string, time.Time, error) {
+	if deviceId == "" {
+		bytes := make([]byte, 32)
+		if _, err := rand.Read(bytes); err != nil {
+			return "", time.Time{}, err
+		}
+		deviceId = hex.EncodeToString(bytes)
+	}
+	now := time.Now()
+	if err := s.repository.SaveDevice(ctx, orgId, userId, hashDeviceId(deviceId), now); err != nil {
+		return "", time.Time{}, err
+	}
+	return deviceId, now.Add(s.cfg.GetRiskDeviceCookieMaxAge()), nil
+}
+
+func (s *riskService) GetLoginEvents(ctx context.Context, orgId, userId string, limit int) ([]LoginEvent, error) {
+	return s.repository.GetLoginEvents(ctx, orgId, userId, limit)
+}
+
+func (s *riskService) GetRiskPolicy(ctx context.Context, orgId string) (RiskPolicy, error) {
+	policy, found, err := s.policyRepository.GetRiskPolicy(ctx, orgId)
+	if err != nil {
+		return RiskPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	mode := s.cfg.Risk.Mode
+	if mode == "" {
+		mode = RiskModeOff
+	}
+	return RiskPolicy{
+		OrganizationId: orgId,
+		Mode:           mode,
+		StepUpScore:    DefaultStepUpScore,
+		BlockScore:     DefaultBlockScore,
+	}, nil
+}
+
+func (s *riskService) UpdateRiskPolicy(ctx context.Context, policy RiskPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	return s.policyRepository.SaveRiskPolicy(ctx, policy)
+}
+
+// hashDeviceId hashes the device id before it is stored, so the stored ids can't be replayed as
+// cookies.
+func hashDeviceId(deviceId string) string {
+	hash := sha256.Sum256([]byte(deviceId))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,178 @@
+package risk
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+const testGeoIPDatabase = `network,country,latitude,longitude
+10.0.0.0/8,LK,6.9271,79.8612
+192.0.2.0/24,US,40.7128,-74.0060
+192.0.2.128/25,GB,51.5072,-0.1276
+`
+
+const testIPList = `# known proxies
+198.51.100.0/24
+203.0.113.7 # botnet
+`
+
+func newTestRiskService(t *testing.T) RiskService {
+	db := testutil.NewDB(t, "risk.sql")
+	geoIP, err := ParseGeoIPDatabase(strings.NewReader(testGeoIPDatabase))
+	if err != nil {
+		t.Fatalf("failed to parse GeoIP database: %v", err)
+	}
+	ipReputation, err := ParseIPList(strings.NewReader(testIPList))
+	if err != nil {
+		t.Fatalf("failed to parse IP list: %v", err)
+	}
+	cfg := &config.Config{}
+	cfg.Risk.Mode = RiskModeEnforce
+	return NewRiskService(cfg, NewRiskRepository(db), NewRiskPolicyRepository(db), geoIP, ipReputation)
+}
+
+func TestNetworkLookup(t *testing.T) {
+	geoIP, _ := ParseGeoIPDatabase(strings.NewReader(testGeoIPDatabase))
+	tests := []struct {
+		addr    string
+		country string
+	}{
+		{"10.1.2.3", "LK"},
+		{"192.0.2.1", "US"},
+		{"192.0.2.200", "GB"},
+		{"::ffff:192.0.2.200", "GB"},
+		{"172.16.0.1", ""},
+	}
+	for _, test := range tests {
+		location, _ := geoIP.Lookup(netip.MustParseAddr(test.addr))
+		if location.Country != test.country {
+			t.Errorf("Expected %s to be in %q, got %q", test.addr, test.country, location.Country)
+		}
+	}
+	ipReputation, _ := ParseIPList(strings.NewReader(testIPList))
+	if !ipReputation.Contains(netip.MustParseAddr("198.51.100.20")) || !ipReputation.Contains(netip.MustParseAddr("203.0.113.7")) {
+		t.Error("Expected listed addresses to be found")
+	}
+	if ipReputation.Contains(netip.MustParseAddr("203.0.113.8")) {
+		t.Error("Expected an unlisted address not to be found")
+	}
+}
+
+func TestAssessLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestRiskService(t)
+	now := time.Now()
+	attempt := LoginAttempt{
+		OrganizationId: "test-organization-id",
+		UserId:         "test-user-id",
+		Username:       "alice",
+		IPAddress:      "10.1.2.3",
+		Time:           now.Add(-2 * time.Hour),
+	}
+	assessment, err := s.AssessLogin(ctx, attempt)
+	if err != nil {
+		t.Fatalf("Failed to assess login: %v", err)
+	}
+	if assessment.Decision != DecisionAllow || !slices.Equal(assessment.Signals, []string{SignalNewDevice}) {
+		t.Errorf("Expected a login from a new device to be allowed, got %+v", assessment)
+	}
+	deviceId, _, err := s.RememberDevice(ctx, attempt.OrganizationId, attempt.UserId, "")
+	if err != nil {
+		t.Fatalf("Failed to remember device: %v", err)
+	}
+	attempt.DeviceId = deviceId
+
+	// from the other side of the world an hour after the last login, following failed attempts
+	attempt.IPAddress = "192.0.2.1"
+	attempt.Time = now.Add(-time.Hour)
+	for range 3 {
+		if err := s.RecordFailedLogin(ctx, attempt); err != nil {
+			t.Fatalf("Failed to record failed login: %v", err)
+		}
+	}
+	assessment, _ = s.AssessLogin(ctx, attempt)
+	if !slices.Equal(assessment.Signals, []string{SignalImpossibleTravel, SignalFailedAttempts}) {
+		t.Errorf("Expected impossible travel and failed attempts, got %v", assessment.Signals)
+	}
+	if assessment.Decision != DecisionBlock || !assessment.Enforced {
+		t.Errorf("Expected the login to be blocked, got %+v", assessment)
+	}
+
+	// the blocked login is not where the user was last seen, and the failed attempts are too old
+	attempt.IPAddress = "203.0.113.7"
+	attempt.Time = now.Add(time.Hour)
+	assessment, _ = s.AssessLogin(ctx, attempt)
+	if assessment.Decision != DecisionStepUp || !slices.Equal(assessment.Signals, []string{SignalIPReputation}) {
+		t.Errorf("Expected a login from a listed address to step up, got %+v", assessment)
+	}
+
+	policy := RiskPolicy{OrganizationId: attempt.OrganizationId, Mode: RiskModeMonitor, StepUpScore: 40, BlockScore: 80}
+	if err := s.UpdateRiskPolicy(ctx, policy); err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+	assessment, _ = s.AssessLogin(ctx, attempt)
+	if assessment.Decision != DecisionStepUp || assessment.Enforced {
+		t.Errorf("Expected a monitored decision not to be enforced, got %+v", assessment)
+	}
+	events, err := s.GetLoginEvents(ctx, attempt.OrganizationId, attempt.UserId, 10)
+	if err != nil {
+		t.Fatalf("Failed to get login events: %v", err)
+	}
+	if len(events) != 7 || events[0].Decision != DecisionStepUp || events[0].Enforced {
+		t.Errorf("Expected 7 events with the monitored decision first, got %+v", events)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	s := newTestRiskService(t)
+	now := time.Now()
+	attempt := LoginAttempt{OrganizationId: "test-organization-id", UserId: "test-user-id", Username: "alice", IPAddress: "10.1.2.3"}
+	for _, age := range []time.Duration{100 * 24 * time.Hour, time.Hour} {
+		attempt.Time = now.Add(-age)
+		if err := s.RecordFailedLogin(ctx, attempt); err != nil {
+			t.Fatalf("Failed to record failed login: %v", err)
+		}
+	}
+	s.(*riskService).sweep(ctx, now)
+	events, err := s.GetLoginEvents(ctx, attempt.OrganizationId, attempt.UserId, 10)
+	if err != nil {
+		t.Fatalf("Failed to get login events: %v", err)
+	}
+	if len(events) != 1 || events[0].CreatedAt.Before(now.Add(-2*time.Hour)) {
+		t.Errorf("Expected only the recent event to be kept, got %+v", events)
+	}
+}
+
+func TestRiskPolicy(t *testing.T) {
+	policy := RiskPolicy{Mode: RiskModeEnforce, UsualHoursStart: 22, UsualHoursEnd: 6, Timezone: "Asia/Colombo"}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Expected a valid policy, got %v", err)
+	}
+	// 23:30 and 10:30 in Colombo
+	if !policy.IsUsualTime(time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Error("Expected a night shift login to be usual")
+	}
+	if policy.IsUsualTime(time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)) {
+		t.Error("Expected a day time login to be unusual")
+	}
+	invalid := []RiskPolicy{
+		{Mode: "strict"},
+		{Mode: RiskModeEnforce, StepUpScore: 90, BlockScore: 80},
+		{Mode: RiskModeEnforce, Weights: map[string]int{"weather": 10}},
+		{Mode: RiskModeEnforce, UsualHoursEnd: 24},
+		{Mode: RiskModeEnforce, Timezone: "Mars/Olympus"},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", policy)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	minCookieKeyLength = 32
+	csrfCookieName     = "csrf"
+	csrfSecretLength   = 32
+	// the __Host- prefix makes browsers only accept the cookie from this host, over HTTPS, for
+	// every path
+	hostCookiePrefix = "__Host-"
+)
+
+// Cookies sets and reads the cookies of the hosted pages. Their values are encrypted and
+// authenticated with a key kept on the server, so they can't be read or forged in the browser.
+// When the server uses HTTPS, cookies are Secure and get the __Host- prefix, so other hosts of
+// the domain can't set them.
+//
+// It also issues the CSRF tokens of the hosted forms. A token is a MAC of a secret kept in a
+// cookie of the browser and of the login it continues, so it can't be used by another browser,
+// or for another login, and a page of another site can't post a form with it.
+type Cookies struct {
+	aead    cipher.AEAD
+	csrfKey []byte
+	secure  bool
+}
+
+// LoadCookieKey reads the cookie key from the file, which has to hold at least 32 random bytes.
+// Without a file a random key is used, so cookies don't survive restarts and can't be read by the
+// other instances of the server.
+func LoadCookieKey(path string) ([]byte, error) {
+	if path == "" {
+		log.Printf("No cookie key is configured, using a random key")
+		key := make([]byte, minCookieKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie key: %v", err)
+	}
+	if len(key) < minCookieKeyLength {
+		return nil, fmt.Errorf("the cookie key has to be at least %d bytes", minCookieKeyLength)
+	}
+	return key, nil
+}
+
+// NewCookies returns cookies protected with keys derived from the key. Cookies are Secure when
+// secure is set.
+func NewCookies(key []byte, secure bool) (*Cookies, error) {
+	if len(key) < minCookieKeyLength {
+		return nil, fmt.Errorf("the cookie key has to be at least %d bytes", minCookieKeyLength)
+	}
+	encryptionKey, err := deriveCookieKey(key, "cookie encryption")
+	if err != nil {
+		return nil, err
+	}
+	csrfKey, err := deriveCookieKey(key, "csrf token")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cookies{aead: aead, csrfKey: csrfKey, secure: secure}, nil
+}
+
+// Set sets the cookie with the value encrypted. A zero expiry makes it a session cookie.
+func (c *Cookies) Set(w http.ResponseWriter, name, value string, expires time.Time) error {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// the name is authenticated with the value, so the value of one cookie can't be used as another
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	http.SetCookie(w, c.cookie(name, base64.RawURLEncoding.EncodeToString(sealed), expires))
+	return nil
+}
+
+// Get returns the value of the cookie. It is not found when it is missing, or was not set by Set
+// with the same key.
+func (c *Cookies) Get(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(c.name(name))
+	if err != nil {
+		return "", false
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	nonceSize := c.aead.NonceSize()
+	if err != nil || len(sealed) < nonceSize {
+		return "", false
+	}
+	value, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+func (c *Cookies) Delete(w http.ResponseWriter, name string) {
+	http.SetCookie(w, c.cookie(name, "", time.Unix(0, 0)))
+}
+
+// CSRFToken returns the CSRF token of the forms that continue the scope, such as the login of a
+// session_data_key, in this browser. The browser is given a CSRF secret when it has none.
+func (c *Cookies) CSRFToken(w http.ResponseWriter, r *http.Request, scope string) (string, error) {
+	secret, found := c.Get(r, csrfCookieName)
+	if !found {
+		secretBytes := make([]byte, csrfSecretLength)
+		if _, err := rand.Read(secretBytes); err != nil {
+			return "", err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(secretBytes)
+		if err := c.Set(w, csrfCookieName, secret, time.Time{}); err != nil {
+			return "", err
+		}
+	}
+	return c.csrfToken(secret, scope), nil
+}
+
+// VerifyCSRFToken reports whether the token was issued by CSRFToken to this browser for the scope.
+func (c *Cookies) VerifyCSRFToken(r *http.Request, scope, token string) bool {
+	if scope == "" || token == "" {
+		return false
+	}
+	secret, found := c.Get(r, csrfCookieName)
+	if !found {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(c.csrfToken(secret, scope)))
+}
+
+func (c *Cookies) csrfToken(secret, scope string) string {
+	mac := hmac.New(sha256.New, c.csrfKey)
+	mac.Write([]byte(secret))
+	mac.Write([]byte{0})
+	mac.Write([]byte(scope))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Cookies) name(name string) string {
+	if c.secure {
+		return hostCookiePrefix + name
+	}
+	return name
+}
+
+func (c *Cookies) cookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.name(name),
+		Value:    value,
+		Expires:  expires,
+		Path:     "/",
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func deriveCookieKey(key []byte, purpose string) ([]byte, error) {
+	derived := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(purpose)), derived); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
@@ -0,0 +1,103 @@
+package security
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCookies(t *testing.T, secure bool) *Cookies {
+	cookies, err := NewCookies(bytes.Repeat([]byte("k"), minCookieKeyLength), secure)
+	if err != nil {
+		t.Fatalf("Failed to create cookies: %v", err)
+	}
+	return cookies
+}
+
+// withCookies returns a request carrying the cookies set in the response.
+func withCookies(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestCookies(t *testing.T) {
+	cookies := newTestCookies(t, false)
+	w := httptest.NewRecorder()
+	if err := cookies.Set(w, "session_id", "test-session-id", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to set the cookie: %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	if cookie.Name != "session_id" || strings.Contains(cookie.Value, "test-session-id") || !cookie.HttpOnly || cookie.Secure {
+		t.Errorf("Expected an encrypted, HttpOnly cookie, got %+v", cookie)
+	}
+	if value, found := cookies.Get(withCookies(w), "session_id"); !found || value != "test-session-id" {
+		t.Errorf("Expected the value to be read back, got %q", value)
+	}
+
+	flipped := "A"
+	if strings.HasPrefix(cookie.Value, flipped) {
+		flipped = "B"
+	}
+	tampered := httptest.NewRequest(http.MethodPost, "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: "session_id", Value: flipped + cookie.Value[1:]})
+	if _, found := cookies.Get(tampered, "session_id"); found {
+		t.Errorf("Expected a tampered cookie to be rejected")
+	}
+	renamed := httptest.NewRequest(http.MethodPost, "/", nil)
+	renamed.AddCookie(&http.Cookie{Name: "device_id", Value: cookie.Value})
+	if _, found := cookies.Get(renamed, "device_id"); found {
+		t.Errorf("Expected the value of another cookie to be rejected")
+	}
+	if _, found := newTestCookies(t, true).Get(withCookies(w), "session_id"); found {
+		t.Errorf("Expected the cookie without the __Host- prefix to be ignored when secure")
+	}
+
+	w = httptest.NewRecorder()
+	secureCookies := newTestCookies(t, true)
+	secureCookies.Set(w, "session_id", "test-session-id", time.Time{})
+	cookie = w.Result().Cookies()[0]
+	if cookie.Name != "__Host-session_id" || !cookie.Secure || cookie.Path != "/" {
+		t.Errorf("Expected a secure __Host- cookie, got %+v", cookie)
+	}
+	if value, found := secureCookies.Get(withCookies(w), "session_id"); !found || value != "test-session-id" {
+		t.Errorf("Expected the secure cookie to be read back, got %q", value)
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	cookies := newTestCookies(t, false)
+	w := httptest.NewRecorder()
+	token, err := cookies.CSRFToken(w, httptest.NewRequest(http.MethodGet, "/", nil), "test-session-data-key")
+	if err != nil {
+		t.Fatalf("Failed to issue a CSRF token: %v", err)
+	}
+	r := withCookies(w)
+	if !cookies.VerifyCSRFToken(r, "test-session-data-key", token) {
+		t.Errorf("Expected the token to be valid for its login")
+	}
+	if again, _ := cookies.CSRFToken(httptest.NewRecorder(), r, "test-session-data-key"); again != token {
+		t.Errorf("Expected the browser to keep its CSRF secret")
+	}
+	if cookies.VerifyCSRFToken(r, "other-session-data-key", token) {
+		t.Errorf("Expected the token to be rejected for another login")
+	}
+	if cookies.VerifyCSRFToken(r, "test-session-data-key", "") {
+		t.Errorf("Expected a missing token to be rejected")
+	}
+
+	// another browser has another secret
+	other := httptest.NewRecorder()
+	cookies.CSRFToken(other, httptest.NewRequest(http.MethodGet, "/", nil), "test-session-data-key")
+	if cookies.VerifyCSRFToken(withCookies(other), "test-session-data-key", token) {
+		t.Errorf("Expected the token to be rejected in another browser")
+	}
+	if cookies.VerifyCSRFToken(httptest.NewRequest(http.MethodPost, "/", nil), "test-session-data-key", token) {
+		t.Errorf("Expected the token to be rejected without the CSRF cookie")
+	}
+}
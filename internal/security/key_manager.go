@@ -2,6 +2,8 @@ package security
 
 import (
 	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -85,6 +87,18 @@ func (km *KeyManager) GetKeyPair(name string) (*KeyPair, error) {
 	return keyPair, nil
 }
 
+// DeriveKey returns a secret key for the purpose, derived from the EdDSA signing key, so every
+// instance of the server derives the same one.
+func (km *KeyManager) DeriveKey(purpose string) ([]byte, error) {
+	keyPair, err := km.GetKeyPair("eddsa")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, keyPair.PrivateKey.Seed())
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil), nil
+}
+
 func parsePrivateKey(data []byte) (ed25519.PrivateKey, ed25519.PublicKey, error) {
 	block, _ := pem.Decode(data)
 	if block == nil {
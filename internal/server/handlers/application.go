@@ -3,9 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
 
 	"github.com/shashimalcse/tiny-is/internal/application"
 	app_models "github.com/shashimalcse/tiny-is/internal/application/models"
+	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
 	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
 	"github.com/shashimalcse/tiny-is/internal/server/models"
 )
@@ -68,11 +70,25 @@ func (handler ApplicationHandler) CreateApplication(w http.ResponseWriter, r *ht
 	if err != nil {
 		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
 	}
+	if len(applicationRequest.AuthenticationSequence) > 0 {
+		if err := applicationRequest.AuthenticationSequence.Validate(); err != nil {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if applicationRequest.ResponseMode != "" && !slices.Contains(oauth2_models.SupportedResponseModes, applicationRequest.ResponseMode) {
+		return middlewares.NewAPIError(http.StatusBadRequest, "unsupported response_mode")
+	}
 	application := app_models.Application{
-		Name:           applicationRequest.Name,
-		RedirectUris:   applicationRequest.RedirectUris,
-		GrantTypes:     applicationRequest.GrantTypes,
-		OrganizationId: orgId,
+		Name:                   applicationRequest.Name,
+		RedirectUris:           applicationRequest.RedirectUris,
+		GrantTypes:             applicationRequest.GrantTypes,
+		ResponseMode:           applicationRequest.ResponseMode,
+		PostLogoutRedirectUris: applicationRequest.PostLogoutRedirectUris,
+		BackchannelLogoutUri:   applicationRequest.BackchannelLogoutUri,
+		FrontchannelLogoutUri:  applicationRequest.FrontchannelLogoutUri,
+		AuthenticationSequence: applicationRequest.AuthenticationSequence,
+		RequireConsent:         &applicationRequest.RequireConsent,
+		OrganizationId:         orgId,
 	}
 	ctx := r.Context()
 	err = handler.applicationService.CreateApplication(ctx, application)
@@ -95,10 +111,24 @@ func (handler ApplicationHandler) UpdateApplication(w http.ResponseWriter, r *ht
 	if err != nil {
 		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
 	}
+	if len(applicationRequest.AuthenticationSequence) > 0 {
+		if err := applicationRequest.AuthenticationSequence.Validate(); err != nil {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if applicationRequest.ResponseMode != "" && !slices.Contains(oauth2_models.SupportedResponseModes, applicationRequest.ResponseMode) {
+		return middlewares.NewAPIError(http.StatusBadRequest, "unsupported response_mode")
+	}
 	application := app_models.Application{
-		Name:         applicationRequest.Name,
-		RedirectUris: applicationRequest.RedirectUris,
-		GrantTypes:   applicationRequest.GrantTypes,
+		Name:                   applicationRequest.Name,
+		RedirectUris:           applicationRequest.RedirectUris,
+		GrantTypes:             applicationRequest.GrantTypes,
+		ResponseMode:           applicationRequest.ResponseMode,
+		PostLogoutRedirectUris: applicationRequest.PostLogoutRedirectUris,
+		BackchannelLogoutUri:   applicationRequest.BackchannelLogoutUri,
+		FrontchannelLogoutUri:  applicationRequest.FrontchannelLogoutUri,
+		AuthenticationSequence: applicationRequest.AuthenticationSequence,
+		RequireConsent:         applicationRequest.RequireConsent,
 	}
 	ctx := r.Context()
 	err = handler.applicationService.UpdateApplication(ctx, applicationId, orgId, application)
@@ -1,23 +1,48 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/shashimalcse/tiny-is/internal/authn"
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/recovery"
+	"github.com/shashimalcse/tiny-is/internal/registration"
+	"github.com/shashimalcse/tiny-is/internal/risk"
+	"github.com/shashimalcse/tiny-is/internal/security"
 	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
 	"github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/session"
+	"github.com/shashimalcse/tiny-is/internal/user"
 )
 
+const blockedLoginMessage = "This sign in was blocked because it looks unusual. Contact your administrator if it was you."
+
 type AuthnHandler struct {
-	authnService authn.AuthnService
+	authnService        authn.AuthnService
+	riskService         risk.RiskService
+	recoveryService     recovery.RecoveryService
+	registrationService registration.RegistrationService
+	cookies             *security.Cookies
 }
 
-func NewAuthnHandler(authnService authn.AuthnService) *AuthnHandler {
+func NewAuthnHandler(authnService authn.AuthnService, riskService risk.RiskService, recoveryService recovery.RecoveryService, registrationService registration.RegistrationService, cookies *security.Cookies) *AuthnHandler {
 	return &AuthnHandler{
-		authnService: authnService,
+		authnService:        authnService,
+		riskService:         riskService,
+		recoveryService:     recoveryService,
+		registrationService: registrationService,
+		cookies:             cookies,
 	}
 }
 
@@ -42,53 +67,439 @@ func (handler AuthnHandler) GetLoginRequest(w http.ResponseWriter, r *http.Reque
 
 func (handler AuthnHandler) Login(w http.ResponseWriter, r *http.Request) error {
 
-	err := r.ParseForm()
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorPassword)
 	if err != nil {
-		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+		return err
+	}
+	loginRequest, err := handler.GetLoginRequest(w, r)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	// the identifier step already asked for the username
+	if username := oauth2AuthorizeContext.PendingUser.Username; username != "" {
+		loginRequest.Username = username
+	}
+	ctx := r.Context()
+	authenticateResult, err := handler.authnService.AuthenticateUser(ctx, loginRequest.Username, loginRequest.Password, loginRequest.OrganizationId, clientIP(r))
+	var lockoutErr *user.LockoutError
+	if errors.As(err, &lockoutErr) {
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, getLockoutMessage(lockoutErr))
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !authenticateResult.Authenticated {
+		if err := handler.recordFailedLogin(r, oauth2AuthorizeContext, authn_models.AuthenticatedUser{Username: loginRequest.Username}); err != nil {
+			return err
+		}
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Invalid username or password.")
+	}
+	passwordStatus, err := handler.authnService.GetPasswordStatus(ctx, authenticateResult.AuthenticatedUser, loginRequest.Password)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if passwordStatus != "" {
+		// the password step is not complete until the user chose a new password, or skipped a warning
+		oauth2AuthorizeContext.PasswordChangeUser = authenticateResult.AuthenticatedUser
+		oauth2AuthorizeContext.PasswordChangeReason = passwordStatus
+		if err := handler.authnService.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		return handler.sendLoginStep(w, r, handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, oauth2AuthorizeContext, ""))
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorPassword, authenticateResult.AuthenticatedUser)
+}
+
+func (handler AuthnHandler) ChangeExpiredPassword(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginContext(r)
+	if err != nil {
+		return err
+	}
+	if !oauth2AuthorizeContext.LoginComplete {
+		sessionDataKey, oauth2AuthorizeContext, err = handler.getLoginStep(r, authn_models.AuthenticatorPassword)
+		if err != nil {
+			return err
+		}
+	}
+	changeUser := oauth2AuthorizeContext.PasswordChangeUser
+	if changeUser.Id == "" {
+		return middlewares.NewAPIError(http.StatusBadRequest, "password change is not required")
+	}
+	ctx := r.Context()
+	newPassword := r.Form.Get("new_password")
+	if newPassword != r.Form.Get("confirm_password") {
+		return handler.sendLoginStep(w, r, handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, oauth2AuthorizeContext, "The passwords don't match."))
+	}
+	err = handler.authnService.ChangeExpiredPassword(ctx, oauth2AuthorizeContext, newPassword)
+	var policyErr *user.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, oauth2AuthorizeContext, "Your "+policyErr.Error()+"."))
+	}
+	if errors.Is(err, user.ErrPasswordReused) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, oauth2AuthorizeContext, "Choose a password you haven't used recently."))
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	oauth2AuthorizeContext.PasswordChangeUser = authn_models.AuthenticatedUser{}
+	oauth2AuthorizeContext.PasswordChangeReason = ""
+	if oauth2AuthorizeContext.LoginComplete {
+		if err := handler.completeLogin(w, r, sessionDataKey, oauth2AuthorizeContext, oauth2AuthorizeContext.PendingAuthMethods); err != nil {
+			return err
+		}
+		handler.redirectToAuthorize(w, r, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName, sessionDataKey)
+		return nil
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorPassword, changeUser)
+}
+
+// SkipPasswordChange keeps the breached password of a user who was only warned about it.
+func (handler AuthnHandler) SkipPasswordChange(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorPassword)
+	if err != nil {
+		return err
+	}
+	changeUser := oauth2AuthorizeContext.PasswordChangeUser
+	if changeUser.Id == "" || oauth2AuthorizeContext.PasswordChangeReason != user.PasswordBreachedWarning {
+		return middlewares.NewAPIError(http.StatusBadRequest, "password change can't be skipped")
+	}
+	oauth2AuthorizeContext.PasswordChangeUser = authn_models.AuthenticatedUser{}
+	oauth2AuthorizeContext.PasswordChangeReason = ""
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorPassword, changeUser)
+}
+
+func (handler AuthnHandler) LoginIdentifier(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorIdentifier)
+	if err != nil {
+		return err
+	}
+	username := strings.TrimSpace(r.Form.Get("username"))
+	if username == "" {
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Enter your username.")
+	}
+	authenticatedUser, err := handler.authnService.IdentifyUser(r.Context(), username, r.Header.Get("org_id"))
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorIdentifier, authenticatedUser)
+}
+
+func (handler AuthnHandler) LoginTOTP(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorTOTP)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	if err := handler.checkMFAAttempts(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return err
+	}
+	verified, err := handler.authnService.VerifyTOTP(ctx, oauth2AuthorizeContext, r.Form.Get("code"))
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if !verified {
+		if err := handler.failMFAAttempt(r, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return err
+		}
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Invalid code, try again.")
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorTOTP, oauth2AuthorizeContext.PendingUser)
+}
+
+func (handler AuthnHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorTOTP)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	if err := handler.checkMFAAttempts(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return err
+	}
+	recoveryCodes, err := handler.authnService.ConfirmTOTPEnrollment(ctx, oauth2AuthorizeContext, r.Form.Get("code"))
+	if errors.Is(err, mfa.ErrInvalidCode) {
+		if err := handler.failMFAAttempt(r, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return err
+		}
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Invalid code, try again.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if _, err := handler.passLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorTOTP, oauth2AuthorizeContext.PendingUser); err != nil {
+		return err
+	}
+	// the recovery codes are only shown once, the user continues from there
+	return handler.sendLoginStep(w, r, handler.authnService.GetRecoveryCodes(ctx, sessionDataKey, orgName, recoveryCodes))
+}
+
+// passLoginStep returns the next step of the login, or nil when it completed the login.
+func (handler AuthnHandler) passLoginStep(w http.ResponseWriter, r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string, authenticatedUser authn_models.AuthenticatedUser) (templ.Component, error) {
+	ctx := r.Context()
+	if isFirstFactor(oauth2AuthorizeContext, authenticator) {
+		assessment, err := handler.riskService.AssessLogin(ctx, handler.getLoginAttempt(r, oauth2AuthorizeContext, authenticatedUser))
+		if err != nil {
+			return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		if assessment.Enforced {
+			switch assessment.Decision {
+			case risk.DecisionBlock:
+				if err := handler.authnService.ResetLogin(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+					return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+				}
+				return handler.authnService.GetLoginError(ctx, blockedLoginMessage), nil
+			case risk.DecisionStepUp:
+				oauth2AuthorizeContext.RiskStepUp = true
+			}
+		}
+	}
+	nextAuthorizeContext, done, err := handler.authnService.CompleteLoginStep(ctx, sessionDataKey, oauth2AuthorizeContext, authenticator, authenticatedUser)
+	var lockoutErr *user.LockoutError
+	if errors.As(err, &lockoutErr) {
+		return handler.getLoginStepForm(r, sessionDataKey, oauth2AuthorizeContext, getLockoutMessage(lockoutErr))
+	}
+	if errors.Is(err, authn.ErrUserMismatch) {
+		return handler.getLoginStepForm(r, sessionDataKey, oauth2AuthorizeContext, "Continue with the account you started signing in with.")
+	}
+	if errors.Is(err, authn.ErrAuthenticatorNotOffered) {
+		return nil, middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !done {
+		return handler.getLoginStepForm(r, sessionDataKey, nextAuthorizeContext, "")
+	}
+	// a login without the password step still has to replace an expired password
+	expired, err := handler.authnService.IsPasswordExpired(ctx, nextAuthorizeContext.PendingUser)
+	if err != nil {
+		return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if expired {
+		nextAuthorizeContext.PasswordChangeUser = nextAuthorizeContext.PendingUser
+		nextAuthorizeContext.PasswordChangeReason = user.PasswordExpired
+		nextAuthorizeContext.LoginComplete = true
+		if err := handler.authnService.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, nextAuthorizeContext); err != nil {
+			return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		return handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, nextAuthorizeContext, ""), nil
+	}
+	if err := handler.completeLogin(w, r, sessionDataKey, nextAuthorizeContext, nextAuthorizeContext.PendingAuthMethods); err != nil {
+		return nil, err
 	}
+	return nil, nil
+}
+
+func (handler AuthnHandler) sendNextLoginStep(w http.ResponseWriter, r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string, authenticatedUser authn_models.AuthenticatedUser) error {
+	step, err := handler.passLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authenticator, authenticatedUser)
+	if err != nil {
+		return err
+	}
+	if step != nil {
+		return handler.sendLoginStep(w, r, step)
+	}
+	handler.redirectToAuthorize(w, r, oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationName, sessionDataKey)
+	return nil
+}
 
+func (handler AuthnHandler) getLoginStepForm(r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) (templ.Component, error) {
+	ctx := r.Context()
+	if oauth2AuthorizeContext.LoginComplete {
+		return handler.authnService.GetPasswordChangeForm(ctx, sessionDataKey, oauth2AuthorizeContext, errorMessage), nil
+	}
+	component, err := handler.authnService.GetLoginStepForm(ctx, sessionDataKey, oauth2AuthorizeContext, errorMessage)
+	if errors.Is(err, authn.ErrNoAuthenticator) {
+		return handler.authnService.GetLoginError(ctx, "Your account has no way to complete this sign in step set up."), nil
+	}
+	if errors.Is(err, authn.ErrStepUpNotPossible) {
+		if err := handler.authnService.ResetLogin(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		return handler.authnService.GetLoginError(ctx, blockedLoginMessage), nil
+	}
+	if err != nil {
+		return nil, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return component, nil
+}
+
+func (handler AuthnHandler) sendLoginStepForm(w http.ResponseWriter, r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) error {
+	component, err := handler.getLoginStepForm(r, sessionDataKey, oauth2AuthorizeContext, errorMessage)
+	if err != nil {
+		return err
+	}
+	return handler.sendLoginStep(w, r, component)
+}
+
+func (handler AuthnHandler) getLoginContext(r *http.Request) (string, oauth2_models.OAuth2AuthorizeContext, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
 	sessionDataKey := r.Form.Get("session_data_key")
 	if sessionDataKey == "" {
-		return middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
 	}
-	loginRequest, err := handler.GetLoginRequest(w, r)
+	oauth2AuthorizeContext, err := handler.authnService.GetOAuth2AuthorizeContextBySessionDataKey(r.Context(), sessionDataKey)
 	if err != nil {
-		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId != r.Header.Get("org_id") {
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusBadRequest, "invalid session_data_key")
+	}
+	return sessionDataKey, oauth2AuthorizeContext, nil
+}
+
+func (handler AuthnHandler) getLoginStep(r *http.Request, authenticator string) (string, oauth2_models.OAuth2AuthorizeContext, error) {
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginContext(r)
+	if err != nil {
+		return "", oauth2_models.OAuth2AuthorizeContext{}, err
+	}
+	offered, err := handler.authnService.IsAuthenticatorOffered(r.Context(), oauth2AuthorizeContext, authenticator)
+	if err != nil {
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !offered {
+		return "", oauth2_models.OAuth2AuthorizeContext{}, middlewares.NewAPIError(http.StatusBadRequest, authn.ErrAuthenticatorNotOffered.Error())
+	}
+	return sessionDataKey, oauth2AuthorizeContext, nil
+}
+
+func getLockoutMessage(lockoutErr *user.LockoutError) string {
+	if lockoutErr.RetryAfter.IsZero() {
+		return "This account is locked. Contact your administrator to unlock it."
+	}
+	wait := time.Until(lockoutErr.RetryAfter)
+	if wait > time.Minute {
+		minutes := int(math.Ceil(wait.Minutes()))
+		return fmt.Sprintf("Too many failed attempts. Try again in %d minutes.", minutes)
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds <= 1 {
+		return "Too many failed attempts. Try again in a second."
+	}
+	return fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", seconds)
+}
+
+// isFirstFactor reports whether the authenticator first authenticates the user, where risk is scored.
+func isFirstFactor(oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authenticator string) bool {
+	return authenticator != authn_models.AuthenticatorIdentifier && len(oauth2AuthorizeContext.LoginAuthenticators) == 0
+}
+
+func (handler AuthnHandler) getLoginAttempt(r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, user authn_models.AuthenticatedUser) risk.LoginAttempt {
+	attempt := risk.LoginAttempt{
+		OrganizationId: oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId,
+		ClientId:       oauth2AuthorizeContext.OAuth2AuthorizeRequest.ClientId,
+		UserId:         user.Id,
+		Username:       user.Username,
+		IPAddress:      clientIP(r),
+		UserAgent:      r.UserAgent(),
+		Time:           time.Now(),
 	}
+	attempt.DeviceId, _ = handler.cookies.Get(r, "device_id")
+	return attempt
+}
+
+func (handler AuthnHandler) checkMFAAttempts(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	return handler.endLoginOnTooManyAttempts(ctx, sessionDataKey, oauth2AuthorizeContext, handler.authnService.CheckMFAAttempts(ctx, oauth2AuthorizeContext))
+}
+
+func (handler AuthnHandler) recordFailedLogin(r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, user authn_models.AuthenticatedUser) error {
+	if err := handler.riskService.RecordFailedLogin(r.Context(), handler.getLoginAttempt(r, oauth2AuthorizeContext, user)); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return nil
+}
+
+// failMFAAttempt ends the login after too many wrong codes. Starting over doesn't reset the count.
+func (handler AuthnHandler) failMFAAttempt(r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+	if err := handler.recordFailedLogin(r, oauth2AuthorizeContext, oauth2AuthorizeContext.PendingUser); err != nil {
+		return err
+	}
+	ctx := r.Context()
+	return handler.endLoginOnTooManyAttempts(ctx, sessionDataKey, oauth2AuthorizeContext, handler.authnService.FailMFAAttempt(ctx, oauth2AuthorizeContext))
+}
+
+func (handler AuthnHandler) endLoginOnTooManyAttempts(ctx context.Context, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, err error) error {
+	if errors.Is(err, mfa.ErrTooManyAttempts) {
+		if err := handler.authnService.ResetLogin(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusUnauthorized, err.Error())
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return nil
+}
+
+func (handler AuthnHandler) completeLogin(w http.ResponseWriter, r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authMethods []string) error {
 	ctx := r.Context()
-	authenticateResult, err := handler.authnService.AuthenticateUser(ctx, loginRequest.Username, loginRequest.Password, loginRequest.OrganizationId)
+	oauth2AuthorizeContext.AuthenticatedUser = oauth2AuthorizeContext.PendingUser
+	oauth2AuthorizeContext.PendingUser = authn_models.AuthenticatedUser{}
+	oauth2AuthorizeContext.PendingAuthMethods = nil
+	oauth2AuthorizeContext.LoginComplete = false
+	currentSessionID, _ := handler.cookies.Get(r, "session_id")
+	device := session.Device{
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	oauth2AuthorizeContext, err := handler.authnService.CreateSession(ctx, currentSessionID, oauth2AuthorizeContext, authMethods, device)
 	if err != nil {
+		if errors.Is(err, session.ErrSessionLimitReached) {
+			return middlewares.NewAPIError(http.StatusForbidden, err.Error())
+		}
 		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
 	}
-	if authenticateResult.Authenticated {
-		oauth2AuthorizeContext, err := handler.authnService.GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx, sessionDataKey)
-		oauth2AuthorizeContext.AuthenticatedUser = authenticateResult.AuthenticatedUser
-		if err != nil {
-			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
-		}
-		sessionDuration := 30 * time.Minute
-		sessionID := handler.authnService.CreateSession(ctx, oauth2AuthorizeContext, sessionDuration)
-		cookie := &http.Cookie{
-			Name:     "session_id",
-			Value:    sessionID,
-			Expires:  time.Now().Add(sessionDuration),
-			HttpOnly: true,
-			Path:     "/",
-			SameSite: http.SameSiteLaxMode,
-		}
-		http.SetCookie(w, cookie)
-		handler.authnService.AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext)
-		u := &url.URL{
-			Path:     fmt.Sprintf("/o/%s/authorize", loginRequest.OrganizationName),
-			RawQuery: "session_data_key=" + url.QueryEscape(sessionDataKey),
-		}
-		http.Redirect(w, r, u.String(), http.StatusFound)
-	} else {
-		return middlewares.NewAPIError(http.StatusUnauthorized, "Invalid credentials")
+	sessionInfo, found, err := handler.authnService.GetSession(ctx, oauth2AuthorizeContext.SessionId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !found {
+		return middlewares.NewAPIError(http.StatusInternalServerError, session.ErrSessionNotFound.Error())
+	}
+	if err := handler.cookies.Set(w, "session_id", sessionInfo.SessionId, sessionInfo.ExpiresAt); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if err := handler.rememberDevice(w, r, oauth2AuthorizeContext.AuthenticatedUser); err != nil {
+		return err
+	}
+	if err := handler.authnService.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return nil
+}
+
+func (handler AuthnHandler) rememberDevice(w http.ResponseWriter, r *http.Request, user authn_models.AuthenticatedUser) error {
+	deviceId, _ := handler.cookies.Get(r, "device_id")
+	deviceId, expiresAt, err := handler.riskService.RememberDevice(r.Context(), user.OrganizationId, user.Id, deviceId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if err := handler.cookies.Set(w, "device_id", deviceId, expiresAt); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
 	}
 	return nil
 }
 
+func (handler AuthnHandler) redirectToAuthorize(w http.ResponseWriter, r *http.Request, orgName, sessionDataKey string) {
+	u := &url.URL{
+		Path:     fmt.Sprintf("/o/%s/authorize", orgName),
+		RawQuery: "session_data_key=" + url.QueryEscape(sessionDataKey),
+	}
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (handler AuthnHandler) sendLoginStep(w http.ResponseWriter, r *http.Request, component templ.Component) error {
+	w.Header().Set("HX-Reswap", "outerHTML")
+	w.Header().Set("Cache-Control", "no-store")
+	return component.Render(r.Context(), w)
+}
+
 func (handler AuthnHandler) GetLoginForm(w http.ResponseWriter, r *http.Request) error {
 
 	orgName := r.Header.Get("org_name")
@@ -100,27 +511,93 @@ func (handler AuthnHandler) GetLoginForm(w http.ResponseWriter, r *http.Request)
 		return middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
 	}
 	ctx := r.Context()
-	cookie, err := r.Cookie("session_id")
-	if err == nil {
-		if _, found := handler.authnService.GetSession(ctx, cookie.Value); found {
-			u := &url.URL{
-				Path:     fmt.Sprintf("/o/%s/authorize", orgName),
-				RawQuery: "session_data_key=" + url.QueryEscape(sessionDataKey),
+	oauth2AuthorizeContext, err := handler.authnService.GetOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	component, err := handler.getLoginStepForm(r, sessionDataKey, oauth2AuthorizeContext, "")
+	if err != nil {
+		return err
+	}
+	csrfToken, err := handler.cookies.CSRFToken(w, r, sessionDataKey)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return handler.authnService.GetLoginStepPage(ctx, component, csrfToken).Render(ctx, w)
+}
+
+func (handler AuthnHandler) Logout(w http.ResponseWriter, r *http.Request) error {
+
+	err := r.ParseForm()
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	orgId := r.Header.Get("org_id")
+	orgName := r.Header.Get("org_name")
+	if orgId == "" || orgName == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	logoutRequest := models.LogoutRequest{
+		IdTokenHint:           r.Form.Get("id_token_hint"),
+		ClientId:              r.Form.Get("client_id"),
+		PostLogoutRedirectUri: r.Form.Get("post_logout_redirect_uri"),
+		State:                 r.Form.Get("state"),
+		Confirmed:             r.Method == http.MethodPost && r.Form.Get("logout_confirm") == "true",
+		OrganizationId:        orgId,
+		OrganizationName:      orgName,
+	}
+	ctx := r.Context()
+	logoutRequest, err = handler.authnService.ValidateLogoutRequest(ctx, logoutRequest)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	var frontchannelLogoutUris []string
+	if sessionId, found := handler.cookies.Get(r, "session_id"); found {
+		sessionInfo, found, err := handler.authnService.GetSession(ctx, sessionId)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		if found && sessionInfo.OrganizationId == orgId {
+			// without a matching id_token_hint the logout may not have been initiated by the user
+			if !logoutRequest.Confirmed && logoutRequest.Subject != sessionInfo.UserID {
+				return handler.authnService.GetLogoutConfirmPage(ctx, logoutRequest).Render(ctx, w)
+			}
+			frontchannelLogoutUris = handler.authnService.GetFrontchannelLogoutUris(ctx, sessionInfo)
+			if err := handler.authnService.Logout(ctx, sessionId); err != nil {
+				return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
 			}
-			http.Redirect(w, r, u.String(), http.StatusFound)
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			Expires:  time.Now().Add(-1 * time.Hour),
-			HttpOnly: true,
-			Path:     "/",
-			SameSite: http.SameSiteLaxMode,
-		})
+		handler.cookies.Delete(w, "session_id")
 	}
-	if sessionDataKey == "" {
-		return middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
+	redirectURL := ""
+	if logoutRequest.PostLogoutRedirectUri != "" {
+		u, err := url.Parse(logoutRequest.PostLogoutRedirectUri)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusBadRequest, "invalid post_logout_redirect_uri")
+		}
+		if logoutRequest.State != "" {
+			query := u.Query()
+			query.Set("state", logoutRequest.State)
+			u.RawQuery = query.Encode()
+		}
+		redirectURL = u.String()
 	}
-	handler.authnService.GetLoginPage(ctx, sessionDataKey, orgName).Render(r.Context(), w)
+	if len(frontchannelLogoutUris) > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+		return handler.authnService.GetFrontchannelLogoutPage(ctx, frontchannelLogoutUris, redirectURL).Render(ctx, w)
+	}
+	if redirectURL == "" {
+		return handler.authnService.GetLoggedOutPage(ctx).Render(ctx, w)
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
 	return nil
 }
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shashimalcse/tiny-is/internal/authn"
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/otp"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+)
+
+func (handler AuthnHandler) GetEmailLoginForm(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorEmail)
+	if err != nil {
+		return err
+	}
+	email := oauth2AuthorizeContext.PendingUser.Email
+	if loginHint := oauth2AuthorizeContext.OAuth2AuthorizeRequest.LoginHint; email == "" && strings.Contains(loginHint, "@") {
+		email = loginHint
+	}
+	return handler.sendLoginStep(w, r, handler.authnService.GetEmailLoginForm(r.Context(), sessionDataKey, r.Header.Get("org_name"), email, ""))
+}
+
+// SendEmailLogin emails the user a one-time code or a sign in link, whichever they picked.
+func (handler AuthnHandler) SendEmailLogin(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorEmail)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	email := strings.TrimSpace(r.Form.Get("email"))
+	method := r.Form.Get("method")
+	if email == "" {
+		return handler.sendLoginStep(w, r, handler.authnService.GetEmailLoginForm(ctx, sessionDataKey, orgName, email, "Enter your email address."))
+	}
+	err = handler.authnService.SendEmailLogin(ctx, sessionDataKey, oauth2AuthorizeContext, email, method)
+	// only emails to known addresses are throttled, so a throttled request gets the same answer as
+	// a sent one, and the code or link sent a moment ago can still be used
+	if errors.Is(err, otp.ErrResendTooSoon) {
+		err = nil
+	}
+	if errors.Is(err, authn.ErrUnsupportedEmailLogin) {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if method == authn_models.EmailLoginLink {
+		return handler.sendLoginStep(w, r, handler.authnService.GetMagicLinkSent(ctx, email))
+	}
+	return handler.sendLoginStep(w, r, handler.authnService.GetEmailCodeForm(ctx, sessionDataKey, orgName, email, ""))
+}
+
+func (handler AuthnHandler) LoginEmailCode(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorEmail)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	email := r.Form.Get("email")
+	authenticatedUser, err := handler.authnService.VerifyEmailCode(ctx, sessionDataKey, strings.TrimSpace(r.Form.Get("code")))
+	if errors.Is(err, otp.ErrInvalidCode) || errors.Is(err, otp.ErrCodeExpired) {
+		failedUser := oauth2AuthorizeContext.PendingUser
+		if failedUser.Username == "" {
+			failedUser.Username = email
+		}
+		if err := handler.recordFailedLogin(r, oauth2AuthorizeContext, failedUser); err != nil {
+			return err
+		}
+	}
+	if errors.Is(err, otp.ErrInvalidCode) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetEmailCodeForm(ctx, sessionDataKey, orgName, email, "Invalid code, try again."))
+	}
+	if errors.Is(err, otp.ErrCodeExpired) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetEmailCodeForm(ctx, sessionDataKey, orgName, email, "The code expired, request a new one."))
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorEmail, authenticatedUser)
+}
+
+// GetMagicLink asks the user to confirm the sign in, submitting the form uses up the link.
+func (handler AuthnHandler) GetMagicLink(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	// the link may be opened in another browser than the login, so the form is bound to the link
+	csrfToken, err := handler.cookies.CSRFToken(w, r, token)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	return handler.authnService.GetMagicLinkConfirmPage(ctx, r.Header.Get("org_name"), token, csrfToken).Render(ctx, w)
+}
+
+func (handler AuthnHandler) LoginMagicLink(w http.ResponseWriter, r *http.Request) error {
+
+	if err := r.ParseForm(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	w.Header().Set("Cache-Control", "no-store")
+	token := r.PostForm.Get("token")
+	sessionDataKey, err := handler.authnService.GetMagicLinkSessionDataKey(ctx, token)
+	if errors.Is(err, otp.ErrInvalidLink) {
+		return handler.sendLoginErrorPage(w, r, "This sign in link is invalid, expired or was already used.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	oauth2AuthorizeContext, err := handler.authnService.GetOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey)
+	if err != nil {
+		return handler.sendLoginErrorPage(w, r, "The sign in request expired.")
+	}
+	// the login completes in the browser it was started in, so a link can't sign that browser in
+	// to the account of whoever opened it
+	if !handler.cookies.VerifyCSRFToken(r, sessionDataKey, oauth2AuthorizeContext.BrowserToken) {
+		w.WriteHeader(http.StatusForbidden)
+		return handler.authnService.GetLoginStepPage(ctx, handler.authnService.GetMagicLinkOtherBrowser(ctx), "").Render(ctx, w)
+	}
+	_, authenticatedUser, err := handler.authnService.VerifyMagicLink(ctx, token)
+	if errors.Is(err, otp.ErrInvalidLink) {
+		return handler.sendLoginErrorPage(w, r, "This sign in link is invalid, expired or was already used.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	orgId := r.Header.Get("org_id")
+	if oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId != orgId || authenticatedUser.OrganizationId != orgId {
+		return handler.sendLoginErrorPage(w, r, "This sign in link is invalid, expired or was already used.")
+	}
+	offered, err := handler.authnService.IsAuthenticatorOffered(ctx, oauth2AuthorizeContext, authn_models.AuthenticatorEmail)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !offered {
+		return handler.sendLoginErrorPage(w, r, "This sign in link can't be used at this step of the sign in.")
+	}
+	step, err := handler.passLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorEmail, authenticatedUser)
+	if err != nil {
+		return err
+	}
+	if step != nil {
+		csrfToken, err := handler.cookies.CSRFToken(w, r, sessionDataKey)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		return handler.authnService.GetLoginStepPage(ctx, step, csrfToken).Render(ctx, w)
+	}
+	handler.redirectToAuthorize(w, r, orgName, sessionDataKey)
+	return nil
+}
+
+func (handler AuthnHandler) sendLoginErrorPage(w http.ResponseWriter, r *http.Request, message string) error {
+	ctx := r.Context()
+	w.WriteHeader(http.StatusBadRequest)
+	return handler.authnService.GetLoginStepPage(ctx, handler.authnService.GetLoginError(ctx, message), "").Render(ctx, w)
+}
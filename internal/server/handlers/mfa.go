@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+type MFAHandler struct {
+	mfaService      mfa.MFAService
+	webAuthnService webauthn.WebAuthnService
+	userService     user.UserService
+}
+
+func NewMFAHandler(mfaService mfa.MFAService, webAuthnService webauthn.WebAuthnService, userService user.UserService) *MFAHandler {
+	return &MFAHandler{
+		mfaService:      mfaService,
+		webAuthnService: webAuthnService,
+		userService:     userService,
+	}
+}
+
+func (handler MFAHandler) GetMyMFAStatus(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	status, err := handler.mfaService.GetTOTPStatus(r.Context(), userId, orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	credentials, err := handler.webAuthnService.GetCredentials(r.Context(), userId, orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MFAStatusResponse{
+		TOTPEnrolled:           status.Enrolled,
+		RecoveryCodesRemaining: status.RecoveryCodesRemaining,
+		Passkeys:               len(credentials),
+	})
+	return nil
+}
+
+func (handler MFAHandler) StartMyTOTPEnrollment(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	user, err := handler.userService.GetUserByID(r.Context(), userId, orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusNotFound, "User not found!")
+	}
+	enrollment, err := handler.mfaService.StartTOTPEnrollment(r.Context(), userId, orgId, r.Header.Get("org_name"), user.Username)
+	if err != nil {
+		if errors.Is(err, mfa.ErrTOTPAlreadyEnrolled) {
+			return middlewares.NewAPIError(http.StatusConflict, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.TOTPEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+	return nil
+}
+
+func (handler MFAHandler) ConfirmMyTOTPEnrollment(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	var verifyRequest models.TOTPVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	recoveryCodes, err := handler.mfaService.ConfirmTOTPEnrollment(r.Context(), userId, orgId, verifyRequest.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, mfa.ErrInvalidCode):
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, mfa.ErrTOTPNotEnrolled), errors.Is(err, mfa.ErrTOTPAlreadyEnrolled):
+			return middlewares.NewAPIError(http.StatusConflict, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return sendRecoveryCodes(w, recoveryCodes)
+}
+
+func (handler MFAHandler) RegenerateMyRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	recoveryCodes, err := handler.mfaService.RegenerateRecoveryCodes(r.Context(), userId, orgId)
+	if err != nil {
+		if errors.Is(err, mfa.ErrTOTPNotEnrolled) {
+			return middlewares.NewAPIError(http.StatusConflict, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return sendRecoveryCodes(w, recoveryCodes)
+}
+
+// DeleteMyTOTP removes the authenticator of the user, who has to confirm it with a code from the
+// authenticator or a recovery code, so a stolen access token alone can't remove the second factor.
+func (handler MFAHandler) DeleteMyTOTP(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	var verifyRequest models.TOTPVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	ctx := r.Context()
+	if err := handler.mfaService.CheckFailedAttempts(ctx, userId, orgId); err != nil {
+		return mfaAttemptError(err)
+	}
+	verified, err := handler.mfaService.VerifyTOTP(ctx, userId, orgId, verifyRequest.Code)
+	if err != nil {
+		if errors.Is(err, mfa.ErrTOTPNotEnrolled) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !verified {
+		if err := handler.mfaService.RecordFailedAttempt(ctx, userId, orgId); err != nil {
+			return mfaAttemptError(err)
+		}
+		return middlewares.NewAPIError(http.StatusForbidden, mfa.ErrInvalidCode.Error())
+	}
+	return handler.deleteTOTP(w, r, userId, orgId)
+}
+
+// DeleteUserTOTP resets the authenticator of a user who lost it, so they can enroll a new one.
+func (handler MFAHandler) DeleteUserTOTP(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.deleteTOTP(w, r, r.PathValue("id"), orgId)
+}
+
+func (handler MFAHandler) GetMyPasskeys(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	return handler.sendPasskeys(w, r, userId, orgId)
+}
+
+func (handler MFAHandler) DeleteMyPasskey(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	return handler.deletePasskey(w, r, userId, orgId)
+}
+
+func (handler MFAHandler) GetUserPasskeys(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.sendPasskeys(w, r, r.PathValue("id"), orgId)
+}
+
+func (handler MFAHandler) DeleteUserPasskey(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.deletePasskey(w, r, r.PathValue("id"), orgId)
+}
+
+func (handler MFAHandler) GetMFAPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.mfaService.GetMFAPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetMFAPolicyResponse(policy))
+	return nil
+}
+
+func (handler MFAHandler) UpdateMFAPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.MFAPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	policy := mfa.MFAPolicy{
+		OrganizationId: orgId,
+		Mode:           policyRequest.Mode,
+		ClientIds:      policyRequest.ClientIds,
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.mfaService.UpdateMFAPolicy(r.Context(), policy); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetMFAPolicyResponse(policy))
+	return nil
+}
+
+func mfaAttemptError(err error) error {
+	if errors.Is(err, mfa.ErrTooManyAttempts) {
+		return middlewares.NewAPIError(http.StatusTooManyRequests, err.Error())
+	}
+	return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+}
+
+func (handler MFAHandler) deleteTOTP(w http.ResponseWriter, r *http.Request, userId, orgId string) error {
+	if err := handler.mfaService.DeleteTOTP(r.Context(), userId, orgId); err != nil {
+		if errors.Is(err, mfa.ErrTOTPNotEnrolled) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler MFAHandler) sendPasskeys(w http.ResponseWriter, r *http.Request, userId, orgId string) error {
+	credentials, err := handler.webAuthnService.GetCredentials(r.Context(), userId, orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetPasskeyResponses(credentials))
+	return nil
+}
+
+func (handler MFAHandler) deletePasskey(w http.ResponseWriter, r *http.Request, userId, orgId string) error {
+	if err := handler.webAuthnService.DeleteCredential(r.Context(), r.PathValue("credential_id"), userId, orgId); err != nil {
+		if errors.Is(err, webauthn.ErrCredentialNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func sendRecoveryCodes(w http.ResponseWriter, recoveryCodes []string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	return nil
+}
@@ -7,19 +7,26 @@ import (
 	"net/url"
 
 	"github.com/google/uuid"
+	"github.com/shashimalcse/tiny-is/internal/authn"
 	"github.com/shashimalcse/tiny-is/internal/oauth2"
 	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/screens"
+	"github.com/shashimalcse/tiny-is/internal/security"
 	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
 	"github.com/shashimalcse/tiny-is/internal/server/models"
 )
 
 type OAuth2Handler struct {
 	oauth2Service oauth2.OAuth2Service
+	authnService  authn.AuthnService
+	cookies       *security.Cookies
 }
 
-func NewOAuth2Handler(oauth2Service oauth2.OAuth2Service) *OAuth2Handler {
+func NewOAuth2Handler(oauth2Service oauth2.OAuth2Service, authnService authn.AuthnService, cookies *security.Cookies) *OAuth2Handler {
 	return &OAuth2Handler{
 		oauth2Service: oauth2Service,
+		authnService:  authnService,
+		cookies:       cookies,
 	}
 }
 
@@ -39,6 +46,12 @@ func (handler OAuth2Handler) GetOAuth2AuthorizeRequest(w http.ResponseWriter, r
 		RedirectUri:         r.URL.Query().Get("redirect_uri"),
 		Scope:               r.URL.Query().Get("scope"),
 		State:               r.URL.Query().Get("state"),
+		ResponseMode:        r.URL.Query().Get("response_mode"),
+		Nonce:               r.URL.Query().Get("nonce"),
+		Prompt:              r.URL.Query().Get("prompt"),
+		MaxAge:              r.URL.Query().Get("max_age"),
+		LoginHint:           r.URL.Query().Get("login_hint"),
+		IdTokenHint:         r.URL.Query().Get("id_token_hint"),
 		CodeChallenge:       r.URL.Query().Get("code_challenge"),
 		CodeChallengeMethod: r.URL.Query().Get("code_challenge_method"),
 		SessionDataKey:      r.URL.Query().Get("session_data_key"),
@@ -80,7 +93,7 @@ func (handler OAuth2Handler) Authorize(w http.ResponseWriter, r *http.Request) e
 	}
 	ctx := r.Context()
 	if oauth2AuthorizeRequest.IsInitialRequestFromClient() {
-		if !oauth2AuthorizeRequest.IsValidRequest() {
+		if oauth2AuthorizeRequest.ClientId == "" || oauth2AuthorizeRequest.RedirectUri == "" {
 			return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request")
 		}
 		oauth2AuthorizeContext := oauth2_models.OAuth2AuthorizeContext{
@@ -88,11 +101,37 @@ func (handler OAuth2Handler) Authorize(w http.ResponseWriter, r *http.Request) e
 		}
 		err := handler.oauth2Service.ValidateAuthroizeRequest(ctx, oauth2AuthorizeContext)
 		if err != nil {
+			if authorizeError, ok := err.(oauth2_models.AuthorizeError); ok {
+				return handler.sendAuthorizeErrorResponse(w, r, oauth2AuthorizeContext, authorizeError)
+			}
 			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
 		}
 		sessionDataKey := uuid.New().String()
 		oauth2AuthorizeContext.OAuth2AuthorizeRequest.SessionDataKey = sessionDataKey
-		handler.oauth2Service.AddOAuth2AuthorizeContextToCacheBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext)
+		browserToken, err := handler.cookies.CSRFToken(w, r, sessionDataKey)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		oauth2AuthorizeContext.BrowserToken = browserToken
+		if sessionId, found := handler.cookies.Get(r, "session_id"); found {
+			resumedContext, resumed, err := handler.authnService.ResumeSession(ctx, sessionId, oauth2AuthorizeContext)
+			if err != nil {
+				return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+			}
+			if resumed {
+				if err := handler.oauth2Service.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, resumedContext); err != nil {
+					return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+				}
+				return handler.completeAuthorization(w, r, resumedContext)
+			}
+		}
+		// prompt=none must not show any UI
+		if oauth2AuthorizeRequest.HasPrompt(oauth2_models.PromptNone) {
+			return handler.sendAuthorizeErrorResponse(w, r, oauth2AuthorizeContext, oauth2_models.NewAuthorizeError(oauth2_models.ErrorLoginRequired, "user is not authenticated"))
+		}
+		if err := handler.oauth2Service.AddOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
 		u := &url.URL{
 			Path:     fmt.Sprintf("/o/%s/login", oauth2AuthorizeRequest.OrganizationName),
 			RawQuery: "session_data_key=" + url.QueryEscape(sessionDataKey),
@@ -105,41 +144,130 @@ func (handler OAuth2Handler) Authorize(w http.ResponseWriter, r *http.Request) e
 	if sessionDataKey == "" {
 		return middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
 	}
-	oauth2AuthorizeContext, err := handler.oauth2Service.GetOAuth2AuthorizeContextFromCacheBySessionDataKey(ctx, sessionDataKey)
+	oauth2AuthorizeContext, err := handler.oauth2Service.GetOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	return handler.completeAuthorization(w, r, oauth2AuthorizeContext)
+}
+
+func (handler OAuth2Handler) completeAuthorization(w http.ResponseWriter, r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+
+	ctx := r.Context()
+	if !handler.isAuthenticated(r, oauth2AuthorizeContext) {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "user is not authenticated")
+	}
+	consentRequired, err := handler.oauth2Service.IsConsentRequired(ctx, oauth2AuthorizeContext)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if consentRequired && !oauth2AuthorizeContext.ConsentGranted {
+		// prompt=none must not show any UI
+		if oauth2AuthorizeContext.OAuth2AuthorizeRequest.HasPrompt(oauth2_models.PromptNone) {
+			return handler.sendAuthorizeErrorResponse(w, r, oauth2AuthorizeContext, oauth2_models.NewAuthorizeError(oauth2_models.ErrorConsentRequired, "user consent is required"))
+		}
+		csrfToken, err := handler.cookies.CSRFToken(w, r, oauth2AuthorizeContext.OAuth2AuthorizeRequest.SessionDataKey)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		consentPage, err := handler.oauth2Service.GetConsentPage(ctx, oauth2AuthorizeContext, csrfToken)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		return consentPage.Render(ctx, w)
+	}
+	return handler.issueAuthorizationCode(w, r, oauth2AuthorizeContext)
+}
+
+func (handler OAuth2Handler) Consent(w http.ResponseWriter, r *http.Request) error {
+
+	if err := r.ParseForm(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	sessionDataKey := r.Form.Get("session_data_key")
+	if sessionDataKey == "" {
+		return middlewares.NewAPIError(http.StatusBadRequest, "session_data_key is required")
+	}
+	ctx := r.Context()
+	oauth2AuthorizeContext, err := handler.oauth2Service.GetOAuth2AuthorizeContextBySessionDataKey(ctx, sessionDataKey)
 	if err != nil {
 		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
 	}
+	if !handler.isAuthenticated(r, oauth2AuthorizeContext) || oauth2AuthorizeContext.OAuth2AuthorizeRequest.OrganizationId != r.Header.Get("org_id") {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "user is not authenticated")
+	}
+	if r.Form.Get("consent") != "approve" {
+		return handler.sendAuthorizeErrorResponse(w, r, oauth2AuthorizeContext, oauth2_models.NewAuthorizeError(oauth2_models.ErrorAccessDenied, "user denied the request"))
+	}
+	if err := handler.oauth2Service.GrantConsent(ctx, oauth2AuthorizeContext); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	oauth2AuthorizeContext.ConsentGranted = true
+	return handler.issueAuthorizationCode(w, r, oauth2AuthorizeContext)
+}
+
+// isAuthenticated reports whether the user of the authorize request signed in with this browser,
+// the session_data_key alone does not get a code.
+func (handler OAuth2Handler) isAuthenticated(r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) bool {
+	sessionId, found := handler.cookies.Get(r, "session_id")
+	return found && oauth2AuthorizeContext.AuthenticatedUser.Id != "" && sessionId == oauth2AuthorizeContext.SessionId
+}
 
+func (handler OAuth2Handler) issueAuthorizationCode(w http.ResponseWriter, r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext) error {
+
+	ctx := r.Context()
 	code := uuid.New().String()
-	handler.oauth2Service.AddOAuth2AuthorizeContextToCacheByAuthCode(ctx, code, oauth2AuthorizeContext)
-	state := oauth2AuthorizeContext.OAuth2AuthorizeRequest.State
-	redirectURI := oauth2AuthorizeContext.OAuth2AuthorizeRequest.RedirectUri
+	oauth2AuthorizeContext.CodeId = uuid.New().String()
+	if err := handler.oauth2Service.AddOAuth2AuthorizeContextByAuthCode(ctx, code, oauth2AuthorizeContext); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	// the authorization request is complete, its session_data_key can't be used again
+	handler.oauth2Service.DeleteOAuth2AuthorizeContextBySessionDataKey(ctx, oauth2AuthorizeContext.OAuth2AuthorizeRequest.SessionDataKey)
+	parameters := url.Values{}
+	parameters.Set("code", code)
+	authorizeResponse, err := handler.oauth2Service.GetAuthorizeResponse(ctx, oauth2AuthorizeContext, parameters)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	return handler.sendAuthorizeResponse(w, r, authorizeResponse)
+}
+
+func (handler OAuth2Handler) sendAuthorizeErrorResponse(w http.ResponseWriter, r *http.Request, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, authorizeError oauth2_models.AuthorizeError) error {
 
-	redirectURL, err := url.ParseRequestURI(redirectURI)
+	authorizeResponse, err := handler.oauth2Service.GetAuthorizeErrorResponse(r.Context(), oauth2AuthorizeContext, authorizeError)
 	if err != nil {
-		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid redirect uri")
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
 	}
+	return handler.sendAuthorizeResponse(w, r, authorizeResponse)
+}
+
+func (handler OAuth2Handler) sendAuthorizeResponse(w http.ResponseWriter, r *http.Request, authorizeResponse oauth2_models.AuthorizeResponse) error {
 
-	query := redirectURL.Query()
-	query.Set("code", code)
-	if state != "" {
-		query.Set("state", state)
+	redirectURL, err := url.ParseRequestURI(authorizeResponse.RedirectUri)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid redirect uri")
 	}
-	redirectURL.RawQuery = query.Encode()
 	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprintf(w, `
-        <!DOCTYPE html>
-        <html>
-        <head>
-        </head>
-        <body>
-            <script>
-                window.location.replace("%s");
-            </script>
-        </body>
-        </html>
-    `, redirectURL.String())
-	return nil
+	w.Header().Set("Cache-Control", "no-store")
+	switch authorizeResponse.ResponseMode {
+	case oauth2_models.ResponseModeFormPost:
+		parameters := make(map[string]string)
+		for name := range authorizeResponse.Parameters {
+			parameters[name] = authorizeResponse.Parameters.Get(name)
+		}
+		return screens.FormPostPage(redirectURL.String(), parameters).Render(r.Context(), w)
+	case oauth2_models.ResponseModeFragment:
+		redirectURL.Fragment = ""
+		return screens.RedirectPage(redirectURL.String()+"#"+authorizeResponse.Parameters.Encode()).Render(r.Context(), w)
+	default:
+		query := redirectURL.Query()
+		for name := range authorizeResponse.Parameters {
+			query.Set(name, authorizeResponse.Parameters.Get(name))
+		}
+		redirectURL.RawQuery = query.Encode()
+	}
+	return screens.RedirectPage(redirectURL.String()).Render(r.Context(), w)
 }
 
 func (handler OAuth2Handler) Token(w http.ResponseWriter, r *http.Request) error {
@@ -199,7 +327,11 @@ func (handler OAuth2Handler) Revoke(w http.ResponseWriter, r *http.Request) erro
 
 func (handler OAuth2Handler) Metadata(w http.ResponseWriter, r *http.Request) error {
 
-	metadata, err := handler.oauth2Service.GetMetadata(r.Context())
+	orgName := r.Header.Get("org_name")
+	if orgName == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	metadata, err := handler.oauth2Service.GetMetadata(r.Context(), orgName)
 	if err != nil {
 		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
 	}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/session"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+func (handler AuthnHandler) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorPasskey)
+	if err != nil {
+		return err
+	}
+	options, err := handler.authnService.BeginPasskeyLogin(r.Context(), sessionDataKey, oauth2AuthorizeContext)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCredentialNotFound) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+	return nil
+}
+
+// LoginPasskey completes a step of the login with a passkey, the first step or a step after the
+// user was identified, when it must be a passkey of that user.
+func (handler AuthnHandler) LoginPasskey(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorPasskey)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	response := webauthn.AssertionResponse{
+		CredentialId:      r.Form.Get("credential_id"),
+		ClientDataJSON:    r.Form.Get("client_data_json"),
+		AuthenticatorData: r.Form.Get("authenticator_data"),
+		Signature:         r.Form.Get("signature"),
+		UserHandle:        r.Form.Get("user_handle"),
+	}
+	identified := oauth2AuthorizeContext.PendingUser.Id != ""
+	if err := handler.checkMFAAttempts(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return err
+	}
+	authenticatedUser, err := handler.authnService.FinishPasskeyLogin(ctx, sessionDataKey, oauth2AuthorizeContext, response)
+	// the passkey prompt may have been opened before the earlier step was completed
+	if err == nil && identified && authenticatedUser.Id != oauth2AuthorizeContext.PendingUser.Id {
+		err = webauthn.ErrCredentialNotFound
+	}
+	if err != nil {
+		if !isPasskeyError(err) {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		if !identified {
+			return sendPasskeyError(w, "Passkey sign in failed, try again.")
+		}
+		if err := handler.failMFAAttempt(r, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return err
+		}
+		return handler.sendLoginStepForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Passkey verification failed, try again.")
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorPasskey, authenticatedUser)
+}
+
+func (handler AuthnHandler) GetPasskeys(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	w.Header().Set("Cache-Control", "no-store")
+	sessionInfo, found, err := handler.getPasskeySession(r)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return handler.authnService.GetPasskeysSignInRequiredPage(ctx, orgName).Render(ctx, w)
+	}
+	csrfToken, err := handler.cookies.CSRFToken(w, r, sessionInfo.SessionId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	component, err := handler.authnService.GetPasskeysPage(ctx, sessionInfo, orgName, csrfToken)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return component.Render(ctx, w)
+}
+
+func (handler AuthnHandler) PasskeyRegistrationOptions(w http.ResponseWriter, r *http.Request) error {
+
+	sessionInfo, found, err := handler.getPasskeySession(r)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "user is not authenticated")
+	}
+	options, err := handler.authnService.BeginPasskeyRegistration(r.Context(), sessionInfo)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+	return nil
+}
+
+func (handler AuthnHandler) RegisterPasskey(w http.ResponseWriter, r *http.Request) error {
+
+	if err := r.ParseForm(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	sessionInfo, found, err := handler.getPasskeySession(r)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "user is not authenticated")
+	}
+	response := webauthn.RegistrationResponse{
+		CredentialId:      r.Form.Get("credential_id"),
+		ClientDataJSON:    r.Form.Get("client_data_json"),
+		AttestationObject: r.Form.Get("attestation_object"),
+	}
+	if transports := r.Form.Get("transports"); transports != "" {
+		response.Transports = strings.Split(transports, ",")
+	}
+	ctx := r.Context()
+	component, err := handler.authnService.FinishPasskeyRegistration(ctx, sessionInfo, r.Header.Get("org_name"), r.Form.Get("name"), response)
+	if err != nil {
+		if isPasskeyError(err) {
+			return sendPasskeyError(w, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return component.Render(ctx, w)
+}
+
+func (handler AuthnHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) error {
+
+	sessionInfo, found, err := handler.getPasskeySession(r)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "user is not authenticated")
+	}
+	if err := handler.authnService.DeletePasskey(r.Context(), sessionInfo, r.PathValue("id")); err != nil {
+		if errors.Is(err, webauthn.ErrCredentialNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	// an empty response removes the passkey from the page
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getPasskeySession returns the SSO session of the user managing their passkeys.
+func (handler AuthnHandler) getPasskeySession(r *http.Request) (session.SessionInfo, bool, error) {
+	sessionId, found := handler.cookies.Get(r, "session_id")
+	if !found {
+		return session.SessionInfo{}, false, nil
+	}
+	sessionInfo, found, err := handler.authnService.GetSession(r.Context(), sessionId)
+	if err != nil {
+		return session.SessionInfo{}, false, middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if !found || sessionInfo.OrganizationId != r.Header.Get("org_id") {
+		return session.SessionInfo{}, false, nil
+	}
+	return sessionInfo, true, nil
+}
+
+func isPasskeyError(err error) bool {
+	return errors.Is(err, webauthn.ErrVerificationFailed) || errors.Is(err, webauthn.ErrCeremonyNotFound) || errors.Is(err, webauthn.ErrCredentialNotFound)
+}
+
+// sendPasskeyError shows the message under the passkey button instead of swapping the page.
+func sendPasskeyError(w http.ResponseWriter, message string) error {
+	w.Header().Set("HX-Retarget", "#passkey-error")
+	w.Header().Set("HX-Reswap", "innerHTML")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte(html.EscapeString(message)))
+	return err
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+	"github.com/shashimalcse/tiny-is/internal/recovery"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/user"
+)
+
+func (handler AuthnHandler) GetForgotPasswordForm(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorPassword)
+	if err != nil {
+		return err
+	}
+	identifier := oauth2AuthorizeContext.PendingUser.Username
+	if identifier == "" {
+		identifier = oauth2AuthorizeContext.OAuth2AuthorizeRequest.LoginHint
+	}
+	return handler.sendLoginStep(w, r, handler.recoveryService.GetForgotPasswordForm(r.Context(), sessionDataKey, r.Header.Get("org_name"), identifier, ""))
+}
+
+// SendPasswordReset emails a password reset link to the user. The response is the same whether or
+// not the account exists.
+func (handler AuthnHandler) SendPasswordReset(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, _, err := handler.getLoginStep(r, authn_models.AuthenticatorPassword)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	orgName := r.Header.Get("org_name")
+	identifier := strings.TrimSpace(r.Form.Get("identifier"))
+	if identifier == "" {
+		return handler.sendLoginStep(w, r, handler.recoveryService.GetForgotPasswordForm(ctx, sessionDataKey, orgName, identifier, "Enter your username or email address."))
+	}
+	err = handler.recoveryService.SendPasswordReset(ctx, r.Header.Get("org_id"), orgName, identifier)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendLoginStep(w, r, handler.recoveryService.GetPasswordResetSent(ctx, identifier))
+}
+
+// GetPasswordReset shows the form to choose a new password, submitting it uses up the link.
+func (handler AuthnHandler) GetPasswordReset(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	token := r.URL.Query().Get("token")
+	_, err := handler.recoveryService.VerifyPasswordReset(ctx, r.Header.Get("org_id"), token)
+	if errors.Is(err, recovery.ErrInvalidResetLink) {
+		return handler.sendLoginErrorPage(w, r, "This password reset link is invalid, expired or was already used.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	csrfToken, err := handler.cookies.CSRFToken(w, r, token)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.recoveryService.GetPasswordResetPage(ctx, r.Header.Get("org_name"), token, csrfToken).Render(ctx, w)
+}
+
+func (handler AuthnHandler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+
+	if err := r.ParseForm(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	orgName := r.Header.Get("org_name")
+	token := r.PostForm.Get("token")
+	newPassword := r.PostForm.Get("new_password")
+	if newPassword != r.PostForm.Get("confirm_password") {
+		return handler.sendLoginStep(w, r, handler.recoveryService.GetPasswordResetForm(ctx, orgName, token, "The passwords don't match."))
+	}
+	err := handler.recoveryService.ResetPassword(ctx, r.Header.Get("org_id"), token, newPassword)
+	var policyErr *user.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return handler.sendLoginStep(w, r, handler.recoveryService.GetPasswordResetForm(ctx, orgName, token, "Your "+policyErr.Error()+"."))
+	}
+	if errors.Is(err, user.ErrPasswordReused) {
+		return handler.sendLoginStep(w, r, handler.recoveryService.GetPasswordResetForm(ctx, orgName, token, "Choose a password you haven't used recently."))
+	}
+	if errors.Is(err, recovery.ErrInvalidResetLink) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetLoginError(ctx, "This password reset link is invalid, expired or was already used."))
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendLoginStep(w, r, handler.recoveryService.GetPasswordResetDone(ctx))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shashimalcse/tiny-is/internal/registration"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/user"
+)
+
+func (handler AuthnHandler) GetRegistrationForm(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, _, err := handler.getLoginContext(r)
+	if err != nil {
+		return err
+	}
+	return handler.sendRegistrationForm(w, r, sessionDataKey, registration.Registration{}, "")
+}
+
+// Register emails a link to verify the email address of the person signing up. The response is
+// the same whether or not the address already has an account.
+func (handler AuthnHandler) Register(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, _, err := handler.getLoginContext(r)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	newRegistration := registration.Registration{
+		Username:   strings.TrimSpace(r.PostForm.Get("username")),
+		Email:      strings.TrimSpace(r.PostForm.Get("email")),
+		Password:   r.PostForm.Get("password"),
+		Attributes: map[string]string{},
+	}
+	for name, values := range r.PostForm {
+		if attribute, found := strings.CutPrefix(name, "attribute_"); found && len(values) > 0 {
+			newRegistration.Attributes[attribute] = values[0]
+		}
+	}
+	if newRegistration.Password != r.PostForm.Get("confirm_password") {
+		return handler.sendRegistrationForm(w, r, sessionDataKey, newRegistration, "The passwords don't match.")
+	}
+	err = handler.registrationService.Register(ctx, r.Header.Get("org_id"), r.Header.Get("org_name"), newRegistration, r.PostForm, clientIP(r))
+	if err != nil {
+		return handler.sendRegistrationForm(w, r, sessionDataKey, newRegistration, getRegistrationErrorMessage(err))
+	}
+	return handler.sendLoginStep(w, r, handler.registrationService.GetRegistrationSent(ctx, newRegistration.Email))
+}
+
+// GetEmailVerification asks to confirm the verification of the email address, submitting the form
+// uses up the link.
+func (handler AuthnHandler) GetEmailVerification(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	token := r.URL.Query().Get("token")
+	err := handler.registrationService.CheckVerificationLink(ctx, r.Header.Get("org_id"), token)
+	if errors.Is(err, registration.ErrInvalidVerificationLink) {
+		return handler.sendLoginErrorPage(w, r, "This verification link is invalid, expired or was already used.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	csrfToken, err := handler.cookies.CSRFToken(w, r, token)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.registrationService.GetRegistrationConfirmPage(ctx, r.Header.Get("org_name"), token, csrfToken).Render(ctx, w)
+}
+
+func (handler AuthnHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+
+	if err := r.ParseForm(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "invalid request")
+	}
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	err := handler.registrationService.VerifyEmail(ctx, r.Header.Get("org_id"), r.PostForm.Get("token"))
+	if errors.Is(err, registration.ErrInvalidVerificationLink) {
+		return handler.sendLoginErrorPage(w, r, "This verification link is invalid, expired or was already used.")
+	}
+	if errors.Is(err, registration.ErrUsernameTaken) || errors.Is(err, registration.ErrEmailTaken) {
+		return handler.sendLoginErrorPage(w, r, "An account with this username or email address was created in the meantime. Sign up again, or sign in if the account is yours.")
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.registrationService.GetRegistrationDonePage(ctx, r.Header.Get("org_name")).Render(ctx, w)
+}
+
+func (handler AuthnHandler) sendRegistrationForm(w http.ResponseWriter, r *http.Request, sessionDataKey string, newRegistration registration.Registration, errorMessage string) error {
+	ctx := r.Context()
+	component, err := handler.registrationService.GetRegistrationForm(ctx, sessionDataKey, r.Header.Get("org_id"), r.Header.Get("org_name"), newRegistration, errorMessage)
+	if errors.Is(err, registration.ErrRegistrationDisabled) {
+		return handler.sendLoginStep(w, r, handler.authnService.GetLoginError(ctx, "Sign up is not available."))
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendLoginStep(w, r, component)
+}
+
+func getRegistrationErrorMessage(err error) string {
+	var policyErr *user.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		return "Your " + policyErr.Error() + "."
+	case errors.Is(err, registration.ErrChallengeFailed):
+		return "We couldn't check your browser, try again."
+	case errors.Is(err, registration.ErrInvalidUsername):
+		return "Choose a username without spaces or an @."
+	case errors.Is(err, registration.ErrInvalidEmail):
+		return "Enter a valid email address."
+	case errors.Is(err, registration.ErrMissingAttribute):
+		_, name, _ := strings.Cut(err.Error(), ": ")
+		return "Enter your " + name + "."
+	case errors.Is(err, registration.ErrUsernameTaken):
+		return "This username is taken, choose another one."
+	case errors.Is(err, registration.ErrResendTooSoon):
+		return "Wait a moment before requesting another email."
+	case errors.Is(err, registration.ErrRegistrationDisabled):
+		return "Sign up is not available."
+	default:
+		return "Something went wrong, try again."
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/shashimalcse/tiny-is/internal/risk"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/server/models"
+)
+
+const (
+	defaultLoginEventLimit = 100
+	maxLoginEventLimit     = 1000
+)
+
+type RiskHandler struct {
+	riskService risk.RiskService
+}
+
+func NewRiskHandler(riskService risk.RiskService) *RiskHandler {
+	return &RiskHandler{
+		riskService: riskService,
+	}
+}
+
+func (handler RiskHandler) GetRiskPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.riskService.GetRiskPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetRiskPolicyResponse(policy))
+	return nil
+}
+
+func (handler RiskHandler) UpdateRiskPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.RiskPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	policy := risk.RiskPolicy{
+		OrganizationId:  orgId,
+		Mode:            policyRequest.Mode,
+		StepUpScore:     policyRequest.StepUpScore,
+		BlockScore:      policyRequest.BlockScore,
+		Weights:         policyRequest.Weights,
+		UsualHoursStart: policyRequest.UsualHoursStart,
+		UsualHoursEnd:   policyRequest.UsualHoursEnd,
+		Timezone:        policyRequest.Timezone,
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.riskService.UpdateRiskPolicy(r.Context(), policy); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetRiskPolicyResponse(policy))
+	return nil
+}
+
+// GetLoginEvents returns the latest entries of the login audit trail, newest first, of one user
+// when the user_id query parameter is set.
+func (handler RiskHandler) GetLoginEvents(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	limit := defaultLoginEventLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxLoginEventLimit {
+			return middlewares.NewAPIError(http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLoginEventLimit))
+		}
+	}
+	events, err := handler.riskService.GetLoginEvents(r.Context(), orgId, r.URL.Query().Get("user_id"), limit)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetLoginEventResponses(events))
+	return nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/server/models"
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+type SessionHandler struct {
+	sessionService session.SessionService
+}
+
+func NewSessionHandler(sessionService session.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+func (handler SessionHandler) GetUserSessions(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.sendSessions(w, r, r.PathValue("id"), orgId)
+}
+
+func (handler SessionHandler) RevokeUserSession(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.revokeSession(w, r, r.PathValue("id"), orgId)
+}
+
+func (handler SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	err := handler.sessionService.RevokeUserSessions(r.Context(), r.PathValue("id"), orgId, r.URL.Query().Get("revoke_tokens") == "true")
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler SessionHandler) GetMySessions(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	return handler.sendSessions(w, r, userId, orgId)
+}
+
+func (handler SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	return handler.revokeSession(w, r, userId, orgId)
+}
+
+func (handler SessionHandler) GetSessionPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.sessionService.GetSessionPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetSessionPolicyResponse(policy))
+	return nil
+}
+
+func (handler SessionHandler) UpdateSessionPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.SessionPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	policy := session.SessionPolicy{
+		OrganizationId:   orgId,
+		MaxSessions:      policyRequest.MaxSessions,
+		LimitAction:      policyRequest.LimitAction,
+		IdleTimeout:      time.Duration(policyRequest.IdleTimeout) * time.Second,
+		AbsoluteLifetime: time.Duration(policyRequest.AbsoluteTimeout) * time.Second,
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.sessionService.UpdateSessionPolicy(r.Context(), policy); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetSessionPolicyResponse(policy))
+	return nil
+}
+
+func (handler SessionHandler) sendSessions(w http.ResponseWriter, r *http.Request, userId, orgId string) error {
+	sessions, err := handler.sessionService.GetUserSessions(r.Context(), userId, orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetSessionResponses(sessions))
+	return nil
+}
+
+func (handler SessionHandler) revokeSession(w http.ResponseWriter, r *http.Request, userId, orgId string) error {
+	err := handler.sessionService.RevokeUserSession(r.Context(), r.PathValue("session_id"), userId, orgId, r.URL.Query().Get("revoke_tokens") == "true")
+	if err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, "Session not found!")
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// requireRecentAuthentication rejects access tokens issued from a sign in older than maxAge, for
+// changes that a stolen access token alone must not be able to make.
+func requireRecentAuthentication(r *http.Request, maxAge time.Duration) error {
+	claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+	if !ok {
+		return middlewares.NewAPIError(http.StatusUnauthorized, "invalid token")
+	}
+	authTime, ok := claims["auth_time"].(float64)
+	if !ok || time.Since(time.Unix(int64(authTime), 0)) > maxAge {
+		return middlewares.NewAPIError(http.StatusForbidden, "Sign in again to make this change")
+	}
+	return nil
+}
+
+// getSubject returns the user the access token of the request was issued to.
+func getSubject(r *http.Request) (string, error) {
+	claims, ok := r.Context().Value("claims").(jwt.MapClaims)
+	if !ok {
+		return "", middlewares.NewAPIError(http.StatusUnauthorized, "invalid token")
+	}
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return "", middlewares.NewAPIError(http.StatusUnauthorized, "invalid token")
+	}
+	return sub, nil
+}
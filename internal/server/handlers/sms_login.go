@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
+	oauth2_models "github.com/shashimalcse/tiny-is/internal/oauth2/models"
+	"github.com/shashimalcse/tiny-is/internal/otp"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+)
+
+// SendLoginSMS texts the pending user a code for the second factor step.
+func (handler AuthnHandler) SendLoginSMS(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorSMS)
+	if err != nil {
+		return err
+	}
+	err = handler.authnService.SendSMSCode(r.Context(), sessionDataKey, oauth2AuthorizeContext)
+	if errors.Is(err, otp.ErrResendTooSoon) {
+		// a code sent a moment ago can still be used
+		return handler.sendSMSCodeForm(w, r, sessionDataKey, oauth2AuthorizeContext, "Wait a moment before requesting another code.")
+	}
+	if errors.Is(err, otp.ErrNoPhoneNumber) {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendSMSCodeForm(w, r, sessionDataKey, oauth2AuthorizeContext, "")
+}
+
+func (handler AuthnHandler) LoginSMS(w http.ResponseWriter, r *http.Request) error {
+
+	sessionDataKey, oauth2AuthorizeContext, err := handler.getLoginStep(r, authn_models.AuthenticatorSMS)
+	if err != nil {
+		return err
+	}
+	ctx := r.Context()
+	if err := handler.checkMFAAttempts(ctx, sessionDataKey, oauth2AuthorizeContext); err != nil {
+		return err
+	}
+	err = handler.authnService.VerifySMSCode(ctx, sessionDataKey, oauth2AuthorizeContext, strings.TrimSpace(r.Form.Get("code")))
+	if errors.Is(err, otp.ErrInvalidCode) || errors.Is(err, otp.ErrCodeExpired) {
+		if err := handler.failMFAAttempt(r, sessionDataKey, oauth2AuthorizeContext); err != nil {
+			return err
+		}
+		errorMessage := "Invalid code, try again."
+		if errors.Is(err, otp.ErrCodeExpired) {
+			errorMessage = "The code expired, request a new one."
+		}
+		return handler.sendSMSCodeForm(w, r, sessionDataKey, oauth2AuthorizeContext, errorMessage)
+	}
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendNextLoginStep(w, r, sessionDataKey, oauth2AuthorizeContext, authn_models.AuthenticatorSMS, oauth2AuthorizeContext.PendingUser)
+}
+
+func (handler AuthnHandler) sendSMSCodeForm(w http.ResponseWriter, r *http.Request, sessionDataKey string, oauth2AuthorizeContext oauth2_models.OAuth2AuthorizeContext, errorMessage string) error {
+	component, err := handler.authnService.GetSMSCodeForm(r.Context(), sessionDataKey, oauth2AuthorizeContext, errorMessage)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	return handler.sendLoginStep(w, r, component)
+}
@@ -1,22 +1,31 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/shashimalcse/tiny-is/internal/otp"
 	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
 	"github.com/shashimalcse/tiny-is/internal/server/models"
 	"github.com/shashimalcse/tiny-is/internal/user"
 	user_models "github.com/shashimalcse/tiny-is/internal/user/models"
 )
 
+// recentAuthenticationMaxAge is how long after signing in a user can change their phone number.
+const recentAuthenticationMaxAge = 5 * time.Minute
+
 type UserHandler struct {
 	userService user.UserService
+	otpService  otp.OTPService
 }
 
-func NewUserHandler(userService user.UserService) *UserHandler {
+func NewUserHandler(userService user.UserService, otpService otp.OTPService) *UserHandler {
 	return &UserHandler{
 		userService: userService,
+		otpService:  otpService,
 	}
 }
 
@@ -69,14 +78,27 @@ func (handler UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
 	}
-	user := user_models.User{
+	newUser := user_models.User{
 		OrganizationId: orgId,
 		Username:       userCreateRequest.Username,
 		Password:       userCreateRequest.Password,
 		Email:          userCreateRequest.Email,
+		EmailVerified:  userCreateRequest.EmailVerified,
+		PhoneNumber:    userCreateRequest.PhoneNumber,
+	}
+	if userCreateRequest.PasswordHash != "" {
+		if userCreateRequest.Password != "" {
+			return middlewares.NewAPIError(http.StatusBadRequest, "Only one of password and password_hash can be set")
+		}
+		newUser.PasswordHash = userCreateRequest.PasswordHash
+		err = handler.userService.ImportUser(ctx, newUser)
+	} else {
+		err = handler.userService.CreateUser(ctx, newUser)
 	}
-	err = handler.userService.CreateUser(ctx, user)
 	if err != nil {
+		if errors.Is(err, user.ErrInvalidPhoneNumber) || errors.Is(err, user.ErrPasswordPolicy) || errors.Is(err, user.ErrUnsupportedPasswordHash) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
 		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -176,3 +198,342 @@ func (handler UserHandler) PatchUserAttributes(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
+
+// StartMyPhoneNumberVerification texts a code to the new phone number of the user. The number
+// replaces the current one once the user confirms the code. The user has to have signed in
+// recently, as the number can be used to sign in.
+func (handler UserHandler) StartMyPhoneNumberVerification(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	if err := requireRecentAuthentication(r, recentAuthenticationMaxAge); err != nil {
+		return err
+	}
+	var phoneNumberRequest models.PhoneNumberRequest
+	if err := json.NewDecoder(r.Body).Decode(&phoneNumberRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	phoneNumber, err := user.NormalizePhoneNumber(phoneNumberRequest.PhoneNumber)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	recipient := otp.Recipient{
+		UserId:         userId,
+		OrganizationId: orgId,
+		PhoneNumber:    phoneNumber,
+	}
+	if err := handler.otpService.SendCode(ctx, otp.ChannelSMS, phoneVerificationKey(userId), recipient, r.Header.Get("org_name")); err != nil {
+		if errors.Is(err, otp.ErrResendTooSoon) {
+			return middlewares.NewAPIError(http.StatusTooManyRequests, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (handler UserHandler) VerifyMyPhoneNumber(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	var verifyRequest models.PhoneNumberVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	recipient, err := handler.otpService.VerifyCode(ctx, otp.ChannelSMS, phoneVerificationKey(userId), verifyRequest.Code)
+	if err != nil {
+		if errors.Is(err, otp.ErrInvalidCode) || errors.Is(err, otp.ErrCodeExpired) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	if recipient.OrganizationId != orgId {
+		return middlewares.NewAPIError(http.StatusBadRequest, otp.ErrCodeExpired.Error())
+	}
+	return handler.setPhoneNumber(w, r, userId, orgId, recipient.PhoneNumber, true)
+}
+
+func (handler UserHandler) DeleteMyPhoneNumber(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	if err := requireRecentAuthentication(r, recentAuthenticationMaxAge); err != nil {
+		return err
+	}
+	return handler.setPhoneNumber(w, r, userId, orgId, "", false)
+}
+
+func (handler UserHandler) UpdateUserPhoneNumber(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var phoneNumberRequest models.PhoneNumberRequest
+	if err := json.NewDecoder(r.Body).Decode(&phoneNumberRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	return handler.setPhoneNumber(w, r, r.PathValue("id"), orgId, phoneNumberRequest.PhoneNumber, phoneNumberRequest.Verified)
+}
+
+func (handler UserHandler) DeleteUserPhoneNumber(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	return handler.setPhoneNumber(w, r, r.PathValue("id"), orgId, "", false)
+}
+
+func (handler UserHandler) setPhoneNumber(w http.ResponseWriter, r *http.Request, userId, orgId, phoneNumber string, verified bool) error {
+	if err := handler.userService.SetPhoneNumber(r.Context(), userId, orgId, phoneNumber, verified); err != nil {
+		if errors.Is(err, user.ErrInvalidPhoneNumber) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, user.ErrUserNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// UnlockUser ends the lockout of the user, temporary or until an administrator unlocks them.
+func (handler UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	if err := handler.userService.UnlockUser(r.Context(), r.PathValue("id"), orgId); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler UserHandler) GetLockoutPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.userService.GetLockoutPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetLockoutPolicyResponse(policy))
+	return nil
+}
+
+func (handler UserHandler) UpdateLockoutPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.LockoutPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	policy := user.LockoutPolicy{
+		OrganizationId:         orgId,
+		MaxFailedAttempts:      policyRequest.MaxFailedAttempts,
+		LockoutDuration:        time.Duration(policyRequest.LockoutDuration) * time.Second,
+		MaxLockouts:            policyRequest.MaxLockouts,
+		ProgressiveDelay:       time.Duration(policyRequest.ProgressiveDelay) * time.Second,
+		MaxDelay:               time.Duration(policyRequest.MaxDelay) * time.Second,
+		MaxFailedAttemptsPerIP: policyRequest.MaxFailedAttemptsPerIP,
+		IPWindow:               time.Duration(policyRequest.IPWindow) * time.Second,
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.userService.UpdateLockoutPolicy(r.Context(), policy); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetLockoutPolicyResponse(policy))
+	return nil
+}
+
+// ChangeMyPassword replaces the password of the user the access token was issued to, after checking
+// their current one.
+func (handler UserHandler) ChangeMyPassword(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	userId, err := getSubject(r)
+	if err != nil {
+		return err
+	}
+	var passwordRequest models.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&passwordRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	err = handler.userService.ChangePassword(r.Context(), userId, orgId, passwordRequest.CurrentPassword, passwordRequest.NewPassword)
+	if errors.Is(err, user.ErrInvalidPassword) {
+		return middlewares.NewAPIError(http.StatusForbidden, err.Error())
+	}
+	var lockoutErr *user.LockoutError
+	if errors.As(err, &lockoutErr) {
+		return middlewares.NewAPIError(http.StatusTooManyRequests, err.Error())
+	}
+	return handlePasswordError(w, err)
+}
+
+// UpdateUserPassword sets the password of the user, and can ask them to change it at their next
+// sign in.
+func (handler UserHandler) UpdateUserPassword(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var passwordRequest models.PasswordSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&passwordRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	err := handler.userService.SetPassword(r.Context(), r.PathValue("id"), orgId, passwordRequest.Password, passwordRequest.PasswordChangeRequired)
+	return handlePasswordError(w, err)
+}
+
+func handlePasswordError(w http.ResponseWriter, err error) error {
+	if err != nil {
+		if errors.Is(err, user.ErrPasswordPolicy) || errors.Is(err, user.ErrPasswordReused) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, user.ErrUserNotFound) {
+			return middlewares.NewAPIError(http.StatusNotFound, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler UserHandler) GetPasswordPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.userService.GetPasswordPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetPasswordPolicyResponse(policy))
+	return nil
+}
+
+func (handler UserHandler) UpdatePasswordPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.PasswordPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	ctx := r.Context()
+	// leaving reject_breached out keeps the current setting, the configured default at first
+	if policyRequest.RejectBreached == nil {
+		current, err := handler.userService.GetPasswordPolicy(ctx, orgId)
+		if err != nil {
+			return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+		}
+		policyRequest.RejectBreached = &current.RejectBreached
+	}
+	policy := user.PasswordPolicy{
+		OrganizationId:      orgId,
+		MinLength:           policyRequest.MinLength,
+		RequireUppercase:    policyRequest.RequireUppercase,
+		RequireLowercase:    policyRequest.RequireLowercase,
+		RequireDigit:        policyRequest.RequireDigit,
+		RequireSymbol:       policyRequest.RequireSymbol,
+		BannedWords:         policyRequest.BannedWords,
+		HistoryCount:        policyRequest.HistoryCount,
+		MaxAge:              time.Duration(policyRequest.MaxAge) * time.Second,
+		RejectBreached:      *policyRequest.RejectBreached,
+		BreachedLoginAction: cmp.Or(policyRequest.BreachedLoginAction, user.BreachedLoginOff),
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.userService.UpdatePasswordPolicy(ctx, policy); err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetPasswordPolicyResponse(policy))
+	return nil
+}
+
+func (handler UserHandler) GetRegistrationPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	policy, err := handler.userService.GetRegistrationPolicy(r.Context(), orgId)
+	if err != nil {
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetRegistrationPolicyResponse(policy))
+	return nil
+}
+
+func (handler UserHandler) UpdateRegistrationPolicy(w http.ResponseWriter, r *http.Request) error {
+	orgId := r.Header.Get("org_id")
+	if orgId == "" {
+		return middlewares.NewAPIError(http.StatusNotFound, "Organization not found!")
+	}
+	var policyRequest models.RegistrationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&policyRequest); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, "Invalid request payload")
+	}
+	policy := user.RegistrationPolicy{
+		OrganizationId:     orgId,
+		Enabled:            policyRequest.Enabled,
+		RequiredAttributes: policyRequest.RequiredAttributes,
+		RequireChallenge:   policyRequest.RequireChallenge,
+	}
+	if err := policy.Validate(); err != nil {
+		return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	if err := handler.userService.UpdateRegistrationPolicy(r.Context(), policy); err != nil {
+		if errors.Is(err, user.ErrUnknownAttribute) {
+			return middlewares.NewAPIError(http.StatusBadRequest, err.Error())
+		}
+		return middlewares.NewAPIError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.GetRegistrationPolicyResponse(policy))
+	return nil
+}
+
+func phoneVerificationKey(userId string) string {
+	return "phone_verification_" + userId
+}
@@ -2,6 +2,7 @@ package tinyhttp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -73,6 +74,19 @@ func (c *TinyServeMux) HandleFunc(pattern string, handler func(http.ResponseWrit
 	c.mux.HandleFunc(pattern, handler)
 }
 
+// GetIssuer returns the issuer identifier of an organization for the server the request was made to.
+func GetIssuer(ctx context.Context, organizationName string) (string, error) {
+	serverURL, ok := ctx.Value(SERVER_URL).(string)
+	if !ok {
+		return "", errors.New("server url not found in context")
+	}
+	serverScheme, ok := ctx.Value(SERVER_SCHEME).(string)
+	if !ok {
+		return "", errors.New("server scheme not found in context")
+	}
+	return fmt.Sprintf("%s://%s/o/%s", serverScheme, serverURL, organizationName), nil
+}
+
 func (c *TinyServeMux) getFullURL(r *http.Request) string {
 	scheme := "http"
 	if r.TLS != nil {
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/shashimalcse/tiny-is/internal/security"
+)
+
+// CSRFMiddleware rejects posts to the hosted pages without the CSRF token of the form. The token
+// is bound to the value of the scope field, such as the session_data_key of the login. htmx and
+// fetch send it in the X-CSRF-Token header, plain forms in the csrf_token field.
+func CSRFMiddleware(cookies *security.Cookies, scopeField string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if err := r.ParseForm(); err != nil {
+				return NewAPIError(http.StatusBadRequest, "invalid request")
+			}
+			if !verifyCSRFToken(cookies, r, r.PostForm.Get(scopeField)) {
+				return NewAPIError(http.StatusForbidden, "invalid csrf token, reload the page and try again")
+			}
+			return next(w, r)
+		}
+	}
+}
+
+// SessionCSRFMiddleware is the CSRFMiddleware of the pages of a signed in user, the token is bound
+// to the SSO session in the session cookie.
+func SessionCSRFMiddleware(cookies *security.Cookies, sessionCookie string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if err := r.ParseForm(); err != nil {
+				return NewAPIError(http.StatusBadRequest, "invalid request")
+			}
+			sessionId, _ := cookies.Get(r, sessionCookie)
+			if !verifyCSRFToken(cookies, r, sessionId) {
+				return NewAPIError(http.StatusForbidden, "invalid csrf token, reload the page and try again")
+			}
+			return next(w, r)
+		}
+	}
+}
+
+func verifyCSRFToken(cookies *security.Cookies, r *http.Request, scope string) bool {
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = r.PostForm.Get("csrf_token")
+	}
+	return cookies.VerifyCSRFToken(r, scope, token)
+}
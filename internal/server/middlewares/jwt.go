@@ -8,10 +8,11 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
 	"github.com/shashimalcse/tiny-is/internal/security"
 )
 
-func JWTMiddleware(cfg *config.Config, keyManager *security.KeyManager) Middleware {
+func JWTMiddleware(cfg *config.Config, keyManager *security.KeyManager, tokenService token.TokenService) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) error {
 			publicPaths := map[string]bool{
@@ -51,6 +52,14 @@ func JWTMiddleware(cfg *config.Config, keyManager *security.KeyManager) Middlewa
 			if !token.Valid {
 				return NewAPIError(http.StatusUnauthorized, "invalid token")
 			}
+			jti, _ := claims["jti"].(string)
+			active, err := tokenService.IsTokenActive(r.Context(), jti)
+			if err != nil {
+				return err
+			}
+			if !active {
+				return NewAPIError(http.StatusUnauthorized, "token has been revoked")
+			}
 			ctx := context.WithValue(r.Context(), "claims", claims)
 			return next(w, r.WithContext(ctx))
 		}
@@ -2,37 +2,62 @@ package models
 
 import (
 	"github.com/shashimalcse/tiny-is/internal/application/models"
+	authn_models "github.com/shashimalcse/tiny-is/internal/authn/models"
 )
 
 type ApplicationResponse struct {
-	Id           string   `json:"id"`
-	Name         string   `json:"name"`
-	ClientId     string   `json:"client_id,omitempty"`
-	ClientSecret string   `json:"client_secret,omitempty"`
-	RedirectUris []string `json:"redirect_uris,omitempty"`
-	GrantTypes   []string `json:"grant_types,omitempty"`
+	Id                     string                              `json:"id"`
+	Name                   string                              `json:"name"`
+	ClientId               string                              `json:"client_id,omitempty"`
+	ClientSecret           string                              `json:"client_secret,omitempty"`
+	RedirectUris           []string                            `json:"redirect_uris,omitempty"`
+	GrantTypes             []string                            `json:"grant_types,omitempty"`
+	ResponseMode           string                              `json:"response_mode,omitempty"`
+	PostLogoutRedirectUris []string                            `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutUri   string                              `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutUri  string                              `json:"frontchannel_logout_uri,omitempty"`
+	AuthenticationSequence authn_models.AuthenticationSequence `json:"authentication_sequence,omitempty"`
+	RequireConsent         *bool                               `json:"require_consent,omitempty"`
 }
 
 type ApplicationCreateRequest struct {
-	Name         string   `json:"name"`
-	RedirectUris []string `json:"redirect_uris,omitempty"`
-	GrantTypes   []string `json:"grant_types,omitempty"`
+	Name                   string                              `json:"name"`
+	RedirectUris           []string                            `json:"redirect_uris,omitempty"`
+	GrantTypes             []string                            `json:"grant_types,omitempty"`
+	ResponseMode           string                              `json:"response_mode,omitempty"`
+	PostLogoutRedirectUris []string                            `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutUri   string                              `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutUri  string                              `json:"frontchannel_logout_uri,omitempty"`
+	AuthenticationSequence authn_models.AuthenticationSequence `json:"authentication_sequence,omitempty"`
+	RequireConsent         bool                                `json:"require_consent,omitempty"`
 }
 
 type ApplicationUpdateRequest struct {
-	Name         string   `json:"name,omitempty"`
-	RedirectUris []string `json:"redirect_uris,omitempty"`
-	GrantTypes   []string `json:"grant_types,omitempty"`
+	Name                   string                              `json:"name,omitempty"`
+	RedirectUris           []string                            `json:"redirect_uris,omitempty"`
+	GrantTypes             []string                            `json:"grant_types,omitempty"`
+	ResponseMode           string                              `json:"response_mode,omitempty"`
+	PostLogoutRedirectUris []string                            `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutUri   string                              `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutUri  string                              `json:"frontchannel_logout_uri,omitempty"`
+	AuthenticationSequence authn_models.AuthenticationSequence `json:"authentication_sequence,omitempty"`
+	RequireConsent         *bool                               `json:"require_consent,omitempty"`
 }
 
 func GetApplicationResponse(application models.Application) ApplicationResponse {
 	return ApplicationResponse{
-		Id:           application.Id,
-		Name:         application.Name,
-		ClientId:     application.ClientId,
-		ClientSecret: application.ClientSecret,
-		RedirectUris: application.RedirectUris,
-		GrantTypes:   application.GrantTypes,
+		Id:                     application.Id,
+		Name:                   application.Name,
+		ClientId:               application.ClientId,
+		ClientSecret:           application.ClientSecret,
+		RedirectUris:           application.RedirectUris,
+		GrantTypes:             application.GrantTypes,
+		ResponseMode:           application.ResponseMode,
+		PostLogoutRedirectUris: application.PostLogoutRedirectUris,
+		BackchannelLogoutUri:   application.BackchannelLogoutUri,
+		FrontchannelLogoutUri:  application.FrontchannelLogoutUri,
+		AuthenticationSequence: application.AuthenticationSequence,
+		RequireConsent:         application.RequireConsent,
 	}
 }
 
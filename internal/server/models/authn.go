@@ -6,3 +6,15 @@ type LoginRequest struct {
 	Username         string `json:"username"`
 	Password         string `json:"password"`
 }
+
+type LogoutRequest struct {
+	IdTokenHint           string
+	ClientId              string
+	PostLogoutRedirectUri string
+	State                 string
+	Confirmed             bool
+	OrganizationId        string
+	OrganizationName      string
+	// Subject is resolved from the id_token_hint during validation.
+	Subject string
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+type MFAStatusResponse struct {
+	TOTPEnrolled           bool `json:"totp_enrolled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	Passkeys               int  `json:"passkeys"`
+}
+
+type PasskeyResponse struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func GetPasskeyResponses(credentials []webauthn.Credential) []PasskeyResponse {
+	passkeyResponses := []PasskeyResponse{}
+	for _, credential := range credentials {
+		passkeyResponse := PasskeyResponse{
+			Id:         credential.Id,
+			Name:       credential.Name,
+			Transports: credential.Transports,
+			CreatedAt:  credential.CreatedAt,
+		}
+		if !credential.LastUsedAt.IsZero() {
+			lastUsedAt := credential.LastUsedAt
+			passkeyResponse.LastUsedAt = &lastUsedAt
+		}
+		passkeyResponses = append(passkeyResponses, passkeyResponse)
+	}
+	return passkeyResponses
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPVerifyRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAPolicyRequest struct {
+	Mode      string   `json:"mode"`
+	ClientIds []string `json:"client_ids"`
+}
+
+type MFAPolicyResponse struct {
+	Mode      string   `json:"mode"`
+	ClientIds []string `json:"client_ids"`
+}
+
+func GetMFAPolicyResponse(policy mfa.MFAPolicy) MFAPolicyResponse {
+	clientIds := policy.ClientIds
+	if clientIds == nil {
+		clientIds = []string{}
+	}
+	return MFAPolicyResponse{
+		Mode:      policy.Mode,
+		ClientIds: clientIds,
+	}
+}
@@ -1,6 +1,13 @@
 package models
 
-import "github.com/shashimalcse/tiny-is/internal/authn/models"
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/authn/models"
+)
 
 type OAuth2AuthorizeRequest struct {
 	ResponseType        string
@@ -8,6 +15,12 @@ type OAuth2AuthorizeRequest struct {
 	RedirectUri         string
 	Scope               string
 	State               string
+	ResponseMode        string
+	Nonce               string
+	Prompt              string
+	MaxAge              string
+	LoginHint           string
+	IdTokenHint         string
 	CodeChallenge       string
 	CodeChallengeMethod string
 	SessionDataKey      string
@@ -20,6 +33,7 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type,omitempty"`
 	ExpiresIn    int    `json:"expires_in,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
 }
 
 type OAuth2AuthorizeContext struct {
@@ -42,6 +56,22 @@ func (or OAuth2AuthorizeRequest) IsInitialRequestFromClient() bool {
 	return or.SessionDataKey == ""
 }
 
+func (or OAuth2AuthorizeRequest) HasPrompt(prompt string) bool {
+	return slices.Contains(strings.Fields(or.Prompt), prompt)
+}
+
+// GetMaxAge returns the max_age parameter, reporting false when it is absent or malformed.
+func (or OAuth2AuthorizeRequest) GetMaxAge() (time.Duration, bool) {
+	if or.MaxAge == "" {
+		return 0, false
+	}
+	maxAge, err := strconv.Atoi(or.MaxAge)
+	if err != nil || maxAge < 0 {
+		return 0, false
+	}
+	return time.Duration(maxAge) * time.Second, true
+}
+
 func (or OAuth2AuthorizeRequest) IsValidRequest() bool {
 	if or.ResponseType == "" || or.ClientId == "" || or.RedirectUri == "" || or.CodeChallenge == "" ||
 		or.CodeChallengeMethod == "" || or.CodeChallengeMethod == "plain" || or.CodeChallengeMethod == "none" {
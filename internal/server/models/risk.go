@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/risk"
+)
+
+type RiskPolicyRequest struct {
+	Mode            string         `json:"mode"`
+	StepUpScore     int            `json:"step_up_score"`
+	BlockScore      int            `json:"block_score"`
+	Weights         map[string]int `json:"weights"`
+	UsualHoursStart int            `json:"usual_hours_start"`
+	UsualHoursEnd   int            `json:"usual_hours_end"`
+	Timezone        string         `json:"timezone"`
+}
+
+type RiskPolicyResponse struct {
+	Mode            string         `json:"mode"`
+	StepUpScore     int            `json:"step_up_score"`
+	BlockScore      int            `json:"block_score"`
+	Weights         map[string]int `json:"weights"`
+	UsualHoursStart int            `json:"usual_hours_start"`
+	UsualHoursEnd   int            `json:"usual_hours_end"`
+	Timezone        string         `json:"timezone"`
+}
+
+func GetRiskPolicyResponse(policy risk.RiskPolicy) RiskPolicyResponse {
+	// the weights the policy scores the signals with, including the defaults it doesn't override
+	weights := map[string]int{}
+	for signal := range risk.DefaultWeights {
+		weights[signal] = policy.Weight(signal)
+	}
+	return RiskPolicyResponse{
+		Mode:            policy.Mode,
+		StepUpScore:     policy.StepUpScore,
+		BlockScore:      policy.BlockScore,
+		Weights:         weights,
+		UsualHoursStart: policy.UsualHoursStart,
+		UsualHoursEnd:   policy.UsualHoursEnd,
+		Timezone:        policy.Timezone,
+	}
+}
+
+type LoginEventResponse struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id,omitempty"`
+	Username  string    `json:"username"`
+	ClientId  string    `json:"client_id,omitempty"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	Succeeded bool      `json:"succeeded"`
+	Score     int       `json:"score"`
+	Signals   []string  `json:"signals"`
+	Decision  string    `json:"decision"`
+	Enforced  bool      `json:"enforced"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func GetLoginEventResponses(events []risk.LoginEvent) []LoginEventResponse {
+	loginEventResponses := []LoginEventResponse{}
+	for _, event := range events {
+		loginEventResponse := LoginEventResponse{
+			Id:        event.Id,
+			UserId:    event.UserId,
+			Username:  event.Username,
+			ClientId:  event.ClientId,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			Succeeded: event.Succeeded,
+			Score:     event.Score,
+			Signals:   event.Signals,
+			Decision:  event.Decision,
+			Enforced:  event.Enforced,
+			CreatedAt: event.CreatedAt,
+		}
+		if loginEventResponse.Signals == nil {
+			loginEventResponse.Signals = []string{}
+		}
+		if event.Location != nil {
+			loginEventResponse.Country = event.Location.Country
+		}
+		loginEventResponses = append(loginEventResponses, loginEventResponse)
+	}
+	return loginEventResponses
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+type SessionResponse struct {
+	Id          string    `json:"id"`
+	Device      string    `json:"device"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Clients     []string  `json:"clients"`
+	AuthMethods []string  `json:"amr,omitempty"`
+}
+
+func GetSessionResponse(sessionInfo session.SessionInfo) SessionResponse {
+	clients := sessionInfo.ClientIDs
+	if clients == nil {
+		clients = []string{}
+	}
+	return SessionResponse{
+		Id:          sessionInfo.SessionId,
+		Device:      sessionInfo.Device.Name(),
+		IPAddress:   sessionInfo.Device.IPAddress,
+		UserAgent:   sessionInfo.Device.UserAgent,
+		CreatedAt:   sessionInfo.CreatedAt,
+		LastSeenAt:  sessionInfo.LastAccessedAt,
+		ExpiresAt:   sessionInfo.ExpiresAt,
+		Clients:     clients,
+		AuthMethods: sessionInfo.AuthMethods,
+	}
+}
+
+func GetSessionResponses(sessions []session.SessionInfo) []SessionResponse {
+	sessionResponses := []SessionResponse{}
+	for _, sessionInfo := range sessions {
+		sessionResponses = append(sessionResponses, GetSessionResponse(sessionInfo))
+	}
+	return sessionResponses
+}
+
+type SessionPolicyRequest struct {
+	MaxSessions     int    `json:"max_sessions"`
+	LimitAction     string `json:"session_limit_action"`
+	IdleTimeout     int    `json:"idle_timeout"`
+	AbsoluteTimeout int    `json:"absolute_timeout"`
+}
+
+type SessionPolicyResponse struct {
+	MaxSessions     int    `json:"max_sessions"`
+	LimitAction     string `json:"session_limit_action"`
+	IdleTimeout     int    `json:"idle_timeout"`
+	AbsoluteTimeout int    `json:"absolute_timeout"`
+}
+
+func GetSessionPolicyResponse(policy session.SessionPolicy) SessionPolicyResponse {
+	return SessionPolicyResponse{
+		MaxSessions:     policy.MaxSessions,
+		LimitAction:     policy.LimitAction,
+		IdleTimeout:     int(policy.IdleTimeout / time.Second),
+		AbsoluteTimeout: int(policy.AbsoluteLifetime / time.Second),
+	}
+}
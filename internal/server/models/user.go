@@ -1,18 +1,53 @@
 package models
 
-import "github.com/shashimalcse/tiny-is/internal/user/models"
+import (
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
 
 type UserResponse struct {
-	Id             string `json:"id"`
-	OrganizationId string `json:"organization_id"`
-	Username       string `json:"username"`
-	Email          string `json:"email"`
+	Id                  string `json:"id"`
+	OrganizationId      string `json:"organization_id"`
+	Username            string `json:"username"`
+	Email               string `json:"email"`
+	EmailVerified       bool   `json:"email_verified"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool   `json:"phone_number_verified"`
+	// PasswordChangeRequired is set when the user was asked to change their password at their next
+	// sign in. Passwords that expired by age are not reported.
+	PasswordChangeRequired bool            `json:"password_change_required"`
+	Lockout                LockoutResponse `json:"lockout"`
+}
+
+type LockoutResponse struct {
+	Locked bool `json:"locked"`
+	// LockedUntil is not set when the account is locked until an administrator unlocks it.
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	FailedAttempts int        `json:"failed_attempts"`
+	LastFailedAt   *time.Time `json:"last_failed_at,omitempty"`
 }
 
 type UserCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Email    string `json:"email"`
+	// PasswordHash imports the user with the hash of their password exported from another identity
+	// provider, instead of a password.
+	PasswordHash  string `json:"password_hash"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	PhoneNumber   string `json:"phone_number"`
+}
+
+type PhoneNumberRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	// Verified can only be set by administrators, users verify their number with a code.
+	Verified bool `json:"phone_number_verified"`
+}
+
+type PhoneNumberVerifyRequest struct {
+	Code string `json:"code"`
 }
 
 type AttributeCreateRequest struct {
@@ -35,10 +70,142 @@ type UserAttributePatchRequest struct {
 
 func GetUserResponse(user models.User) UserResponse {
 	return UserResponse{
-		Id:             user.Id,
-		Username:       user.Username,
-		OrganizationId: user.OrganizationId,
-		Email:          user.Email,
+		Id:                     user.Id,
+		Username:               user.Username,
+		OrganizationId:         user.OrganizationId,
+		Email:                  user.Email,
+		EmailVerified:          user.EmailVerified,
+		PhoneNumber:            user.PhoneNumber,
+		PhoneNumberVerified:    user.PhoneNumberVerified,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+		Lockout:                GetLockoutResponse(user.Lockout),
+	}
+}
+
+func GetLockoutResponse(lockout models.Lockout) LockoutResponse {
+	locked, lockedUntil := user.IsLocked(lockout, time.Now())
+	lockoutResponse := LockoutResponse{
+		Locked:         locked,
+		FailedAttempts: lockout.FailedAttempts,
+	}
+	if locked && !lockedUntil.IsZero() {
+		lockoutResponse.LockedUntil = &lockedUntil
+	}
+	if lockout.LastFailedAt > 0 {
+		lastFailedAt := time.Unix(lockout.LastFailedAt, 0)
+		lockoutResponse.LastFailedAt = &lastFailedAt
+	}
+	return lockoutResponse
+}
+
+type LockoutPolicyRequest struct {
+	MaxFailedAttempts      int `json:"max_failed_attempts"`
+	LockoutDuration        int `json:"lockout_duration"`
+	MaxLockouts            int `json:"max_lockouts"`
+	ProgressiveDelay       int `json:"progressive_delay"`
+	MaxDelay               int `json:"max_delay"`
+	MaxFailedAttemptsPerIP int `json:"max_failed_attempts_per_ip"`
+	IPWindow               int `json:"ip_window"`
+}
+
+type LockoutPolicyResponse struct {
+	MaxFailedAttempts      int `json:"max_failed_attempts"`
+	LockoutDuration        int `json:"lockout_duration"`
+	MaxLockouts            int `json:"max_lockouts"`
+	ProgressiveDelay       int `json:"progressive_delay"`
+	MaxDelay               int `json:"max_delay"`
+	MaxFailedAttemptsPerIP int `json:"max_failed_attempts_per_ip"`
+	IPWindow               int `json:"ip_window"`
+}
+
+func GetLockoutPolicyResponse(policy user.LockoutPolicy) LockoutPolicyResponse {
+	return LockoutPolicyResponse{
+		MaxFailedAttempts:      policy.MaxFailedAttempts,
+		LockoutDuration:        int(policy.LockoutDuration / time.Second),
+		MaxLockouts:            policy.MaxLockouts,
+		ProgressiveDelay:       int(policy.ProgressiveDelay / time.Second),
+		MaxDelay:               int(policy.MaxDelay / time.Second),
+		MaxFailedAttemptsPerIP: policy.MaxFailedAttemptsPerIP,
+		IPWindow:               int(policy.IPWindow / time.Second),
+	}
+}
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordSetRequest struct {
+	Password               string `json:"password"`
+	PasswordChangeRequired bool   `json:"password_change_required"`
+}
+
+type PasswordPolicyRequest struct {
+	MinLength           int      `json:"min_length"`
+	RequireUppercase    bool     `json:"require_uppercase"`
+	RequireLowercase    bool     `json:"require_lowercase"`
+	RequireDigit        bool     `json:"require_digit"`
+	RequireSymbol       bool     `json:"require_symbol"`
+	BannedWords         []string `json:"banned_words"`
+	HistoryCount        int      `json:"history_count"`
+	MaxAge              int      `json:"max_age"`
+	RejectBreached      *bool    `json:"reject_breached"`
+	BreachedLoginAction string   `json:"breached_login_action"`
+}
+
+type PasswordPolicyResponse struct {
+	MinLength           int      `json:"min_length"`
+	RequireUppercase    bool     `json:"require_uppercase"`
+	RequireLowercase    bool     `json:"require_lowercase"`
+	RequireDigit        bool     `json:"require_digit"`
+	RequireSymbol       bool     `json:"require_symbol"`
+	BannedWords         []string `json:"banned_words"`
+	HistoryCount        int      `json:"history_count"`
+	MaxAge              int      `json:"max_age"`
+	RejectBreached      bool     `json:"reject_breached"`
+	BreachedLoginAction string   `json:"breached_login_action"`
+}
+
+func GetPasswordPolicyResponse(policy user.PasswordPolicy) PasswordPolicyResponse {
+	bannedWords := policy.BannedWords
+	if bannedWords == nil {
+		bannedWords = []string{}
+	}
+	return PasswordPolicyResponse{
+		MinLength:           policy.MinLength,
+		RequireUppercase:    policy.RequireUppercase,
+		RequireLowercase:    policy.RequireLowercase,
+		RequireDigit:        policy.RequireDigit,
+		RequireSymbol:       policy.RequireSymbol,
+		BannedWords:         bannedWords,
+		HistoryCount:        policy.HistoryCount,
+		MaxAge:              int(policy.MaxAge / time.Second),
+		RejectBreached:      policy.RejectBreached,
+		BreachedLoginAction: policy.BreachedLoginAction,
+	}
+}
+
+type RegistrationPolicyRequest struct {
+	Enabled            bool     `json:"enabled"`
+	RequiredAttributes []string `json:"required_attributes"`
+	RequireChallenge   bool     `json:"require_challenge"`
+}
+
+type RegistrationPolicyResponse struct {
+	Enabled            bool     `json:"enabled"`
+	RequiredAttributes []string `json:"required_attributes"`
+	RequireChallenge   bool     `json:"require_challenge"`
+}
+
+func GetRegistrationPolicyResponse(policy user.RegistrationPolicy) RegistrationPolicyResponse {
+	requiredAttributes := policy.RequiredAttributes
+	if requiredAttributes == nil {
+		requiredAttributes = []string{}
+	}
+	return RegistrationPolicyResponse{
+		Enabled:            policy.Enabled,
+		RequiredAttributes: requiredAttributes,
+		RequireChallenge:   policy.RequireChallenge,
 	}
 }
 
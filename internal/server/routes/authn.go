@@ -4,15 +4,78 @@ import (
 	"net/http"
 
 	"github.com/shashimalcse/tiny-is/internal/authn"
+	"github.com/shashimalcse/tiny-is/internal/recovery"
+	"github.com/shashimalcse/tiny-is/internal/registration"
+	"github.com/shashimalcse/tiny-is/internal/risk"
+	"github.com/shashimalcse/tiny-is/internal/security"
 	"github.com/shashimalcse/tiny-is/internal/server/handlers"
 	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
 	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
 )
 
-func RegisterAuthnRoutes(mux *tinyhttp.TinyServeMux, authnService authn.AuthnService) {
-	handler := handlers.NewAuthnHandler(authnService)
-	loginHandler := middlewares.ChainMiddleware(handler.Login, middlewares.ErrorMiddleware())
+func RegisterAuthnRoutes(mux *tinyhttp.TinyServeMux, authnService authn.AuthnService, riskService risk.RiskService, recoveryService recovery.RecoveryService, registrationService registration.RegistrationService, cookies *security.Cookies) {
+	handler := handlers.NewAuthnHandler(authnService, riskService, recoveryService, registrationService, cookies)
+	loginCSRF := middlewares.CSRFMiddleware(cookies, "session_data_key")
+	linkCSRF := middlewares.CSRFMiddleware(cookies, "token")
+	sessionCSRF := middlewares.SessionCSRFMiddleware(cookies, "session_id")
+	loginHandler := middlewares.ChainMiddleware(handler.Login, middlewares.ErrorMiddleware(), loginCSRF)
 	getLoginFormHandler := middlewares.ChainMiddleware(handler.GetLoginForm, middlewares.ErrorMiddleware())
+	changeExpiredPasswordHandler := middlewares.ChainMiddleware(handler.ChangeExpiredPassword, middlewares.ErrorMiddleware(), loginCSRF)
+	skipPasswordChangeHandler := middlewares.ChainMiddleware(handler.SkipPasswordChange, middlewares.ErrorMiddleware(), loginCSRF)
+	getForgotPasswordFormHandler := middlewares.ChainMiddleware(handler.GetForgotPasswordForm, middlewares.ErrorMiddleware())
+	sendPasswordResetHandler := middlewares.ChainMiddleware(handler.SendPasswordReset, middlewares.ErrorMiddleware(), loginCSRF)
+	getPasswordResetHandler := middlewares.ChainMiddleware(handler.GetPasswordReset, middlewares.ErrorMiddleware())
+	resetPasswordHandler := middlewares.ChainMiddleware(handler.ResetPassword, middlewares.ErrorMiddleware(), linkCSRF)
+	getRegistrationFormHandler := middlewares.ChainMiddleware(handler.GetRegistrationForm, middlewares.ErrorMiddleware())
+	registerHandler := middlewares.ChainMiddleware(handler.Register, middlewares.ErrorMiddleware(), loginCSRF)
+	getEmailVerificationHandler := middlewares.ChainMiddleware(handler.GetEmailVerification, middlewares.ErrorMiddleware())
+	verifyEmailHandler := middlewares.ChainMiddleware(handler.VerifyEmail, middlewares.ErrorMiddleware(), linkCSRF)
+	loginIdentifierHandler := middlewares.ChainMiddleware(handler.LoginIdentifier, middlewares.ErrorMiddleware(), loginCSRF)
+	loginTOTPHandler := middlewares.ChainMiddleware(handler.LoginTOTP, middlewares.ErrorMiddleware(), loginCSRF)
+	enrollTOTPHandler := middlewares.ChainMiddleware(handler.EnrollTOTP, middlewares.ErrorMiddleware(), loginCSRF)
+	passkeyLoginOptionsHandler := middlewares.ChainMiddleware(handler.PasskeyLoginOptions, middlewares.ErrorMiddleware(), loginCSRF)
+	loginPasskeyHandler := middlewares.ChainMiddleware(handler.LoginPasskey, middlewares.ErrorMiddleware(), loginCSRF)
+	getPasskeysHandler := middlewares.ChainMiddleware(handler.GetPasskeys, middlewares.ErrorMiddleware())
+	passkeyRegistrationOptionsHandler := middlewares.ChainMiddleware(handler.PasskeyRegistrationOptions, middlewares.ErrorMiddleware(), sessionCSRF)
+	registerPasskeyHandler := middlewares.ChainMiddleware(handler.RegisterPasskey, middlewares.ErrorMiddleware(), sessionCSRF)
+	deletePasskeyHandler := middlewares.ChainMiddleware(handler.DeletePasskey, middlewares.ErrorMiddleware(), sessionCSRF)
+	sendLoginSMSHandler := middlewares.ChainMiddleware(handler.SendLoginSMS, middlewares.ErrorMiddleware(), loginCSRF)
+	loginSMSHandler := middlewares.ChainMiddleware(handler.LoginSMS, middlewares.ErrorMiddleware(), loginCSRF)
+	getEmailLoginFormHandler := middlewares.ChainMiddleware(handler.GetEmailLoginForm, middlewares.ErrorMiddleware())
+	sendEmailLoginHandler := middlewares.ChainMiddleware(handler.SendEmailLogin, middlewares.ErrorMiddleware(), loginCSRF)
+	loginEmailCodeHandler := middlewares.ChainMiddleware(handler.LoginEmailCode, middlewares.ErrorMiddleware(), loginCSRF)
+	getMagicLinkHandler := middlewares.ChainMiddleware(handler.GetMagicLink, middlewares.ErrorMiddleware())
+	loginMagicLinkHandler := middlewares.ChainMiddleware(handler.LoginMagicLink, middlewares.ErrorMiddleware(), linkCSRF)
+	logoutHandler := middlewares.ChainMiddleware(handler.Logout, middlewares.ErrorMiddleware())
 	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) { loginHandler(w, r) })
 	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) { getLoginFormHandler(w, r) })
+	mux.HandleFunc("POST /login/password/change", func(w http.ResponseWriter, r *http.Request) { changeExpiredPasswordHandler(w, r) })
+	mux.HandleFunc("POST /login/password/skip", func(w http.ResponseWriter, r *http.Request) { skipPasswordChangeHandler(w, r) })
+	mux.HandleFunc("GET /login/password/forgot", func(w http.ResponseWriter, r *http.Request) { getForgotPasswordFormHandler(w, r) })
+	mux.HandleFunc("POST /login/password/forgot", func(w http.ResponseWriter, r *http.Request) { sendPasswordResetHandler(w, r) })
+	mux.HandleFunc("GET /password/reset", func(w http.ResponseWriter, r *http.Request) { getPasswordResetHandler(w, r) })
+	mux.HandleFunc("POST /password/reset", func(w http.ResponseWriter, r *http.Request) { resetPasswordHandler(w, r) })
+	mux.HandleFunc("GET /login/register", func(w http.ResponseWriter, r *http.Request) { getRegistrationFormHandler(w, r) })
+	mux.HandleFunc("POST /login/register", func(w http.ResponseWriter, r *http.Request) { registerHandler(w, r) })
+	mux.HandleFunc("GET /register/verify", func(w http.ResponseWriter, r *http.Request) { getEmailVerificationHandler(w, r) })
+	mux.HandleFunc("POST /register/verify", func(w http.ResponseWriter, r *http.Request) { verifyEmailHandler(w, r) })
+	mux.HandleFunc("POST /login/identifier", func(w http.ResponseWriter, r *http.Request) { loginIdentifierHandler(w, r) })
+	mux.HandleFunc("POST /login/totp", func(w http.ResponseWriter, r *http.Request) { loginTOTPHandler(w, r) })
+	mux.HandleFunc("POST /login/totp/enroll", func(w http.ResponseWriter, r *http.Request) { enrollTOTPHandler(w, r) })
+	mux.HandleFunc("POST /login/passkey/options", func(w http.ResponseWriter, r *http.Request) { passkeyLoginOptionsHandler(w, r) })
+	mux.HandleFunc("POST /login/passkey", func(w http.ResponseWriter, r *http.Request) { loginPasskeyHandler(w, r) })
+	mux.HandleFunc("POST /login/sms", func(w http.ResponseWriter, r *http.Request) { sendLoginSMSHandler(w, r) })
+	mux.HandleFunc("POST /login/sms/verify", func(w http.ResponseWriter, r *http.Request) { loginSMSHandler(w, r) })
+	mux.HandleFunc("GET /login/email", func(w http.ResponseWriter, r *http.Request) { getEmailLoginFormHandler(w, r) })
+	mux.HandleFunc("POST /login/email", func(w http.ResponseWriter, r *http.Request) { sendEmailLoginHandler(w, r) })
+	mux.HandleFunc("POST /login/email/verify", func(w http.ResponseWriter, r *http.Request) { loginEmailCodeHandler(w, r) })
+	mux.HandleFunc("GET /login/email/link", func(w http.ResponseWriter, r *http.Request) { getMagicLinkHandler(w, r) })
+	mux.HandleFunc("POST /login/email/link", func(w http.ResponseWriter, r *http.Request) { loginMagicLinkHandler(w, r) })
+	// passkeys of the user signed in to the organization
+	mux.HandleFunc("GET /passkeys", func(w http.ResponseWriter, r *http.Request) { getPasskeysHandler(w, r) })
+	mux.HandleFunc("POST /passkeys/options", func(w http.ResponseWriter, r *http.Request) { passkeyRegistrationOptionsHandler(w, r) })
+	mux.HandleFunc("POST /passkeys", func(w http.ResponseWriter, r *http.Request) { registerPasskeyHandler(w, r) })
+	mux.HandleFunc("DELETE /passkeys/{id}", func(w http.ResponseWriter, r *http.Request) { deletePasskeyHandler(w, r) })
+	mux.HandleFunc("GET /logout", func(w http.ResponseWriter, r *http.Request) { logoutHandler(w, r) })
+	mux.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) { logoutHandler(w, r) })
 }
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/organization"
+	"github.com/shashimalcse/tiny-is/internal/organization/models"
+	"github.com/shashimalcse/tiny-is/internal/security"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+)
+
+type testOrganizationService struct {
+	organization.OrganizationService
+}
+
+func (s testOrganizationService) GetOrganizationByName(ctx context.Context, name string) (models.Organization, error) {
+	if name != "org-1" {
+		return models.Organization{}, fmt.Errorf("organization not found")
+	}
+	return models.Organization{Id: "org-1-id", Name: name}, nil
+}
+
+func newTestAuthnRoutes(t *testing.T) (*tinyhttp.TinyServeMux, *security.Cookies) {
+	cookies, err := security.NewCookies(bytes.Repeat([]byte("k"), 32), false)
+	if err != nil {
+		t.Fatalf("Failed to create cookies: %v", err)
+	}
+	mux := tinyhttp.NewTinyServeMux(testOrganizationService{})
+	// the handlers are never reached, the requests are rejected before
+	RegisterAuthnRoutes(mux, nil, nil, nil, nil, cookies)
+	return mux, cookies
+}
+
+func TestAuthnRoutesRequireCSRFToken(t *testing.T) {
+	mux, _ := newTestAuthnRoutes(t)
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/login"},
+		{http.MethodPost, "/password/reset"},
+		{http.MethodPost, "/register/verify"},
+		{http.MethodPost, "/login/email/link"},
+		{http.MethodPost, "/passkeys/options"},
+		{http.MethodPost, "/passkeys"},
+		{http.MethodDelete, "/passkeys/credential-1"},
+	}
+	for _, tt := range tests {
+		form := url.Values{"session_data_key": {"key-1"}, "token": {"token-1"}}
+		r := httptest.NewRequest(tt.method, "/o/org-1"+tt.path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func TestPasskeyRoutesRejectTokenOfAnotherSession(t *testing.T) {
+	mux, cookies := newTestAuthnRoutes(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token, err := cookies.CSRFToken(w, r, "session-2")
+	if err != nil {
+		t.Fatalf("Failed to issue the CSRF token: %v", err)
+	}
+	if err := cookies.Set(w, "session_id", "session-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to set the session cookie: %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/o/org-1/passkeys/options", nil)
+	r.Header.Set("X-CSRF-Token", token)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
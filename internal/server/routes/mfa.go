@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/security"
+	"github.com/shashimalcse/tiny-is/internal/server/handlers"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
+)
+
+func RegisterMFARoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManager *security.KeyManager, tokenService token.TokenService, mfaService mfa.MFAService, webAuthnService webauthn.WebAuthnService, userService user.UserService) {
+	handler := handlers.NewMFAHandler(mfaService, webAuthnService, userService)
+	getMyMFAStatusHandler := middlewares.ChainMiddleware(handler.GetMyMFAStatus, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	startMyTOTPEnrollmentHandler := middlewares.ChainMiddleware(handler.StartMyTOTPEnrollment, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	confirmMyTOTPEnrollmentHandler := middlewares.ChainMiddleware(handler.ConfirmMyTOTPEnrollment, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteMyTOTPHandler := middlewares.ChainMiddleware(handler.DeleteMyTOTP, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	regenerateMyRecoveryCodesHandler := middlewares.ChainMiddleware(handler.RegenerateMyRecoveryCodes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteUserTOTPHandler := middlewares.ChainMiddleware(handler.DeleteUserTOTP, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getMyPasskeysHandler := middlewares.ChainMiddleware(handler.GetMyPasskeys, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteMyPasskeyHandler := middlewares.ChainMiddleware(handler.DeleteMyPasskey, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getUserPasskeysHandler := middlewares.ChainMiddleware(handler.GetUserPasskeys, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteUserPasskeyHandler := middlewares.ChainMiddleware(handler.DeleteUserPasskey, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getMFAPolicyHandler := middlewares.ChainMiddleware(handler.GetMFAPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateMFAPolicyHandler := middlewares.ChainMiddleware(handler.UpdateMFAPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	// authenticator of the user the access token was issued to
+	mux.HandleFunc("GET /me/mfa", func(w http.ResponseWriter, r *http.Request) { getMyMFAStatusHandler(w, r) })
+	mux.HandleFunc("POST /me/mfa/totp", func(w http.ResponseWriter, r *http.Request) { startMyTOTPEnrollmentHandler(w, r) })
+	mux.HandleFunc("POST /me/mfa/totp/verify", func(w http.ResponseWriter, r *http.Request) { confirmMyTOTPEnrollmentHandler(w, r) })
+	mux.HandleFunc("DELETE /me/mfa/totp", func(w http.ResponseWriter, r *http.Request) { deleteMyTOTPHandler(w, r) })
+	mux.HandleFunc("POST /me/mfa/recovery-codes", func(w http.ResponseWriter, r *http.Request) { regenerateMyRecoveryCodesHandler(w, r) })
+	mux.HandleFunc("GET /me/passkeys", func(w http.ResponseWriter, r *http.Request) { getMyPasskeysHandler(w, r) })
+	mux.HandleFunc("DELETE /me/passkeys/{credential_id}", func(w http.ResponseWriter, r *http.Request) { deleteMyPasskeyHandler(w, r) })
+	mux.HandleFunc("GET /users/{id}/passkeys", func(w http.ResponseWriter, r *http.Request) { getUserPasskeysHandler(w, r) })
+	mux.HandleFunc("DELETE /users/{id}/passkeys/{credential_id}", func(w http.ResponseWriter, r *http.Request) { deleteUserPasskeyHandler(w, r) })
+	mux.HandleFunc("DELETE /users/{id}/mfa/totp", func(w http.ResponseWriter, r *http.Request) { deleteUserTOTPHandler(w, r) })
+	mux.HandleFunc("GET /mfa-policy", func(w http.ResponseWriter, r *http.Request) { getMFAPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /mfa-policy", func(w http.ResponseWriter, r *http.Request) { updateMFAPolicyHandler(w, r) })
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/risk"
+	"github.com/shashimalcse/tiny-is/internal/security"
+	"github.com/shashimalcse/tiny-is/internal/server/handlers"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+)
+
+func RegisterRiskRoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManager *security.KeyManager, tokenService token.TokenService, riskService risk.RiskService) {
+	handler := handlers.NewRiskHandler(riskService)
+	getRiskPolicyHandler := middlewares.ChainMiddleware(handler.GetRiskPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateRiskPolicyHandler := middlewares.ChainMiddleware(handler.UpdateRiskPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getLoginEventsHandler := middlewares.ChainMiddleware(handler.GetLoginEvents, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	mux.HandleFunc("GET /risk-policy", func(w http.ResponseWriter, r *http.Request) { getRiskPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /risk-policy", func(w http.ResponseWriter, r *http.Request) { updateRiskPolicyHandler(w, r) })
+	mux.HandleFunc("GET /login-events", func(w http.ResponseWriter, r *http.Request) { getLoginEventsHandler(w, r) })
+}
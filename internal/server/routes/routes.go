@@ -5,21 +5,32 @@ import (
 	"github.com/shashimalcse/tiny-is/internal/authn"
 	"github.com/shashimalcse/tiny-is/internal/cache"
 	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
 	"github.com/shashimalcse/tiny-is/internal/oauth2"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
 	"github.com/shashimalcse/tiny-is/internal/organization"
+	"github.com/shashimalcse/tiny-is/internal/otp"
+	"github.com/shashimalcse/tiny-is/internal/recovery"
+	"github.com/shashimalcse/tiny-is/internal/registration"
+	"github.com/shashimalcse/tiny-is/internal/risk"
 	"github.com/shashimalcse/tiny-is/internal/security"
 	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
 	"github.com/shashimalcse/tiny-is/internal/session"
 	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
 )
 
-func NewRouter(cfg *config.Config, keyManager *security.KeyManager, cacheService cache.CacheService, sessionStore session.SessionStore, organizationService organization.OrganizationService, applicationService application.ApplicationService, userService user.UserService, tokenService token.TokenService) *tinyhttp.TinyServeMux {
+func NewRouter(cfg *config.Config, keyManager *security.KeyManager, cacheService cache.CacheService, authorizeContextStore store.AuthorizeContextStore, sessionStore session.SessionStore, sessionService session.SessionService, mfaService mfa.MFAService, webAuthnService webauthn.WebAuthnService, otpService otp.OTPService, riskService risk.RiskService, recoveryService recovery.RecoveryService, registrationService registration.RegistrationService, organizationService organization.OrganizationService, applicationService application.ApplicationService, userService user.UserService, tokenService token.TokenService, consentRepository oauth2.ConsentRepository, cookies *security.Cookies) *tinyhttp.TinyServeMux {
 	mux := tinyhttp.NewTinyServeMux(organizationService)
 
-	RegisterOAuth2Routes(mux, oauth2.NewOAuth2Service(cacheService, tokenService, applicationService))
-	RegisterAuthnRoutes(mux, authn.NewAuthnService(cfg, cacheService, sessionStore, userService))
-	RegisterApplicationRoutes(mux, cfg, keyManager, applicationService)
-	RegisterUserRoutes(mux, cfg, keyManager, userService)
+	authnService := authn.NewAuthnService(cfg, cacheService, authorizeContextStore, sessionStore, sessionService, mfaService, webAuthnService, otpService, userService, applicationService, tokenService)
+	RegisterOAuth2Routes(mux, oauth2.NewOAuth2Service(cfg, cacheService, authorizeContextStore, tokenService, applicationService, consentRepository), authnService, cookies)
+	RegisterAuthnRoutes(mux, authnService, riskService, recoveryService, registrationService, cookies)
+	RegisterApplicationRoutes(mux, cfg, keyManager, tokenService, applicationService)
+	RegisterUserRoutes(mux, cfg, keyManager, tokenService, userService, otpService)
+	RegisterSessionRoutes(mux, cfg, keyManager, tokenService, sessionService)
+	RegisterMFARoutes(mux, cfg, keyManager, tokenService, mfaService, webAuthnService, userService)
+	RegisterRiskRoutes(mux, cfg, keyManager, tokenService, riskService)
 	return mux
 }
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/security"
+	"github.com/shashimalcse/tiny-is/internal/server/handlers"
+	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
+	"github.com/shashimalcse/tiny-is/internal/server/middlewares"
+	"github.com/shashimalcse/tiny-is/internal/session"
+)
+
+func RegisterSessionRoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManager *security.KeyManager, tokenService token.TokenService, sessionService session.SessionService) {
+	handler := handlers.NewSessionHandler(sessionService)
+	getUserSessionsHandler := middlewares.ChainMiddleware(handler.GetUserSessions, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	revokeUserSessionHandler := middlewares.ChainMiddleware(handler.RevokeUserSession, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	revokeUserSessionsHandler := middlewares.ChainMiddleware(handler.RevokeUserSessions, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getSessionPolicyHandler := middlewares.ChainMiddleware(handler.GetSessionPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateSessionPolicyHandler := middlewares.ChainMiddleware(handler.UpdateSessionPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getMySessionsHandler := middlewares.ChainMiddleware(handler.GetMySessions, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	revokeMySessionHandler := middlewares.ChainMiddleware(handler.RevokeMySession, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	mux.HandleFunc("GET /users/{id}/sessions", func(w http.ResponseWriter, r *http.Request) { getUserSessionsHandler(w, r) })
+	mux.HandleFunc("DELETE /users/{id}/sessions", func(w http.ResponseWriter, r *http.Request) { revokeUserSessionsHandler(w, r) })
+	mux.HandleFunc("DELETE /users/{id}/sessions/{session_id}", func(w http.ResponseWriter, r *http.Request) { revokeUserSessionHandler(w, r) })
+	mux.HandleFunc("GET /session-policy", func(w http.ResponseWriter, r *http.Request) { getSessionPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /session-policy", func(w http.ResponseWriter, r *http.Request) { updateSessionPolicyHandler(w, r) })
+	// sessions of the user the access token was issued to
+	mux.HandleFunc("GET /me/sessions", func(w http.ResponseWriter, r *http.Request) { getMySessionsHandler(w, r) })
+	mux.HandleFunc("DELETE /me/sessions/{session_id}", func(w http.ResponseWriter, r *http.Request) { revokeMySessionHandler(w, r) })
+}
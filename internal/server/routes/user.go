@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
+	"github.com/shashimalcse/tiny-is/internal/otp"
 	"github.com/shashimalcse/tiny-is/internal/security"
 	"github.com/shashimalcse/tiny-is/internal/server/handlers"
 	tinyhttp "github.com/shashimalcse/tiny-is/internal/server/http"
@@ -11,15 +13,29 @@ import (
 	"github.com/shashimalcse/tiny-is/internal/user"
 )
 
-func RegisterUserRoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManager *security.KeyManager, userService user.UserService) {
-	handler := handlers.NewUserHandler(userService)
-	getUsersHandler := middlewares.ChainMiddleware(handler.GetUsers, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	getUserByIDHandler := middlewares.ChainMiddleware(handler.GetUserByID, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	createUserHandler := middlewares.ChainMiddleware(handler.CreateUser, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	addUserAttributesHandler := middlewares.ChainMiddleware(handler.AddUserAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	patchUserAttributesHandler := middlewares.ChainMiddleware(handler.PatchUserAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	createAttributeHandler := middlewares.ChainMiddleware(handler.CreateAttribute, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
-	getAttributesHandler := middlewares.ChainMiddleware(handler.GetAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager))
+func RegisterUserRoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManager *security.KeyManager, tokenService token.TokenService, userService user.UserService, otpService otp.OTPService) {
+	handler := handlers.NewUserHandler(userService, otpService)
+	getUsersHandler := middlewares.ChainMiddleware(handler.GetUsers, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getUserByIDHandler := middlewares.ChainMiddleware(handler.GetUserByID, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	createUserHandler := middlewares.ChainMiddleware(handler.CreateUser, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	addUserAttributesHandler := middlewares.ChainMiddleware(handler.AddUserAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	patchUserAttributesHandler := middlewares.ChainMiddleware(handler.PatchUserAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	createAttributeHandler := middlewares.ChainMiddleware(handler.CreateAttribute, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getAttributesHandler := middlewares.ChainMiddleware(handler.GetAttributes, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	startMyPhoneNumberVerificationHandler := middlewares.ChainMiddleware(handler.StartMyPhoneNumberVerification, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	verifyMyPhoneNumberHandler := middlewares.ChainMiddleware(handler.VerifyMyPhoneNumber, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteMyPhoneNumberHandler := middlewares.ChainMiddleware(handler.DeleteMyPhoneNumber, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateUserPhoneNumberHandler := middlewares.ChainMiddleware(handler.UpdateUserPhoneNumber, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	deleteUserPhoneNumberHandler := middlewares.ChainMiddleware(handler.DeleteUserPhoneNumber, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	unlockUserHandler := middlewares.ChainMiddleware(handler.UnlockUser, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getLockoutPolicyHandler := middlewares.ChainMiddleware(handler.GetLockoutPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateLockoutPolicyHandler := middlewares.ChainMiddleware(handler.UpdateLockoutPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	changeMyPasswordHandler := middlewares.ChainMiddleware(handler.ChangeMyPassword, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateUserPasswordHandler := middlewares.ChainMiddleware(handler.UpdateUserPassword, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getPasswordPolicyHandler := middlewares.ChainMiddleware(handler.GetPasswordPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updatePasswordPolicyHandler := middlewares.ChainMiddleware(handler.UpdatePasswordPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	getRegistrationPolicyHandler := middlewares.ChainMiddleware(handler.GetRegistrationPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
+	updateRegistrationPolicyHandler := middlewares.ChainMiddleware(handler.UpdateRegistrationPolicy, middlewares.ErrorMiddleware(), middlewares.JWTMiddleware(cfg, keyManager, tokenService))
 	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) { getUsersHandler(w, r) })
 	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) { getUserByIDHandler(w, r) })
 	mux.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) { createUserHandler(w, r) })
@@ -29,4 +45,23 @@ func RegisterUserRoutes(mux *tinyhttp.TinyServeMux, cfg *config.Config, keyManag
 	// user attributes
 	mux.HandleFunc("POST /users/{id}/attributes", func(w http.ResponseWriter, r *http.Request) { addUserAttributesHandler(w, r) })
 	mux.HandleFunc("PATCH /users/{id}/attributes", func(w http.ResponseWriter, r *http.Request) { patchUserAttributesHandler(w, r) })
+	// phone number
+	mux.HandleFunc("PUT /users/{id}/phone-number", func(w http.ResponseWriter, r *http.Request) { updateUserPhoneNumberHandler(w, r) })
+	mux.HandleFunc("DELETE /users/{id}/phone-number", func(w http.ResponseWriter, r *http.Request) { deleteUserPhoneNumberHandler(w, r) })
+	// phone number of the user the access token was issued to, verified with a texted code
+	mux.HandleFunc("PUT /me/phone-number", func(w http.ResponseWriter, r *http.Request) { startMyPhoneNumberVerificationHandler(w, r) })
+	mux.HandleFunc("POST /me/phone-number/verify", func(w http.ResponseWriter, r *http.Request) { verifyMyPhoneNumberHandler(w, r) })
+	mux.HandleFunc("DELETE /me/phone-number", func(w http.ResponseWriter, r *http.Request) { deleteMyPhoneNumberHandler(w, r) })
+	// brute force protection
+	mux.HandleFunc("POST /users/{id}/unlock", func(w http.ResponseWriter, r *http.Request) { unlockUserHandler(w, r) })
+	mux.HandleFunc("GET /lockout-policy", func(w http.ResponseWriter, r *http.Request) { getLockoutPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /lockout-policy", func(w http.ResponseWriter, r *http.Request) { updateLockoutPolicyHandler(w, r) })
+	// passwords
+	mux.HandleFunc("PUT /users/{id}/password", func(w http.ResponseWriter, r *http.Request) { updateUserPasswordHandler(w, r) })
+	mux.HandleFunc("PUT /me/password", func(w http.ResponseWriter, r *http.Request) { changeMyPasswordHandler(w, r) })
+	mux.HandleFunc("GET /password-policy", func(w http.ResponseWriter, r *http.Request) { getPasswordPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /password-policy", func(w http.ResponseWriter, r *http.Request) { updatePasswordPolicyHandler(w, r) })
+	// sign up from the login page
+	mux.HandleFunc("GET /registration-policy", func(w http.ResponseWriter, r *http.Request) { getRegistrationPolicyHandler(w, r) })
+	mux.HandleFunc("PUT /registration-policy", func(w http.ResponseWriter, r *http.Request) { updateRegistrationPolicyHandler(w, r) })
 }
@@ -6,25 +6,46 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/shashimalcse/tiny-is/internal/application"
 	cs "github.com/shashimalcse/tiny-is/internal/cache"
 	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/logout"
+	"github.com/shashimalcse/tiny-is/internal/mfa"
+	"github.com/shashimalcse/tiny-is/internal/notification"
+	"github.com/shashimalcse/tiny-is/internal/oauth2"
+	"github.com/shashimalcse/tiny-is/internal/oauth2/store"
 	"github.com/shashimalcse/tiny-is/internal/oauth2/token"
 	"github.com/shashimalcse/tiny-is/internal/organization"
+	"github.com/shashimalcse/tiny-is/internal/otp"
+	"github.com/shashimalcse/tiny-is/internal/recovery"
+	"github.com/shashimalcse/tiny-is/internal/registration"
+	"github.com/shashimalcse/tiny-is/internal/risk"
 	"github.com/shashimalcse/tiny-is/internal/security"
 	"github.com/shashimalcse/tiny-is/internal/server/routes"
 	"github.com/shashimalcse/tiny-is/internal/server/utils"
 	"github.com/shashimalcse/tiny-is/internal/session"
 	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/webauthn"
 )
 
 func StartServer(cfg *config.Config) {
 
-	cacheService := cs.NewCacheService()
-	sessionStore := session.NewInMemorySessionStore()
+	var cacheBackend cs.Backend
+	switch cfg.Cache.Backend {
+	case "redis":
+		redisCfg := cfg.Cache.Redis
+		cacheBackend = cs.NewRedisBackend(redisCfg.Address, redisCfg.Password, redisCfg.DB, time.Duration(redisCfg.Timeout)*time.Second)
+	case "", "memory":
+		cacheBackend = cs.NewMemoryBackend()
+	default:
+		log.Fatalf("Unsupported cache backend: %s", cfg.Cache.Backend)
+	}
+	defer cacheBackend.Close()
+	cacheService := cs.NewCacheServiceWithBackend(cacheBackend, time.Duration(cfg.Cache.LocalTTL)*time.Second)
 	keyManager := security.NewKeyManager()
 	err := keyManager.LoadKeys(cfg.Crypto.JWT.Path)
 	if err != nil {
@@ -44,15 +65,91 @@ func StartServer(cfg *config.Config) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	var sessionStore session.SessionStore
+	switch cfg.Session.Store {
+	case "database":
+		sessionStore = session.NewSQLSessionStore(db, time.Duration(cfg.Session.SweepInterval)*time.Second)
+	case "", "memory":
+		sessionStore = session.NewInMemorySessionStore()
+	default:
+		log.Fatalf("Unsupported session store: %s", cfg.Session.Store)
+	}
+	var authorizeContextStore store.AuthorizeContextStore
+	switch cfg.OAuth2.Store {
+	case "database":
+		authorizeContextStore = store.NewSQLAuthorizeContextStore(db, time.Duration(cfg.OAuth2.SweepInterval)*time.Second)
+	case "cache":
+		authorizeContextStore = store.NewCacheAuthorizeContextStore(cacheBackend)
+	case "", "memory":
+		authorizeContextStore = store.NewInMemoryAuthorizeContextStore()
+	default:
+		log.Fatalf("Unsupported authorize context store: %s", cfg.OAuth2.Store)
+	}
 	organizationService := organization.NewOrganizationService(cacheService, organization.NewOrganizationRepository(db))
 	applicationService := application.NewApplicationService(cacheService, application.NewApplicationRepository(db))
-	userService := user.NewUserService(cacheService, user.NewUserRepository(db))
+	var breachedPasswords *user.BreachedPasswords
+	if cfg.BreachedPasswords.File != "" {
+		breachedPasswords, err = user.OpenBreachedPasswords(cfg.BreachedPasswords.File)
+		if err != nil {
+			log.Fatalf("Failed to open breached password corpus: %v", err)
+		}
+		defer breachedPasswords.Close()
+	}
+	passwordHasher, err := user.NewPasswordHasher(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	userService := user.NewUserService(cfg, cacheService, cacheBackend, user.NewUserRepository(db), user.NewLockoutPolicyRepository(db), user.NewPasswordPolicyRepository(db), user.NewRegistrationPolicyRepository(db), breachedPasswords, passwordHasher)
 	tokenService := token.NewTokenService(cacheService, token.NewTokenRepository(db), keyManager)
 	err = utils.InitServer(cfg, db, organizationService, applicationService, userService)
 	if err != nil {
 		log.Fatal(err)
 	}
-	router := routes.NewRouter(cfg, keyManager, cacheService, sessionStore, organizationService, applicationService, userService, tokenService)
+	backchannelCfg := cfg.Logout.Backchannel
+	deliveryWorker := logout.NewDeliveryWorker(&http.Client{Timeout: time.Duration(backchannelCfg.Timeout) * time.Second}, backchannelCfg.MaxAttempts, time.Duration(backchannelCfg.RetryInterval)*time.Second)
+	deliveryWorker.Start()
+	defer deliveryWorker.Stop()
+	backchannelLogoutService := logout.NewBackchannelLogoutService(applicationService, tokenService, deliveryWorker)
+	sessionStore.OnSessionEnd(backchannelLogoutService.NotifySessionEnded)
+	sessionService := session.NewSessionService(cfg, sessionStore, session.NewSessionPolicyRepository(db), tokenService)
+	mfaService := mfa.NewMFAService(cfg, cacheBackend, mfa.NewMFARepository(db), mfa.NewMFAPolicyRepository(db))
+	webAuthnService := webauthn.NewWebAuthnService(cfg, webauthn.NewWebAuthnRepository(db), cacheBackend)
+	emailSender, err := notification.NewEmailSender(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	emailSender = notification.NewQueuedEmailSender(emailSender, 100)
+	smsSender, err := notification.NewSMSSender(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	otpService := otp.NewOTPService(cfg, cacheBackend, emailSender, smsSender)
+	var geoIP *risk.GeoIPDatabase
+	if cfg.Risk.GeoIPFile != "" {
+		geoIP, err = risk.LoadGeoIPDatabase(cfg.Risk.GeoIPFile)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+	}
+	var ipReputation *risk.IPList
+	if cfg.Risk.IPReputationFile != "" {
+		ipReputation, err = risk.LoadIPList(cfg.Risk.IPReputationFile)
+		if err != nil {
+			log.Fatalf("Failed to load IP reputation list: %v", err)
+		}
+	}
+	riskService := risk.NewRiskService(cfg, risk.NewRiskRepository(db), risk.NewRiskPolicyRepository(db), geoIP, ipReputation)
+	recoveryService := recovery.NewRecoveryService(cfg, cacheBackend, keyManager, emailSender, userService, sessionService, tokenService)
+	registrationService := registration.NewRegistrationService(cfg, cacheBackend, emailSender, userService, registration.NewProofOfWork(cacheBackend, keyManager, cfg.GetProofOfWorkDifficulty()))
+	cookieKey, err := security.LoadCookieKey(cfg.Crypto.Cookie.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cookies, err := security.NewCookies(cookieKey, cfg.Transport.Https)
+	if err != nil {
+		log.Fatal(err)
+	}
+	router := routes.NewRouter(cfg, keyManager, cacheService, authorizeContextStore, sessionStore, sessionService, mfaService, webAuthnService, otpService, riskService, recoveryService, registrationService, organizationService, applicationService, userService, tokenService, oauth2.NewConsentRepository(db), cookies)
 	loggedRouter := LoggingMiddleware(router)
 	if cfg.Transport.Https {
 		cwd, err := os.Getwd()
@@ -52,7 +52,7 @@ func InitServer(cfg *config.Config, db *sqlx.DB, organizationService organizatio
 		Email:          "admin",
 		OrganizationId: super_org.Id,
 	}
-	err = userService.CreateUser(context.Background(), admin)
+	err = userService.CreateInitialUser(context.Background(), admin)
 	if err != nil {
 		return err
 	}
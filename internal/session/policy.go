@@ -0,0 +1,94 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	SessionLimitActionEvictOldest = "evict_oldest"
+	SessionLimitActionReject      = "reject"
+)
+
+var ErrSessionLimitReached = errors.New("maximum number of concurrent sessions reached")
+
+// SessionPolicy controls the sessions of the users of an organization.
+type SessionPolicy struct {
+	OrganizationId string
+	// MaxSessions is the number of concurrent sessions a user may have. Zero means no limit.
+	MaxSessions int
+	// LimitAction decides what happens to a new login once MaxSessions is reached.
+	LimitAction string
+	// IdleTimeout slides on every use of the session. Zero disables it.
+	IdleTimeout      time.Duration
+	AbsoluteLifetime time.Duration
+}
+
+func (p SessionPolicy) Validate() error {
+	if p.MaxSessions < 0 {
+		return errors.New("max_sessions must not be negative")
+	}
+	if p.LimitAction != SessionLimitActionEvictOldest && p.LimitAction != SessionLimitActionReject {
+		return errors.New("session_limit_action must be evict_oldest or reject")
+	}
+	if p.IdleTimeout < 0 {
+		return errors.New("idle_timeout must not be negative")
+	}
+	if p.AbsoluteLifetime <= 0 {
+		return errors.New("absolute_timeout must be positive")
+	}
+	return nil
+}
+
+type SessionPolicyRepository interface {
+	GetSessionPolicy(ctx context.Context, orgId string) (SessionPolicy, bool, error)
+	SaveSessionPolicy(ctx context.Context, policy SessionPolicy) error
+}
+
+type sessionPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionPolicyRepository(db *sqlx.DB) SessionPolicyRepository {
+	return &sessionPolicyRepository{
+		db: db,
+	}
+}
+
+type sessionPolicyRow struct {
+	OrganizationId  string `db:"organization_id"`
+	MaxSessions     int    `db:"max_sessions"`
+	LimitAction     string `db:"session_limit_action"`
+	IdleTimeout     int64  `db:"idle_timeout"`
+	AbsoluteTimeout int64  `db:"absolute_timeout"`
+}
+
+func (r *sessionPolicyRepository) GetSessionPolicy(ctx context.Context, orgId string) (SessionPolicy, bool, error) {
+	var row sessionPolicyRow
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, max_sessions, session_limit_action, idle_timeout, absolute_timeout FROM session_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SessionPolicy{}, false, nil
+		}
+		return SessionPolicy{}, false, err
+	}
+	return SessionPolicy{
+		OrganizationId:   row.OrganizationId,
+		MaxSessions:      row.MaxSessions,
+		LimitAction:      row.LimitAction,
+		IdleTimeout:      time.Duration(row.IdleTimeout) * time.Second,
+		AbsoluteLifetime: time.Duration(row.AbsoluteTimeout) * time.Second,
+	}, true, nil
+}
+
+func (r *sessionPolicyRepository) SaveSessionPolicy(ctx context.Context, policy SessionPolicy) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO session_policy (organization_id, max_sessions, session_limit_action, idle_timeout, absolute_timeout) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (organization_id) DO UPDATE SET max_sessions = excluded.max_sessions, session_limit_action = excluded.session_limit_action,
+		idle_timeout = excluded.idle_timeout, absolute_timeout = excluded.absolute_timeout`,
+		policy.OrganizationId, policy.MaxSessions, policy.LimitAction, int64(policy.IdleTimeout/time.Second), int64(policy.AbsoluteLifetime/time.Second))
+	return err
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+// TokenRevoker revokes the tokens issued under a session.
+type TokenRevoker interface {
+	RevokeTokensBySession(ctx context.Context, sessionId string) error
+}
+
+type SessionService interface {
+	CreateSession(ctx context.Context, sessionInfo SessionInfo) (string, error)
+	GetSessionPolicy(ctx context.Context, orgId string) (SessionPolicy, error)
+	UpdateSessionPolicy(ctx context.Context, policy SessionPolicy) error
+	GetUserSessions(ctx context.Context, userId, orgId string) ([]SessionInfo, error)
+	RevokeUserSession(ctx context.Context, sessionId, userId, orgId string, revokeTokens bool) error
+	RevokeUserSessions(ctx context.Context, userId, orgId string, revokeTokens bool) error
+}
+
+type sessionService struct {
+	cfg              *config.Config
+	sessionStore     SessionStore
+	policyRepository SessionPolicyRepository
+	tokenRevoker     TokenRevoker
+}
+
+func NewSessionService(cfg *config.Config, sessionStore SessionStore, policyRepository SessionPolicyRepository, tokenRevoker TokenRevoker) SessionService {
+	return &sessionService{
+		cfg:              cfg,
+		sessionStore:     sessionStore,
+		policyRepository: policyRepository,
+		tokenRevoker:     tokenRevoker,
+	}
+}
+
+// CreateSession starts a session for the user under the session policy of the organization. When
+// the user already has the maximum number of sessions the oldest one is ended, or the new session
+// is rejected with ErrSessionLimitReached, depending on the policy.
+func (s *sessionService) CreateSession(ctx context.Context, sessionInfo SessionInfo) (string, error) {
+	policy, err := s.GetSessionPolicy(ctx, sessionInfo.OrganizationId)
+	if err != nil {
+		return "", err
+	}
+	sessionInfo.IdleTimeout = policy.IdleTimeout
+	return s.sessionStore.CreateLimitedSession(sessionInfo, policy)
+}
+
+func (s *sessionService) GetSessionPolicy(ctx context.Context, orgId string) (SessionPolicy, error) {
+	policy, found, err := s.policyRepository.GetSessionPolicy(ctx, orgId)
+	if err != nil {
+		return SessionPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	limitAction := s.cfg.Session.LimitAction
+	if limitAction == "" {
+		limitAction = SessionLimitActionEvictOldest
+	}
+	return SessionPolicy{
+		OrganizationId:   orgId,
+		MaxSessions:      s.cfg.Session.MaxSessions,
+		LimitAction:      limitAction,
+		IdleTimeout:      s.cfg.GetSessionIdleTimeout(),
+		AbsoluteLifetime: s.cfg.GetSessionAbsoluteTimeout(),
+	}, nil
+}
+
+func (s *sessionService) UpdateSessionPolicy(ctx context.Context, policy SessionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	return s.policyRepository.SaveSessionPolicy(ctx, policy)
+}
+
+func (s *sessionService) GetUserSessions(ctx context.Context, userId, orgId string) ([]SessionInfo, error) {
+	return s.sessionStore.GetSessionsByUser(userId, orgId)
+}
+
+func (s *sessionService) RevokeUserSession(ctx context.Context, sessionId, userId, orgId string, revokeTokens bool) error {
+	sessions, err := s.sessionStore.GetSessionsByUser(userId, orgId)
+	if err != nil {
+		return err
+	}
+	for _, sessionInfo := range sessions {
+		if sessionInfo.SessionId == sessionId {
+			return s.revokeSession(ctx, sessionId, revokeTokens)
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (s *sessionService) RevokeUserSessions(ctx context.Context, userId, orgId string, revokeTokens bool) error {
+	sessions, err := s.sessionStore.GetSessionsByUser(userId, orgId)
+	if err != nil {
+		return err
+	}
+	for _, sessionInfo := range sessions {
+		if err := s.revokeSession(ctx, sessionInfo.SessionId, revokeTokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sessionService) revokeSession(ctx context.Context, sessionId string, revokeTokens bool) error {
+	if err := s.sessionStore.DeleteSession(sessionId); err != nil {
+		return err
+	}
+	if revokeTokens {
+		return s.tokenRevoker.RevokeTokensBySession(ctx, sessionId)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+type fakeTokenRevoker struct {
+	revoked []string
+}
+
+func (f *fakeTokenRevoker) RevokeTokensBySession(ctx context.Context, sessionId string) error {
+	f.revoked = append(f.revoked, sessionId)
+	return nil
+}
+
+type fakeSessionPolicyRepository struct {
+	policies map[string]SessionPolicy
+}
+
+func (f *fakeSessionPolicyRepository) GetSessionPolicy(ctx context.Context, orgId string) (SessionPolicy, bool, error) {
+	policy, found := f.policies[orgId]
+	return policy, found, nil
+}
+
+func (f *fakeSessionPolicyRepository) SaveSessionPolicy(ctx context.Context, policy SessionPolicy) error {
+	f.policies[policy.OrganizationId] = policy
+	return nil
+}
+
+func newTestSessionService(store SessionStore, tokenRevoker TokenRevoker) SessionService {
+	cfg := &config.Config{}
+	cfg.Session.AbsoluteTimeout = 60
+	return NewSessionService(cfg, store, &fakeSessionPolicyRepository{policies: map[string]SessionPolicy{}}, tokenRevoker)
+}
+
+func TestSessionServiceCreateSessionDefaultPolicy(t *testing.T) {
+	service := newTestSessionService(NewInMemorySessionStore(), &fakeTokenRevoker{})
+	policy, err := service.GetSessionPolicy(context.Background(), "test-organization-id")
+	if err != nil {
+		t.Fatalf("failed to get session policy: %v", err)
+	}
+	if policy.AbsoluteLifetime != time.Minute || policy.LimitAction != SessionLimitActionEvictOldest {
+		t.Errorf("Expected the configured defaults, got %+v", policy)
+	}
+}
+
+func TestSessionServiceDefaultPolicyWithoutConfig(t *testing.T) {
+	store := NewInMemorySessionStore()
+	service := NewSessionService(&config.Config{}, store, &fakeSessionPolicyRepository{policies: map[string]SessionPolicy{}}, &fakeTokenRevoker{})
+	sessionID, err := service.CreateSession(context.Background(), SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"})
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	sessionInfo, found, _ := store.GetSession(sessionID)
+	if !found {
+		t.Fatal("Expected the session to outlive its creation")
+	}
+	if lifetime := sessionInfo.ExpiresAt.Sub(sessionInfo.CreatedAt); lifetime != 30*time.Minute {
+		t.Errorf("Expected the default lifetime, got %v", lifetime)
+	}
+}
+
+func TestSessionServiceCreateSessionEvictsOldest(t *testing.T) {
+	store := NewInMemorySessionStore()
+	service := newTestSessionService(store, &fakeTokenRevoker{})
+	err := service.UpdateSessionPolicy(context.Background(), SessionPolicy{OrganizationId: "test-organization-id", MaxSessions: 2, LimitAction: SessionLimitActionEvictOldest, IdleTimeout: time.Minute, AbsoluteLifetime: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to update session policy: %v", err)
+	}
+	var sessionIDs []string
+	for i := 0; i < 3; i++ {
+		sessionID, err := service.CreateSession(context.Background(), SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"})
+		if err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if _, found, _ := store.GetSession(sessionIDs[0]); found {
+		t.Error("Expected the oldest session to be evicted")
+	}
+	sessionInfo, found, _ := store.GetSession(sessionIDs[2])
+	if !found {
+		t.Fatal("Expected the new session to be created")
+	}
+	if sessionInfo.IdleTimeout != time.Minute {
+		t.Errorf("Expected the idle timeout of the policy, got %v", sessionInfo.IdleTimeout)
+	}
+}
+
+func TestSessionServiceCreateSessionRejectsOverLimit(t *testing.T) {
+	service := newTestSessionService(NewInMemorySessionStore(), &fakeTokenRevoker{})
+	err := service.UpdateSessionPolicy(context.Background(), SessionPolicy{OrganizationId: "test-organization-id", MaxSessions: 1, LimitAction: SessionLimitActionReject, AbsoluteLifetime: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to update session policy: %v", err)
+	}
+	if _, err := service.CreateSession(context.Background(), SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if _, err := service.CreateSession(context.Background(), SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}); err != ErrSessionLimitReached {
+		t.Errorf("Expected ErrSessionLimitReached, got %v", err)
+	}
+}
+
+func TestSessionServiceRevokeUserSession(t *testing.T) {
+	store := NewInMemorySessionStore()
+	tokenRevoker := &fakeTokenRevoker{}
+	service := newTestSessionService(store, tokenRevoker)
+	sessionID, _ := store.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, time.Minute)
+	otherSessionID, _ := store.CreateSession(SessionInfo{UserID: "test-user-id-2", OrganizationId: "test-organization-id"}, time.Minute)
+
+	if err := service.RevokeUserSession(context.Background(), otherSessionID, "test-user-id", "test-organization-id", true); err == nil {
+		t.Error("Expected an error when revoking another user's session")
+	}
+	if err := service.RevokeUserSession(context.Background(), sessionID, "test-user-id", "test-organization-id", true); err != nil {
+		t.Fatalf("failed to revoke session: %v", err)
+	}
+	if _, found, _ := store.GetSession(sessionID); found {
+		t.Error("Expected the session to be revoked")
+	}
+	if _, found, _ := store.GetSession(otherSessionID); !found {
+		t.Error("Expected the other user's session to remain")
+	}
+	if len(tokenRevoker.revoked) != 1 || tokenRevoker.revoked[0] != sessionID {
+		t.Errorf("Expected the tokens of the session to be revoked, got %v", tokenRevoker.revoked)
+	}
+}
+
+func TestSessionServiceRevokeUserSessions(t *testing.T) {
+	store := NewInMemorySessionStore()
+	tokenRevoker := &fakeTokenRevoker{}
+	service := newTestSessionService(store, tokenRevoker)
+	store.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, time.Minute)
+	store.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, time.Minute)
+
+	if err := service.RevokeUserSessions(context.Background(), "test-user-id", "test-organization-id", false); err != nil {
+		t.Fatalf("failed to revoke sessions: %v", err)
+	}
+	if sessions, _ := service.GetUserSessions(context.Background(), "test-user-id", "test-organization-id"); len(sessions) != 0 {
+		t.Errorf("Expected no sessions, got %v", sessions)
+	}
+	if len(tokenRevoker.revoked) != 0 {
+		t.Errorf("Expected no tokens to be revoked, got %v", tokenRevoker.revoked)
+	}
+}
@@ -1,52 +1,154 @@
 package session
 
 import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/patrickmn/go-cache"
 )
 
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionInfo is an organization level single sign-on session that any application in the
+// organization can reuse.
 type SessionInfo struct {
 	SessionId      string
 	UserID         string
 	OrganizationId string
-	ClientID       string
-	ExpiresAt      time.Time
+	// Issuer is the issuer the user signed in at, the logout tokens of the session carry it.
+	Issuer string
+	// ClientIDs are the clients that took part in the session, in the order they joined.
+	ClientIDs []string
+	// AuthMethods are the methods the user authenticated with, as amr values.
+	AuthMethods []string
+	AuthTime    time.Time
+	// IdleTimeout ends the session when it is not used for that long. Zero disables it.
+	IdleTimeout    time.Duration
+	LastAccessedAt time.Time
+	// ExpiresAt is the absolute end of the session regardless of activity.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Device    Device
+}
+
+// Device describes where the session was started from.
+type Device struct {
+	IPAddress string
+	UserAgent string
 }
 
+func (si SessionInfo) IsActive(now time.Time) bool {
+	return now.Before(si.expiration())
+}
+
+func (si SessionInfo) expiration() time.Time {
+	if si.IdleTimeout > 0 {
+		if idleExpiration := si.LastAccessedAt.Add(si.IdleTimeout); idleExpiration.Before(si.ExpiresAt) {
+			return idleExpiration
+		}
+	}
+	return si.ExpiresAt
+}
+
+// SessionEndListener is notified when a session ends, whether it was deleted or it expired.
+type SessionEndListener func(sessionInfo SessionInfo)
+
 type SessionStore interface {
-	CreateSession(userID, OrganizationId, clientID string, expireTime time.Duration) string
-	GetSession(sessionID string) (SessionInfo, bool)
-	DeleteSession(sessionID string)
+	// CreateSession stores a new session for the user, organization, auth methods, idle timeout and
+	// device of sessionInfo and returns its id.
+	CreateSession(sessionInfo SessionInfo, expireTime time.Duration) (string, error)
+	// CreateLimitedSession creates the session for the lifetime of the policy, first ending the
+	// oldest sessions of the user over the limit of the policy, or failing with
+	// ErrSessionLimitReached, depending on the policy.
+	CreateLimitedSession(sessionInfo SessionInfo, policy SessionPolicy) (string, error)
+	GetSession(sessionID string) (SessionInfo, bool, error)
+	// GetSessionsByUser returns the active sessions of the user, oldest first.
+	GetSessionsByUser(userID, organizationId string) ([]SessionInfo, error)
+	// AddClientToSession and UpdateAuthentication fail with ErrSessionNotFound when the session
+	// ended.
+	AddClientToSession(sessionID, clientID string) error
+	UpdateAuthentication(sessionID string, authMethods []string) error
+	DeleteSession(sessionID string) error
+	OnSessionEnd(listener SessionEndListener)
 }
 
 type inMemorySessionStore struct {
-	c *cache.Cache
+	c         *cache.Cache
+	mu        sync.RWMutex
+	listeners []SessionEndListener
+	// updateMu serializes the updates that read the sessions and store them back
+	updateMu sync.Mutex
 }
 
 func NewInMemorySessionStore() SessionStore {
-	return &inMemorySessionStore{
-		c: cache.New(cache.NoExpiration, cache.NoExpiration),
+	s := &inMemorySessionStore{
+		c: cache.New(cache.NoExpiration, time.Minute),
+	}
+	s.c.OnEvicted(func(sessionID string, data interface{}) {
+		s.notifySessionEnd(data.(SessionInfo))
+	})
+	return s
+}
+
+func (s *inMemorySessionStore) CreateSession(sessionInfo SessionInfo, expireTime time.Duration) (string, error) {
+	sessionInfo = newSessionInfo(sessionInfo, expireTime)
+	s.set(sessionInfo)
+	return sessionInfo.SessionId, nil
+}
+
+func (s *inMemorySessionStore) CreateLimitedSession(sessionInfo SessionInfo, policy SessionPolicy) (string, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	if policy.MaxSessions > 0 {
+		sessions, _ := s.GetSessionsByUser(sessionInfo.UserID, sessionInfo.OrganizationId)
+		if len(sessions) >= policy.MaxSessions {
+			if policy.LimitAction == SessionLimitActionReject {
+				return "", ErrSessionLimitReached
+			}
+			for _, oldest := range sessions[:len(sessions)-policy.MaxSessions+1] {
+				s.DeleteSession(oldest.SessionId)
+			}
+		}
 	}
+	return s.CreateSession(sessionInfo, policy.AbsoluteLifetime)
 }
 
-func (s inMemorySessionStore) CreateSession(userID, OrganizationId, clientID string, expireTime time.Duration) string {
-	sessionID := uuid.New().String()
-	s.c.Set(sessionID, SessionInfo{
-		UserID:         userID,
-		OrganizationId: OrganizationId,
-		ClientID:       clientID,
-		ExpiresAt:      time.Now().Add(expireTime),
-		SessionId:      sessionID,
-	}, expireTime)
-	return sessionID
+func newSessionInfo(sessionInfo SessionInfo, expireTime time.Duration) SessionInfo {
+	now := time.Now()
+	sessionInfo.SessionId = uuid.New().String()
+	sessionInfo.ClientIDs = nil
+	sessionInfo.AuthMethods = slices.Clone(sessionInfo.AuthMethods)
+	sessionInfo.AuthTime = now
+	sessionInfo.LastAccessedAt = now
+	sessionInfo.CreatedAt = now
+	sessionInfo.ExpiresAt = now.Add(expireTime)
+	return sessionInfo
 }
 
-func (s inMemorySessionStore) GetSession(sessionID string) (SessionInfo, bool) {
+// set stores the session until it expires, so the janitor also ends sessions that went idle.
+func (s *inMemorySessionStore) set(sessionInfo SessionInfo) {
+	s.c.Set(sessionInfo.SessionId, sessionInfo, time.Until(sessionInfo.expiration()))
+}
+
+func (s *inMemorySessionStore) GetSession(sessionID string) (SessionInfo, bool, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	sessionInfo, found := s.touchSession(sessionID)
+	return sessionInfo, found, nil
+}
+
+// touchSession returns the session and records its use, the caller holds updateMu.
+func (s *inMemorySessionStore) touchSession(sessionID string) (SessionInfo, bool) {
 	if data, found := s.c.Get(sessionID); found {
 		sessionInfo := data.(SessionInfo)
-		if time.Now().Before(sessionInfo.ExpiresAt) {
+		now := time.Now()
+		if sessionInfo.IsActive(now) {
+			sessionInfo.LastAccessedAt = now
+			s.set(sessionInfo)
 			return sessionInfo, true
 		}
 		s.c.Delete(sessionID)
@@ -54,6 +156,101 @@ func (s inMemorySessionStore) GetSession(sessionID string) (SessionInfo, bool) {
 	return SessionInfo{}, false
 }
 
-func (s inMemorySessionStore) DeleteSession(sessionID string) {
+func (s *inMemorySessionStore) GetSessionsByUser(userID, organizationId string) ([]SessionInfo, error) {
+	var sessions []SessionInfo
+	now := time.Now()
+	for _, item := range s.c.Items() {
+		sessionInfo := item.Object.(SessionInfo)
+		if sessionInfo.UserID == userID && sessionInfo.OrganizationId == organizationId && sessionInfo.IsActive(now) {
+			sessions = append(sessions, sessionInfo)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b SessionInfo) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (s *inMemorySessionStore) AddClientToSession(sessionID, clientID string) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	sessionInfo, found := s.touchSession(sessionID)
+	if !found {
+		return ErrSessionNotFound
+	}
+	if !slices.Contains(sessionInfo.ClientIDs, clientID) {
+		sessionInfo.ClientIDs = append(slices.Clone(sessionInfo.ClientIDs), clientID)
+		s.set(sessionInfo)
+	}
+	return nil
+}
+
+// UpdateAuthentication records a fresh authentication of the session user.
+func (s *inMemorySessionStore) UpdateAuthentication(sessionID string, authMethods []string) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	sessionInfo, found := s.touchSession(sessionID)
+	if !found {
+		return ErrSessionNotFound
+	}
+	sessionInfo.AuthMethods = slices.Clone(sessionInfo.AuthMethods)
+	for _, authMethod := range authMethods {
+		if !slices.Contains(sessionInfo.AuthMethods, authMethod) {
+			sessionInfo.AuthMethods = append(sessionInfo.AuthMethods, authMethod)
+		}
+	}
+	sessionInfo.AuthTime = time.Now()
+	s.set(sessionInfo)
+	return nil
+}
+
+func (s *inMemorySessionStore) DeleteSession(sessionID string) error {
 	s.c.Delete(sessionID)
+	return nil
+}
+
+func (s *inMemorySessionStore) OnSessionEnd(listener SessionEndListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *inMemorySessionStore) notifySessionEnd(sessionInfo SessionInfo) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, listener := range s.listeners {
+		listener(sessionInfo)
+	}
+}
+
+// Name gives a short, human readable description of the device such as "Firefox on Linux".
+func (d Device) Name() string {
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(d.UserAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	platform := "unknown OS"
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(d.UserAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+	return browser + " on " + platform
 }
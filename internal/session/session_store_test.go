@@ -1,23 +1,126 @@
 package session
 
 import (
+	"fmt"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestInMemorySessionStore(t *testing.T) {
 	s := NewInMemorySessionStore()
-	sessionID := s.CreateSession("test-user-id", "test-organization-id", "test-client-id", time.Minute)
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
 	if sessionID == "" {
 		t.Error("Expected a session ID to be returned")
 	}
-	_, found := s.GetSession(sessionID)
+	_, found, _ := s.GetSession(sessionID)
 	if !found {
 		t.Error("Expected to find the session")
 	}
 	s.DeleteSession(sessionID)
-	_, found = s.GetSession(sessionID)
+	_, found, _ = s.GetSession(sessionID)
 	if found {
 		t.Error("Expected not to find the session")
 	}
 }
+
+func TestInMemorySessionStoreAddClientToSession(t *testing.T) {
+	s := NewInMemorySessionStore()
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.AddClientToSession(sessionID, "test-client-id")
+	s.AddClientToSession(sessionID, "test-client-id-2")
+	s.AddClientToSession(sessionID, "test-client-id-2")
+	sessionInfo, found, _ := s.GetSession(sessionID)
+	if !found {
+		t.Fatal("Expected to find the session")
+	}
+	if len(sessionInfo.ClientIDs) != 2 || sessionInfo.ClientIDs[1] != "test-client-id-2" {
+		t.Errorf("Expected two participating clients, got %v", sessionInfo.ClientIDs)
+	}
+}
+
+func TestInMemorySessionStoreAddClientToSessionWhileInUse(t *testing.T) {
+	s := NewInMemorySessionStore()
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s.AddClientToSession(sessionID, fmt.Sprintf("test-client-id-%d", i))
+		}(i)
+		go func() {
+			defer wg.Done()
+			s.GetSession(sessionID)
+		}()
+	}
+	wg.Wait()
+	sessionInfo, _, _ := s.GetSession(sessionID)
+	if len(sessionInfo.ClientIDs) != 100 {
+		t.Errorf("Expected every client to be recorded, got %v", sessionInfo.ClientIDs)
+	}
+}
+
+func TestInMemorySessionStoreUpdateAuthentication(t *testing.T) {
+	s := NewInMemorySessionStore()
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	created, _, _ := s.GetSession(sessionID)
+	s.UpdateAuthentication(sessionID, []string{"pwd", "otp"})
+	sessionInfo, found, _ := s.GetSession(sessionID)
+	if !found {
+		t.Fatal("Expected to find the session")
+	}
+	if len(sessionInfo.AuthMethods) != 2 || sessionInfo.AuthMethods[1] != "otp" {
+		t.Errorf("Expected the auth methods to be merged, got %v", sessionInfo.AuthMethods)
+	}
+	if sessionInfo.AuthTime.Before(created.AuthTime) {
+		t.Error("Expected the auth time to be refreshed")
+	}
+}
+
+func TestInMemorySessionStoreOnSessionEnd(t *testing.T) {
+	s := NewInMemorySessionStore()
+	var ended []SessionInfo
+	s.OnSessionEnd(func(sessionInfo SessionInfo) {
+		ended = append(ended, sessionInfo)
+	})
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.DeleteSession(sessionID)
+	if len(ended) != 1 || ended[0].SessionId != sessionID {
+		t.Errorf("Expected the listener to be notified once for the session, got %v", ended)
+	}
+}
+
+func TestInMemorySessionStoreIdleTimeout(t *testing.T) {
+	s := NewInMemorySessionStore()
+	sessionID, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}, IdleTimeout: 50 * time.Millisecond}, time.Minute)
+	time.Sleep(30 * time.Millisecond)
+	if _, found, _ := s.GetSession(sessionID); !found {
+		t.Fatal("Expected the session to still be active")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, found, _ := s.GetSession(sessionID); !found {
+		t.Fatal("Expected the idle timeout to slide on access")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, found, _ := s.GetSession(sessionID); found {
+		t.Error("Expected the idle session to end")
+	}
+}
+
+func TestInMemorySessionStoreGetSessionsByUser(t *testing.T) {
+	s := NewInMemorySessionStore()
+	first, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	second, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.CreateSession(SessionInfo{UserID: "test-user-id-2", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id-2", AuthMethods: []string{"pwd"}}, time.Minute)
+	sessions, _ := s.GetSessionsByUser("test-user-id", "test-organization-id")
+	if len(sessions) != 2 {
+		t.Fatalf("Expected two sessions for the user, got %v", sessions)
+	}
+	ids := []string{sessions[0].SessionId, sessions[1].SessionId}
+	if !slices.Contains(ids, first) || !slices.Contains(ids, second) {
+		t.Errorf("Expected the sessions of the user, got %v", ids)
+	}
+}
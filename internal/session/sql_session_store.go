@@ -0,0 +1,348 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlSessionStore struct {
+	db        *sqlx.DB
+	mu        sync.RWMutex
+	listeners []SessionEndListener
+}
+
+type sessionRow struct {
+	Id             string         `db:"id"`
+	UserId         string         `db:"user_id"`
+	OrganizationId string         `db:"organization_id"`
+	Issuer         sql.NullString `db:"issuer"`
+	AuthMethods    sql.NullString `db:"auth_methods"`
+	AuthTime       int64          `db:"auth_time"`
+	LastAccessedAt int64          `db:"last_accessed_at"`
+	IdleTimeout    int64          `db:"idle_timeout"`
+	ExpiresAt      int64          `db:"expires_at"`
+	CreatedAt      int64          `db:"created_at"`
+	IPAddress      sql.NullString `db:"ip_address"`
+	UserAgent      sql.NullString `db:"user_agent"`
+}
+
+const sessionColumns = "id, user_id, organization_id, issuer, auth_methods, auth_time, last_accessed_at, idle_timeout, expires_at, created_at, ip_address, user_agent"
+
+// NewSQLSessionStore returns a session store that keeps sessions in the database so they survive
+// restarts and can be shared between instances. Ended sessions are swept every sweepInterval.
+func NewSQLSessionStore(db *sqlx.DB, sweepInterval time.Duration) SessionStore {
+	s := &sqlSessionStore{
+		db: db,
+	}
+	if sweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(sweepInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.sweep()
+			}
+		}()
+	}
+	return s
+}
+
+const activeSessionCondition = "expires_at > ? AND (idle_timeout = 0 OR last_accessed_at + idle_timeout > ?)"
+
+func (s *sqlSessionStore) CreateSession(sessionInfo SessionInfo, expireTime time.Duration) (string, error) {
+	sessionInfo = newSessionInfo(sessionInfo, expireTime)
+	if _, err := insertSession(s.db, sessionInfo, "1 = 1"); err != nil {
+		return "", err
+	}
+	return sessionInfo.SessionId, nil
+}
+
+// CreateLimitedSession counts the sessions of the user in the statement that inserts the new one,
+// and evicts in the same transaction, so concurrent logins can't go over the limit.
+func (s *sqlSessionStore) CreateLimitedSession(sessionInfo SessionInfo, policy SessionPolicy) (string, error) {
+	if policy.MaxSessions <= 0 {
+		return s.CreateSession(sessionInfo, policy.AbsoluteLifetime)
+	}
+	sessionInfo = newSessionInfo(sessionInfo, policy.AbsoluteLifetime)
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	var evicted []SessionInfo
+	if policy.LimitAction == SessionLimitActionReject {
+		inserted, err := insertSession(tx, sessionInfo, "(SELECT COUNT(*) FROM session WHERE user_id = ? AND organization_id = ? AND "+activeSessionCondition+") < ?",
+			sessionInfo.UserID, sessionInfo.OrganizationId, now, now, policy.MaxSessions)
+		if err != nil {
+			return "", err
+		}
+		if !inserted {
+			return "", ErrSessionLimitReached
+		}
+	} else {
+		if _, err := insertSession(tx, sessionInfo, "1 = 1"); err != nil {
+			return "", err
+		}
+		var rows []sessionRow
+		err := tx.Select(&rows, "SELECT "+sessionColumns+" FROM session WHERE user_id = ? AND organization_id = ? AND "+activeSessionCondition+" ORDER BY created_at DESC, rowid DESC LIMIT -1 OFFSET ?",
+			sessionInfo.UserID, sessionInfo.OrganizationId, now, now, policy.MaxSessions)
+		if err != nil {
+			return "", err
+		}
+		for _, row := range rows {
+			oldest, err := s.toSessionInfo(tx, row)
+			if err != nil {
+				return "", err
+			}
+			if _, err := tx.Exec("DELETE FROM session_client WHERE session_id = ?", row.Id); err != nil {
+				return "", err
+			}
+			if _, err := tx.Exec("DELETE FROM session WHERE id = ?", row.Id); err != nil {
+				return "", err
+			}
+			evicted = append(evicted, oldest)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	for _, oldest := range evicted {
+		s.notifySessionEnd(oldest)
+	}
+	return sessionInfo.SessionId, nil
+}
+
+// insertSession inserts the session when the condition holds and reports whether it did.
+func insertSession(db sqlx.Execer, sessionInfo SessionInfo, condition string, args ...any) (bool, error) {
+	authMethodsJSON, err := json.Marshal(sessionInfo.AuthMethods)
+	if err != nil {
+		return false, err
+	}
+	result, err := db.Exec("INSERT INTO session ("+sessionColumns+") SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE "+condition,
+		append([]any{sessionInfo.SessionId, sessionInfo.UserID, sessionInfo.OrganizationId, sessionInfo.Issuer, string(authMethodsJSON), sessionInfo.AuthTime.Unix(),
+			sessionInfo.LastAccessedAt.Unix(), int64(sessionInfo.IdleTimeout / time.Second), sessionInfo.ExpiresAt.Unix(), sessionInfo.CreatedAt.Unix(),
+			sessionInfo.Device.IPAddress, sessionInfo.Device.UserAgent}, args...)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to create session: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted > 0, nil
+}
+
+func (s *sqlSessionStore) GetSession(sessionID string) (SessionInfo, bool, error) {
+	sessionInfo, found, err := s.getSession(sessionID)
+	if err != nil || !found {
+		return SessionInfo{}, false, err
+	}
+	now := time.Now()
+	if !sessionInfo.IsActive(now) {
+		return SessionInfo{}, false, s.endSession(sessionInfo)
+	}
+	if _, err := s.db.Exec("UPDATE session SET last_accessed_at = ? WHERE id = ?", now.Unix(), sessionID); err != nil {
+		return SessionInfo{}, false, fmt.Errorf("failed to update session: %w", err)
+	}
+	sessionInfo.LastAccessedAt = now
+	return sessionInfo, true, nil
+}
+
+func (s *sqlSessionStore) getSession(sessionID string) (SessionInfo, bool, error) {
+	var row sessionRow
+	err := s.db.Get(&row, "SELECT "+sessionColumns+" FROM session WHERE id = ?", sessionID)
+	if err == sql.ErrNoRows {
+		return SessionInfo{}, false, nil
+	}
+	if err != nil {
+		return SessionInfo{}, false, fmt.Errorf("failed to get session: %w", err)
+	}
+	sessionInfo, err := s.toSessionInfo(s.db, row)
+	if err != nil {
+		return SessionInfo{}, false, err
+	}
+	return sessionInfo, true, nil
+}
+
+func (s *sqlSessionStore) GetSessionsByUser(userID, organizationId string) ([]SessionInfo, error) {
+	var rows []sessionRow
+	err := s.db.Select(&rows, "SELECT "+sessionColumns+" FROM session WHERE user_id = ? AND organization_id = ? ORDER BY created_at, rowid", userID, organizationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	var sessions []SessionInfo
+	now := time.Now()
+	for _, row := range rows {
+		sessionInfo, err := s.toSessionInfo(s.db, row)
+		if err != nil {
+			return nil, err
+		}
+		if sessionInfo.IsActive(now) {
+			sessions = append(sessions, sessionInfo)
+		}
+	}
+	return sessions, nil
+}
+
+// AddClientToSession adds the client with a row of its own, so clients joining the session at the
+// same time can't overwrite each other.
+func (s *sqlSessionStore) AddClientToSession(sessionID, clientID string) error {
+	_, found, err := s.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
+	_, err = s.db.Exec("INSERT INTO session_client (session_id, client_id) SELECT id, ? FROM session WHERE id = ? ON CONFLICT DO NOTHING", clientID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// UpdateAuthentication records a fresh authentication of the session user. The first statement
+// writes, so the transaction holds the write lock while it merges the auth methods.
+func (s *sqlSessionStore) UpdateAuthentication(sessionID string, authMethods []string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	result, err := tx.Exec("UPDATE session SET auth_time = ?, last_accessed_at = ? WHERE id = ? AND "+activeSessionCondition, now, now, sessionID, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return ErrSessionNotFound
+	}
+	var current sql.NullString
+	if err := tx.Get(&current, "SELECT auth_methods FROM session WHERE id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	var merged []string
+	if current.Valid {
+		if err := json.Unmarshal([]byte(current.String), &merged); err != nil {
+			return fmt.Errorf("invalid auth methods of session %s: %w", sessionID, err)
+		}
+	}
+	for _, authMethod := range authMethods {
+		if !slices.Contains(merged, authMethod) {
+			merged = append(merged, authMethod)
+		}
+	}
+	authMethodsJSON, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE session SET auth_methods = ? WHERE id = ?", string(authMethodsJSON), sessionID); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *sqlSessionStore) DeleteSession(sessionID string) error {
+	sessionInfo, found, err := s.getSession(sessionID)
+	if err != nil || !found {
+		return err
+	}
+	return s.endSession(sessionInfo)
+}
+
+func (s *sqlSessionStore) OnSessionEnd(listener SessionEndListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// endSession deletes the session and notifies the listeners. Only the instance whose delete
+// removed the row notifies, so a session ends once even when instances race to sweep it.
+func (s *sqlSessionStore) endSession(sessionInfo SessionInfo) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("DELETE FROM session WHERE id = ?", sessionInfo.SessionId)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil || deleted == 0 {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM session_client WHERE session_id = ?", sessionInfo.SessionId); err != nil {
+		return fmt.Errorf("failed to delete session clients: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.notifySessionEnd(sessionInfo)
+	return nil
+}
+
+func (s *sqlSessionStore) notifySessionEnd(sessionInfo SessionInfo) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, listener := range s.listeners {
+		listener(sessionInfo)
+	}
+}
+
+func (s *sqlSessionStore) sweep() {
+	var rows []sessionRow
+	now := time.Now().Unix()
+	err := s.db.Select(&rows, "SELECT "+sessionColumns+" FROM session WHERE NOT ("+activeSessionCondition+")", now, now)
+	if err != nil {
+		log.Printf("failed to sweep sessions: %v", err)
+		return
+	}
+	for _, row := range rows {
+		sessionInfo, err := s.toSessionInfo(s.db, row)
+		if err != nil {
+			log.Printf("failed to read session: %v", err)
+			continue
+		}
+		if err := s.endSession(sessionInfo); err != nil {
+			log.Printf("failed to sweep session: %v", err)
+		}
+	}
+}
+
+func (s *sqlSessionStore) toSessionInfo(q sqlx.Queryer, row sessionRow) (SessionInfo, error) {
+	sessionInfo := SessionInfo{
+		SessionId:      row.Id,
+		UserID:         row.UserId,
+		OrganizationId: row.OrganizationId,
+		Issuer:         row.Issuer.String,
+		AuthTime:       time.Unix(row.AuthTime, 0),
+		IdleTimeout:    time.Duration(row.IdleTimeout) * time.Second,
+		LastAccessedAt: time.Unix(row.LastAccessedAt, 0),
+		ExpiresAt:      time.Unix(row.ExpiresAt, 0),
+		CreatedAt:      time.Unix(row.CreatedAt, 0),
+		Device: Device{
+			IPAddress: row.IPAddress.String,
+			UserAgent: row.UserAgent.String,
+		},
+	}
+	if row.AuthMethods.Valid {
+		if err := json.Unmarshal([]byte(row.AuthMethods.String), &sessionInfo.AuthMethods); err != nil {
+			return SessionInfo{}, fmt.Errorf("invalid auth methods of session %s: %w", row.Id, err)
+		}
+	}
+	err := sqlx.Select(q, &sessionInfo.ClientIDs, "SELECT client_id FROM session_client WHERE session_id = ? ORDER BY rowid", row.Id)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	return sessionInfo, nil
+}
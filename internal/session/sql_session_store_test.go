@@ -0,0 +1,183 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+func newTestSQLSessionStore(t *testing.T) *sqlSessionStore {
+	db := testutil.NewDB(t, "session.sql")
+	return NewSQLSessionStore(db, 0).(*sqlSessionStore)
+}
+
+func TestSQLSessionStore(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	var ended []SessionInfo
+	s.OnSessionEnd(func(sessionInfo SessionInfo) {
+		ended = append(ended, sessionInfo)
+	})
+	sessionID, err := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", Issuer: "https://login.example.com/o/test", AuthMethods: []string{"pwd"}}, time.Minute)
+	if err != nil || sessionID == "" {
+		t.Fatalf("Expected a session ID to be returned, got %v", err)
+	}
+	s.AddClientToSession(sessionID, "test-client-id")
+	s.AddClientToSession(sessionID, "test-client-id")
+	sessionInfo, found, _ := s.GetSession(sessionID)
+	if !found {
+		t.Fatal("Expected to find the session")
+	}
+	if sessionInfo.UserID != "test-user-id" || sessionInfo.Issuer != "https://login.example.com/o/test" || len(sessionInfo.ClientIDs) != 1 || len(sessionInfo.AuthMethods) != 1 {
+		t.Errorf("Unexpected session %+v", sessionInfo)
+	}
+	s.DeleteSession(sessionID)
+	if _, found, _ := s.GetSession(sessionID); found {
+		t.Error("Expected not to find the session")
+	}
+	if len(ended) != 1 || ended[0].SessionId != sessionID {
+		t.Errorf("Expected the listener to be notified once for the session, got %v", ended)
+	}
+}
+
+func TestSQLSessionStoreAddClientsConcurrently(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	sessionID, err := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create the session: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.AddClientToSession(sessionID, fmt.Sprintf("test-client-id-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	sessionInfo, _, _ := s.GetSession(sessionID)
+	if len(sessionInfo.ClientIDs) != 10 {
+		t.Errorf("Expected all ten clients in the session, got %v", sessionInfo.ClientIDs)
+	}
+}
+
+func TestSQLSessionStoreCreateLimitedSessionConcurrently(t *testing.T) {
+	for _, limitAction := range []string{SessionLimitActionReject, SessionLimitActionEvictOldest} {
+		t.Run(limitAction, func(t *testing.T) {
+			s := newTestSQLSessionStore(t)
+			var ended atomic.Int32
+			s.OnSessionEnd(func(sessionInfo SessionInfo) {
+				ended.Add(1)
+			})
+			policy := SessionPolicy{OrganizationId: "test-organization-id", MaxSessions: 2, LimitAction: limitAction, AbsoluteLifetime: time.Hour}
+			var wg sync.WaitGroup
+			var rejected atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := s.CreateLimitedSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, policy)
+					if err == ErrSessionLimitReached {
+						rejected.Add(1)
+					} else if err != nil {
+						t.Errorf("Failed to create the session: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if sessions, _ := s.GetSessionsByUser("test-user-id", "test-organization-id"); len(sessions) != 2 {
+				t.Errorf("Expected the user to keep two sessions, got %d", len(sessions))
+			}
+			if limitAction == SessionLimitActionReject && rejected.Load() != 8 {
+				t.Errorf("Expected eight logins to be rejected, got %d", rejected.Load())
+			}
+			if limitAction == SessionLimitActionEvictOldest && ended.Load() != 8 {
+				t.Errorf("Expected eight sessions to be evicted, got %d", ended.Load())
+			}
+		})
+	}
+}
+
+func TestSQLSessionStoreGetSessionsByUser(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	s.CreateSession(SessionInfo{UserID: "test-user-id-2", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	if sessions, _ := s.GetSessionsByUser("test-user-id", "test-organization-id"); len(sessions) != 2 {
+		t.Errorf("Expected two sessions for the user, got %v", sessions)
+	}
+}
+
+func TestSQLSessionStoreSweep(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	var ended []SessionInfo
+	s.OnSessionEnd(func(sessionInfo SessionInfo) {
+		ended = append(ended, sessionInfo)
+	})
+	expired, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, -time.Minute)
+	idle, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}, IdleTimeout: time.Second}, time.Minute)
+	active, _ := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}, IdleTimeout: time.Hour}, time.Minute)
+	s.db.MustExec("UPDATE session SET last_accessed_at = last_accessed_at - 10 WHERE id = ?", idle)
+	s.sweep()
+	if len(ended) != 2 {
+		t.Fatalf("Expected the expired and idle sessions to end, got %v", ended)
+	}
+	for _, sessionID := range []string{expired, idle} {
+		if _, found, _ := s.getSession(sessionID); found {
+			t.Errorf("Expected session %s to be removed", sessionID)
+		}
+	}
+	if _, found, _ := s.GetSession(active); !found {
+		t.Error("Expected the active session to remain")
+	}
+}
+
+func TestSQLSessionStoreUpdateAuthentication(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	sessionID, err := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id", AuthMethods: []string{"pwd"}}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create the session: %v", err)
+	}
+	if err := s.UpdateAuthentication(sessionID, []string{"pwd", "otp"}); err != nil {
+		t.Fatalf("Failed to update the session: %v", err)
+	}
+	sessionInfo, _, _ := s.GetSession(sessionID)
+	if !slices.Equal(sessionInfo.AuthMethods, []string{"pwd", "otp"}) {
+		t.Errorf("Expected the auth methods to be merged, got %v", sessionInfo.AuthMethods)
+	}
+	if err := s.UpdateAuthentication("unknown", []string{"pwd"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected an unknown session to be reported, got %v", err)
+	}
+	if err := s.AddClientToSession("unknown", "test-client-id"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected an unknown session to be reported, got %v", err)
+	}
+}
+
+func TestSQLSessionStoreReportsErrors(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+	sessionID, err := s.CreateSession(SessionInfo{UserID: "test-user-id", OrganizationId: "test-organization-id"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create the session: %v", err)
+	}
+	s.db.Close()
+	if _, found, err := s.GetSession(sessionID); err == nil || found {
+		t.Errorf("Expected GetSession to fail, got %v", err)
+	}
+	if _, err := s.GetSessionsByUser("test-user-id", "test-organization-id"); err == nil {
+		t.Error("Expected GetSessionsByUser to fail")
+	}
+	if err := s.AddClientToSession(sessionID, "test-client-id"); err == nil {
+		t.Error("Expected AddClientToSession to fail")
+	}
+	if err := s.UpdateAuthentication(sessionID, []string{"pwd"}); err == nil {
+		t.Error("Expected UpdateAuthentication to fail")
+	}
+	if err := s.DeleteSession(sessionID); err == nil {
+		t.Error("Expected DeleteSession to fail")
+	}
+}
@@ -0,0 +1,35 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewDB returns an in-memory database with the schema of the scripts in resources/test/db_scripts.
+func NewDB(t *testing.T, scripts ...string) *sqlx.DB {
+	t.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	scriptDir := filepath.Join(filepath.Dir(file), "..", "..", "resources", "test", "db_scripts")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// every connection to :memory: is a new database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, script := range scripts {
+		schema, err := os.ReadFile(filepath.Join(scriptDir, script))
+		if err != nil {
+			t.Fatalf("failed to read schema file: %v", err)
+		}
+		if _, err := db.Exec(string(schema)); err != nil {
+			t.Fatalf("failed to execute schema %s: %v", script, err)
+		}
+	}
+	return db
+}
@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/notification"
+)
+
+// EmailSender records the emails instead of sending them.
+type EmailSender struct {
+	mu     sync.Mutex
+	emails []notification.Email
+}
+
+func (s *EmailSender) SendEmail(ctx context.Context, email notification.Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emails = append(s.emails, email)
+	return nil
+}
+
+// Emails returns the emails sent so far, oldest first.
+func (s *EmailSender) Emails() []notification.Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]notification.Email(nil), s.emails...)
+}
+
+// Last returns the first group of the pattern in the body of the last email.
+func (s *EmailSender) Last(t *testing.T, pattern string) string {
+	t.Helper()
+	emails := s.Emails()
+	if len(emails) == 0 {
+		t.Fatalf("Expected an email to be sent")
+	}
+	body := emails[len(emails)-1].Body
+	match := regexp.MustCompile(pattern).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("Expected %q in the email, got %q", pattern, body)
+	}
+	return match[1]
+}
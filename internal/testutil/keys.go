@@ -0,0 +1,42 @@
+// Package testutil holds the fixtures shared by the tests of the other packages.
+package testutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/security"
+)
+
+// NewKeyManager returns a key manager with a new EdDSA signing key.
+func NewKeyManager(t *testing.T) *security.KeyManager {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(keyDir, "eddsa.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	// keys are loaded from a directory relative to the working directory
+	cwd, _ := os.Getwd()
+	relativeKeyDir, err := filepath.Rel(cwd, keyDir)
+	if err != nil {
+		t.Fatalf("failed to find key directory: %v", err)
+	}
+	keyManager := security.NewKeyManager()
+	if err := keyManager.LoadKeys(relativeKeyDir); err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	return keyManager
+}
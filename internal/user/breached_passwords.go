@@ -0,0 +1,140 @@
+package user
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// a line is a 40 character hash and an occurrence count, lines longer than this are not expected
+const maxBreachedPasswordLine = 128
+
+// BreachedPasswords is a corpus of breached passwords, read from a file of SHA-1 hashes sorted by
+// hash, one per line with an optional occurrence count, as published by Have I Been Pwned:
+//
+//	000000005AD76BD555C1D6D771DE417A4B87E4B4:10
+//
+// The file is searched on disk, so it can be larger than memory.
+type BreachedPasswords struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachedPasswords opens the corpus at the path. It stays open until Close.
+func OpenBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	b := &BreachedPasswords{file: file, size: info.Size()}
+	line, err := b.lineAt(0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, _, ok := parseBreachedPasswordLine(line); !ok {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a file of SHA-1 password hashes", path)
+	}
+	return b, nil
+}
+
+func (b *BreachedPasswords) Close() error {
+	if b == nil {
+		return nil
+	}
+	return b.file.Close()
+}
+
+// Count returns how many times the password was seen in breaches, zero when it was not. A nil
+// corpus knows no passwords.
+func (b *BreachedPasswords) Count(password string) (int, error) {
+	if b == nil || b.size == 0 {
+		return 0, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	// find the first offset whose line has a hash not before the password's
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := b.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		lineHash, _, _ := parseBreachedPasswordLine(line)
+		if line != nil && lineHash < hash {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	line, err := b.lineFrom(lo)
+	if err != nil {
+		return 0, err
+	}
+	lineHash, count, ok := parseBreachedPasswordLine(line)
+	if !ok || lineHash != hash {
+		return 0, nil
+	}
+	return count, nil
+}
+
+// lineFrom returns the first line starting at or after the offset, or nil at the end of the file.
+func (b *BreachedPasswords) lineFrom(offset int64) ([]byte, error) {
+	if offset == 0 {
+		return b.lineAt(0)
+	}
+	// the line starts after the first line break from the byte before the offset
+	buf := make([]byte, maxBreachedPasswordLine)
+	n, err := b.file.ReadAt(buf, offset-1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	i := bytes.IndexByte(buf[:n], '\n')
+	if i < 0 {
+		return nil, nil
+	}
+	return b.lineAt(offset + int64(i))
+}
+
+func (b *BreachedPasswords) lineAt(offset int64) ([]byte, error) {
+	if offset >= b.size {
+		return nil, nil
+	}
+	buf := make([]byte, maxBreachedPasswordLine)
+	n, err := b.file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line, _, _ := bytes.Cut(buf[:n], []byte{'\n'})
+	return bytes.TrimSpace(line), nil
+}
+
+func parseBreachedPasswordLine(line []byte) (string, int, bool) {
+	hash, countText, hasCount := strings.Cut(string(line), ":")
+	if len(hash) != sha1.Size*2 {
+		return "", 0, false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", 0, false
+	}
+	count := 1
+	if hasCount {
+		var err error
+		if count, err = strconv.Atoi(countText); err != nil {
+			return "", 0, false
+		}
+	}
+	return strings.ToUpper(hash), count, true
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBreachedPasswords(t *testing.T) {
+	// a count of zero writes the hash without one
+	counts := map[string]int{"password": 9545824, "123456": 37359195, "letmein": 0, "qwerty": 0, "dragon": 1}
+	var lines []string
+	for password, count := range counts {
+		sum := sha1.Sum([]byte(password))
+		line := strings.ToUpper(hex.EncodeToString(sum[:]))
+		if count > 0 {
+			line += ":" + strconv.Itoa(count)
+		}
+		lines = append(lines, line)
+	}
+	// fill the file so the search has to skip around
+	for i := range 500 {
+		sum := sha1.Sum([]byte{byte(i), byte(i >> 8), 0xff})
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":1")
+	}
+	slices.Sort(lines)
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatalf("failed to write corpus: %v", err)
+	}
+	breachedPasswords, err := OpenBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("Failed to open corpus: %v", err)
+	}
+	defer breachedPasswords.Close()
+
+	for password, count := range counts {
+		// lines without a count were seen once
+		want := max(count, 1)
+		got, err := breachedPasswords.Count(password)
+		if err != nil {
+			t.Fatalf("Failed to count %q: %v", password, err)
+		}
+		if got != want {
+			t.Errorf("Expected %q to be seen %d times, got %d", password, want, got)
+		}
+	}
+	for _, password := range []string{"correct horse battery staple", ""} {
+		if count, _ := breachedPasswords.Count(password); count != 0 {
+			t.Errorf("Expected %q not to be breached, got %d", password, count)
+		}
+	}
+	var none *BreachedPasswords
+	if count, err := none.Count("password"); count != 0 || err != nil {
+		t.Errorf("Expected no corpus to know no passwords, got %d %v", count, err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.txt")
+	os.WriteFile(invalid, []byte("password\n"), 0o600)
+	if _, err := OpenBreachedPasswords(invalid); err == nil {
+		t.Error("Expected a file that is not a hash corpus to be rejected")
+	}
+}
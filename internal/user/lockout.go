@@ -0,0 +1,200 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+var (
+	ErrAccountLocked   = errors.New("account is locked")
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+)
+
+// LockoutError is returned instead of checking a password the user or address may not try yet.
+type LockoutError struct {
+	// Err is ErrAccountLocked or ErrTooManyAttempts.
+	Err error
+	// RetryAfter is zero when the account stays locked until an administrator unlocks it.
+	RetryAfter time.Time
+}
+
+func (e *LockoutError) Error() string {
+	if e.RetryAfter.IsZero() {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s, try again after %s", e.Err, e.RetryAfter.Format(time.RFC3339))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return e.Err
+}
+
+type LockoutPolicy struct {
+	OrganizationId string
+	// MaxFailedAttempts, ProgressiveDelay and MaxFailedAttemptsPerIP are disabled when zero.
+	MaxFailedAttempts int
+	LockoutDuration   time.Duration
+	// MaxLockouts lockouts in a row lock the account until an administrator unlocks it.
+	MaxLockouts int
+	// ProgressiveDelay doubles after every further failed attempt, up to MaxDelay.
+	ProgressiveDelay       time.Duration
+	MaxDelay               time.Duration
+	MaxFailedAttemptsPerIP int
+	IPWindow               time.Duration
+}
+
+func (p LockoutPolicy) Validate() error {
+	if p.MaxFailedAttempts < 0 || p.MaxLockouts < 0 || p.MaxFailedAttemptsPerIP < 0 {
+		return errors.New("attempt and lockout limits must not be negative")
+	}
+	if p.MaxFailedAttempts > 0 && p.LockoutDuration <= 0 {
+		return errors.New("lockout_duration must be positive")
+	}
+	if p.ProgressiveDelay < 0 || p.MaxDelay < 0 {
+		return errors.New("delays must not be negative")
+	}
+	if p.MaxFailedAttemptsPerIP > 0 && p.IPWindow <= 0 {
+		return errors.New("ip_window must be positive")
+	}
+	return nil
+}
+
+func (p LockoutPolicy) checkLockout(lockout models.Lockout, now time.Time) error {
+	if lockout.Locked {
+		return &LockoutError{Err: ErrAccountLocked}
+	}
+	if lockedUntil := time.Unix(lockout.LockedUntil, 0); lockout.LockedUntil > 0 && now.Before(lockedUntil) {
+		return &LockoutError{Err: ErrAccountLocked, RetryAfter: lockedUntil}
+	}
+	if delay := p.delay(p.failedAttempts(lockout, now)); delay > 0 {
+		if next := time.Unix(lockout.LastFailedAt, 0).Add(delay); now.Before(next) {
+			return &LockoutError{Err: ErrTooManyAttempts, RetryAfter: next}
+		}
+	}
+	return nil
+}
+
+// checkAttempt is checked after the attempt was counted as failed, so of attempts made at the same
+// time only as many as the policy allows get past it.
+func (p LockoutPolicy) checkAttempt(lockout models.Lockout, now time.Time) error {
+	if locked, until := IsLocked(lockout, now); locked {
+		return &LockoutError{Err: ErrAccountLocked, RetryAfter: until}
+	}
+	if p.MaxFailedAttempts > 0 && lockout.FailedAttempts > p.MaxFailedAttempts {
+		return &LockoutError{Err: ErrTooManyAttempts, RetryAfter: now.Add(p.LockoutDuration)}
+	}
+	return nil
+}
+
+func (p LockoutPolicy) lock(lockout models.Lockout, now time.Time) (models.Lockout, bool) {
+	if p.MaxFailedAttempts == 0 || lockout.FailedAttempts < p.MaxFailedAttempts {
+		return lockout, false
+	}
+	lockout.FailedAttempts = 0
+	lockout.Lockouts++
+	if p.MaxLockouts > 0 && lockout.Lockouts >= p.MaxLockouts {
+		lockout.Locked = true
+	} else {
+		lockout.LockedUntil = now.Add(p.LockoutDuration).Unix()
+	}
+	return lockout, true
+}
+
+func (p LockoutPolicy) forgetBefore(now time.Time) time.Time {
+	if p.LockoutDuration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-p.LockoutDuration)
+}
+
+func (p LockoutPolicy) failedAttempts(lockout models.Lockout, now time.Time) int {
+	if lockout.LastFailedAt < p.forgetBefore(now).Unix() {
+		return 0
+	}
+	return lockout.FailedAttempts
+}
+
+func (p LockoutPolicy) delay(failedAttempts int) time.Duration {
+	if failedAttempts == 0 || p.ProgressiveDelay <= 0 {
+		return 0
+	}
+	delay := p.ProgressiveDelay
+	for i := 1; i < failedAttempts && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// IsLocked reports whether the account is locked and until when, zero until an administrator unlocks it.
+func IsLocked(lockout models.Lockout, now time.Time) (bool, time.Time) {
+	if lockout.Locked {
+		return true, time.Time{}
+	}
+	if lockedUntil := time.Unix(lockout.LockedUntil, 0); lockout.LockedUntil > 0 && now.Before(lockedUntil) {
+		return true, lockedUntil
+	}
+	return false, time.Time{}
+}
+
+type LockoutPolicyRepository interface {
+	GetLockoutPolicy(ctx context.Context, orgId string) (LockoutPolicy, bool, error)
+	SaveLockoutPolicy(ctx context.Context, policy LockoutPolicy) error
+}
+
+type lockoutPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewLockoutPolicyRepository(db *sqlx.DB) LockoutPolicyRepository {
+	return &lockoutPolicyRepository{
+		db: db,
+	}
+}
+
+type lockoutPolicyRow struct {
+	OrganizationId         string `db:"organization_id"`
+	MaxFailedAttempts      int    `db:"max_failed_attempts"`
+	LockoutDuration        int64  `db:"lockout_duration"`
+	MaxLockouts            int    `db:"max_lockouts"`
+	ProgressiveDelay       int64  `db:"progressive_delay"`
+	MaxDelay               int64  `db:"max_delay"`
+	MaxFailedAttemptsPerIP int    `db:"max_failed_attempts_per_ip"`
+	IPWindow               int64  `db:"ip_window"`
+}
+
+func (r *lockoutPolicyRepository) GetLockoutPolicy(ctx context.Context, orgId string) (LockoutPolicy, bool, error) {
+	var row lockoutPolicyRow
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, max_failed_attempts, lockout_duration, max_lockouts, progressive_delay, max_delay, max_failed_attempts_per_ip, ip_window FROM lockout_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return LockoutPolicy{}, false, nil
+		}
+		return LockoutPolicy{}, false, err
+	}
+	return LockoutPolicy{
+		OrganizationId:         row.OrganizationId,
+		MaxFailedAttempts:      row.MaxFailedAttempts,
+		LockoutDuration:        time.Duration(row.LockoutDuration) * time.Second,
+		MaxLockouts:            row.MaxLockouts,
+		ProgressiveDelay:       time.Duration(row.ProgressiveDelay) * time.Second,
+		MaxDelay:               time.Duration(row.MaxDelay) * time.Second,
+		MaxFailedAttemptsPerIP: row.MaxFailedAttemptsPerIP,
+		IPWindow:               time.Duration(row.IPWindow) * time.Second,
+	}, true, nil
+}
+
+func (r *lockoutPolicyRepository) SaveLockoutPolicy(ctx context.Context, policy LockoutPolicy) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO lockout_policy (organization_id, max_failed_attempts, lockout_duration, max_lockouts, progressive_delay, max_delay, max_failed_attempts_per_ip, ip_window) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (organization_id) DO UPDATE SET max_failed_attempts = excluded.max_failed_attempts, lockout_duration = excluded.lockout_duration, max_lockouts = excluded.max_lockouts, progressive_delay = excluded.progressive_delay, max_delay = excluded.max_delay, max_failed_attempts_per_ip = excluded.max_failed_attempts_per_ip, ip_window = excluded.ip_window",
+		policy.OrganizationId, policy.MaxFailedAttempts, int64(policy.LockoutDuration/time.Second), policy.MaxLockouts, int64(policy.ProgressiveDelay/time.Second),
+		int64(policy.MaxDelay/time.Second), policy.MaxFailedAttemptsPerIP, int64(policy.IPWindow/time.Second))
+	return err
+}
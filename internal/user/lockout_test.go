@@ -0,0 +1,78 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+// fail returns the state of the user after a failed attempt, as AuthenticateUser leaves it.
+func fail(policy LockoutPolicy, lockout models.Lockout, now time.Time) models.Lockout {
+	lockout.FailedAttempts = policy.failedAttempts(lockout, now) + 1
+	lockout.LastFailedAt = now.Unix()
+	lockout, _ = policy.lock(lockout, now)
+	return lockout
+}
+
+func TestLockout(t *testing.T) {
+	policy := LockoutPolicy{
+		MaxFailedAttempts: 3,
+		LockoutDuration:   15 * time.Minute,
+		MaxLockouts:       2,
+		ProgressiveDelay:  time.Second,
+		MaxDelay:          3 * time.Second,
+	}
+	now := time.Unix(1700000000, 0)
+	var lockout models.Lockout
+
+	lockout = fail(policy, lockout, now)
+	if err := policy.checkLockout(lockout, now); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected an attempt right after a failed one to wait, got %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := policy.checkLockout(lockout, now); err != nil {
+		t.Errorf("Expected an attempt after the delay to be accepted, got %v", err)
+	}
+	lockout = fail(policy, lockout, now)
+	if err := policy.checkLockout(lockout, now.Add(time.Second)); err == nil {
+		t.Error("Expected the delay to double after the second failed attempt")
+	}
+
+	now = now.Add(2 * time.Second)
+	lockout = fail(policy, lockout, now)
+	err := policy.checkLockout(lockout, now.Add(time.Hour/4-time.Second))
+	var lockoutErr *LockoutError
+	if !errors.As(err, &lockoutErr) || !errors.Is(err, ErrAccountLocked) || !lockoutErr.RetryAfter.Equal(now.Add(15*time.Minute)) {
+		t.Fatalf("Expected the account to be locked for 15 minutes, got %v", err)
+	}
+	now = now.Add(15 * time.Minute)
+	if err := policy.checkLockout(lockout, now); err != nil {
+		t.Errorf("Expected the lockout to end, got %v", err)
+	}
+
+	for range 3 {
+		now = now.Add(5 * time.Second)
+		lockout = fail(policy, lockout, now)
+	}
+	if locked, until := IsLocked(lockout, now.Add(24*time.Hour)); !locked || !until.IsZero() {
+		t.Errorf("Expected the second lockout in a row to be permanent, got %v %v", locked, until)
+	}
+	if err := policy.checkLockout(lockout, now.Add(24*time.Hour)); !errors.As(err, &lockoutErr) || !lockoutErr.RetryAfter.IsZero() {
+		t.Errorf("Expected a permanent lockout error, got %v", err)
+	}
+}
+
+func TestLockoutForgetsOldAttempts(t *testing.T) {
+	policy := LockoutPolicy{MaxFailedAttempts: 2, LockoutDuration: time.Minute}
+	now := time.Unix(1700000000, 0)
+	lockout := fail(policy, models.Lockout{}, now)
+	lockout = fail(policy, lockout, now.Add(2*time.Minute))
+	if locked, _ := IsLocked(lockout, now.Add(2*time.Minute)); locked {
+		t.Error("Expected failed attempts older than the lockout duration not to count")
+	}
+	if lockout.FailedAttempts != 1 {
+		t.Errorf("Expected 1 failed attempt, got %d", lockout.FailedAttempts)
+	}
+}
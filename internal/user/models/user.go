@@ -1,11 +1,33 @@
 package models
 
 type User struct {
-	Id             string          `db:"id" json:"id"`
-	OrganizationId string          `db:"organization_id" json:"organization_id"`
-	Username       string          `db:"username" json:"username"`
-	Email          string          `db:"email" json:"email"`
-	PasswordHash   string          `db:"password_hash"`
-	Password       string          `json:"password"`
-	Attributes     []UserAttribute `json:"attributes"`
+	Id             string `db:"id" json:"id"`
+	OrganizationId string `db:"organization_id" json:"organization_id"`
+	Username       string `db:"username" json:"username"`
+	Email          string `db:"email" json:"email"`
+	// EmailVerified is set when the user proved they own the email address.
+	EmailVerified bool `db:"email_verified" json:"email_verified"`
+	// PhoneNumber is in E.164 format. It can receive codes once it is verified.
+	PhoneNumber         string `db:"phone_number" json:"phone_number"`
+	PhoneNumberVerified bool   `db:"phone_number_verified" json:"phone_number_verified"`
+	PasswordHash        string `db:"password_hash"`
+	Password            string `json:"password"`
+	// PasswordChangedAt is when the password was last set, and PasswordChangeRequired asks the user
+	// to change it at their next sign in.
+	PasswordChangedAt      int64           `db:"password_changed_at" json:"password_changed_at"`
+	PasswordChangeRequired bool            `db:"password_change_required" json:"password_change_required"`
+	Attributes             []UserAttribute `json:"attributes"`
+	Lockout
+}
+
+// Lockout is the state of the protection of the password of a user from guessing.
+type Lockout struct {
+	FailedAttempts int   `db:"failed_login_attempts" json:"failed_login_attempts"`
+	LastFailedAt   int64 `db:"last_failed_login_at" json:"last_failed_login_at"`
+	// LockedUntil is when a temporary lockout ends, and Lockouts the lockouts in a row since the
+	// last successful sign in.
+	LockedUntil int64 `db:"locked_until" json:"locked_until"`
+	Lockouts    int   `db:"lockout_count" json:"lockout_count"`
+	// Locked is set when the account is locked until an administrator unlocks it.
+	Locked bool `db:"locked" json:"locked"`
 }
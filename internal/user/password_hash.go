@@ -0,0 +1,401 @@
+package user
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The algorithms new passwords can be hashed with.
+const (
+	HashArgon2id = "argon2id"
+	HashScrypt   = "scrypt"
+	HashBcrypt   = "bcrypt"
+)
+
+const (
+	hashArgon2i        = "argon2i"
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+	// hashes are checked at every sign in, so the costs of imported ones are bounded
+	maxBcryptCost       = 14
+	maxArgon2Memory     = 1 << 18 // KiB
+	maxArgon2Iterations = 16
+	maxScryptMemory     = 1 << 28 // bytes
+	maxScryptP          = 16
+	maxPBKDF2Iterations = 10_000_000
+	maxHashKeyLength    = 128
+)
+
+var ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+
+// PasswordHasher hashes new passwords with the configured algorithm, and checks passwords against
+// hashes in any of these formats:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>   Argon2id, or Argon2i as $argon2i$
+//	$scrypt$ln=15,r=8,p=1$<salt>$<hash>            scrypt, with N as its base 2 logarithm
+//	$2b$10$...                                     bcrypt, also $2a$ and $2y$
+//	$pbkdf2-sha256$<iterations>$<salt>$<hash>      PBKDF2 as exported by passlib, also $pbkdf2$ (SHA-1) and $pbkdf2-sha512$
+//	pbkdf2_sha256$<iterations>$<salt>$<hash>       PBKDF2 as exported by Django, also pbkdf2_sha1
+//	{SSHA256}<hash><salt>                          salted SHA as exported by LDAP directories, also {SSHA}, {SSHA512}, and unsalted {SHA}, {SHA256} and {SHA512}
+//
+// Salts and hashes are base64, except Django salts.
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Hash
+	scrypt     scryptHash
+}
+
+// NewPasswordHasher returns a hasher with the configured algorithm, the parameters default to the
+// OWASP recommendations.
+func NewPasswordHasher(cfg *config.Config) (*PasswordHasher, error) {
+	hashingCfg := cfg.PasswordHashing
+	algorithm := cmp.Or(hashingCfg.Algorithm, HashArgon2id)
+	if algorithm != HashArgon2id && algorithm != HashScrypt && algorithm != HashBcrypt {
+		return nil, fmt.Errorf("unsupported password hashing algorithm: %s", algorithm)
+	}
+	bcryptCost := cmp.Or(hashingCfg.Bcrypt.Cost, bcrypt.DefaultCost)
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("password_hashing.bcrypt.cost has to be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	argon2Cfg := hashingCfg.Argon2id
+	memory, iterations, parallelism := cmp.Or(argon2Cfg.Memory, 19456), cmp.Or(argon2Cfg.Iterations, 2), cmp.Or(argon2Cfg.Parallelism, 1)
+	if !validArgon2Params(memory, iterations, parallelism) {
+		return nil, errors.New("password_hashing.argon2id has invalid parameters")
+	}
+	scryptCfg := hashingCfg.Scrypt
+	n, r, p := cmp.Or(scryptCfg.N, 32768), cmp.Or(scryptCfg.R, 8), cmp.Or(scryptCfg.P, 1)
+	if n < 2 || n&(n-1) != 0 || !validScryptParams(bits.TrailingZeros(uint(n)), r, p) {
+		return nil, errors.New("password_hashing.scrypt has invalid parameters, n has to be a power of two")
+	}
+	return &PasswordHasher{
+		algorithm:  algorithm,
+		bcryptCost: bcryptCost,
+		argon2:     argon2Hash{variant: HashArgon2id, memory: uint32(memory), iterations: uint32(iterations), parallelism: uint8(parallelism)},
+		scrypt:     scryptHash{costLog2: bits.TrailingZeros(uint(n)), r: r, p: p},
+	}, nil
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm == HashBcrypt {
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(passwordHash), err
+	}
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	if h.algorithm == HashScrypt {
+		passwordHash := h.scrypt
+		passwordHash.salt = salt
+		key, err := scrypt.Key([]byte(password), salt, 1<<passwordHash.costLog2, passwordHash.r, passwordHash.p, passwordKeyLength)
+		if err != nil {
+			return "", err
+		}
+		passwordHash.key = key
+		return passwordHash.String(), nil
+	}
+	passwordHash := h.argon2
+	passwordHash.salt = salt
+	passwordHash.key = argon2.IDKey([]byte(password), salt, passwordHash.iterations, passwordHash.memory, passwordHash.parallelism, passwordKeyLength)
+	return passwordHash.String(), nil
+}
+
+// Verify reports whether the password matches the hash.
+func (h *PasswordHasher) Verify(passwordHash, password string) (bool, error) {
+	parsed, err := parsePasswordHash(passwordHash)
+	if err != nil {
+		return false, err
+	}
+	return parsed.verify([]byte(password)), nil
+}
+
+// CheckHash returns ErrUnsupportedPasswordHash when the hash is not in a format Verify knows.
+func (h *PasswordHasher) CheckHash(passwordHash string) error {
+	_, err := parsePasswordHash(passwordHash)
+	return err
+}
+
+// NeedsRehash reports whether the hash is weaker than, or not made with, the configured algorithm.
+func (h *PasswordHasher) NeedsRehash(passwordHash string) bool {
+	parsed, err := parsePasswordHash(passwordHash)
+	if err != nil {
+		return true
+	}
+	switch parsed := parsed.(type) {
+	case bcryptHash:
+		return h.algorithm != HashBcrypt || parsed.cost < h.bcryptCost
+	case argon2Hash:
+		return h.algorithm != HashArgon2id || parsed.variant != HashArgon2id || parsed.memory < h.argon2.memory ||
+			parsed.iterations < h.argon2.iterations || parsed.parallelism < h.argon2.parallelism || len(parsed.key) < passwordKeyLength
+	case scryptHash:
+		return h.algorithm != HashScrypt || parsed.costLog2 < h.scrypt.costLog2 || parsed.r < h.scrypt.r ||
+			parsed.p < h.scrypt.p || len(parsed.key) < passwordKeyLength
+	}
+	return true
+}
+
+type passwordHash interface {
+	verify(password []byte) bool
+}
+
+type bcryptHash struct {
+	hash []byte
+	cost int
+}
+
+func (h bcryptHash) verify(password []byte) bool {
+	return bcrypt.CompareHashAndPassword(h.hash, password) == nil
+}
+
+type argon2Hash struct {
+	variant     string
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h argon2Hash) verify(password []byte) bool {
+	var key []byte
+	if h.variant == HashArgon2id {
+		key = argon2.IDKey(password, h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+	} else {
+		key = argon2.Key(password, h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+	}
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func (h argon2Hash) String() string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", h.variant, argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(h.salt), base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+type scryptHash struct {
+	costLog2 int
+	r        int
+	p        int
+	salt     []byte
+	key      []byte
+}
+
+func (h scryptHash) verify(password []byte) bool {
+	key, err := scrypt.Key(password, h.salt, 1<<h.costLog2, h.r, h.p, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func (h scryptHash) String() string {
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.costLog2, h.r, h.p,
+		base64.RawStdEncoding.EncodeToString(h.salt), base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+type pbkdf2Hash struct {
+	digest     func() hash.Hash
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func (h pbkdf2Hash) verify(password []byte) bool {
+	key := pbkdf2.Key(password, h.salt, h.iterations, len(h.key), h.digest)
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// shaHash is the digest of the password followed by the salt, which may be empty.
+type shaHash struct {
+	digest func() hash.Hash
+	salt   []byte
+	sum    []byte
+}
+
+func (h shaHash) verify(password []byte) bool {
+	digest := h.digest()
+	digest.Write(password)
+	digest.Write(h.salt)
+	return subtle.ConstantTimeCompare(digest.Sum(nil), h.sum) == 1
+}
+
+func parsePasswordHash(encoded string) (passwordHash, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$2"):
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil || cost > maxBcryptCost {
+			return nil, invalidPasswordHash("bcrypt")
+		}
+		return bcryptHash{hash: []byte(encoded), cost: cost}, nil
+	case strings.HasPrefix(encoded, "$argon2"):
+		return parseArgon2Hash(encoded)
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return parseScryptHash(encoded)
+	case strings.HasPrefix(encoded, "$pbkdf2"):
+		return parsePassLibPBKDF2Hash(encoded)
+	case strings.HasPrefix(encoded, "pbkdf2_"):
+		return parseDjangoPBKDF2Hash(encoded)
+	case strings.HasPrefix(encoded, "{"):
+		return parseLDAPHash(encoded)
+	}
+	return nil, ErrUnsupportedPasswordHash
+}
+
+func parseArgon2Hash(encoded string) (passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || (parts[1] != HashArgon2id && parts[1] != hashArgon2i) || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return nil, invalidPasswordHash("argon2")
+	}
+	params, ok := parseHashParams(parts[3], "m", "t", "p")
+	if !ok || !validArgon2Params(params[0], params[1], params[2]) {
+		return nil, invalidPasswordHash("argon2")
+	}
+	salt, key, ok := decodeSaltAndKey(parts[4], parts[5])
+	if !ok {
+		return nil, invalidPasswordHash("argon2")
+	}
+	return argon2Hash{variant: parts[1], memory: uint32(params[0]), iterations: uint32(params[1]), parallelism: uint8(params[2]), salt: salt, key: key}, nil
+}
+
+func parseScryptHash(encoded string) (passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return nil, invalidPasswordHash("scrypt")
+	}
+	params, ok := parseHashParams(parts[2], "ln", "r", "p")
+	if !ok || !validScryptParams(params[0], params[1], params[2]) {
+		return nil, invalidPasswordHash("scrypt")
+	}
+	salt, key, ok := decodeSaltAndKey(parts[3], parts[4])
+	if !ok {
+		return nil, invalidPasswordHash("scrypt")
+	}
+	return scryptHash{costLog2: params[0], r: params[1], p: params[2], salt: salt, key: key}, nil
+}
+
+func parsePassLibPBKDF2Hash(encoded string) (passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	digests := map[string]func() hash.Hash{"pbkdf2": sha1.New, "pbkdf2-sha256": sha256.New, "pbkdf2-sha512": sha512.New}
+	digest, found := digests[parts[1]]
+	iterations, err := strconv.Atoi(parts[2])
+	if !found || err != nil || iterations < 1 || iterations > maxPBKDF2Iterations {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	salt, key, ok := decodeSaltAndKey(parts[3], parts[4])
+	if !ok {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	return pbkdf2Hash{digest: digest, iterations: iterations, salt: salt, key: key}, nil
+}
+
+func parseDjangoPBKDF2Hash(encoded string) (passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[2] == "" {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	digests := map[string]func() hash.Hash{"pbkdf2_sha1": sha1.New, "pbkdf2_sha256": sha256.New}
+	digest, found := digests[parts[0]]
+	iterations, err := strconv.Atoi(parts[1])
+	if !found || err != nil || iterations < 1 || iterations > maxPBKDF2Iterations {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	key, err := decodeHashBase64(parts[3])
+	if err != nil || len(key) == 0 || len(key) > maxHashKeyLength {
+		return nil, invalidPasswordHash("PBKDF2")
+	}
+	return pbkdf2Hash{digest: digest, iterations: iterations, salt: []byte(parts[2]), key: key}, nil
+}
+
+var ldapSchemes = map[string]struct {
+	digest func() hash.Hash
+	salted bool
+}{
+	"SHA":     {sha1.New, false},
+	"SSHA":    {sha1.New, true},
+	"SHA256":  {sha256.New, false},
+	"SSHA256": {sha256.New, true},
+	"SHA512":  {sha512.New, false},
+	"SSHA512": {sha512.New, true},
+}
+
+func parseLDAPHash(encoded string) (passwordHash, error) {
+	name, value, found := strings.Cut(strings.TrimPrefix(encoded, "{"), "}")
+	scheme, supported := ldapSchemes[strings.ToUpper(name)]
+	if !found || !supported {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	decoded, err := decodeHashBase64(value)
+	size := scheme.digest().Size()
+	if err != nil || len(decoded) < size || (len(decoded) > size) != scheme.salted {
+		return nil, invalidPasswordHash(name)
+	}
+	return shaHash{digest: scheme.digest, sum: decoded[:size], salt: decoded[size:]}, nil
+}
+
+// parseHashParams parses parameters such as m=19456,t=2,p=1, in the order of names.
+func parseHashParams(params string, names ...string) ([]int, bool) {
+	fields := strings.Split(params, ",")
+	if len(fields) != len(names) {
+		return nil, false
+	}
+	values := make([]int, len(names))
+	for i, field := range fields {
+		name, value, found := strings.Cut(field, "=")
+		if !found || name != names[i] {
+			return nil, false
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		values[i] = n
+	}
+	return values, true
+}
+
+func validArgon2Params(memory, iterations, parallelism int) bool {
+	return parallelism >= 1 && parallelism <= 255 && memory >= 8*parallelism && memory <= maxArgon2Memory &&
+		iterations >= 1 && iterations <= maxArgon2Iterations
+}
+
+func validScryptParams(costLog2, r, p int) bool {
+	return costLog2 >= 1 && costLog2 < 32 && r >= 1 && p >= 1 && p <= maxScryptP && 128*r <= maxScryptMemory>>costLog2
+}
+
+func decodeSaltAndKey(encodedSalt, encodedKey string) ([]byte, []byte, bool) {
+	salt, err := decodeHashBase64(encodedSalt)
+	if err != nil || len(salt) == 0 {
+		return nil, nil, false
+	}
+	key, err := decodeHashBase64(encodedKey)
+	if err != nil || len(key) == 0 || len(key) > maxHashKeyLength {
+		return nil, nil, false
+	}
+	return salt, key, true
+}
+
+// decodeHashBase64 also accepts the base64 of passlib, which has . instead of +.
+func decodeHashBase64(value string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(strings.TrimRight(value, "="), ".", "+"))
+}
+
+func invalidPasswordHash(format string) error {
+	return fmt.Errorf("%w: invalid %s hash", ErrUnsupportedPasswordHash, format)
+}
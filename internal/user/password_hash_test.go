@@ -0,0 +1,117 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+func newTestPasswordHasher(t *testing.T, algorithm string) *PasswordHasher {
+	cfg := &config.Config{}
+	cfg.PasswordHashing.Algorithm = algorithm
+	cfg.PasswordHashing.Bcrypt.Cost = 4
+	cfg.PasswordHashing.Argon2id.Memory = 64
+	cfg.PasswordHashing.Argon2id.Iterations = 1
+	cfg.PasswordHashing.Scrypt.N = 16
+	hasher, err := NewPasswordHasher(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create password hasher: %v", err)
+	}
+	return hasher
+}
+
+func TestPasswordHasher(t *testing.T) {
+	for _, algorithm := range []string{HashArgon2id, HashScrypt, HashBcrypt} {
+		hasher := newTestPasswordHasher(t, algorithm)
+		passwordHash, err := hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("Failed to hash with %s: %v", algorithm, err)
+		}
+		if matched, err := hasher.Verify(passwordHash, "correct horse"); !matched || err != nil {
+			t.Errorf("Expected the %s hash %q to match, got %v", algorithm, passwordHash, err)
+		}
+		if matched, _ := hasher.Verify(passwordHash, "battery staple"); matched {
+			t.Errorf("Expected the %s hash not to match another password", algorithm)
+		}
+		if hasher.NeedsRehash(passwordHash) {
+			t.Errorf("Expected the %s hash %q not to need a rehash", algorithm, passwordHash)
+		}
+	}
+	cfg := &config.Config{}
+	cfg.PasswordHashing.Algorithm = "md5"
+	if _, err := NewPasswordHasher(cfg); err == nil {
+		t.Errorf("Expected an unknown algorithm to be rejected")
+	}
+	cfg.PasswordHashing.Algorithm = HashScrypt
+	cfg.PasswordHashing.Scrypt.N = 1000
+	if _, err := NewPasswordHasher(cfg); err == nil {
+		t.Errorf("Expected an n that is not a power of two to be rejected")
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	hasher := newTestPasswordHasher(t, HashArgon2id)
+	bcryptHash, _ := newTestPasswordHasher(t, HashBcrypt).Hash("correct horse")
+	tests := []struct {
+		passwordHash string
+		rehash       bool
+	}{
+		{"$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY", false},
+		{"$argon2id$v=19$m=32,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY", true},
+		{"$argon2id$v=19$m=128,t=3,p=2$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY", false},
+		{"$argon2i$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY", true},
+		{"$scrypt$ln=4,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$OAkZqUBelG6VIYdTJfYSENL5OmZRxMa3GwXn5oFliTg", true},
+		{bcryptHash, true},
+		{"{SSHA}LhKrkM9Fy+zlstjdD7Kv2s6QvhBzYWx0", true},
+	}
+	for _, test := range tests {
+		if rehash := hasher.NeedsRehash(test.passwordHash); rehash != test.rehash {
+			t.Errorf("Expected %q to need a rehash: %t, got %t", test.passwordHash, test.rehash, rehash)
+		}
+	}
+}
+
+func TestPasswordHasherImportedFormats(t *testing.T) {
+	hasher := newTestPasswordHasher(t, HashArgon2id)
+	// made with Python's hashlib
+	passwordHashes := []string{
+		"$scrypt$ln=4,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$OAkZqUBelG6VIYdTJfYSENL5OmZRxMa3GwXn5oFliTg",
+		"$pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$cBg8D2DungRB9k76szThf5ehfyBz991ay6PT8Srwk4M",
+		"$pbkdf2-sha512$1000$MDEyMzQ1Njc4OWFiY2RlZg$OM0FAoIqCVK1sWtxDiffVlBejtLa.ks4TP71JiecwuSZCG8iLbnlIEPOMoVX.i2B2wkSxjQ8CRGR9OkNGuIPMQ",
+		"pbkdf2_sha256$1000$seasalt$mQnueSakb748zqBAC1tmWVZsZbi2zPGZarEzTGdfmso=",
+		"{SSHA}LhKrkM9Fy+zlstjdD7Kv2s6QvhBzYWx0",
+		"{SSHA512}foa0o5b0ZNtnD4d7mkHNhvOYnvv07lgQLIiqhLd1FEa5XsTVUbPtF47ABIGbnQq2Ah1uFh4t800l1g7N4YIQh3NhbHQxMjM0",
+		"{SHA256}QQTTb42iwlQ0n4WDZ5Pr4CngyVcGOjTJHC6SAxh7VjE=",
+	}
+	for _, passwordHash := range passwordHashes {
+		if matched, err := hasher.Verify(passwordHash, "correct horse"); !matched || err != nil {
+			t.Errorf("Expected %q to match, got %v", passwordHash, err)
+		}
+		if matched, _ := hasher.Verify(passwordHash, "correct horsE"); matched {
+			t.Errorf("Expected %q not to match another password", passwordHash)
+		}
+	}
+	invalidHashes := []string{
+		"",
+		"correct horse",
+		"{MD5}1B2M2Y8AsgTpgAmY7PhCfg==",
+		"{SSHA}" + strings.Repeat("A", 27),
+		"$argon2id$v=16$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$argon2id$v=19$m=4194304,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$argon2id$v=19$t=1,m=64,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$scrypt$ln=30,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$scrypt$ln=20,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$argon2id$v=19$m=524288,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$argon2id$v=19$m=64,t=32,p=1$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"$2a$15$" + strings.Repeat("a", 53),
+		"$pbkdf2-md5$1000$MDEyMzQ1Njc4OWFiY2RlZg$c2FtZQ",
+		"pbkdf2_sha256$0$seasalt$c2FtZQ==",
+	}
+	for _, passwordHash := range invalidHashes {
+		if err := hasher.CheckHash(passwordHash); !errors.Is(err, ErrUnsupportedPasswordHash) {
+			t.Errorf("Expected %q to be unsupported, got %v", passwordHash, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+const (
+	// bcrypt only uses the first 72 bytes of a password, the limit holds for every algorithm so
+	// passwords can be hashed again with bcrypt
+	maxPasswordLength = 72
+	// MaxPasswordHistory is the most passwords of a user that are remembered to prevent reuse.
+	MaxPasswordHistory = 24
+)
+
+// What happens when a user signs in with a breached password.
+const (
+	BreachedLoginOff   = "off"
+	BreachedLoginWarn  = "warn"
+	BreachedLoginReset = "reset"
+)
+
+// The reasons a user has to, or should, change the password they signed in with.
+const (
+	PasswordExpired         = "expired"
+	PasswordBreached        = "breached"
+	PasswordBreachedWarning = "breached_warning"
+)
+
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+// PasswordPolicyError lists the rules of the password policy a password breaks.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrPasswordPolicy
+}
+
+// PasswordPolicy controls the passwords the users of an organization can choose.
+type PasswordPolicy struct {
+	OrganizationId string
+	MinLength      int
+	// The password must contain at least one character of every required class.
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// BannedWords can't be part of a password, ignoring case. The username and the email address
+	// of the user are always banned, unless they are shorter than three characters.
+	BannedWords []string
+	// HistoryCount is how many of the last passwords of a user, including the current one, can't be
+	// chosen again. The current password can never be chosen again.
+	HistoryCount int
+	// MaxAge is how long a password can be used before the user has to change it at their next
+	// sign in. Zero never expires passwords.
+	MaxAge time.Duration
+	// RejectBreached rejects new passwords found in the breached password corpus.
+	RejectBreached bool
+	// BreachedLoginAction is what happens when a user signs in with a breached password: nothing,
+	// a warning asking them to change it, or a change they can't skip.
+	BreachedLoginAction string
+}
+
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 0 || p.MinLength > maxPasswordLength {
+		return fmt.Errorf("min_length must be between 0 and %d", maxPasswordLength)
+	}
+	for _, word := range p.BannedWords {
+		if strings.TrimSpace(word) == "" {
+			return errors.New("banned words must not be empty")
+		}
+	}
+	if p.HistoryCount < 0 || p.HistoryCount > MaxPasswordHistory {
+		return fmt.Errorf("history_count must be between 0 and %d", MaxPasswordHistory)
+	}
+	if p.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	switch p.BreachedLoginAction {
+	case BreachedLoginOff, BreachedLoginWarn, BreachedLoginReset:
+	default:
+		return fmt.Errorf("breached_login_action must be %s, %s or %s", BreachedLoginOff, BreachedLoginWarn, BreachedLoginReset)
+	}
+	return nil
+}
+
+// checkPassword returns a PasswordPolicyError when the password of the user breaks a rule of the
+// policy. Reuse of earlier passwords is checked separately.
+func (p PasswordPolicy) checkPassword(password string, user models.User) error {
+	var violations []string
+	if len(password) == 0 || len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", max(p.MinLength, 1)))
+	}
+	if len(password) > maxPasswordLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", maxPasswordLength))
+	}
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+	bannedWords := p.BannedWords
+	emailName, _, _ := strings.Cut(user.Email, "@")
+	for _, word := range []string{user.Username, emailName} {
+		if len([]rune(word)) >= 3 {
+			bannedWords = append(bannedWords, word)
+		}
+	}
+	lowerPassword := strings.ToLower(password)
+	for _, word := range bannedWords {
+		if strings.Contains(lowerPassword, strings.ToLower(word)) {
+			violations = append(violations, "must not contain your username, your email address or a banned word")
+			break
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// isPasswordExpired reports whether the user has to change their password before they can sign in.
+func (p PasswordPolicy) isPasswordExpired(user models.User, now time.Time) bool {
+	if user.PasswordChangeRequired {
+		return true
+	}
+	// users whose password was set before passwords had an age are not forced to change it
+	if p.MaxAge == 0 || user.PasswordChangedAt == 0 {
+		return false
+	}
+	return now.After(time.Unix(user.PasswordChangedAt, 0).Add(p.MaxAge))
+}
+
+type PasswordPolicyRepository interface {
+	GetPasswordPolicy(ctx context.Context, orgId string) (PasswordPolicy, bool, error)
+	SavePasswordPolicy(ctx context.Context, policy PasswordPolicy) error
+}
+
+type passwordPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewPasswordPolicyRepository(db *sqlx.DB) PasswordPolicyRepository {
+	return &passwordPolicyRepository{
+		db: db,
+	}
+}
+
+type passwordPolicyRow struct {
+	OrganizationId      string         `db:"organization_id"`
+	MinLength           int            `db:"min_length"`
+	RequireUppercase    bool           `db:"require_uppercase"`
+	RequireLowercase    bool           `db:"require_lowercase"`
+	RequireDigit        bool           `db:"require_digit"`
+	RequireSymbol       bool           `db:"require_symbol"`
+	BannedWords         sql.NullString `db:"banned_words"`
+	HistoryCount        int            `db:"history_count"`
+	MaxAge              int64          `db:"max_age"`
+	RejectBreached      bool           `db:"reject_breached"`
+	BreachedLoginAction string         `db:"breached_login_action"`
+}
+
+func (r *passwordPolicyRepository) GetPasswordPolicy(ctx context.Context, orgId string) (PasswordPolicy, bool, error) {
+	var row passwordPolicyRow
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, min_length, require_uppercase, require_lowercase, require_digit, require_symbol, banned_words, history_count, max_age, reject_breached, breached_login_action FROM password_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PasswordPolicy{}, false, nil
+		}
+		return PasswordPolicy{}, false, err
+	}
+	policy := PasswordPolicy{
+		OrganizationId:      row.OrganizationId,
+		MinLength:           row.MinLength,
+		RequireUppercase:    row.RequireUppercase,
+		RequireLowercase:    row.RequireLowercase,
+		RequireDigit:        row.RequireDigit,
+		RequireSymbol:       row.RequireSymbol,
+		HistoryCount:        row.HistoryCount,
+		MaxAge:              time.Duration(row.MaxAge) * time.Second,
+		RejectBreached:      row.RejectBreached,
+		BreachedLoginAction: row.BreachedLoginAction,
+	}
+	if row.BannedWords.Valid && row.BannedWords.String != "" {
+		if err := json.Unmarshal([]byte(row.BannedWords.String), &policy.BannedWords); err != nil {
+			return PasswordPolicy{}, false, err
+		}
+	}
+	return policy, true, nil
+}
+
+func (r *passwordPolicyRepository) SavePasswordPolicy(ctx context.Context, policy PasswordPolicy) error {
+	bannedWordsJSON, err := json.Marshal(policy.BannedWords)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO password_policy (organization_id, min_length, require_uppercase, require_lowercase, require_digit, require_symbol, banned_words, history_count, max_age, reject_breached, breached_login_action) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (organization_id) DO UPDATE SET min_length = excluded.min_length, require_uppercase = excluded.require_uppercase, require_lowercase = excluded.require_lowercase, require_digit = excluded.require_digit, require_symbol = excluded.require_symbol, banned_words = excluded.banned_words, history_count = excluded.history_count, max_age = excluded.max_age, reject_breached = excluded.reject_breached, breached_login_action = excluded.breached_login_action",
+		policy.OrganizationId, policy.MinLength, policy.RequireUppercase, policy.RequireLowercase, policy.RequireDigit, policy.RequireSymbol,
+		string(bannedWordsJSON), policy.HistoryCount, int64(policy.MaxAge/time.Second), policy.RejectBreached, policy.BreachedLoginAction)
+	return err
+}
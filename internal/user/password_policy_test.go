@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+func TestCheckPassword(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:        10,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		BannedWords:      []string{"Tiny"},
+	}
+	user := models.User{Username: "alice", Email: "alice.smith@example.com"}
+	if err := policy.checkPassword("Correct-horse-9", user); err != nil {
+		t.Errorf("Expected the password to meet the policy, got %v", err)
+	}
+	tests := []struct {
+		password   string
+		violations []string
+	}{
+		{"", []string{"must be at least 10 characters long", "must contain an uppercase letter", "must contain a digit", "must contain a symbol"}},
+		{"correct-horse-9", []string{"must contain an uppercase letter"}},
+		{"Correct-horse", []string{"must contain a digit"}},
+		{"Correct-tinyhorse-9", []string{"must not contain your username, your email address or a banned word"}},
+		{"Correct-ALICE-9", []string{"must not contain your username, your email address or a banned word"}},
+		{"Alice.Smith-9", []string{"must not contain your username, your email address or a banned word"}},
+	}
+	for _, test := range tests {
+		err := policy.checkPassword(test.password, user)
+		var policyErr *PasswordPolicyError
+		if !errors.As(err, &policyErr) || !errors.Is(err, ErrPasswordPolicy) {
+			t.Errorf("Expected %q to break the policy, got %v", test.password, err)
+			continue
+		}
+		if !slices.Equal(policyErr.Violations, test.violations) {
+			t.Errorf("Expected %q to break %v, got %v", test.password, test.violations, policyErr.Violations)
+		}
+	}
+	// usernames shorter than three characters would ban too many passwords
+	if err := (PasswordPolicy{}).checkPassword("alright", models.User{Username: "al"}); err != nil {
+		t.Errorf("Expected a short username not to be banned, got %v", err)
+	}
+}
+
+func TestIsPasswordExpired(t *testing.T) {
+	policy := PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	changedAt := time.Unix(1700000000, 0)
+	user := models.User{PasswordChangedAt: changedAt.Unix()}
+	if policy.isPasswordExpired(user, changedAt.Add(89*24*time.Hour)) {
+		t.Error("Expected the password not to expire before the maximum age")
+	}
+	if !policy.isPasswordExpired(user, changedAt.Add(91*24*time.Hour)) {
+		t.Error("Expected the password to expire after the maximum age")
+	}
+	if (PasswordPolicy{}).isPasswordExpired(user, changedAt.Add(365*24*time.Hour)) {
+		t.Error("Expected passwords not to expire without a maximum age")
+	}
+	user.PasswordChangeRequired = true
+	if !(PasswordPolicy{}).isPasswordExpired(user, changedAt) {
+		t.Error("Expected a required change to expire the password")
+	}
+}
+
+func TestPasswordPolicyRejectsBreachedByDefault(t *testing.T) {
+	db := testutil.NewDB(t, "user.sql")
+	if _, err := db.Exec("INSERT INTO password_policy (organization_id, min_length) VALUES ('test-organization-id', 8)"); err != nil {
+		t.Fatalf("Failed to insert password policy: %v", err)
+	}
+	policy, found, err := NewPasswordPolicyRepository(db).GetPasswordPolicy(context.Background(), "test-organization-id")
+	if err != nil || !found {
+		t.Fatalf("Failed to get password policy: %v %v", found, err)
+	}
+	if !policy.RejectBreached {
+		t.Error("Expected a policy saved without the setting to reject breached passwords")
+	}
+}
@@ -0,0 +1,27 @@
+package user
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPhoneNumber = errors.New("phone number must be in E.164 format, such as +14155552671")
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizePhoneNumber returns the phone number in E.164 format, dropping the separators people
+// commonly type, such as spaces and dashes.
+func NormalizePhoneNumber(phoneNumber string) (string, error) {
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, phoneNumber)
+	if !e164.MatchString(normalized) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return normalized, nil
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	for input, expected := range map[string]string{
+		"+14155552671":      "+14155552671",
+		"+1 (415) 555-2671": "+14155552671",
+		"+94 77 123 4567":   "+94771234567",
+	} {
+		normalized, err := NormalizePhoneNumber(input)
+		if err != nil || normalized != expected {
+			t.Errorf("Expected %s for %q, got %s %v", expected, input, normalized, err)
+		}
+	}
+	for _, input := range []string{"", "4155552671", "+04155552671", "+1415555267123456", "+1415555abcd"} {
+		if _, err := NormalizePhoneNumber(input); !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("Expected %q to be rejected, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUnknownAttribute = errors.New("attribute is not defined for the organization")
+
+// RegistrationPolicy controls whether people can sign up to an organization from the login page.
+type RegistrationPolicy struct {
+	OrganizationId string
+	Enabled        bool
+	// RequiredAttributes are the names of attributes of the organization people fill in to sign up.
+	RequiredAttributes []string
+	// RequireChallenge asks people to pass a challenge, such as a proof of work or a CAPTCHA, to
+	// sign up, so accounts can't be created by bots in bulk.
+	RequireChallenge bool
+}
+
+func (p RegistrationPolicy) Validate() error {
+	for i, name := range p.RequiredAttributes {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("required attributes must not be empty")
+		}
+		if slices.Contains(p.RequiredAttributes[:i], name) {
+			return errors.New("required attributes must not repeat")
+		}
+	}
+	return nil
+}
+
+type RegistrationPolicyRepository interface {
+	GetRegistrationPolicy(ctx context.Context, orgId string) (RegistrationPolicy, bool, error)
+	SaveRegistrationPolicy(ctx context.Context, policy RegistrationPolicy) error
+}
+
+type registrationPolicyRepository struct {
+	db *sqlx.DB
+}
+
+func NewRegistrationPolicyRepository(db *sqlx.DB) RegistrationPolicyRepository {
+	return &registrationPolicyRepository{
+		db: db,
+	}
+}
+
+type registrationPolicyRow struct {
+	OrganizationId     string         `db:"organization_id"`
+	Enabled            bool           `db:"enabled"`
+	RequiredAttributes sql.NullString `db:"required_attributes"`
+	RequireChallenge   bool           `db:"require_challenge"`
+}
+
+func (r *registrationPolicyRepository) GetRegistrationPolicy(ctx context.Context, orgId string) (RegistrationPolicy, bool, error) {
+	var row registrationPolicyRow
+	err := r.db.GetContext(ctx, &row, "SELECT organization_id, enabled, required_attributes, require_challenge FROM registration_policy WHERE organization_id = ?", orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RegistrationPolicy{}, false, nil
+		}
+		return RegistrationPolicy{}, false, err
+	}
+	policy := RegistrationPolicy{
+		OrganizationId:   row.OrganizationId,
+		Enabled:          row.Enabled,
+		RequireChallenge: row.RequireChallenge,
+	}
+	if row.RequiredAttributes.Valid && row.RequiredAttributes.String != "" {
+		if err := json.Unmarshal([]byte(row.RequiredAttributes.String), &policy.RequiredAttributes); err != nil {
+			return RegistrationPolicy{}, false, err
+		}
+	}
+	return policy, true, nil
+}
+
+func (r *registrationPolicyRepository) SaveRegistrationPolicy(ctx context.Context, policy RegistrationPolicy) error {
+	requiredAttributesJSON, err := json.Marshal(policy.RequiredAttributes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO registration_policy (organization_id, enabled, required_attributes, require_challenge) VALUES (?, ?, ?, ?) ON CONFLICT (organization_id) DO UPDATE SET enabled = excluded.enabled, required_attributes = excluded.required_attributes, require_challenge = excluded.require_challenge",
+		policy.OrganizationId, policy.Enabled, string(requiredAttributesJSON), policy.RequireChallenge)
+	return err
+}
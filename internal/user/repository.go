@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/shashimalcse/tiny-is/internal/user/models"
@@ -11,8 +12,27 @@ type UserRepository interface {
 	GetUsers(ctx context.Context, orgId string) ([]models.User, error)
 	GetUserByID(ctx context.Context, id, orgId string) (models.User, error)
 	GetUserByUsername(ctx context.Context, username, orgId string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email, orgId string) (models.User, error)
+	// CreateUser creates the user with their attributes, and remembers their password in their
+	// password history.
 	CreateUser(ctx context.Context, User models.User) error
+	UpdatePhoneNumber(ctx context.Context, id, orgId, phoneNumber string, verified bool) (bool, error)
 	GetHashedPasswordByUsername(ctx context.Context, username, orgId string) (string, error)
+	UpdateLockout(ctx context.Context, id, orgId string, lockout models.Lockout) (bool, error)
+	// AddFailedLogin counts a failed attempt of the user at the time, after forgetting the attempts
+	// that failed before forgetBefore, and returns the lockout state of the user it left.
+	AddFailedLogin(ctx context.Context, id, orgId string, forgetBefore, now time.Time) (models.Lockout, error)
+	// LockUser replaces the lockout state of the user while they have failedAttempts or more failed
+	// attempts and the lockouts of current, so concurrent attempts lock the account once.
+	LockUser(ctx context.Context, id, orgId string, failedAttempts int, current, lockout models.Lockout) (bool, error)
+	GetHashedPasswordByID(ctx context.Context, id, orgId string) (string, error)
+	// UpdatePassword replaces the password of the user and remembers it in their password history.
+	UpdatePassword(ctx context.Context, id, orgId, passwordHash string, changedAt time.Time, changeRequired bool) (bool, error)
+	// UpdatePasswordHash replaces the hash of the current password with another hash of the same
+	// password, in the password history too. It does nothing when the password was changed since.
+	UpdatePasswordHash(ctx context.Context, id, orgId, currentHash, passwordHash string) (bool, error)
+	// GetPasswordHistory returns the hashes of the last passwords of the user, newest first.
+	GetPasswordHistory(ctx context.Context, id, orgId string, limit int) ([]string, error)
 	CreateAttribute(ctx context.Context, id, name, orgId string) error
 	GetAttributes(ctx context.Context, orgId string) ([]models.Attribute, error)
 	PatchAttributes(ctx context.Context, orgId string, addedAttributes []models.Attribute, removedAttributes []models.Attribute) error
@@ -33,7 +53,7 @@ func NewUserRepository(db *sqlx.DB) UserRepository {
 
 func (r *userRepository) GetUsers(ctx context.Context, orgId string) ([]models.User, error) {
 	var Users []models.User
-	err := r.db.Select(&Users, "SELECT id, organization_id, username, email FROM org_user WHERE organization_id=$1", orgId)
+	err := r.db.Select(&Users, "SELECT id, organization_id, username, email, email_verified, phone_number, phone_number_verified, password_changed_at, password_change_required, failed_login_attempts, last_failed_login_at, locked_until, lockout_count, locked FROM org_user WHERE organization_id=$1", orgId)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +62,7 @@ func (r *userRepository) GetUsers(ctx context.Context, orgId string) ([]models.U
 
 func (r *userRepository) GetUserByID(ctx context.Context, id, orgId string) (models.User, error) {
 	var User models.User
-	err := r.db.Get(&User, "SELECT id, organization_id, username, email FROM org_user WHERE id=$1 AND organization_id=$2", id, orgId)
+	err := r.db.Get(&User, "SELECT id, organization_id, username, email, email_verified, phone_number, phone_number_verified, password_changed_at, password_change_required, failed_login_attempts, last_failed_login_at, locked_until, lockout_count, locked FROM org_user WHERE id=$1 AND organization_id=$2", id, orgId)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -51,7 +71,16 @@ func (r *userRepository) GetUserByID(ctx context.Context, id, orgId string) (mod
 
 func (r *userRepository) GetUserByUsername(ctx context.Context, username, orgId string) (models.User, error) {
 	var User models.User
-	err := r.db.Get(&User, "SELECT id, organization_id, username, email FROM org_user WHERE username=$1 AND organization_id=$2", username, orgId)
+	err := r.db.Get(&User, "SELECT id, organization_id, username, email, email_verified, phone_number, phone_number_verified, password_changed_at, password_change_required, failed_login_attempts, last_failed_login_at, locked_until, lockout_count, locked FROM org_user WHERE username=$1 AND organization_id=$2", username, orgId)
+	if err != nil {
+		return models.User{}, err
+	}
+	return User, nil
+}
+
+func (r *userRepository) GetUserByEmail(ctx context.Context, email, orgId string) (models.User, error) {
+	var User models.User
+	err := r.db.Get(&User, "SELECT id, organization_id, username, email, email_verified, phone_number, phone_number_verified, password_changed_at, password_change_required, failed_login_attempts, last_failed_login_at, locked_until, lockout_count, locked FROM org_user WHERE email=$1 COLLATE NOCASE AND organization_id=$2", email, orgId)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -59,11 +88,38 @@ func (r *userRepository) GetUserByUsername(ctx context.Context, username, orgId
 }
 
 func (r *userRepository) CreateUser(ctx context.Context, User models.User) error {
-	_, err := r.db.Exec("INSERT INTO org_user (id, organization_id, username, email, password_hash) VALUES ($1, $2, $3, $4, $5)", User.Id, User.OrganizationId, User.Username, User.Email, User.PasswordHash)
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO org_user (id, organization_id, username, email, email_verified, phone_number, phone_number_verified, password_hash, password_changed_at, password_change_required) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		User.Id, User.OrganizationId, User.Username, User.Email, User.EmailVerified, User.PhoneNumber, User.PhoneNumberVerified, User.PasswordHash, User.PasswordChangedAt, User.PasswordChangeRequired)
+	if err != nil {
+		return err
+	}
+	for _, attribute := range User.Attributes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_attribute (user_id, attribute_id, value) VALUES ($1, $2, $3)", User.Id, attribute.ID, attribute.Value)
+		if err != nil {
+			return err
+		}
+	}
+	if err := addPasswordHistory(ctx, tx, User.Id, User.OrganizationId, User.PasswordHash, time.Unix(User.PasswordChangedAt, 0)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *userRepository) UpdatePhoneNumber(ctx context.Context, id, orgId, phoneNumber string, verified bool) (bool, error) {
+	result, err := r.db.Exec("UPDATE org_user SET phone_number=$1, phone_number_verified=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$3 AND organization_id=$4", phoneNumber, verified, id, orgId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
 }
 
 func (r *userRepository) GetHashedPasswordByUsername(ctx context.Context, username, orgId string) (string, error) {
@@ -75,6 +131,110 @@ func (r *userRepository) GetHashedPasswordByUsername(ctx context.Context, userna
 	return password, nil
 }
 
+func (r *userRepository) UpdateLockout(ctx context.Context, id, orgId string, lockout models.Lockout) (bool, error) {
+	result, err := r.db.Exec("UPDATE org_user SET failed_login_attempts=$1, last_failed_login_at=$2, locked_until=$3, lockout_count=$4, locked=$5 WHERE id=$6 AND organization_id=$7",
+		lockout.FailedAttempts, lockout.LastFailedAt, lockout.LockedUntil, lockout.Lockouts, lockout.Locked, id, orgId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *userRepository) AddFailedLogin(ctx context.Context, id, orgId string, forgetBefore, now time.Time) (models.Lockout, error) {
+	var lockout models.Lockout
+	err := r.db.GetContext(ctx, &lockout, "UPDATE org_user SET failed_login_attempts = CASE WHEN last_failed_login_at < $1 THEN 1 ELSE failed_login_attempts + 1 END, last_failed_login_at=$2 WHERE id=$3 AND organization_id=$4 RETURNING failed_login_attempts, last_failed_login_at, locked_until, lockout_count, locked",
+		forgetBefore.Unix(), now.Unix(), id, orgId)
+	return lockout, err
+}
+
+func (r *userRepository) LockUser(ctx context.Context, id, orgId string, failedAttempts int, current, lockout models.Lockout) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE org_user SET failed_login_attempts=$1, locked_until=$2, lockout_count=$3, locked=$4 WHERE id=$5 AND organization_id=$6 AND failed_login_attempts >= $7 AND lockout_count=$8",
+		lockout.FailedAttempts, lockout.LockedUntil, lockout.Lockouts, lockout.Locked, id, orgId, failedAttempts, current.Lockouts)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *userRepository) GetHashedPasswordByID(ctx context.Context, id, orgId string) (string, error) {
+	var password string
+	err := r.db.Get(&password, "SELECT password_hash FROM org_user WHERE id=$1 AND organization_id=$2", id, orgId)
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id, orgId, passwordHash string, changedAt time.Time, changeRequired bool) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE org_user SET password_hash=$1, password_changed_at=$2, password_change_required=$3, updated_at=CURRENT_TIMESTAMP WHERE id=$4 AND organization_id=$5",
+		passwordHash, changedAt.Unix(), changeRequired, id, orgId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	if err := addPasswordHistory(ctx, tx, id, orgId, passwordHash, changedAt); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, id, orgId, currentHash, passwordHash string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE org_user SET password_hash=$1 WHERE id=$2 AND organization_id=$3 AND password_hash=$4", passwordHash, id, orgId, currentHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE password_history SET password_hash=$1 WHERE user_id=$2 AND organization_id=$3 AND password_hash=$4", passwordHash, id, orgId, currentHash)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// addPasswordHistory remembers the password, forgetting the ones no policy can ask about anymore.
+func addPasswordHistory(ctx context.Context, tx *sqlx.Tx, id, orgId, passwordHash string, createdAt time.Time) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO password_history (user_id, organization_id, password_hash, created_at) VALUES ($1, $2, $3, $4)", id, orgId, passwordHash, createdAt.Unix())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM password_history WHERE user_id=$1 AND organization_id=$2 AND rowid NOT IN (SELECT rowid FROM password_history WHERE user_id=$1 AND organization_id=$2 ORDER BY created_at DESC, rowid DESC LIMIT $3)",
+		id, orgId, MaxPasswordHistory)
+	return err
+}
+
+func (r *userRepository) GetPasswordHistory(ctx context.Context, id, orgId string, limit int) ([]string, error) {
+	var passwordHashes []string
+	err := r.db.SelectContext(ctx, &passwordHashes, "SELECT password_hash FROM password_history WHERE user_id=$1 AND organization_id=$2 ORDER BY created_at DESC, rowid DESC LIMIT $3", id, orgId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return passwordHashes, nil
+}
+
 // Attributes
 
 func (r *userRepository) CreateAttribute(ctx context.Context, id, name, orgId string) error {
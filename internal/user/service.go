@@ -1,20 +1,62 @@
 package user
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
 	"github.com/shashimalcse/tiny-is/internal/user/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const ipFailuresCachePrefix = "ip_failed_logins_"
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrPasswordReused  = errors.New("password was used recently")
+)
+
 type UserService interface {
 	GetUsers(ctx context.Context, orgId string) ([]models.User, error)
 	GetUserByID(ctx context.Context, id, orgId string) (models.User, error)
 	GetUserByUsername(ctx context.Context, username, orgId string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email, orgId string) (models.User, error)
 	CreateUser(ctx context.Context, User models.User) error
-	AuthenticateUser(ctx context.Context, username, password, orgId string) (bool, error)
+	// CreateInitialUser skips the password policy and asks the user to change the password.
+	CreateInitialUser(ctx context.Context, User models.User) error
+	// ImportUser creates the user with a password hash in one of the formats PasswordHasher knows.
+	ImportUser(ctx context.Context, User models.User) error
+	// HashNewPassword checks the password of a user signing up and returns its hash for RegisterUser,
+	// so the password itself is not kept until they verify their email address.
+	HashNewPassword(ctx context.Context, User models.User) (string, error)
+	RegisterUser(ctx context.Context, User models.User) error
+	// AuthenticateUser returns a LockoutError without checking the password when the user or the
+	// address may not try one.
+	AuthenticateUser(ctx context.Context, username, password, orgId, ipAddress string) (bool, error)
+	UnlockUser(ctx context.Context, id, orgId string) error
+	GetLockoutPolicy(ctx context.Context, orgId string) (LockoutPolicy, error)
+	UpdateLockoutPolicy(ctx context.Context, policy LockoutPolicy) error
+	SetPassword(ctx context.Context, id, orgId, password string, changeRequired bool) error
+	// ChangePassword counts a wrong current password towards the lockout of the user.
+	ChangePassword(ctx context.Context, id, orgId, currentPassword, newPassword string) error
+	// GetPasswordStatus returns PasswordExpired, PasswordBreached, PasswordBreachedWarning or empty.
+	GetPasswordStatus(ctx context.Context, id, orgId, password string) (string, error)
+	IsPasswordExpired(ctx context.Context, id, orgId string) (bool, error)
+	GetPasswordPolicy(ctx context.Context, orgId string) (PasswordPolicy, error)
+	UpdatePasswordPolicy(ctx context.Context, policy PasswordPolicy) error
+	GetRegistrationPolicy(ctx context.Context, orgId string) (RegistrationPolicy, error)
+	UpdateRegistrationPolicy(ctx context.Context, policy RegistrationPolicy) error
+	SetPhoneNumber(ctx context.Context, id, orgId, phoneNumber string, verified bool) error
 	CreateAttribute(ctx context.Context, name, orgId string) error
 	GetAttributes(ctx context.Context, orgId string) ([]models.Attribute, error)
 	PatchAttributes(ctx context.Context, orgId string, addedAttributes []models.Attribute, removedAttributes []models.Attribute) error
@@ -23,14 +65,30 @@ type UserService interface {
 }
 
 type userService struct {
-	cacheService cache.CacheService
-	repo         UserRepository
+	cfg                          *config.Config
+	cacheService                 cache.CacheService
+	backend                      cache.Backend
+	repo                         UserRepository
+	lockoutPolicyRepository      LockoutPolicyRepository
+	passwordPolicyRepository     PasswordPolicyRepository
+	registrationPolicyRepository RegistrationPolicyRepository
+	breachedPasswords            *BreachedPasswords
+	passwordHasher               *PasswordHasher
 }
 
-func NewUserService(cacheService cache.CacheService, repo UserRepository) UserService {
+// NewUserService returns a user service that counts the failed attempts of addresses in the
+// backend. Passwords are not screened without a breached password corpus.
+func NewUserService(cfg *config.Config, cacheService cache.CacheService, backend cache.Backend, repo UserRepository, lockoutPolicyRepository LockoutPolicyRepository, passwordPolicyRepository PasswordPolicyRepository, registrationPolicyRepository RegistrationPolicyRepository, breachedPasswords *BreachedPasswords, passwordHasher *PasswordHasher) UserService {
 	return &userService{
-		cacheService: cacheService,
-		repo:         repo,
+		cfg:                          cfg,
+		cacheService:                 cacheService,
+		backend:                      backend,
+		repo:                         repo,
+		lockoutPolicyRepository:      lockoutPolicyRepository,
+		passwordPolicyRepository:     passwordPolicyRepository,
+		registrationPolicyRepository: registrationPolicyRepository,
+		breachedPasswords:            breachedPasswords,
+		passwordHasher:               passwordHasher,
 	}
 }
 
@@ -64,29 +122,451 @@ func (s *userService) GetUserByUsername(ctx context.Context, username, orgId str
 	return user, nil
 }
 
+func (s *userService) GetUserByEmail(ctx context.Context, email, orgId string) (models.User, error) {
+	return s.repo.GetUserByEmail(ctx, email, orgId)
+}
+
 func (s *userService) CreateUser(ctx context.Context, user models.User) error {
-	userId := uuid.New().String()
-	passwordHash, err := getPasswordHash(user.Password)
+	policy, err := s.GetPasswordPolicy(ctx, user.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(policy, user.Password, user); err != nil {
+		return err
+	}
+	user.PasswordChangeRequired = false
+	return s.createUser(ctx, user)
+}
+
+func (s *userService) CreateInitialUser(ctx context.Context, user models.User) error {
+	user.PasswordChangeRequired = true
+	return s.createUser(ctx, user)
+}
+
+func (s *userService) HashNewPassword(ctx context.Context, user models.User) (string, error) {
+	policy, err := s.GetPasswordPolicy(ctx, user.OrganizationId)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkPassword(policy, user.Password, user); err != nil {
+		return "", err
+	}
+	return s.passwordHasher.Hash(user.Password)
+}
+
+func (s *userService) ImportUser(ctx context.Context, user models.User) error {
+	if err := s.passwordHasher.CheckHash(user.PasswordHash); err != nil {
+		return err
+	}
+	user.Password = ""
+	user.PasswordChangeRequired = false
+	return s.insertUser(ctx, user)
+}
+
+func (s *userService) RegisterUser(ctx context.Context, user models.User) error {
+	user.Password = ""
+	user.EmailVerified = true
+	user.PasswordChangeRequired = false
+	return s.insertUser(ctx, user)
+}
+
+func (s *userService) createUser(ctx context.Context, user models.User) error {
+	passwordHash, err := s.passwordHasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
-	user.Id = userId
 	user.PasswordHash = passwordHash
+	return s.insertUser(ctx, user)
+}
+
+func (s *userService) insertUser(ctx context.Context, user models.User) error {
+	var err error
+	if user.PhoneNumber != "" {
+		user.PhoneNumber, err = NormalizePhoneNumber(user.PhoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+	user.Id = uuid.New().String()
+	user.PasswordChangedAt = time.Now().Unix()
 	return s.repo.CreateUser(ctx, user)
 }
 
-func (s *userService) AuthenticateUser(ctx context.Context, username, password, orgId string) (bool, error) {
-	hashedPassword, err := s.repo.GetHashedPasswordByUsername(ctx, username, orgId)
+func (s *userService) AuthenticateUser(ctx context.Context, username, password, orgId, ipAddress string) (bool, error) {
+	policy, err := s.GetLockoutPolicy(ctx, orgId)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if err := s.checkIPFailures(policy, ipAddress, now); err != nil {
+		return false, err
+	}
+	user, err := s.repo.GetUserByUsername(ctx, username, orgId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// guessing usernames counts against the address too
+			if err := s.failIP(policy, ipAddress); err != nil {
+				return false, err
+			}
+		}
 		return false, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	matched, hashedPassword, err := s.verifyPassword(ctx, policy, user, password, now)
 	if err != nil {
-		return false, nil
+		return false, err
+	}
+	if !matched {
+		return false, s.failIP(policy, ipAddress)
+	}
+	if s.passwordHasher.NeedsRehash(hashedPassword) {
+		// the old hash still works, the next sign in tries again
+		if err := s.rehashPassword(ctx, user.Id, orgId, hashedPassword, password); err != nil {
+			log.Printf("failed to rehash the password of user %s: %v", user.Id, err)
+		}
 	}
 	return true, nil
 }
 
+// verifyPassword returns the hash the password matched.
+func (s *userService) verifyPassword(ctx context.Context, policy LockoutPolicy, user models.User, password string, now time.Time) (bool, string, error) {
+	if err := policy.checkLockout(user.Lockout, now); err != nil {
+		return false, "", err
+	}
+	// the attempt counts as failed until the password matched, so attempts made at the same time
+	// can't get past the limit
+	lockout, err := s.repo.AddFailedLogin(ctx, user.Id, user.OrganizationId, policy.forgetBefore(now), now)
+	if err != nil {
+		return false, "", err
+	}
+	if err := policy.checkAttempt(lockout, now); err != nil {
+		return false, "", err
+	}
+	hashedPassword, err := s.repo.GetHashedPasswordByID(ctx, user.Id, user.OrganizationId)
+	if err != nil {
+		return false, "", err
+	}
+	matched, err := s.passwordHasher.Verify(hashedPassword, password)
+	if err != nil {
+		return false, "", err
+	}
+	if !matched {
+		if locked, ok := policy.lock(lockout, now); ok {
+			if _, err := s.repo.LockUser(ctx, user.Id, user.OrganizationId, policy.MaxFailedAttempts, lockout, locked); err != nil {
+				return false, "", err
+			}
+		}
+		return false, "", nil
+	}
+	if _, err := s.repo.UpdateLockout(ctx, user.Id, user.OrganizationId, models.Lockout{}); err != nil {
+		return false, "", err
+	}
+	return true, hashedPassword, nil
+}
+
+// rehashPassword keeps the age of the password, which did not change.
+func (s *userService) rehashPassword(ctx context.Context, id, orgId, currentHash, password string) error {
+	passwordHash, err := s.passwordHasher.Hash(password)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		// an imported password too long for bcrypt keeps the hash it has
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.UpdatePasswordHash(ctx, id, orgId, currentHash, passwordHash)
+	return err
+}
+
+func (s *userService) UnlockUser(ctx context.Context, id, orgId string) error {
+	updated, err := s.repo.UpdateLockout(ctx, id, orgId, models.Lockout{})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// checkIPFailures asks to retry a whole window later, as the end of the window is not kept.
+func (s *userService) checkIPFailures(policy LockoutPolicy, ipAddress string, now time.Time) error {
+	if policy.MaxFailedAttemptsPerIP == 0 || ipAddress == "" {
+		return nil
+	}
+	data, found, err := s.backend.Get(ipFailuresCacheKey(policy, ipAddress))
+	if err != nil || !found {
+		return err
+	}
+	count, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+	if count >= policy.MaxFailedAttemptsPerIP {
+		return &LockoutError{Err: ErrTooManyAttempts, RetryAfter: now.Add(policy.IPWindow)}
+	}
+	return nil
+}
+
+func (s *userService) failIP(policy LockoutPolicy, ipAddress string) error {
+	if policy.MaxFailedAttemptsPerIP == 0 || ipAddress == "" {
+		return nil
+	}
+	_, err := s.backend.Incr(ipFailuresCacheKey(policy, ipAddress), policy.IPWindow)
+	return err
+}
+
+func ipFailuresCacheKey(policy LockoutPolicy, ipAddress string) string {
+	return ipFailuresCachePrefix + policy.OrganizationId + "_" + ipAddress
+}
+
+func (s *userService) GetLockoutPolicy(ctx context.Context, orgId string) (LockoutPolicy, error) {
+	policy, found, err := s.lockoutPolicyRepository.GetLockoutPolicy(ctx, orgId)
+	if err != nil {
+		return LockoutPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	lockoutCfg := s.cfg.Lockout
+	return LockoutPolicy{
+		OrganizationId:         orgId,
+		MaxFailedAttempts:      lockoutCfg.MaxFailedAttempts,
+		LockoutDuration:        time.Duration(lockoutCfg.LockoutDuration) * time.Second,
+		MaxLockouts:            lockoutCfg.MaxLockouts,
+		ProgressiveDelay:       time.Duration(lockoutCfg.ProgressiveDelay) * time.Second,
+		MaxDelay:               time.Duration(lockoutCfg.MaxDelay) * time.Second,
+		MaxFailedAttemptsPerIP: lockoutCfg.MaxFailedAttemptsPerIP,
+		IPWindow:               time.Duration(lockoutCfg.IPWindow) * time.Second,
+	}, nil
+}
+
+func (s *userService) UpdateLockoutPolicy(ctx context.Context, policy LockoutPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	return s.lockoutPolicyRepository.SaveLockoutPolicy(ctx, policy)
+}
+
+func (s *userService) SetPassword(ctx context.Context, id, orgId, password string, changeRequired bool) error {
+	user, err := s.repo.GetUserByID(ctx, id, orgId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	policy, err := s.GetPasswordPolicy(ctx, orgId)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(policy, password, user); err != nil {
+		return err
+	}
+	// the current password is always in the history, so it can't be chosen again
+	history, err := s.repo.GetPasswordHistory(ctx, id, orgId, max(policy.HistoryCount, 1))
+	if err != nil {
+		return err
+	}
+	for _, passwordHash := range history {
+		reused, err := s.passwordHasher.Verify(passwordHash, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			return ErrPasswordReused
+		}
+	}
+	passwordHash, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	updated, err := s.repo.UpdatePassword(ctx, id, orgId, passwordHash, time.Now(), changeRequired)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *userService) ChangePassword(ctx context.Context, id, orgId, currentPassword, newPassword string) error {
+	user, err := s.repo.GetUserByID(ctx, id, orgId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	policy, err := s.GetLockoutPolicy(ctx, orgId)
+	if err != nil {
+		return err
+	}
+	matched, _, err := s.verifyPassword(ctx, policy, user, currentPassword, time.Now())
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return ErrInvalidPassword
+	}
+	return s.SetPassword(ctx, id, orgId, newPassword, false)
+}
+
+func (s *userService) checkPassword(policy PasswordPolicy, password string, user models.User) error {
+	err := policy.checkPassword(password, user)
+	if !policy.RejectBreached {
+		return err
+	}
+	breached, breachedErr := s.isBreached(password)
+	if breachedErr != nil {
+		return breachedErr
+	}
+	if !breached {
+		return err
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		policyErr = &PasswordPolicyError{}
+	}
+	policyErr.Violations = append(policyErr.Violations, "has appeared in a data breach")
+	return policyErr
+}
+
+func (s *userService) isBreached(password string) (bool, error) {
+	count, err := s.breachedPasswords.Count(password)
+	if err != nil {
+		return false, err
+	}
+	return count >= s.cfg.GetBreachedPasswordsMinCount(), nil
+}
+
+func (s *userService) GetPasswordStatus(ctx context.Context, id, orgId, password string) (string, error) {
+	user, err := s.repo.GetUserByID(ctx, id, orgId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+	policy, err := s.GetPasswordPolicy(ctx, orgId)
+	if err != nil {
+		return "", err
+	}
+	if policy.isPasswordExpired(user, time.Now()) {
+		return PasswordExpired, nil
+	}
+	if policy.BreachedLoginAction == BreachedLoginOff {
+		return "", nil
+	}
+	breached, err := s.isBreached(password)
+	if err != nil || !breached {
+		return "", err
+	}
+	if policy.BreachedLoginAction == BreachedLoginReset {
+		return PasswordBreached, nil
+	}
+	return PasswordBreachedWarning, nil
+}
+
+func (s *userService) IsPasswordExpired(ctx context.Context, id, orgId string) (bool, error) {
+	user, err := s.repo.GetUserByID(ctx, id, orgId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	policy, err := s.GetPasswordPolicy(ctx, orgId)
+	if err != nil {
+		return false, err
+	}
+	return policy.isPasswordExpired(user, time.Now()), nil
+}
+
+func (s *userService) GetPasswordPolicy(ctx context.Context, orgId string) (PasswordPolicy, error) {
+	policy, found, err := s.passwordPolicyRepository.GetPasswordPolicy(ctx, orgId)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	passwordCfg := s.cfg.PasswordPolicy
+	return PasswordPolicy{
+		OrganizationId:      orgId,
+		MinLength:           passwordCfg.MinLength,
+		RequireUppercase:    passwordCfg.RequireUppercase,
+		RequireLowercase:    passwordCfg.RequireLowercase,
+		RequireDigit:        passwordCfg.RequireDigit,
+		RequireSymbol:       passwordCfg.RequireSymbol,
+		BannedWords:         passwordCfg.BannedWords,
+		HistoryCount:        passwordCfg.HistoryCount,
+		MaxAge:              time.Duration(passwordCfg.MaxAge) * time.Second,
+		RejectBreached:      passwordCfg.RejectBreached,
+		BreachedLoginAction: cmp.Or(passwordCfg.BreachedLoginAction, BreachedLoginOff),
+	}, nil
+}
+
+func (s *userService) UpdatePasswordPolicy(ctx context.Context, policy PasswordPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	return s.passwordPolicyRepository.SavePasswordPolicy(ctx, policy)
+}
+
+func (s *userService) GetRegistrationPolicy(ctx context.Context, orgId string) (RegistrationPolicy, error) {
+	policy, found, err := s.registrationPolicyRepository.GetRegistrationPolicy(ctx, orgId)
+	if err != nil {
+		return RegistrationPolicy{}, err
+	}
+	if found {
+		return policy, nil
+	}
+	registrationCfg := s.cfg.Registration
+	return RegistrationPolicy{
+		OrganizationId:     orgId,
+		Enabled:            registrationCfg.Enabled,
+		RequiredAttributes: registrationCfg.RequiredAttributes,
+		RequireChallenge:   registrationCfg.RequireChallenge,
+	}, nil
+}
+
+func (s *userService) UpdateRegistrationPolicy(ctx context.Context, policy RegistrationPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	attributes, err := s.repo.GetAttributes(ctx, policy.OrganizationId)
+	if err != nil {
+		return err
+	}
+	for _, name := range policy.RequiredAttributes {
+		if !slices.ContainsFunc(attributes, func(attribute models.Attribute) bool { return attribute.Name == name }) {
+			return fmt.Errorf("%w: %s", ErrUnknownAttribute, name)
+		}
+	}
+	return s.registrationPolicyRepository.SaveRegistrationPolicy(ctx, policy)
+}
+
+func (s *userService) SetPhoneNumber(ctx context.Context, id, orgId, phoneNumber string, verified bool) error {
+	if phoneNumber == "" {
+		verified = false
+	} else {
+		var err error
+		phoneNumber, err = NormalizePhoneNumber(phoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+	updated, err := s.repo.UpdatePhoneNumber(ctx, id, orgId, phoneNumber, verified)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 func (s *userService) CreateAttribute(ctx context.Context, name, orgId string) error {
 	attributeId := uuid.New().String()
 	return s.repo.CreateAttribute(ctx, attributeId, name, orgId)
@@ -107,11 +587,3 @@ func (s *userService) AddUserAttributes(ctx context.Context, userId string, attr
 func (s *userService) PatchUserAttributes(ctx context.Context, userId string, addedAttributes []models.UserAttribute, removedAttributes []models.UserAttribute) error {
 	return s.repo.PatchUserAttributes(ctx, userId, addedAttributes, removedAttributes)
 }
-
-func getPasswordHash(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
-}
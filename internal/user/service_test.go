@@ -0,0 +1,233 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+func newTestUserService(t *testing.T, lockoutPolicy LockoutPolicy) (UserService, UserRepository) {
+	db := testutil.NewDB(t, "user.sql")
+	repo := NewUserRepository(db)
+	lockoutPolicyRepository := NewLockoutPolicyRepository(db)
+	if err := lockoutPolicyRepository.SaveLockoutPolicy(context.Background(), lockoutPolicy); err != nil {
+		t.Fatalf("Failed to save lockout policy: %v", err)
+	}
+	s := NewUserService(&config.Config{}, cache.NewCacheService(), cache.NewMemoryBackend(), repo, lockoutPolicyRepository,
+		NewPasswordPolicyRepository(db), NewRegistrationPolicyRepository(db), nil, newTestPasswordHasher(t, HashBcrypt))
+	return s, repo
+}
+
+func createTestUser(t *testing.T, s UserService) models.User {
+	user := models.User{OrganizationId: "test-organization-id", Username: "alice", Email: "alice@example.com", Password: "correct horse battery staple"}
+	if err := s.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	user, err := s.GetUserByUsername(context.Background(), user.Username, user.OrganizationId)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	return user
+}
+
+func TestAuthenticateUserConcurrentFailures(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{OrganizationId: "test-organization-id", MaxFailedAttempts: 3, LockoutDuration: 15 * time.Minute}
+	s, repo := newTestUserService(t, policy)
+	user := createTestUser(t, s)
+
+	var checked, lockedOut atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			authenticated, err := s.AuthenticateUser(ctx, user.Username, "wrong password", user.OrganizationId, "")
+			var lockoutErr *LockoutError
+			switch {
+			case err == nil && !authenticated:
+				checked.Add(1)
+			case errors.As(err, &lockoutErr):
+				lockedOut.Add(1)
+			default:
+				t.Errorf("Unexpected result %v %v", authenticated, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := checked.Load(); n != int32(policy.MaxFailedAttempts) {
+		t.Errorf("Expected %d passwords to be checked, got %d", policy.MaxFailedAttempts, n)
+	}
+	stored, err := repo.GetUserByID(ctx, user.Id, user.OrganizationId)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if stored.Lockout.Lockouts != 1 {
+		t.Errorf("Expected the account to be locked once, got %d", stored.Lockout.Lockouts)
+	}
+	if locked, _ := IsLocked(stored.Lockout, time.Now()); !locked {
+		t.Error("Expected the account to be locked")
+	}
+	if _, err := s.AuthenticateUser(ctx, user.Username, "correct horse battery staple", user.OrganizationId, ""); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected the right password to be refused while locked, got %v", err)
+	}
+}
+
+func TestAuthenticateUserForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{OrganizationId: "test-organization-id", MaxFailedAttempts: 2, LockoutDuration: time.Minute}
+	s, repo := newTestUserService(t, policy)
+	user := createTestUser(t, s)
+	if _, err := repo.UpdateLockout(ctx, user.Id, user.OrganizationId, models.Lockout{FailedAttempts: 1, LastFailedAt: time.Now().Add(-2 * time.Minute).Unix()}); err != nil {
+		t.Fatalf("Failed to update lockout: %v", err)
+	}
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "wrong password", user.OrganizationId, ""); authenticated || err != nil {
+		t.Fatalf("Expected a failed attempt, got %v %v", authenticated, err)
+	}
+	stored, _ := repo.GetUserByID(ctx, user.Id, user.OrganizationId)
+	if stored.Lockout.FailedAttempts != 1 || stored.Lockout.Lockouts != 0 {
+		t.Errorf("Expected the old failed attempt not to count, got %+v", stored.Lockout)
+	}
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "correct horse battery staple", user.OrganizationId, ""); !authenticated || err != nil {
+		t.Fatalf("Expected the password to be accepted, got %v %v", authenticated, err)
+	}
+	stored, _ = repo.GetUserByID(ctx, user.Id, user.OrganizationId)
+	if stored.Lockout != (models.Lockout{}) {
+		t.Errorf("Expected a sign in to reset the lockout, got %+v", stored.Lockout)
+	}
+}
+
+func TestAuthenticateUserIPFailures(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{OrganizationId: "test-organization-id", MaxFailedAttemptsPerIP: 2, IPWindow: time.Minute}
+	s, _ := newTestUserService(t, policy)
+	user := createTestUser(t, s)
+	var wg sync.WaitGroup
+	for _, username := range []string{"bob", "carol", user.Username} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.AuthenticateUser(ctx, username, "wrong password", user.OrganizationId, "192.0.2.1")
+		}()
+	}
+	wg.Wait()
+	if _, err := s.AuthenticateUser(ctx, user.Username, "correct horse battery staple", user.OrganizationId, "192.0.2.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected the address to be blocked, got %v", err)
+	}
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "correct horse battery staple", user.OrganizationId, "192.0.2.2"); !authenticated || err != nil {
+		t.Errorf("Expected another address to sign in, got %v %v", authenticated, err)
+	}
+}
+
+func TestChangePasswordLocksOut(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{OrganizationId: "test-organization-id", MaxFailedAttempts: 2, LockoutDuration: 15 * time.Minute}
+	s, _ := newTestUserService(t, policy)
+	user := createTestUser(t, s)
+	for range policy.MaxFailedAttempts {
+		if err := s.ChangePassword(ctx, user.Id, user.OrganizationId, "wrong password", "a new password to use"); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("Expected the current password to be wrong, got %v", err)
+		}
+	}
+	var lockoutErr *LockoutError
+	if err := s.ChangePassword(ctx, user.Id, user.OrganizationId, "correct horse battery staple", "a new password to use"); !errors.As(err, &lockoutErr) {
+		t.Errorf("Expected the change to be refused while locked, got %v", err)
+	}
+}
+
+func TestCreateUserRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestUserService(t, LockoutPolicy{OrganizationId: "test-organization-id"})
+	user := models.User{OrganizationId: "test-organization-id", Username: "alice", Password: "correct horse battery staple", Attributes: []models.UserAttribute{
+		{ID: "test-attribute-id", Value: "a"},
+		{ID: "test-attribute-id", Value: "b"},
+	}}
+	if err := s.CreateUser(ctx, user); err == nil {
+		t.Fatal("Expected the duplicate attribute to fail the user creation")
+	}
+	if _, err := repo.GetUserByUsername(ctx, user.Username, user.OrganizationId); err == nil {
+		t.Error("Expected the user not to be created")
+	}
+}
+
+func TestGetUserByEmailIgnoresCase(t *testing.T) {
+	s, _ := newTestUserService(t, LockoutPolicy{OrganizationId: "test-organization-id"})
+	user := createTestUser(t, s)
+	found, err := s.GetUserByEmail(context.Background(), "Alice@Example.COM", user.OrganizationId)
+	if err != nil || found.Id != user.Id {
+		t.Errorf("Expected the user to be found by their email address in another case, got %v", err)
+	}
+}
+
+// made with Python's hashlib, for the password "correct horse"
+const testImportedHash = "$pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$cBg8D2DungRB9k76szThf5ehfyBz991ay6PT8Srwk4M"
+
+func importTestUser(t *testing.T, s UserService) models.User {
+	user := models.User{OrganizationId: "test-organization-id", Username: "alice", Email: "alice@example.com", PasswordHash: testImportedHash}
+	if err := s.ImportUser(context.Background(), user); err != nil {
+		t.Fatalf("Failed to import user: %v", err)
+	}
+	user, err := s.GetUserByUsername(context.Background(), user.Username, user.OrganizationId)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	return user
+}
+
+func TestAuthenticateUserRehashesImportedPassword(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestUserService(t, LockoutPolicy{OrganizationId: "test-organization-id"})
+	user := importTestUser(t, s)
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "correct horse", user.OrganizationId, ""); !authenticated || err != nil {
+		t.Fatalf("Expected the imported password to be accepted, got %v %v", authenticated, err)
+	}
+	passwordHash, err := repo.GetHashedPasswordByID(ctx, user.Id, user.OrganizationId)
+	if err != nil {
+		t.Fatalf("Failed to get password hash: %v", err)
+	}
+	if !strings.HasPrefix(passwordHash, "$2") {
+		t.Errorf("Expected the password to be hashed with bcrypt, got %q", passwordHash)
+	}
+	history, err := repo.GetPasswordHistory(ctx, user.Id, user.OrganizationId, MaxPasswordHistory)
+	if err != nil || len(history) != 1 || history[0] != passwordHash {
+		t.Errorf("Expected the password history to hold the new hash, got %v %v", history, err)
+	}
+	stored, _ := repo.GetUserByID(ctx, user.Id, user.OrganizationId)
+	if stored.PasswordChangedAt != user.PasswordChangedAt {
+		t.Errorf("Expected the password to keep its age, got %d instead of %d", stored.PasswordChangedAt, user.PasswordChangedAt)
+	}
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "correct horse", user.OrganizationId, ""); !authenticated || err != nil {
+		t.Errorf("Expected the rehashed password to be accepted, got %v %v", authenticated, err)
+	}
+}
+
+// failingRehashRepository can't save a new hash of a password.
+type failingRehashRepository struct {
+	UserRepository
+}
+
+func (r failingRehashRepository) UpdatePasswordHash(ctx context.Context, id, orgId, currentHash, passwordHash string) (bool, error) {
+	return false, errors.New("test failure")
+}
+
+func TestAuthenticateUserWhenRehashFails(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestUserService(t, LockoutPolicy{OrganizationId: "test-organization-id"})
+	user := importTestUser(t, s)
+	s.(*userService).repo = failingRehashRepository{repo}
+	if authenticated, err := s.AuthenticateUser(ctx, user.Username, "correct horse", user.OrganizationId, ""); !authenticated || err != nil {
+		t.Errorf("Expected the sign in to succeed with the old hash, got %v %v", authenticated, err)
+	}
+	if passwordHash, _ := repo.GetHashedPasswordByID(ctx, user.Id, user.OrganizationId); passwordHash != testImportedHash {
+		t.Errorf("Expected the imported hash to be kept, got %q", passwordHash)
+	}
+}
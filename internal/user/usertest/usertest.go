@@ -0,0 +1,85 @@
+// Package usertest holds a user service for the tests of the packages that use one.
+package usertest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/shashimalcse/tiny-is/internal/user"
+	"github.com/shashimalcse/tiny-is/internal/user/models"
+)
+
+// UserService keeps the users of the test in memory. Passwords shorter than 8 characters break the
+// password policy, and a password is "hashed" by prefixing it with "hashed-". The methods it does
+// not implement panic.
+type UserService struct {
+	user.UserService
+	Users              []models.User
+	Attributes         []models.Attribute
+	RegistrationPolicy user.RegistrationPolicy
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id, orgId string) (models.User, error) {
+	return s.find(func(u models.User) bool { return u.Id == id && u.OrganizationId == orgId })
+}
+
+func (s *UserService) GetUserByUsername(ctx context.Context, username, orgId string) (models.User, error) {
+	return s.find(func(u models.User) bool { return u.Username == username && u.OrganizationId == orgId })
+}
+
+func (s *UserService) GetUserByEmail(ctx context.Context, email, orgId string) (models.User, error) {
+	return s.find(func(u models.User) bool { return strings.EqualFold(u.Email, email) && u.OrganizationId == orgId })
+}
+
+func (s *UserService) HashNewPassword(ctx context.Context, u models.User) (string, error) {
+	if err := checkPassword(u.Password); err != nil {
+		return "", err
+	}
+	return "hashed-" + u.Password, nil
+}
+
+func (s *UserService) SetPassword(ctx context.Context, id, orgId, password string, changeRequired bool) error {
+	if err := checkPassword(password); err != nil {
+		return err
+	}
+	for i, u := range s.Users {
+		if u.Id == id && u.OrganizationId == orgId {
+			s.Users[i].PasswordHash = "hashed-" + password
+			s.Users[i].PasswordChangedAt++
+			s.Users[i].PasswordChangeRequired = changeRequired
+			return nil
+		}
+	}
+	return user.ErrUserNotFound
+}
+
+func (s *UserService) RegisterUser(ctx context.Context, u models.User) error {
+	u.EmailVerified = true
+	s.Users = append(s.Users, u)
+	return nil
+}
+
+func (s *UserService) GetAttributes(ctx context.Context, orgId string) ([]models.Attribute, error) {
+	return s.Attributes, nil
+}
+
+func (s *UserService) GetRegistrationPolicy(ctx context.Context, orgId string) (user.RegistrationPolicy, error) {
+	return s.RegistrationPolicy, nil
+}
+
+func (s *UserService) find(match func(models.User) bool) (models.User, error) {
+	for _, u := range s.Users {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func checkPassword(password string) error {
+	if len(password) < 8 {
+		return &user.PasswordPolicyError{Violations: []string{"must be at least 8 characters long"}}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// WebAuthn encodes attestation objects and public keys in CBOR (RFC 8949). Authenticators only use
+// a small part of it: integers, byte and text strings, arrays, maps and simple values, always with
+// definite lengths. decodeCBOR reads that subset into Go values:
+//
+//	unsigned and negative integers -> int64
+//	byte strings                   -> []byte
+//	text strings                   -> string
+//	arrays                         -> []any
+//	maps                           -> map[any]any, keyed by int64 or string
+//	false, true, null              -> bool, nil
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// maxCBORDepth bounds the nesting of arrays and maps, so a crafted input can't exhaust the stack.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item of data and returns the bytes that follow it.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+	}
+	majorType := data[0] >> 5
+	additional := data[0] & 0x1f
+	if majorType == 7 {
+		switch additional {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22:
+			return nil, data[1:], nil
+		}
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errInvalidCBOR, additional)
+	}
+	argument, rest, err := readCBORArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch majorType {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return int64(argument), rest, nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return -1 - int64(argument), rest, nil
+	case 2, 3:
+		if argument > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: string longer than the data", errInvalidCBOR)
+		}
+		value := rest[:argument]
+		if majorType == 3 {
+			return string(value), rest[argument:], nil
+		}
+		return append([]byte(nil), value...), rest[argument:], nil
+	case 4:
+		// every item takes at least one byte, a longer array can't fit in the data
+		if argument > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: array longer than the data", errInvalidCBOR)
+		}
+		items := make([]any, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			var item any
+			item, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if argument > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: map longer than the data", errInvalidCBOR)
+		}
+		entries := make(map[any]any, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, value any
+			key, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", errInvalidCBOR)
+			}
+			if _, found := entries[key]; found {
+				return nil, nil, fmt.Errorf("%w: duplicate map key", errInvalidCBOR)
+			}
+			value, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, rest, nil
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported major type %d", errInvalidCBOR, majorType)
+}
+
+func readCBORArgument(data []byte) (uint64, []byte, error) {
+	additional := data[0] & 0x1f
+	data = data[1:]
+	var size int
+	switch {
+	case additional < 24:
+		return uint64(additional), data, nil
+	case additional == 24:
+		size = 1
+	case additional == 25:
+		size = 2
+	case additional == 26:
+		size = 4
+	case additional == 27:
+		size = 8
+	default:
+		// indefinite lengths are not used by authenticators
+		return 0, nil, fmt.Errorf("%w: unsupported length encoding", errInvalidCBOR)
+	}
+	if len(data) < size {
+		return 0, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+	}
+	var argument uint64
+	switch size {
+	case 1:
+		argument = uint64(data[0])
+	case 2:
+		argument = uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		argument = uint64(binary.BigEndian.Uint32(data))
+	case 8:
+		argument = binary.BigEndian.Uint64(data)
+	}
+	return argument, data[size:], nil
+}
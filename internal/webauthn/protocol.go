@@ -0,0 +1,217 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// authenticator data flags
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// COSE algorithms the server accepts, in order of preference.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+var supportedAlgorithms = []int{algES256, algEdDSA, algRS256}
+
+var base64URL = base64.RawURLEncoding
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// set for registrations only
+	AAGUID       []byte
+	CredentialId []byte
+	PublicKey    []byte
+}
+
+func (d authenticatorData) UserPresent() bool {
+	return d.Flags&flagUserPresent != 0
+}
+
+func (d authenticatorData) UserVerified() bool {
+	return d.Flags&flagUserVerified != 0
+}
+
+// decodeBase64URL decodes the base64url values browsers send, with or without padding.
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64URL.DecodeString(strings.TrimRight(value, "="))
+}
+
+// verifyClientData checks that the browser ran the expected ceremony for our challenge on one of
+// our origins.
+func verifyClientData(clientDataJSON []byte, ceremony, challenge string, origins []string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return errors.New("invalid client data")
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %q", data.Type)
+	}
+	if data.Challenge != challenge {
+		return errors.New("challenge does not match")
+	}
+	for _, origin := range origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected origin %q", data.Origin)
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("authenticator data is too short")
+	}
+	authData := authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.Flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, errors.New("attested credential data is too short")
+	}
+	authData.AAGUID = rest[:16]
+	credentialIdLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if credentialIdLength == 0 || credentialIdLength > 1023 || len(rest) < credentialIdLength {
+		return authenticatorData{}, errors.New("invalid credential id")
+	}
+	authData.CredentialId = rest[:credentialIdLength]
+	rest = rest[credentialIdLength:]
+	// the public key is a CBOR map, followed by the extensions when there are any
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	authData.PublicKey = rest[:len(rest)-len(extensions)]
+	return authData, nil
+}
+
+// parseAttestationObject returns the authenticator data of a registration. The attestation
+// statement is not verified: the server asks for no attestation, as it does not restrict which
+// authenticators users may register.
+func parseAttestationObject(attestationObject []byte) (authenticatorData, error) {
+	value, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return authenticatorData{}, err
+	}
+	object, ok := value.(map[any]any)
+	if !ok {
+		return authenticatorData{}, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return authenticatorData{}, errors.New("attestation object has no authenticator data")
+	}
+	return parseAuthenticatorData(rawAuthData)
+}
+
+// parsePublicKey reads a COSE_Key (RFC 9053) with one of the supported algorithms.
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, int, error) {
+	value, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	key, ok := value.(map[any]any)
+	if !ok {
+		return nil, 0, errors.New("invalid public key")
+	}
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == algES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid P-256 public key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, errors.New("invalid P-256 public key")
+		}
+		return publicKey, algES256, nil
+	case kty == 1 && alg == algEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), algEdDSA, nil
+	case kty == 3 && alg == algRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("invalid RSA public key")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, algRS256, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported public key algorithm %d", alg)
+}
+
+// verifySignature checks an assertion signature, made over the authenticator data and the hash of
+// the client data.
+func verifySignature(coseKey, rawAuthData, clientDataJSON, signature []byte) error {
+	publicKey, alg, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	switch alg {
+	case algES256:
+		digest := sha256.Sum256(signed)
+		if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+	case algEdDSA:
+		if !ed25519.Verify(publicKey.(ed25519.PublicKey), signed, signature) {
+			return errors.New("invalid signature")
+		}
+	case algRS256:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package webauthn
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Credential is a passkey or security key a user registered.
+type Credential struct {
+	// Id is the base64url encoded credential id the authenticator chose.
+	Id             string
+	UserId         string
+	OrganizationId string
+	Name           string
+	// PublicKey is the COSE encoded public key of the credential.
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+	AAGUID     string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type credentialRow struct {
+	Id             string         `db:"id"`
+	UserId         string         `db:"user_id"`
+	OrganizationId string         `db:"organization_id"`
+	Name           string         `db:"name"`
+	PublicKey      []byte         `db:"public_key"`
+	SignCount      int64          `db:"sign_count"`
+	Transports     sql.NullString `db:"transports"`
+	AAGUID         sql.NullString `db:"aaguid"`
+	CreatedAt      int64          `db:"created_at"`
+	LastUsedAt     sql.NullInt64  `db:"last_used_at"`
+}
+
+const credentialColumns = "id, user_id, organization_id, name, public_key, sign_count, transports, aaguid, created_at, last_used_at"
+
+type WebAuthnRepository interface {
+	GetCredential(ctx context.Context, credentialId string) (Credential, bool, error)
+	GetCredentialsByUser(ctx context.Context, userId, orgId string) ([]Credential, error)
+	AddCredential(ctx context.Context, credential Credential) error
+	// UpdateSignCount records a use of the credential. It returns false when another sign in
+	// already recorded the same or a later count.
+	UpdateSignCount(ctx context.Context, credentialId string, signCount uint32) (bool, error)
+	DeleteCredential(ctx context.Context, credentialId, userId, orgId string) (bool, error)
+}
+
+type webAuthnRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebAuthnRepository(db *sqlx.DB) WebAuthnRepository {
+	return &webAuthnRepository{
+		db: db,
+	}
+}
+
+func (r *webAuthnRepository) GetCredential(ctx context.Context, credentialId string) (Credential, bool, error) {
+	var row credentialRow
+	err := r.db.GetContext(ctx, &row, "SELECT "+credentialColumns+" FROM webauthn_credential WHERE id = ?", credentialId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Credential{}, false, nil
+		}
+		return Credential{}, false, err
+	}
+	return row.toCredential(), true, nil
+}
+
+func (r *webAuthnRepository) GetCredentialsByUser(ctx context.Context, userId, orgId string) ([]Credential, error) {
+	var rows []credentialRow
+	err := r.db.SelectContext(ctx, &rows, "SELECT "+credentialColumns+" FROM webauthn_credential WHERE user_id = ? AND organization_id = ? ORDER BY created_at, rowid", userId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	credentials := []Credential{}
+	for _, row := range rows {
+		credentials = append(credentials, row.toCredential())
+	}
+	return credentials, nil
+}
+
+func (r *webAuthnRepository) AddCredential(ctx context.Context, credential Credential) error {
+	transportsJSON, err := json.Marshal(credential.Transports)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO webauthn_credential ("+credentialColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)",
+		credential.Id, credential.UserId, credential.OrganizationId, credential.Name, credential.PublicKey, int64(credential.SignCount),
+		string(transportsJSON), credential.AAGUID, credential.CreatedAt.Unix())
+	return err
+}
+
+func (r *webAuthnRepository) UpdateSignCount(ctx context.Context, credentialId string, signCount uint32) (bool, error) {
+	// authenticators that don't count signatures always report 0
+	result, err := r.db.ExecContext(ctx, "UPDATE webauthn_credential SET sign_count = ?, last_used_at = ? WHERE id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))",
+		int64(signCount), time.Now().Unix(), credentialId, int64(signCount), int64(signCount))
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, credentialId, userId, orgId string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webauthn_credential WHERE id = ? AND user_id = ? AND organization_id = ?", credentialId, userId, orgId)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
+func (row credentialRow) toCredential() Credential {
+	credential := Credential{
+		Id:             row.Id,
+		UserId:         row.UserId,
+		OrganizationId: row.OrganizationId,
+		Name:           row.Name,
+		PublicKey:      row.PublicKey,
+		SignCount:      uint32(row.SignCount),
+		AAGUID:         row.AAGUID.String,
+		CreatedAt:      time.Unix(row.CreatedAt, 0),
+	}
+	if row.LastUsedAt.Valid {
+		credential.LastUsedAt = time.Unix(row.LastUsedAt.Int64, 0)
+	}
+	if row.Transports.Valid {
+		json.Unmarshal([]byte(row.Transports.String), &credential.Transports)
+	}
+	return credential
+}
@@ -0,0 +1,430 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+)
+
+var (
+	ErrCeremonyNotFound   = errors.New("the passkey request expired, try again")
+	ErrCredentialNotFound = errors.New("passkey not found")
+	ErrVerificationFailed = errors.New("passkey verification failed")
+)
+
+const (
+	ceremonyCachePrefix = "webauthn_ceremony_"
+	challengeLength     = 32
+	maxCredentialName   = 64
+)
+
+const (
+	userVerificationRequired  = "required"
+	userVerificationPreferred = "preferred"
+)
+
+// ceremony is the state kept between the options sent to the browser and its response.
+type ceremony struct {
+	Challenge      string `json:"challenge"`
+	UserId         string `json:"user_id,omitempty"`
+	OrganizationId string `json:"organization_id"`
+	// UserVerification is required when the credential is the only factor.
+	UserVerification string `json:"user_verification"`
+}
+
+type RelyingParty struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	Id         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions for navigator.credentials.create, with
+// binary values base64url encoded.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions for navigator.credentials.get, with
+// binary values base64url encoded.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPId             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+}
+
+// RegistrationResponse is the credential the browser created, with binary values base64url encoded.
+type RegistrationResponse struct {
+	CredentialId      string
+	ClientDataJSON    string
+	AttestationObject string
+	Transports        []string
+}
+
+// AssertionResponse is the signature the browser returned for a sign in, with binary values
+// base64url encoded.
+type AssertionResponse struct {
+	CredentialId      string
+	ClientDataJSON    string
+	AuthenticatorData string
+	Signature         string
+	UserHandle        string
+}
+
+type WebAuthnService interface {
+	// BeginRegistration starts registering a passkey for the user. The ceremony key ties the
+	// options to the response, and must be the same when finishing.
+	BeginRegistration(ctx context.Context, ceremonyKey, userId, orgId, userName string) (CreationOptions, error)
+	FinishRegistration(ctx context.Context, ceremonyKey, name string, response RegistrationResponse) (Credential, error)
+	// BeginLogin starts a sign in with a passkey of the user, or with any passkey of the
+	// organization when userId is empty.
+	BeginLogin(ctx context.Context, ceremonyKey, userId, orgId string) (RequestOptions, error)
+	FinishLogin(ctx context.Context, ceremonyKey string, response AssertionResponse) (Credential, error)
+	HasCredentials(ctx context.Context, userId, orgId string) (bool, error)
+	GetCredentials(ctx context.Context, userId, orgId string) ([]Credential, error)
+	DeleteCredential(ctx context.Context, credentialId, userId, orgId string) error
+}
+
+type webAuthnService struct {
+	cfg        *config.Config
+	repository WebAuthnRepository
+	backend    cache.Backend
+}
+
+// NewWebAuthnService returns a passkey service that keeps ceremonies in the cache backend.
+func NewWebAuthnService(cfg *config.Config, repository WebAuthnRepository, backend cache.Backend) WebAuthnService {
+	return &webAuthnService{
+		cfg:        cfg,
+		repository: repository,
+		backend:    backend,
+	}
+}
+
+func (s *webAuthnService) BeginRegistration(ctx context.Context, ceremonyKey, userId, orgId, userName string) (CreationOptions, error) {
+	credentials, err := s.repository.GetCredentialsByUser(ctx, userId, orgId)
+	if err != nil {
+		return CreationOptions{}, err
+	}
+	challenge, err := s.startCeremony(ceremonyKey, ceremony{
+		UserId:           userId,
+		OrganizationId:   orgId,
+		UserVerification: userVerificationRequired,
+	})
+	if err != nil {
+		return CreationOptions{}, err
+	}
+	options := CreationOptions{
+		Challenge: challenge,
+		RP: RelyingParty{
+			Id:   s.cfg.GetWebAuthnRPID(),
+			Name: s.cfg.WebAuthn.RPName,
+		},
+		User: UserEntity{
+			Id:          base64URL.EncodeToString([]byte(userId)),
+			Name:        userName,
+			DisplayName: userName,
+		},
+		Timeout:     s.cfg.GetWebAuthnTimeout().Milliseconds(),
+		Attestation: "none",
+		// passkeys are discoverable, so they can sign the user in without a username
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   userVerificationRequired,
+		},
+		ExcludeCredentials: getCredentialDescriptors(credentials),
+	}
+	if options.RP.Name == "" {
+		options.RP.Name = options.RP.Id
+	}
+	for _, alg := range supportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	return options, nil
+}
+
+func (s *webAuthnService) FinishRegistration(ctx context.Context, ceremonyKey, name string, response RegistrationResponse) (Credential, error) {
+	state, err := s.finishCeremony(ceremonyKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	clientDataJSON, err := decodeBase64URL(response.ClientDataJSON)
+	if err != nil {
+		return Credential{}, verificationFailed("invalid client data")
+	}
+	if err := verifyClientData(clientDataJSON, ceremonyCreate, state.Challenge, s.cfg.GetWebAuthnOrigins()); err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	attestationObject, err := decodeBase64URL(response.AttestationObject)
+	if err != nil {
+		return Credential{}, verificationFailed("invalid attestation object")
+	}
+	authData, err := parseAttestationObject(attestationObject)
+	if err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	if err := s.verifyAuthenticatorData(authData, state.UserVerification); err != nil {
+		return Credential{}, err
+	}
+	if authData.CredentialId == nil {
+		return Credential{}, verificationFailed("no credential was created")
+	}
+	if _, _, err := parsePublicKey(authData.PublicKey); err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	credentialId := base64URL.EncodeToString(authData.CredentialId)
+	if _, found, err := s.repository.GetCredential(ctx, credentialId); err != nil || found {
+		if err != nil {
+			return Credential{}, err
+		}
+		return Credential{}, verificationFailed("the passkey is already registered")
+	}
+	credential := Credential{
+		Id:             credentialId,
+		UserId:         state.UserId,
+		OrganizationId: state.OrganizationId,
+		Name:           getCredentialName(name),
+		PublicKey:      authData.PublicKey,
+		SignCount:      authData.SignCount,
+		Transports:     response.Transports,
+		AAGUID:         hex.EncodeToString(authData.AAGUID),
+		CreatedAt:      time.Now(),
+	}
+	if err := s.repository.AddCredential(ctx, credential); err != nil {
+		return Credential{}, err
+	}
+	return credential, nil
+}
+
+func (s *webAuthnService) BeginLogin(ctx context.Context, ceremonyKey, userId, orgId string) (RequestOptions, error) {
+	userVerification := userVerificationRequired
+	allowCredentials := []CredentialDescriptor{}
+	if userId != "" {
+		credentials, err := s.repository.GetCredentialsByUser(ctx, userId, orgId)
+		if err != nil {
+			return RequestOptions{}, err
+		}
+		if len(credentials) == 0 {
+			return RequestOptions{}, ErrCredentialNotFound
+		}
+		// the passkey is a second factor here, the user already proved who they are
+		userVerification = userVerificationPreferred
+		allowCredentials = getCredentialDescriptors(credentials)
+	}
+	challenge, err := s.startCeremony(ceremonyKey, ceremony{
+		UserId:           userId,
+		OrganizationId:   orgId,
+		UserVerification: userVerification,
+	})
+	if err != nil {
+		return RequestOptions{}, err
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		RPId:             s.cfg.GetWebAuthnRPID(),
+		Timeout:          s.cfg.GetWebAuthnTimeout().Milliseconds(),
+		UserVerification: userVerification,
+		AllowCredentials: allowCredentials,
+	}, nil
+}
+
+func (s *webAuthnService) FinishLogin(ctx context.Context, ceremonyKey string, response AssertionResponse) (Credential, error) {
+	state, err := s.finishCeremony(ceremonyKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	credential, found, err := s.repository.GetCredential(ctx, strings.TrimRight(response.CredentialId, "="))
+	if err != nil {
+		return Credential{}, err
+	}
+	if !found || credential.OrganizationId != state.OrganizationId || (state.UserId != "" && credential.UserId != state.UserId) {
+		return Credential{}, ErrCredentialNotFound
+	}
+	if response.UserHandle != "" {
+		userHandle, err := decodeBase64URL(response.UserHandle)
+		if err != nil || string(userHandle) != credential.UserId {
+			return Credential{}, verificationFailed("user handle does not match the passkey")
+		}
+	}
+	clientDataJSON, err := decodeBase64URL(response.ClientDataJSON)
+	if err != nil {
+		return Credential{}, verificationFailed("invalid client data")
+	}
+	if err := verifyClientData(clientDataJSON, ceremonyGet, state.Challenge, s.cfg.GetWebAuthnOrigins()); err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	rawAuthData, err := decodeBase64URL(response.AuthenticatorData)
+	if err != nil {
+		return Credential{}, verificationFailed("invalid authenticator data")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	if err := s.verifyAuthenticatorData(authData, state.UserVerification); err != nil {
+		return Credential{}, err
+	}
+	signature, err := decodeBase64URL(response.Signature)
+	if err != nil {
+		return Credential{}, verificationFailed("invalid signature")
+	}
+	if err := verifySignature(credential.PublicKey, rawAuthData, clientDataJSON, signature); err != nil {
+		return Credential{}, verificationFailed(err.Error())
+	}
+	// a counter that did not move forward means the credential may have been cloned
+	updated, err := s.repository.UpdateSignCount(ctx, credential.Id, authData.SignCount)
+	if err != nil {
+		return Credential{}, err
+	}
+	if !updated {
+		return Credential{}, verificationFailed("signature counter did not increase")
+	}
+	credential.SignCount = authData.SignCount
+	credential.LastUsedAt = time.Now()
+	return credential, nil
+}
+
+func (s *webAuthnService) HasCredentials(ctx context.Context, userId, orgId string) (bool, error) {
+	credentials, err := s.repository.GetCredentialsByUser(ctx, userId, orgId)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+func (s *webAuthnService) GetCredentials(ctx context.Context, userId, orgId string) ([]Credential, error) {
+	return s.repository.GetCredentialsByUser(ctx, userId, orgId)
+}
+
+func (s *webAuthnService) DeleteCredential(ctx context.Context, credentialId, userId, orgId string) error {
+	deleted, err := s.repository.DeleteCredential(ctx, credentialId, userId, orgId)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func (s *webAuthnService) verifyAuthenticatorData(authData authenticatorData, userVerification string) error {
+	rpIdHash := sha256.Sum256([]byte(s.cfg.GetWebAuthnRPID()))
+	if !bytes.Equal(authData.RPIDHash, rpIdHash[:]) {
+		return verificationFailed("the passkey is for another site")
+	}
+	if !authData.UserPresent() {
+		return verificationFailed("user presence was not confirmed")
+	}
+	if userVerification == userVerificationRequired && !authData.UserVerified() {
+		return verificationFailed("user verification is required")
+	}
+	return nil
+}
+
+func (s *webAuthnService) startCeremony(ceremonyKey string, state ceremony) (string, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	state.Challenge = base64URL.EncodeToString(challenge)
+	data, err := cache.Encode(state)
+	if err != nil {
+		return "", err
+	}
+	if err := s.backend.Set(ceremonyCachePrefix+ceremonyKey, data, s.cfg.GetWebAuthnTimeout()); err != nil {
+		return "", err
+	}
+	return state.Challenge, nil
+}
+
+// finishCeremony returns the state of the ceremony once, so a response can't be replayed against
+// the same challenge.
+func (s *webAuthnService) finishCeremony(ceremonyKey string) (ceremony, error) {
+	key := ceremonyCachePrefix + ceremonyKey
+	data, found, err := s.backend.Get(key)
+	if err != nil {
+		return ceremony{}, err
+	}
+	if !found {
+		return ceremony{}, ErrCeremonyNotFound
+	}
+	state, err := cache.Decode[ceremony](data)
+	if err != nil {
+		return ceremony{}, err
+	}
+	finished, err := s.backend.SetNX(key+"_"+state.Challenge, []byte("1"), s.cfg.GetWebAuthnTimeout())
+	if err != nil {
+		return ceremony{}, err
+	}
+	if !finished {
+		return ceremony{}, ErrCeremonyNotFound
+	}
+	s.backend.Delete(key)
+	return state, nil
+}
+
+func getCredentialDescriptors(credentials []Credential) []CredentialDescriptor {
+	descriptors := []CredentialDescriptor{}
+	for _, credential := range credentials {
+		descriptors = append(descriptors, CredentialDescriptor{
+			Type:       "public-key",
+			Id:         credential.Id,
+			Transports: credential.Transports,
+		})
+	}
+	return descriptors
+}
+
+func getCredentialName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Passkey"
+	}
+	if len([]rune(name)) > maxCredentialName {
+		return string([]rune(name)[:maxCredentialName])
+	}
+	return name
+}
+
+func verificationFailed(reason string) error {
+	return fmt.Errorf("%w: %s", ErrVerificationFailed, reason)
+}
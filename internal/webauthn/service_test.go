@@ -0,0 +1,252 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/shashimalcse/tiny-is/internal/cache"
+	"github.com/shashimalcse/tiny-is/internal/config"
+	"github.com/shashimalcse/tiny-is/internal/testutil"
+)
+
+const testOrigin = "https://login.example.com"
+
+func newTestWebAuthnService(t *testing.T) WebAuthnService {
+	db := testutil.NewDB(t, "webauthn.sql")
+	cfg := &config.Config{}
+	cfg.WebAuthn.RPID = "login.example.com"
+	cfg.WebAuthn.Origins = []string{testOrigin}
+	return NewWebAuthnService(cfg, NewWebAuthnRepository(db), cache.NewMemoryBackend())
+}
+
+// testAuthenticator is a software passkey with a P-256 key.
+type testAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+	return &testAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (a *testAuthenticator) authData(rpId string, flags byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	data := append(rpIdHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *testAuthenticator) create(options CreationOptions, origin string) RegistrationResponse {
+	a.userHandle, _ = base64URL.DecodeString(options.User.Id)
+	coseKey := encodeTestCBOR(map[int64]any{
+		1:  int64(2),
+		3:  int64(algES256),
+		-1: int64(1),
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	authData := a.authData(options.RP.Id, flagUserPresent|flagUserVerified|flagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialId)))
+	authData = append(authData, a.credentialId...)
+	authData = append(authData, coseKey...)
+	attestationObject := encodeTestCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	return RegistrationResponse{
+		CredentialId:      base64URL.EncodeToString(a.credentialId),
+		ClientDataJSON:    testClientData(ceremonyCreate, options.Challenge, origin),
+		AttestationObject: base64URL.EncodeToString(attestationObject),
+	}
+}
+
+func (a *testAuthenticator) get(options RequestOptions, origin string) AssertionResponse {
+	a.signCount++
+	authData := a.authData(options.RPId, flagUserPresent|flagUserVerified)
+	clientDataJSON := testClientData(ceremonyGet, options.Challenge, origin)
+	rawClientData, _ := base64URL.DecodeString(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	return AssertionResponse{
+		CredentialId:      base64URL.EncodeToString(a.credentialId),
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: base64URL.EncodeToString(authData),
+		Signature:         base64URL.EncodeToString(signature),
+		UserHandle:        base64URL.EncodeToString(a.userHandle),
+	}
+}
+
+func testClientData(ceremony, challenge, origin string) string {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return base64URL.EncodeToString(data)
+}
+
+// encodeTestCBOR encodes the values authenticators send, with map keys in a stable order.
+func encodeTestCBOR(value any) []byte {
+	header := func(majorType byte, argument int) []byte {
+		switch {
+		case argument < 24:
+			return []byte{majorType<<5 | byte(argument)}
+		case argument < 256:
+			return []byte{majorType<<5 | 24, byte(argument)}
+		default:
+			return binary.BigEndian.AppendUint16([]byte{majorType<<5 | 25}, uint16(argument))
+		}
+	}
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return header(1, int(-1-v))
+		}
+		return header(0, int(v))
+	case []byte:
+		return append(header(2, len(v)), v...)
+	case string:
+		return append(header(3, len(v)), v...)
+	case map[int64]any:
+		keys := make([]int64, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		data := header(5, len(v))
+		for _, key := range keys {
+			data = append(data, encodeTestCBOR(key)...)
+			data = append(data, encodeTestCBOR(v[key])...)
+		}
+		return data
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		data := header(5, len(v))
+		for _, key := range keys {
+			data = append(data, encodeTestCBOR(key)...)
+			data = append(data, encodeTestCBOR(v[key])...)
+		}
+		return data
+	}
+	panic("unsupported value")
+}
+
+func registerTestPasskey(t *testing.T, s WebAuthnService, authenticator *testAuthenticator) Credential {
+	ctx := context.Background()
+	options, err := s.BeginRegistration(ctx, "test-session-id", "test-user-id", "test-organization-id", "alice")
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+	credential, err := s.FinishRegistration(ctx, "test-session-id", "Laptop", authenticator.create(options, testOrigin))
+	if err != nil {
+		t.Fatalf("Failed to finish registration: %v", err)
+	}
+	return credential
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestWebAuthnService(t)
+	authenticator := newTestAuthenticator(t)
+	credential := registerTestPasskey(t, s, authenticator)
+	if credential.UserId != "test-user-id" || credential.Name != "Laptop" {
+		t.Errorf("Unexpected credential %+v", credential)
+	}
+	options, err := s.BeginRegistration(ctx, "test-session-id", "test-user-id", "test-organization-id", "alice")
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+	if len(options.ExcludeCredentials) != 1 || options.ExcludeCredentials[0].Id != credential.Id {
+		t.Errorf("Expected the registered passkey to be excluded, got %v", options.ExcludeCredentials)
+	}
+
+	// passwordless, any passkey of the organization can sign in
+	requestOptions, err := s.BeginLogin(ctx, "test-session-data-key", "", "test-organization-id")
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	if requestOptions.UserVerification != userVerificationRequired || len(requestOptions.AllowCredentials) != 0 {
+		t.Errorf("Unexpected passwordless options %+v", requestOptions)
+	}
+	response := authenticator.get(requestOptions, testOrigin)
+	signedIn, err := s.FinishLogin(ctx, "test-session-data-key", response)
+	if err != nil {
+		t.Fatalf("Failed to finish login: %v", err)
+	}
+	if signedIn.UserId != "test-user-id" || signedIn.SignCount != 1 {
+		t.Errorf("Unexpected credential %+v", signedIn)
+	}
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", response); !errors.Is(err, ErrCeremonyNotFound) {
+		t.Errorf("Expected a replayed response to be rejected, got %v", err)
+	}
+}
+
+func TestPasskeyLoginRejectsInvalidResponses(t *testing.T) {
+	ctx := context.Background()
+	s := newTestWebAuthnService(t)
+	authenticator := newTestAuthenticator(t)
+	registerTestPasskey(t, s, authenticator)
+
+	requestOptions, _ := s.BeginLogin(ctx, "test-session-data-key", "test-user-id", "test-organization-id")
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", authenticator.get(requestOptions, "https://evil.example.com")); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Expected a response from another origin to be rejected, got %v", err)
+	}
+
+	requestOptions, _ = s.BeginLogin(ctx, "test-session-data-key", "test-user-id", "test-organization-id")
+	response := authenticator.get(requestOptions, testOrigin)
+	response.Signature = base64URL.EncodeToString([]byte("invalid"))
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", response); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Expected an invalid signature to be rejected, got %v", err)
+	}
+
+	// a copy of the authenticator reports a counter that was already used
+	requestOptions, _ = s.BeginLogin(ctx, "test-session-data-key", "test-user-id", "test-organization-id")
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", authenticator.get(requestOptions, testOrigin)); err != nil {
+		t.Fatalf("Failed to finish login: %v", err)
+	}
+	authenticator.signCount--
+	requestOptions, _ = s.BeginLogin(ctx, "test-session-data-key", "test-user-id", "test-organization-id")
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", authenticator.get(requestOptions, testOrigin)); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Expected a counter that did not increase to be rejected, got %v", err)
+	}
+
+	requestOptions, _ = s.BeginLogin(ctx, "test-session-data-key", "", "other-organization-id")
+	if _, err := s.FinishLogin(ctx, "test-session-data-key", authenticator.get(requestOptions, testOrigin)); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("Expected a passkey of another organization to be rejected, got %v", err)
+	}
+	// as a second factor only the passkeys of the user can be used
+	if _, err := s.BeginLogin(ctx, "test-session-data-key", "other-user-id", "test-organization-id"); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("Expected no passkeys for another user, got %v", err)
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x5a, 0xff, 0xff, 0xff, 0xff},
+		{0x9f},
+		{0xa2, 0x01, 0x02, 0x01, 0x03},
+	} {
+		if _, _, err := decodeCBOR(data); !errors.Is(err, errInvalidCBOR) {
+			t.Errorf("Expected %x to be rejected, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+CREATE TABLE authorize_context (
+    type TEXT NOT NULL,
+    id TEXT NOT NULL,
+    context TEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    consumed_at BIGINT,
+    PRIMARY KEY (type, id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE user_consent (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, organization_id, client_id, scope)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE user_totp (
+    user_id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    confirmed BOOLEAN NOT NULL DEFAULT 0,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL
+);
+
+CREATE TABLE user_recovery_code (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at BIGINT,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE mfa_policy (
+    organization_id TEXT PRIMARY KEY,
+    mode TEXT NOT NULL,
+    client_ids TEXT
+);
@@ -0,0 +1,38 @@
+CREATE TABLE risk_policy (
+    organization_id TEXT PRIMARY KEY,
+    mode TEXT NOT NULL,
+    step_up_score INTEGER NOT NULL,
+    block_score INTEGER NOT NULL,
+    weights TEXT,
+    usual_hours_start INTEGER NOT NULL DEFAULT 0,
+    usual_hours_end INTEGER NOT NULL DEFAULT 0,
+    timezone TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE login_event (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    country TEXT,
+    latitude REAL,
+    longitude REAL,
+    succeeded BOOLEAN NOT NULL,
+    score INTEGER NOT NULL DEFAULT 0,
+    signals TEXT,
+    decision TEXT NOT NULL,
+    enforced BOOLEAN NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL
+);
+
+CREATE TABLE user_device (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    device_hash TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    last_seen_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, device_hash)
+);
@@ -0,0 +1,30 @@
+CREATE TABLE session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    issuer TEXT,
+    auth_methods TEXT,
+    auth_time BIGINT NOT NULL,
+    last_accessed_at BIGINT NOT NULL,
+    idle_timeout BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT
+);
+
+CREATE INDEX idx_session_user ON session (user_id, organization_id);
+
+CREATE TABLE session_client (
+    session_id TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    PRIMARY KEY (session_id, client_id)
+);
+
+CREATE TABLE session_policy (
+    organization_id TEXT PRIMARY KEY,
+    max_sessions INTEGER NOT NULL DEFAULT 0,
+    session_limit_action TEXT NOT NULL,
+    idle_timeout BIGINT NOT NULL,
+    absolute_timeout BIGINT NOT NULL
+);
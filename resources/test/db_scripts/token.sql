@@ -0,0 +1,10 @@
+CREATE TABLE token (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    entry_id TEXT NOT NULL,
+    organization_id TEXT,
+    session_id TEXT,
+    code_id TEXT,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
@@ -0,0 +1,76 @@
+CREATE TABLE org_user (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT,
+    username TEXT NOT NULL,
+    email TEXT NOT NULL COLLATE NOCASE,
+    email_verified BOOLEAN NOT NULL DEFAULT 0,
+    phone_number TEXT NOT NULL DEFAULT '',
+    phone_number_verified BOOLEAN NOT NULL DEFAULT 0,
+    password_hash TEXT NOT NULL,
+    password_changed_at BIGINT NOT NULL DEFAULT 0,
+    password_change_required BOOLEAN NOT NULL DEFAULT 0,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_login_at BIGINT NOT NULL DEFAULT 0,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    lockout_count INTEGER NOT NULL DEFAULT 0,
+    locked BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, username),
+    UNIQUE (organization_id, email)
+);
+
+CREATE TABLE attribute (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT,
+    name TEXT NOT NULL,
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE user_attribute (
+    user_id TEXT,
+    attribute_id TEXT,
+    value TEXT,
+    PRIMARY KEY (user_id, attribute_id)
+);
+
+CREATE TABLE lockout_policy (
+    organization_id TEXT PRIMARY KEY,
+    max_failed_attempts INTEGER NOT NULL DEFAULT 0,
+    lockout_duration BIGINT NOT NULL DEFAULT 0,
+    max_lockouts INTEGER NOT NULL DEFAULT 0,
+    progressive_delay BIGINT NOT NULL DEFAULT 0,
+    max_delay BIGINT NOT NULL DEFAULT 0,
+    max_failed_attempts_per_ip INTEGER NOT NULL DEFAULT 0,
+    ip_window BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE password_policy (
+    organization_id TEXT PRIMARY KEY,
+    min_length INTEGER NOT NULL DEFAULT 0,
+    require_uppercase BOOLEAN NOT NULL DEFAULT 0,
+    require_lowercase BOOLEAN NOT NULL DEFAULT 0,
+    require_digit BOOLEAN NOT NULL DEFAULT 0,
+    require_symbol BOOLEAN NOT NULL DEFAULT 0,
+    banned_words TEXT,
+    history_count INTEGER NOT NULL DEFAULT 0,
+    max_age BIGINT NOT NULL DEFAULT 0,
+    reject_breached BOOLEAN NOT NULL DEFAULT 1,
+    breached_login_action TEXT NOT NULL DEFAULT 'off'
+);
+
+CREATE TABLE password_history (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX idx_password_history_user ON password_history (user_id, organization_id, created_at);
+
+CREATE TABLE registration_policy (
+    organization_id TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    required_attributes TEXT,
+    require_challenge BOOLEAN NOT NULL DEFAULT 0
+);
@@ -0,0 +1,12 @@
+CREATE TABLE webauthn_credential (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT,
+    aaguid TEXT,
+    created_at BIGINT NOT NULL,
+    last_used_at BIGINT
+);
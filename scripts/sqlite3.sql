@@ -12,6 +12,12 @@ CREATE TABLE application (
     client_secret TEXT NOT NULL,
     name TEXT NOT NULL,
     redirect_uris TEXT,
+    response_mode TEXT,
+    post_logout_redirect_uris TEXT,
+    backchannel_logout_uri TEXT,
+    frontchannel_logout_uri TEXT,
+    authentication_sequence TEXT,
+    require_consent BOOLEAN NOT NULL DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE,
@@ -36,8 +42,18 @@ CREATE TABLE org_user (
     id TEXT PRIMARY KEY,
     organization_id TEXT,
     username TEXT NOT NULL,
-    email TEXT NOT NULL,
+    email TEXT NOT NULL COLLATE NOCASE,
+    email_verified BOOLEAN NOT NULL DEFAULT 0,
+    phone_number TEXT NOT NULL DEFAULT '',
+    phone_number_verified BOOLEAN NOT NULL DEFAULT 0,
     password_hash TEXT NOT NULL,
+    password_changed_at BIGINT NOT NULL DEFAULT 0,
+    password_change_required BOOLEAN NOT NULL DEFAULT 0,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_login_at BIGINT NOT NULL DEFAULT 0,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    lockout_count INTEGER NOT NULL DEFAULT 0,
+    locked BOOLEAN NOT NULL DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE,
@@ -67,6 +83,8 @@ CREATE TABLE token (
     client_id TEXT NOT NULL,
     entry_id TEXT NOT NULL,
     organization_id TEXT,
+    session_id TEXT,
+    code_id TEXT,
     created_at BIGINT NOT NULL,
     expires_at BIGINT NOT NULL,
     FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE,
@@ -91,3 +109,187 @@ CREATE TABLE user_role (
     FOREIGN KEY (user_id) REFERENCES org_user(id),
     FOREIGN KEY (role_id) REFERENCES role(id)
 );
+
+CREATE TABLE session (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    issuer TEXT,
+    auth_methods TEXT,
+    auth_time BIGINT NOT NULL,
+    last_accessed_at BIGINT NOT NULL,
+    idle_timeout BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_session_user ON session (user_id, organization_id);
+
+CREATE TABLE session_client (
+    session_id TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    PRIMARY KEY (session_id, client_id),
+    FOREIGN KEY (session_id) REFERENCES session(id) ON DELETE CASCADE
+);
+
+CREATE TABLE session_policy (
+    organization_id TEXT PRIMARY KEY,
+    max_sessions INTEGER NOT NULL DEFAULT 0,
+    session_limit_action TEXT NOT NULL,
+    idle_timeout BIGINT NOT NULL,
+    absolute_timeout BIGINT NOT NULL,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE authorize_context (
+    type TEXT NOT NULL,
+    id TEXT NOT NULL,
+    context TEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    consumed_at BIGINT,
+    PRIMARY KEY (type, id)
+);
+
+CREATE TABLE user_totp (
+    user_id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    confirmed BOOLEAN NOT NULL DEFAULT 0,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_recovery_code (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at BIGINT,
+    PRIMARY KEY (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_policy (
+    organization_id TEXT PRIMARY KEY,
+    mode TEXT NOT NULL,
+    client_ids TEXT,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webauthn_credential (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT,
+    aaguid TEXT,
+    created_at BIGINT NOT NULL,
+    last_used_at BIGINT,
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE
+);
+
+CREATE TABLE risk_policy (
+    organization_id TEXT PRIMARY KEY,
+    mode TEXT NOT NULL,
+    step_up_score INTEGER NOT NULL,
+    block_score INTEGER NOT NULL,
+    weights TEXT,
+    usual_hours_start INTEGER NOT NULL DEFAULT 0,
+    usual_hours_end INTEGER NOT NULL DEFAULT 0,
+    timezone TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE login_event (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    country TEXT,
+    latitude REAL,
+    longitude REAL,
+    succeeded BOOLEAN NOT NULL,
+    score INTEGER NOT NULL DEFAULT 0,
+    signals TEXT,
+    decision TEXT NOT NULL,
+    enforced BOOLEAN NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_login_event_user ON login_event (organization_id, user_id, created_at);
+CREATE INDEX idx_login_event_username ON login_event (organization_id, username, created_at);
+
+CREATE TABLE user_device (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    device_hash TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    last_seen_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, device_hash),
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE
+);
+
+CREATE TABLE lockout_policy (
+    organization_id TEXT PRIMARY KEY,
+    max_failed_attempts INTEGER NOT NULL DEFAULT 0,
+    lockout_duration BIGINT NOT NULL DEFAULT 0,
+    max_lockouts INTEGER NOT NULL DEFAULT 0,
+    progressive_delay BIGINT NOT NULL DEFAULT 0,
+    max_delay BIGINT NOT NULL DEFAULT 0,
+    max_failed_attempts_per_ip INTEGER NOT NULL DEFAULT 0,
+    ip_window BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE password_policy (
+    organization_id TEXT PRIMARY KEY,
+    min_length INTEGER NOT NULL DEFAULT 0,
+    require_uppercase BOOLEAN NOT NULL DEFAULT 0,
+    require_lowercase BOOLEAN NOT NULL DEFAULT 0,
+    require_digit BOOLEAN NOT NULL DEFAULT 0,
+    require_symbol BOOLEAN NOT NULL DEFAULT 0,
+    banned_words TEXT,
+    history_count INTEGER NOT NULL DEFAULT 0,
+    max_age BIGINT NOT NULL DEFAULT 0,
+    reject_breached BOOLEAN NOT NULL DEFAULT 1,
+    breached_login_action TEXT NOT NULL DEFAULT 'off',
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE password_history (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_password_history_user ON password_history (user_id, organization_id, created_at);
+
+CREATE TABLE registration_policy (
+    organization_id TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    required_attributes TEXT,
+    require_challenge BOOLEAN NOT NULL DEFAULT 0,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_consent (
+    user_id TEXT NOT NULL,
+    organization_id TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, organization_id, client_id, scope),
+    FOREIGN KEY (user_id) REFERENCES org_user(id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id, client_id) REFERENCES application(organization_id, client_id) ON DELETE CASCADE
+);